@@ -63,6 +63,10 @@ export function fetchQuery(
     }
 
     return requestPromise.then(json => {
+      // errors are notified by the api service
+      if (!json) {
+        return;
+      }
       if (json.status !== 200) {
         return dispatch(notifyActions.showNotify(json.error));
       }
@@ -96,7 +100,7 @@ export function fetchMetadata(objType) {
     }
     dispatch(requestMetadata(objType));
     ApiService.getMetadata(objType).then(json => {
-      if (json.objects === undefined || json.objects.length !== 1) {
+      if (!json || json.objects === undefined || json.objects.length !== 1) {
         dispatch(notifyActions.showNotify(FETCH_METADATA_ERR));
         return;
       }
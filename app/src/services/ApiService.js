@@ -97,7 +97,19 @@ const makeResponse = res => {
   if (res.ok) {
     return res.json();
   } else {
-    res.text().then(txt => store.dispatch(notifyActions.showNotify(txt)));
+    res.text().then(txt => {
+      store.dispatch(notifyActions.showNotify(errorMessage(txt)));
+    });
     return null;
   }
 };
+
+// errorMessage return the message of an error body of the service, the body itself if it is not JSON
+const errorMessage = txt => {
+  try {
+    const json = JSON.parse(txt);
+    return json.message || json.error || txt;
+  } catch (e) {
+    return txt;
+  }
+};
@@ -0,0 +1,193 @@
+// Package client is the Go client of the K-Atlas REST API: entities, sync, queries, QSL, metadata and schema.
+// It only depends on the standard library so tools and the collector can vendor it without the service.
+//
+//	c := client.New("https://katlas.example.com", client.WithAPIKey(key))
+//	pod, err := c.GetEntity(ctx, "0x1")
+//	if client.IsNotFound(err) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Entity is an object of the graph with its fields, relationships are nested entities
+type Entity map[string]interface{}
+
+// Retry of the requests failed by the transport or with status 429, 502, 503 or 504
+type Retry struct {
+	// Max retries after the first attempt, none if 0
+	Max int
+	// Wait before the first retry, doubled for every retry up to MaxWait
+	Wait    time.Duration
+	MaxWait time.Duration
+}
+
+// DefaultRetry of the clients created without WithRetry
+var DefaultRetry = Retry{Max: 3, Wait: 500 * time.Millisecond, MaxWait: 10 * time.Second}
+
+// Client of the REST API of a K-Atlas service, safe for concurrent use
+type Client struct {
+	endpoint string
+	http     *http.Client
+	header   http.Header
+	retry    Retry
+}
+
+// Option of a client
+type Option func(*Client)
+
+// WithHTTPClient send the requests with hc, e.g. configured for mutual TLS
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithAuthorization send value as Authorization header
+func WithAuthorization(value string) Option {
+	return func(c *Client) {
+		if value != "" {
+			c.header.Set("Authorization", value)
+		}
+	}
+}
+
+// WithAPIKey authenticate with a static API key
+func WithAPIKey(key string) Option {
+	return WithAuthorization("ApiKey " + key)
+}
+
+// WithToken authenticate with a JWT bearer token
+func WithToken(token string) Option {
+	return WithAuthorization("Bearer " + token)
+}
+
+// WithCluster send the clustername header the collector endpoints read the cluster of the objects from
+func WithCluster(name string) Option {
+	return func(c *Client) { c.header.Set("clustername", name) }
+}
+
+// WithRetry replace DefaultRetry, Retry{} disables the retries
+func WithRetry(r Retry) Option {
+	return func(c *Client) { c.retry = r }
+}
+
+// New client of the service at endpoint, e.g. http://katlas:8011
+func New(endpoint string, opts ...Option) *Client {
+	c := &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		http:     http.DefaultClient,
+		header:   http.Header{},
+		retry:    DefaultRetry,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Do send a request to path, relative to the endpoint or an absolute url, with body marshaled as json unless nil
+// or an io.Reader sent as is. It returns the status and body of the response, or an *Error if the request failed,
+// its status is not 2xx or its body reports an error status
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body interface{}) (int, []byte, error) {
+	var payload []byte
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		data, err := ioutil.ReadAll(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = data
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload = data
+	}
+	u := path
+	if !strings.Contains(path, "://") {
+		u = c.endpoint + "/" + strings.TrimPrefix(path, "/")
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	wait := c.retry.Wait
+	for attempt := 0; ; attempt++ {
+		status, data, err := c.send(ctx, method, u, body != nil, payload)
+		if err == nil || attempt >= c.retry.Max || !retriable(err) {
+			return status, data, err
+		}
+		select {
+		case <-ctx.Done():
+			return status, data, err
+		case <-time.After(wait):
+		}
+		if wait *= 2; c.retry.MaxWait > 0 && wait > c.retry.MaxWait {
+			wait = c.retry.MaxWait
+		}
+	}
+}
+
+// send a single attempt of a request
+func (c *Client) send(ctx context.Context, method, u string, hasBody bool, payload []byte) (int, []byte, error) {
+	var reader io.Reader
+	if hasBody {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		// the service could not be reached
+		return http.StatusServiceUnavailable, []byte(err.Error()), &Error{StatusCode: http.StatusServiceUnavailable, Message: err.Error(), Body: []byte(err.Error()), transport: true}
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, data, &Error{StatusCode: res.StatusCode, Message: err.Error(), Body: data, transport: true}
+	}
+	if err = checkResponse(res.StatusCode, data); err != nil {
+		return res.StatusCode, data, err
+	}
+	return res.StatusCode, data, nil
+}
+
+// call send a request and decode its json response into out unless nil
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	_, data, err := c.Do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// objects of a response
+type objectsResponse struct {
+	Count   int      `json:"count"`
+	Objects []Entity `json:"objects"`
+}
+
+// escape a path segment
+func escape(segment string) string {
+	return url.PathEscape(segment)
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.1/entity/0x9":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status": 404, "code": "NotFound", "message": "entity with id 0x9 not found",
+				"details": {"uid": "0x9"}, "requestid": "7f3a", "error": "entity with id 0x9 not found"}`))
+		case "/v1.1/qsl/pod[":
+			// former versions of the service sent QSL errors with status 200
+			w.Write([]byte(`{"status": 400, "error": "Malformed Query: pod["}`))
+		case "/v1.1/cluster/c1/purge":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"status": 409, "error": "cluster is active"}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("missing credentials"))
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	_, err := c.GetEntity(ctx, "0x9")
+	if !IsNotFound(err) || err.(*Error).Message != "entity with id 0x9 not found" {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if e := err.(*Error); e.Code != "NotFound" || e.RequestID != "7f3a" || e.Details["uid"] != "0x9" {
+		t.Errorf("expected code, request id and details, got %#v", e)
+	}
+	if _, err = c.QSL(ctx, "pod["); !IsBadRequest(err) {
+		t.Errorf("expected bad request, got %v", err)
+	}
+	if _, _, err = c.Do(ctx, http.MethodPost, "v1.1/cluster/c1/purge", nil, nil); !IsConflict(err) {
+		t.Errorf("expected conflict, got %v", err)
+	}
+	if err = c.DeleteMetadata(ctx, "pod"); !IsUnauthorized(err) || err.(*Error).Message != "missing credentials" {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("Authorization") != "ApiKey k1" || r.Header.Get("clustername") != "c1" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status": 200, "stale": ["pod:c1:ns:web"], "missing": [], "deleted": []}`))
+	}))
+	defer server.Close()
+	c := New(server.URL, WithAPIKey("k1"), WithCluster("c1"), WithRetry(Retry{Max: 2, Wait: time.Millisecond}))
+
+	ret, err := c.SyncDigest(context.Background(), "pod", []Digest{{ResourceID: "pod:c1:ns:web", ResourceVersion: "2"}})
+	if err != nil || attempts != 3 || len(ret.Stale) != 1 {
+		t.Errorf("expected success at the third attempt, got %v after %d attempts", err, attempts)
+	}
+	// no retry left
+	attempts = 0
+	c = New(server.URL, WithAPIKey("k1"), WithCluster("c1"), WithRetry(Retry{Max: 1, Wait: time.Millisecond}))
+	if _, err = c.SyncDigest(context.Background(), "pod", nil); !IsUnavailable(err) || attempts != 2 {
+		t.Errorf("expected unavailable after 2 attempts, got %v after %d", err, attempts)
+	}
+	// the service is not reached
+	if err = New("http://127.0.0.1:1", WithRetry(Retry{})).DeleteEntity(context.Background(), "0x1"); !IsUnavailable(err) {
+		t.Errorf("expected unavailable service, got %v", err)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	const total = 7
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		limit, offset := 3, 0
+		if r.URL.Path == "/v1.1/query" {
+			limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+			offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+		} else {
+			fmt.Sscanf(r.URL.Path, `/v1.1/qsl/pod[@status="Running"$$limit=%d,offset=%d]`, &limit, &offset)
+		}
+		objs := []Entity{}
+		for i := offset; i < offset+limit && i < total; i++ {
+			objs = append(objs, Entity{"name": "pod" + strconv.Itoa(i)})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": 200, "count": total, "objects": objs})
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	for _, it := range []*Iterator{
+		c.QueryIterator(context.Background(), url.Values{"objtype": {"pod"}}, 3),
+		c.QSLIterator(context.Background(), `pod[@status="Running"]{*}`, 3),
+	} {
+		queries = nil
+		names := []string{}
+		for it.Next() {
+			names = append(names, it.Entity()["name"].(string))
+		}
+		if it.Err() != nil || len(names) != total || names[total-1] != "pod6" {
+			t.Errorf("unexpected objects %v, error %v", names, it.Err())
+		}
+		if len(queries) != 3 {
+			t.Errorf("expected 3 pages, got %v", queries)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{`pod`, `pod[$$limit=10,offset=20]`},
+		{`pod{*}`, `pod[$$limit=10,offset=20]{*}`},
+		{`cluster.pod[@name="a]"]`, `cluster[$$limit=10,offset=20].pod[@name="a]"]`},
+		{`cluster[@name="a]"]{*}.pod`, `cluster[@name="a]"$$limit=10,offset=20]{*}.pod`},
+		{`pod[$$limit=5]`, ``},
+	}
+	for _, test := range tests {
+		out, err := paginate(test.in, 10, 20)
+		if out != test.out || (test.out == "") != (err != nil) {
+			t.Errorf("paginate(%s) = %s, %v, expected %s", test.in, out, err, test.out)
+		}
+	}
+}
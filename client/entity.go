@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// batch operations of BatchItem
+const (
+	OpUpsert = "upsert"
+	OpDelete = "delete"
+)
+
+// DeleteRequest of an entity by its type and resourceid, the entity is replaced by a tombstone. K8sUID and
+// ResourceVersion of the deleted object let the service ignore the delete if a newer object was created since,
+// Object is its last known state
+type DeleteRequest struct {
+	ObjType         string      `json:"objtype"`
+	ResourceID      string      `json:"resourceid"`
+	K8sUID          string      `json:"k8suid,omitempty"`
+	ResourceVersion string      `json:"resourceversion,omitempty"`
+	Object          interface{} `json:"object,omitempty"`
+}
+
+// BatchItem is a single upsert or delete of a batch
+type BatchItem struct {
+	Op         string      `json:"op"`
+	ObjType    string      `json:"objtype"`
+	ResourceID string      `json:"resourceid,omitempty"`
+	Object     interface{} `json:"object,omitempty"`
+	// K8sUID and ResourceVersion of a deleted object, Object holds its last known state
+	K8sUID          string `json:"k8suid,omitempty"`
+	ResourceVersion string `json:"resourceversion,omitempty"`
+}
+
+// BatchResult of the item at Index of a batch
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Digest identifies an object and its version for SyncDigest
+type Digest struct {
+	ResourceID      string `json:"resourceid"`
+	ResourceVersion string `json:"resourceversion"`
+}
+
+// DigestResult lists the objects the service found stale or missing, and the ones it deleted
+type DigestResult struct {
+	Stale   []string `json:"stale"`
+	Missing []string `json:"missing"`
+	Deleted []string `json:"deleted"`
+}
+
+// GetEntity return the entity of uid with its fields and the uids of its relationships
+func (c *Client) GetEntity(ctx context.Context, uid string) (Entity, error) {
+	var ret objectsResponse
+	if err := c.call(ctx, http.MethodGet, "v1.1/entity/"+escape(uid), nil, nil, &ret); err != nil {
+		return nil, err
+	}
+	if len(ret.Objects) == 0 {
+		return nil, &Error{StatusCode: http.StatusNotFound, Message: "entity with id " + uid + " not found"}
+	}
+	return ret.Objects[0], nil
+}
+
+// GetEntityByResourceID return the entity of the resourceid
+func (c *Client) GetEntityByResourceID(ctx context.Context, resourceID string) (Entity, error) {
+	ret, err := c.Query(ctx, url.Values{"resourceid": {resourceID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(ret.Objects) == 0 {
+		return nil, &Error{StatusCode: http.StatusNotFound, Message: "entity " + resourceID + " not found"}
+	}
+	return ret.Objects[0], nil
+}
+
+// CreateEntity create or update an object of objtype, a Kubernetes object for the types of the collector taken
+// from the cluster of WithCluster, and return its uid. Objects are updated if their resourceversion is higher
+func (c *Client) CreateEntity(ctx context.Context, objtype string, obj interface{}) (string, error) {
+	var ret objectsResponse
+	if err := c.call(ctx, http.MethodPost, "v1.1/entity", url.Values{"objtype": {objtype}}, obj, &ret); err != nil {
+		return "", err
+	}
+	if len(ret.Objects) == 0 {
+		return "", nil
+	}
+	uid, _ := ret.Objects[0]["uid"].(string)
+	return uid, nil
+}
+
+// UpdateEntity set the fields of the entity of uid
+func (c *Client) UpdateEntity(ctx context.Context, uid string, fields Entity) error {
+	return c.call(ctx, http.MethodPost, "v1.1/entity/"+escape(uid), nil, fields, nil)
+}
+
+// DeleteEntity delete the entity of uid
+func (c *Client) DeleteEntity(ctx context.Context, uid string) error {
+	return c.call(ctx, http.MethodDelete, "v1.1/entity/"+escape(uid), nil, nil, nil)
+}
+
+// DeleteEntityByResourceID replace the entity of the request by a tombstone
+func (c *Client) DeleteEntityByResourceID(ctx context.Context, req DeleteRequest) error {
+	return c.call(ctx, http.MethodDelete, "v1.1/entity", nil, req, nil)
+}
+
+// Batch send upserts and deletes in a single request and return the result of every item, an item failing
+// does not fail the batch
+func (c *Client) Batch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	var ret struct {
+		Objects []BatchResult `json:"objects"`
+	}
+	if err := c.call(ctx, http.MethodPost, "v1.1/entities:batch", nil, items, &ret); err != nil {
+		return nil, err
+	}
+	return ret.Objects, nil
+}
+
+// Sync replace the objects of objtype of the cluster of WithCluster by objs, the objects not in objs are deleted
+func (c *Client) Sync(ctx context.Context, objtype string, objs interface{}) error {
+	return c.call(ctx, http.MethodPost, "v1.1/sync/"+escape(objtype), nil, objs, nil)
+}
+
+// SyncDigest compare the digest of all objects of objtype in the cluster of WithCluster with the stored objects,
+// the objects not in the digest are deleted and the stale and missing ones returned to be sent again
+func (c *Client) SyncDigest(ctx context.Context, objtype string, digest []Digest) (*DigestResult, error) {
+	ret := &DigestResult{}
+	if err := c.call(ctx, http.MethodPost, "v1.1/sync/"+escape(objtype)+"/digest", nil, digest, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error of a request, mapped from the {"status", "code", "message", "details", "requestid"} body of the service
+type Error struct {
+	// StatusCode of the response, or of the body for errors sent with status 200 by former versions of the service,
+	// 503 if the service was not reached
+	StatusCode int
+	// Code of the error, e.g. NotFound, Invalid, Conflict or Unavailable, empty for former versions of the service
+	Code    string
+	Message string
+	// Details of the error for the client to act on, if any
+	Details map[string]interface{}
+	// RequestID of the request in the logs of the service
+	RequestID string
+	// Body of the response
+	Body []byte
+	// transport failed, no response
+	transport bool
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("katlas: %d %s (request id %s)", e.StatusCode, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("katlas: %d %s", e.StatusCode, e.Message)
+}
+
+// Temporary is true for the errors worth a retry: the service was not reached, overloaded or timed out
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return e.transport
+}
+
+// IsNotFound is true if err is a 404 of the service
+func IsNotFound(err error) bool { return hasStatus(err, http.StatusNotFound) }
+
+// IsBadRequest is true if the service rejected the request as invalid
+func IsBadRequest(err error) bool { return hasStatus(err, http.StatusBadRequest) }
+
+// IsUnauthorized is true if the request had no valid credentials
+func IsUnauthorized(err error) bool { return hasStatus(err, http.StatusUnauthorized) }
+
+// IsForbidden is true if the credentials do not grant the request
+func IsForbidden(err error) bool { return hasStatus(err, http.StatusForbidden) }
+
+// IsConflict is true if the request conflicts with the state of the resource, e.g. purge of an active cluster
+func IsConflict(err error) bool { return hasStatus(err, http.StatusConflict) }
+
+// IsUnavailable is true if the service or its database could not be reached or timed out
+func IsUnavailable(err error) bool {
+	return hasStatus(err, http.StatusServiceUnavailable) || hasStatus(err, http.StatusGatewayTimeout)
+}
+
+func hasStatus(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == code
+}
+
+// retriable is true for the errors of the transport and the temporary statuses
+func retriable(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Temporary()
+}
+
+// checkResponse return an *Error if code is not 2xx or the body has an error status, former versions of the
+// service sent some errors with status 200
+func checkResponse(code int, body []byte) error {
+	var envelope struct {
+		Status    interface{}            `json:"status"`
+		Code      string                 `json:"code"`
+		Message   string                 `json:"message"`
+		Details   map[string]interface{} `json:"details"`
+		RequestID string                 `json:"requestid"`
+		Error     string                 `json:"error"`
+	}
+	// NDJSON of the export is not an envelope
+	json.Unmarshal(body, &envelope)
+	status := code
+	switch s := envelope.Status.(type) {
+	case float64:
+		if int(s) >= http.StatusBadRequest {
+			status = int(s)
+		}
+	case string:
+		if n, err := strconv.Atoi(s); err == nil && n >= http.StatusBadRequest {
+			status = n
+		}
+	}
+	if status < http.StatusBadRequest {
+		return nil
+	}
+	msg := envelope.Message
+	if msg == "" {
+		msg = envelope.Error
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(body))
+	}
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	return &Error{
+		StatusCode: status,
+		Code:       envelope.Code,
+		Message:    msg,
+		Details:    envelope.Details,
+		RequestID:  envelope.RequestID,
+		Body:       body,
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/intuit/katlas/client
+
+go 1.12
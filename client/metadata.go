@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Metadata describes an object type and its fields
+type Metadata struct {
+	UID     string          `json:"uid,omitempty"`
+	Name    string          `json:"name"`
+	ObjType string          `json:"objtype,omitempty"`
+	Fields  []MetadataField `json:"fields,omitempty"`
+}
+
+// MetadataField is a field of an object type
+type MetadataField struct {
+	FieldName string `json:"fieldname"`
+	// FieldType is one of int, long, string, json, double, bool, date, enum or relationship
+	FieldType string `json:"fieldtype"`
+	Mandatory bool   `json:"mandatory"`
+	// RefDataType is the object type of a relationship, several separated by comma
+	RefDataType string `json:"refdatatype,omitempty"`
+	// Cardinality is One or Many
+	Cardinality string `json:"cardinality,omitempty"`
+}
+
+// Schema of a predicate of the database
+type Schema struct {
+	Predicate string   `json:"predicate"`
+	Type      string   `json:"type"`
+	List      bool     `json:"list,omitempty"`
+	Index     bool     `json:"index,omitempty"`
+	Upsert    bool     `json:"upsert,omitempty"`
+	Count     bool     `json:"count,omitempty"`
+	Reverse   bool     `json:"reverse,omitempty"`
+	Tokenizer []string `json:"tokenizer,omitempty"`
+}
+
+// GetMetadata return the metadata of an object type
+func (c *Client) GetMetadata(ctx context.Context, name string) (*Metadata, error) {
+	meta := &Metadata{}
+	if err := c.call(ctx, http.MethodGet, "v1.1/metadata/"+escape(name), nil, nil, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// ListMetadata return the names of the object types
+func (c *Client) ListMetadata(ctx context.Context) ([]string, error) {
+	ret, err := c.Query(ctx, url.Values{"objtype": {"metadata"}, "print": {"name"}})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(ret.Objects))
+	for _, obj := range ret.Objects {
+		if name, ok := obj["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// CreateMetadata create the metadata and return their uids
+func (c *Client) CreateMetadata(ctx context.Context, metas ...Metadata) ([]string, error) {
+	var ret objectsResponse
+	if err := c.call(ctx, http.MethodPost, "v1.1/metadata", nil, metas, &ret); err != nil {
+		return nil, err
+	}
+	uids := make([]string, 0, len(ret.Objects))
+	for _, obj := range ret.Objects {
+		uid, _ := obj["uid"].(string)
+		uids = append(uids, uid)
+	}
+	return uids, nil
+}
+
+// UpdateMetadata replace the metadata of name
+func (c *Client) UpdateMetadata(ctx context.Context, name string, meta Metadata) error {
+	return c.call(ctx, http.MethodPost, "v1.1/metadata/"+escape(name), nil, meta, nil)
+}
+
+// DeleteMetadata delete the metadata of name
+func (c *Client) DeleteMetadata(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, "v1.1/metadata/"+escape(name), nil, nil, nil)
+}
+
+// UpsertSchema create or update the predicates of the database schema
+func (c *Client) UpsertSchema(ctx context.Context, predicates ...Schema) error {
+	return c.call(ctx, http.MethodPost, "v1.1/schema", nil, predicates, nil)
+}
+
+// DropSchema drop a predicate of the database schema
+func (c *Client) DropSchema(ctx context.Context, predicate string) error {
+	return c.call(ctx, http.MethodDelete, "v1.1/schema/"+escape(predicate), nil, nil, nil)
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// QueryResult is a page of the objects of a query with the total count of the objects matching
+type QueryResult struct {
+	Count   int
+	Objects []Entity
+}
+
+// Query run a key/value query, e.g. objtype=pod&name=web, "keyword" runs a keyword search instead. limit and
+// offset page the objects and print selects the fields returned
+func (c *Client) Query(ctx context.Context, params url.Values) (*QueryResult, error) {
+	var ret objectsResponse
+	if err := c.call(ctx, http.MethodGet, "v1.1/query", params, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &QueryResult{Count: ret.Count, Objects: ret.Objects}, nil
+}
+
+// Keyword return the objects with a field containing keyword
+func (c *Client) Keyword(ctx context.Context, keyword string) (*QueryResult, error) {
+	return c.Query(ctx, url.Values{"keyword": {keyword}})
+}
+
+// QSL run a QSL query, e.g. cluster[@name="c1"].pod[@status="Running"]{*}
+func (c *Client) QSL(ctx context.Context, query string) (*QueryResult, error) {
+	var ret objectsResponse
+	if err := c.call(ctx, http.MethodGet, "v1.1/qsl/"+escape(query), nil, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &QueryResult{Count: ret.Count, Objects: ret.Objects}, nil
+}
+
+// Iterator over the objects of a query fetched page by page
+//
+//	it := c.QSLIterator(ctx, `pod[@status="Running"]`, 500)
+//	for it.Next() {
+//		pod := it.Entity()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	fetch    func(offset int) (*QueryResult, error)
+	pageSize int
+	offset   int
+	page     []Entity
+	index    int
+	done     bool
+	err      error
+}
+
+// Next advance to the next object, false once all objects are read or a page failed
+func (it *Iterator) Next() bool {
+	if it.index+1 < len(it.page) {
+		it.index++
+		return true
+	}
+	if it.done || it.err != nil {
+		return false
+	}
+	ret, err := it.fetch(it.offset)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.page, it.index = ret.Objects, 0
+	it.offset += len(ret.Objects)
+	it.done = len(ret.Objects) < it.pageSize || it.offset >= ret.Count
+	return len(it.page) > 0
+}
+
+// Entity return the current object
+func (it *Iterator) Entity() Entity {
+	if it.index < len(it.page) {
+		return it.page[it.index]
+	}
+	return nil
+}
+
+// Err return the error of the page that failed, nil if all objects were read
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// QueryIterator iterate over the objects of a key/value or keyword query, pageSize objects per request
+func (c *Client) QueryIterator(ctx context.Context, params url.Values, pageSize int) *Iterator {
+	return &Iterator{
+		pageSize: pageSize,
+		index:    -1,
+		fetch: func(offset int) (*QueryResult, error) {
+			page := url.Values{}
+			for k, v := range params {
+				page[k] = v
+			}
+			page.Set("limit", strconv.Itoa(pageSize))
+			page.Set("offset", strconv.Itoa(offset))
+			return c.Query(ctx, page)
+		},
+	}
+}
+
+// QSLIterator iterate over the objects of a QSL query, pageSize objects of the first block per request. The first
+// block of the query must not have pagination
+func (c *Client) QSLIterator(ctx context.Context, query string, pageSize int) *Iterator {
+	return &Iterator{
+		pageSize: pageSize,
+		index:    -1,
+		fetch: func(offset int) (*QueryResult, error) {
+			paged, err := paginate(query, pageSize, offset)
+			if err != nil {
+				return nil, err
+			}
+			return c.QSL(ctx, paged)
+		},
+	}
+}
+
+// paginate add $$limit and offset to the filters of the first block of a QSL query
+func paginate(query string, limit, offset int) (string, error) {
+	pagination := fmt.Sprintf("$$limit=%d,offset=%d", limit, offset)
+	end := strings.IndexAny(query, "[{.")
+	if end < 0 || query[end] != '[' {
+		if end < 0 {
+			end = len(query)
+		}
+		return query[:end] + "[" + pagination + "]" + query[end:], nil
+	}
+	// end of the filters, brackets in quoted values do not count
+	quoted := false
+	for i := end + 1; i < len(query); i++ {
+		switch {
+		case query[i] == '"' && query[i-1] != '\\':
+			quoted = !quoted
+		case query[i] == ']' && !quoted:
+			if strings.Contains(query[end:i], "$$") {
+				return "", errors.New("query already has pagination: " + query)
+			}
+			return query[:i] + pagination + query[i:], nil
+		}
+	}
+	return "", errors.New("malformed query: " + query)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+	handlers "github.com/intuit/katlas/controller/handlers"
+	"github.com/intuit/katlas/controller/leader"
+	core_v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// objTypes lists the kubernetes object types collected for every cluster
+var objTypes = []string{"Pod", "Service", "Namespace", "Deployment", "ReplicaSet", "Ingress", "StatefulSet"}
+
+// ClusterConfig describes a cluster watched by the collector
+type ClusterConfig struct {
+	// Name reported to the rest service, default to the context name
+	Name string `json:"name"`
+	// Kubeconfig path to the kubeconfig file, e.g. a kubeconfig mounted from a secret
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context to use from the kubeconfig, current context is used if empty
+	Context string `json:"context,omitempty"`
+	// Filter selects the namespaces and objects collected, all objects are collected if empty
+	Filter *handlers.Filter `json:"filter,omitempty"`
+}
+
+// clustersFile is the layout of the cluster config file, see README for an example
+type clustersFile struct {
+	Clusters []ClusterConfig `json:"clusters"`
+}
+
+// LoadClusterConfigs read the list of clusters from yaml or json file
+func LoadClusterConfigs(path string) ([]ClusterConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := clustersFile{}
+	err = yaml.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range f.Clusters {
+		if f.Clusters[i].Name == "" {
+			f.Clusters[i].Name = f.Clusters[i].Context
+		}
+		err = f.Clusters[i].Filter.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", f.Clusters[i].Name, err)
+		}
+	}
+	return f.Clusters, nil
+}
+
+// LoadFilter read the filter of a single cluster from yaml or json file
+func LoadFilter(path string) (*handlers.Filter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	filter := &handlers.Filter{}
+	err = yaml.Unmarshal(data, filter)
+	if err != nil {
+		return nil, err
+	}
+	return filter, filter.Validate()
+}
+
+// redactionFile is the layout of the redaction config file, see README for an example
+type redactionFile struct {
+	// DisableDefaults drops handlers.DefaultRedactionRules, only Rules are applied
+	DisableDefaults bool                     `json:"disableDefaults,omitempty"`
+	Rules           []handlers.RedactionRule `json:"rules"`
+}
+
+// LoadRedactor read redaction rules from yaml or json file, the rules are added to the default rules
+func LoadRedactor(path string) (*handlers.Redactor, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := redactionFile{}
+	err = yaml.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+	rules := f.Rules
+	if !f.DisableDefaults {
+		rules = append(append([]handlers.RedactionRule{}, handlers.DefaultRedactionRules...), f.Rules...)
+	}
+	return handlers.NewRedactor(rules)
+}
+
+// redactor applied to the objects of all clusters, set from REDACTION_CONFIG
+var redactor = handlers.DefaultRedactor
+
+// ClusterWatcher runs the controllers and the synchronizer of a single cluster
+// each watcher has its own stop channel so it can be stopped without affecting others
+type ClusterWatcher struct {
+	config  ClusterConfig
+	client  kubernetes.Interface
+	cluster *handlers.Cluster
+	stopCh  chan struct{}
+	// leaseClient holds the lease electing the replica pushing the events of the cluster, no election if nil
+	leaseClient kubernetes.Interface
+	// running counts the outbox and batcher loops, a new leadership term waits for the loops of the previous one
+	// so they never replay the outbox together, Stop waits for them before the outbox files are closed
+	running sync.WaitGroup
+	mutex   sync.Mutex
+	stopped bool
+}
+
+// NewClusterWatcher create watcher for cluster with given client
+// events are kept in an outbox under OUTBOX_DIR if set, sent in batches every BATCH_FLUSH_INTERVAL if set,
+// otherwise sent one by one. With a leaseClient only the replica holding the lease of the cluster
+// pushes events, the others keep their informer caches warm
+func NewClusterWatcher(config ClusterConfig, client kubernetes.Interface, leaseClient kubernetes.Interface) (*ClusterWatcher, error) {
+	cluster := &handlers.Cluster{Name: config.Name, Filter: config.Filter, Redactor: redactor}
+	maxSize, err := strconv.Atoi(os.Getenv("BATCH_MAX_SIZE"))
+	if err != nil || maxSize <= 0 {
+		maxSize = 500
+	}
+	if dir := os.Getenv("OUTBOX_DIR"); dir != "" {
+		outbox, err := handlers.NewOutbox(config.Name, filepath.Join(dir, config.Name), maxSize)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Outbox = outbox
+	} else if interval, err := time.ParseDuration(os.Getenv("BATCH_FLUSH_INTERVAL")); err == nil && interval > 0 {
+		cluster.Batcher = handlers.NewBatcher(config.Name, interval, maxSize)
+	}
+	return &ClusterWatcher{
+		config:      config,
+		client:      client,
+		cluster:     cluster,
+		stopCh:      make(chan struct{}),
+		leaseClient: leaseClient,
+	}, nil
+}
+
+// Start create informers for all object types and start to process events
+func (w *ClusterWatcher) Start() {
+	log.Infof("ClusterWatcher.Start: start watching cluster %s", w.config.Name)
+	controllers := []*Controller{}
+	for _, objType := range objTypes {
+		controller := CreateController(objType, w.client, w.cluster)
+		if objType == "Namespace" {
+			w.cluster.NamespaceLabels = namespaceLabels(controller.informer)
+		}
+		go controller.Run(w.stopCh)
+		controllers = append(controllers, controller)
+	}
+	if w.leaseClient == nil {
+		w.lead(controllers, w.stopCh)
+		return
+	}
+	config := leader.NewConfig(w.config.Name)
+	go func() {
+		err := leader.Run(w.leaseClient, config, w.stopCh, func(leadCh <-chan struct{}) {
+			w.lead(controllers, leadCh)
+		})
+		if err != nil {
+			log.Errorf("ClusterWatcher.Start: leader election of cluster %s failed: %v", w.config.Name, err)
+		}
+	}()
+}
+
+// lead process the events of the cluster and run the sync task until leadCh is closed
+func (w *ClusterWatcher) lead(controllers []*Controller, leadCh <-chan struct{}) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stopped {
+		return
+	}
+	// the leadCh of the previous term is closed, its loops are saving the cursor or flushing
+	w.running.Wait()
+	if w.cluster.Outbox != nil {
+		w.running.Add(1)
+		go func() {
+			defer w.running.Done()
+			w.cluster.Outbox.Run(leadCh)
+		}()
+	}
+	if w.cluster.Batcher != nil {
+		w.running.Add(1)
+		go func() {
+			defer w.running.Done()
+			w.cluster.Batcher.Run(leadCh)
+		}()
+	}
+	go Heartbeats(w.cluster, controllers, leadCh)
+	go func() {
+		// wait for all caches so the namespace labels are known before objects are filtered
+		synced := []cache.InformerSynced{}
+		for _, controller := range controllers {
+			synced = append(synced, controller.HasSynced)
+		}
+		if !cache.WaitForCacheSync(leadCh, synced...) {
+			return
+		}
+		for _, controller := range controllers {
+			go controller.RunWorker(leadCh)
+		}
+		// start sync task
+		go Synchronizer(w.client, w.cluster, leadCh)
+	}()
+}
+
+// namespaceLabels returns the labels of namespaces found in the cache of the namespace informer
+func namespaceLabels(informer cache.SharedIndexInformer) func(namespace string) (map[string]string, bool) {
+	return func(namespace string) (map[string]string, bool) {
+		obj, exists, err := informer.GetIndexer().GetByKey(namespace)
+		if err != nil || !exists {
+			return nil, false
+		}
+		ns, ok := obj.(*core_v1.Namespace)
+		if !ok {
+			return nil, false
+		}
+		return ns.Labels, true
+	}
+}
+
+// Stop shutdown informers, queues and sync task of the cluster, it returns once the outbox has
+// saved its cursor or the batcher has flushed so the outbox directory can be opened again
+func (w *ClusterWatcher) Stop() {
+	log.Infof("ClusterWatcher.Stop: stop watching cluster %s", w.config.Name)
+	w.mutex.Lock()
+	w.stopped = true
+	close(w.stopCh)
+	w.mutex.Unlock()
+	w.running.Wait()
+	if w.cluster.Outbox != nil {
+		w.cluster.Outbox.Close()
+	}
+}
+
+// ClusterManager keeps the running cluster watchers in line with the cluster config file
+type ClusterManager struct {
+	path        string
+	interval    time.Duration
+	watchers    map[string]*ClusterWatcher
+	mutex       sync.Mutex
+	leaseClient kubernetes.Interface
+}
+
+// NewClusterManager create manager for given cluster config file
+// the file is reloaded every CLUSTERS_RELOAD_INTERVAL, default 30s, see NewClusterWatcher for leaseClient
+func NewClusterManager(path string, leaseClient kubernetes.Interface) *ClusterManager {
+	interval, err := time.ParseDuration(os.Getenv("CLUSTERS_RELOAD_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &ClusterManager{
+		path:        path,
+		interval:    interval,
+		watchers:    make(map[string]*ClusterWatcher),
+		leaseClient: leaseClient,
+	}
+}
+
+// Run reload the cluster config periodically until stopCh is closed, then stop all watchers
+func (m *ClusterManager) Run(stopCh <-chan struct{}) {
+	for {
+		err := m.Reload()
+		if err != nil {
+			log.Errorf("ClusterManager.Run: failed to reload %s: %v", m.path, err)
+		}
+		select {
+		case <-stopCh:
+			m.stopAll()
+			return
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+// Reload start watchers for new clusters, stop watchers for removed clusters
+// and restart watchers whose config has changed
+func (m *ClusterManager) Reload() error {
+	configs, err := LoadClusterConfigs(m.path)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	desired := make(map[string]ClusterConfig)
+	for _, config := range configs {
+		if config.Name == "" {
+			log.Errorf("ClusterManager.Reload: ignore cluster without name or context in %s", m.path)
+			continue
+		}
+		desired[config.Name] = config
+	}
+	for name, watcher := range m.watchers {
+		config, ok := desired[name]
+		if !ok || !reflect.DeepEqual(config, watcher.config) {
+			watcher.Stop()
+			delete(m.watchers, name)
+		}
+	}
+	for name, config := range desired {
+		if _, ok := m.watchers[name]; ok {
+			continue
+		}
+		client, err := handlers.NewKubernetesClient(config.Kubeconfig, config.Context)
+		if err != nil {
+			// other clusters keep running, retry on next reload
+			log.Errorf("ClusterManager.Reload: failed to create client for cluster %s: %v", name, err)
+			continue
+		}
+		watcher, err := NewClusterWatcher(config, client, m.leaseClient)
+		if err != nil {
+			log.Errorf("ClusterManager.Reload: failed to create watcher for cluster %s: %v", name, err)
+			continue
+		}
+		watcher.Start()
+		m.watchers[name] = watcher
+	}
+	return nil
+}
+
+func (m *ClusterManager) stopAll() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for name, watcher := range m.watchers {
+		watcher.Stop()
+		delete(m.watchers, name)
+	}
+}
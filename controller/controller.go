@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -23,9 +25,42 @@ type Controller struct {
 	informer  cache.SharedIndexInformer
 	handler   handlers.Handler
 	name      string
+	cluster   string
+	// maxRetries is the number of times a failed item is put back in the queue
+	maxRetries int
+	// finalStates keeps the last known state of deleted objects until their delete is processed
+	finalStates map[string]interface{}
+	mutex       sync.Mutex
+}
+
+// setFinalState keep the last known state of the deleted object with key,
+// the object is unwrapped if the informer missed the delete and only knows its cached state
+func (c *Controller) setFinalState(key string, obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.finalStates[key] = obj
+}
+
+// finalState returns the last known state of the deleted object with key, nil if unknown
+func (c *Controller) finalState(key string) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.finalStates[key]
+}
+
+// clearFinalState forget the state of object with key once its delete is processed or it exists again
+func (c *Controller) clearFinalState(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.finalStates, key)
 }
 
 // Run is the main path of execution for the controller loop
+// the informer keeps its cache and the queue up to date until stopCh is closed,
+// items are processed by RunWorker which may run only while this replica leads
 func (c *Controller) Run(stopCh <-chan struct{}) {
 	// handle a panic with logging and exiting
 	defer utilruntime.HandleCrash()
@@ -44,9 +79,17 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 		return
 	}
 	c.logger.Infof("%sController.Run: cache sync complete", c.name)
+	<-stopCh
+}
 
+// RunWorker process the queued items until stopCh is closed
+func (c *Controller) RunWorker(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	if !cache.WaitForCacheSync(stopCh, c.HasSynced) {
+		return
+	}
 	// run the runWorker method every second with a stop channel
-	wait.Until(c.runWorker, time.Second, stopCh)
+	wait.Until(func() { c.runWorker(stopCh) }, time.Second, stopCh)
 }
 
 // HasSynced allows us to satisfy the Controller interface
@@ -56,12 +99,12 @@ func (c *Controller) HasSynced() bool {
 }
 
 // runWorker executes the loop to process new items added to the queue
-func (c *Controller) runWorker() {
+func (c *Controller) runWorker(stopCh <-chan struct{}) {
 	log.Infof("%sController.runWorker: starting", c.name)
 
 	// invoke processNextItem to fetch and consume the next change
 	// to a watched or listed resource
-	for c.processNextItem() {
+	for c.processNextItem(stopCh) {
 		log.Infof("%sController.runWorker: processing next item", c.name)
 	}
 
@@ -71,7 +114,7 @@ func (c *Controller) runWorker() {
 // processNextItem retrieves each queued item and takes the
 // necessary handler action based off of if the item was
 // created or deleted
-func (c *Controller) processNextItem() bool {
+func (c *Controller) processNextItem(stopCh <-chan struct{}) bool {
 	log.Infof("%sController.processNextItem: start", c.name)
 
 	// fetch the next item (blocking) from the queue to process or
@@ -88,6 +131,15 @@ func (c *Controller) processNextItem() bool {
 
 	defer c.queue.Done(key)
 
+	// the worker was stopped while waiting, e.g. the leadership is lost,
+	// keep the item for when this replica leads again
+	select {
+	case <-stopCh:
+		c.queue.Add(key)
+		return false
+	default:
+	}
+
 	// assert the string out of the key (format `namespace/name`)
 	keyRaw := key.(string)
 
@@ -99,43 +151,58 @@ func (c *Controller) processNextItem() bool {
 	//
 	// if there is an error in getting the key from the index
 	// then we want to retry this particular queue key a certain
-	// number of times (5 here) before we forget the queue key
+	// number of times (MAX_RETRIES) before we forget the queue key
 	// and throw an error
 	item, exists, err := c.informer.GetIndexer().GetByKey(keyRaw)
 	// c.logger.Infof("    %s: %s", keyRaw, item)
 	if err != nil {
-		if c.queue.NumRequeues(key) < 5 {
-			c.logger.Errorf("%sController.processNextItem: Failed processing item with key %s with error %v, retrying", c.name, key, err)
-			c.queue.AddRateLimited(key)
-		} else {
-			c.logger.Errorf("%sController.processNextItem: Failed processing item with key %s with error %v, no more retries", c.name, key, err)
-			c.queue.Forget(key)
-			utilruntime.HandleError(err)
-		}
+		c.retry(key, err)
+		return true
 	}
 
 	// if the item doesn't exist then it was deleted and we need to fire off the handler's
 	// ObjectDeleted method. but if the object does exist that indicates that the object
 	// was created (or updated) so run the ObjectCreated method
 	//
-	// after both instances, we want to forget the key from the queue, as this indicates
-	// a code path of successful queue key processing
+	// after both instances, we want to forget the key from the queue if the handler succeeded,
+	// otherwise put it back in the queue to try again later
 	if !exists {
 		c.logger.Infof("%sController.processNextItem: object deleted detected: %s", c.name, keyRaw)
-		c.handler.ObjectDeleted(item, keyRaw) // TODO: make this check for the error
-		c.queue.Forget(key)                   // TODO: forget if no error, otherwise put back in queue and try again
+		err = c.handler.ObjectDeleted(c.finalState(keyRaw), keyRaw)
 	} else {
 		c.logger.Infof("%sController.processNextItem: object created detected: %s", c.name, keyRaw)
+		c.clearFinalState(keyRaw)
 		//c.logger.Infof("%sController.processNextItem: %s %s ", c.name, item, reflect.TypeOf(item))
 		if item == nil {
-			c.handler.ObjectUpdated(item, item)
+			err = c.handler.ObjectUpdated(item, item)
 		} else {
-			c.handler.ObjectCreated(item)
+			err = c.handler.ObjectCreated(item)
 		}
-		// c.handler.ObjectCreated(item)
-		c.queue.Forget(key)
 	}
+	if err != nil {
+		c.retry(key, err)
+		return true
+	}
+	if !exists {
+		c.clearFinalState(keyRaw)
+	}
+	c.queue.Forget(key)
 
 	// keep the worker loop running by returning true
 	return true
 }
+
+// retry put key back in the queue with rate limiting until maxRetries is reached,
+// then forget the key and add it to the dead letters
+func (c *Controller) retry(key interface{}, err error) {
+	if c.queue.NumRequeues(key) < c.maxRetries {
+		c.logger.Errorf("%sController.retry: Failed processing item with key %s with error %v, retrying", c.name, key, err)
+		c.queue.AddRateLimited(key)
+		return
+	}
+	c.logger.Errorf("%sController.retry: Failed processing item with key %s with error %v, no more retries", c.name, key, err)
+	c.queue.Forget(key)
+	c.clearFinalState(key.(string))
+	handlers.DeadLetters.Add(c.cluster, strings.ToLower(c.name), key.(string), c.maxRetries+1, err)
+	utilruntime.HandleError(err)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/client"
+)
+
+// batch operations understood by the rest service
+const (
+	OpUpsert = client.OpUpsert
+	OpDelete = client.OpDelete
+)
+
+// BatchItem is a single create or delete sent to the batch endpoint of the rest service
+type BatchItem = client.BatchItem
+
+// BatchResult is the result of a single item returned by the batch endpoint
+type BatchResult = client.BatchResult
+
+// batchClient reuses connections across batches instead of opening one per request
+var batchClient = &http.Client{Timeout: time.Minute}
+
+// SendBatch post items to the batch endpoint and return the result of every item
+func SendBatch(items []BatchItem, cluster string) ([]BatchResult, error) {
+	results, err := restClient(cluster, client.WithHTTPClient(batchClient)).Batch(context.Background(), items)
+	if err != nil {
+		return nil, fmt.Errorf("batch request failed: %v", err)
+	}
+	if len(results) != len(items) {
+		return nil, fmt.Errorf("batch response has %d results for %d items", len(results), len(items))
+	}
+	return results, nil
+}
+
+// pendingItem is an item waiting in the batcher with the number of failed attempts
+type pendingItem struct {
+	item     BatchItem
+	attempts int
+}
+
+// Batcher coalesces events per key within a flush window and sends them in a single request
+// only the latest event of a key is sent, items failing on the service are retried in the next batches
+type Batcher struct {
+	cluster    string
+	interval   time.Duration
+	maxSize    int
+	maxRetries int
+	pending    map[string]*pendingItem
+	order      []string
+	mutex      sync.Mutex
+}
+
+// NewBatcher create batcher for cluster which flush every interval or when maxSize items are pending
+func NewBatcher(cluster string, interval time.Duration, maxSize int) *Batcher {
+	return &Batcher{
+		cluster:    cluster,
+		interval:   interval,
+		maxSize:    maxSize,
+		maxRetries: 5,
+		pending:    make(map[string]*pendingItem),
+	}
+}
+
+// Add queue item with key, replace the pending item of same key
+func (b *Batcher) Add(key string, item BatchItem) {
+	b.mutex.Lock()
+	if _, ok := b.pending[key]; !ok {
+		b.order = append(b.order, key)
+	}
+	b.pending[key] = &pendingItem{item: item}
+	full := len(b.pending) >= b.maxSize
+	b.mutex.Unlock()
+	if full {
+		b.Flush()
+	}
+}
+
+// Len returns the number of pending items
+func (b *Batcher) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.pending)
+}
+
+// Run flush pending items every interval until stopCh is closed
+func (b *Batcher) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			b.Flush()
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
+
+// Flush send all pending items, failed items are put back unless replaced by a newer event
+func (b *Batcher) Flush() error {
+	b.mutex.Lock()
+	keys := b.order
+	pending := b.pending
+	b.order = nil
+	b.pending = make(map[string]*pendingItem)
+	b.mutex.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	items := make([]BatchItem, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, pending[key].item)
+	}
+	log.Infof("Batcher.Flush: sending %d items of cluster %s", len(items), b.cluster)
+	results, err := SendBatch(items, b.cluster)
+	if err != nil {
+		log.Errorf("Batcher.Flush: failed to send batch: %v", err)
+		errs := make([]error, len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+		b.requeue(keys, errs, pending)
+		return err
+	}
+	failed := []string{}
+	errs := []error{}
+	for _, result := range results {
+		if result.Status != http.StatusOK && result.Index >= 0 && result.Index < len(keys) {
+			key := keys[result.Index]
+			log.Errorf("Batcher.Flush: %s %s failed with status %d: %s", items[result.Index].Op, key, result.Status, result.Error)
+			failed = append(failed, key)
+			errs = append(errs, fmt.Errorf("%s failed with status %d: %s", items[result.Index].Op, result.Status, result.Error))
+		}
+	}
+	b.requeue(failed, errs, pending)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d batch items failed", len(failed), len(items))
+	}
+	return nil
+}
+
+// requeue put items back to pending if they have retries left and no newer event arrived
+// items out of retries go to the dead letters with the error of their last attempt
+func (b *Batcher) requeue(keys []string, errs []error, pending map[string]*pendingItem) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, key := range keys {
+		p := pending[key]
+		p.attempts++
+		if p.attempts > b.maxRetries {
+			DeadLetters.Add(b.cluster, p.item.ObjType, key, p.attempts, errs[i])
+			continue
+		}
+		if _, ok := b.pending[key]; ok {
+			// a newer event replaced this one
+			continue
+		}
+		b.order = append(b.order, key)
+		b.pending[key] = p
+	}
+}
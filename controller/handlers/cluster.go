@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Cluster holds the settings shared by all handlers collecting
+// objects from the same kubernetes cluster
+type Cluster struct {
+	// Name of the cluster reported to the rest service
+	Name string
+	// Outbox persists events on disk until the rest service accepts them, takes precedence over Batcher
+	Outbox *Outbox
+	// Batcher coalesces events and sends them in batches, events are sent one by one if nil
+	Batcher *Batcher
+	// Filter selects the collected objects, all objects are collected if nil
+	Filter *Filter
+	// NamespaceLabels returns the labels of a namespace to find the namespaces opted out with IgnoreLabel
+	NamespaceLabels func(namespace string) (map[string]string, bool)
+	// Redactor transforms objects before they are sent, DefaultRedactor is used if nil
+	Redactor *Redactor
+}
+
+// name returns the cluster name, fall back to CLUSTER_NAME for single cluster deployments
+func (c *Cluster) name() string {
+	if c == nil || c.Name == "" {
+		return ClusterName
+	}
+	return c.Name
+}
+
+// resourceID build the resourceid of object with key in format namespace/name or name
+func (c *Cluster) resourceID(objType string, key string) string {
+	return objType + ":" + c.name() + ":" + strings.Replace(key, "/", ":", -1)
+}
+
+// upsert send created or updated object to the rest service
+func (c *Cluster) upsert(objType string, obj interface{}) error {
+	if !c.allows(objType, obj) {
+		log.Debugf("Cluster.upsert: skip filtered %s", objType)
+		return nil
+	}
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return err
+	}
+	data, err := c.redact(objType, obj)
+	if err != nil {
+		return fmt.Errorf("failed to redact %s %s: %v", objType, key, err)
+	}
+	if c != nil && c.Outbox != nil {
+		return c.Outbox.Add(BatchItem{Op: OpUpsert, ObjType: objType, Object: data})
+	}
+	if c != nil && c.Batcher != nil {
+		c.Batcher.Add(objType+"/"+key, BatchItem{Op: OpUpsert, ObjType: objType, Object: data})
+		return nil
+	}
+	// a single attempt, failed events are retried by the workqueue of the controller
+	status, body := SendJSONQuery(data, RestSvcEndpoint+"v1.1/entity?objtype="+objType, c.name())
+	if status != http.StatusOK {
+		return fmt.Errorf("upsert %s failed with status %d: %s", objType, status, string(body))
+	}
+	return nil
+}
+
+// delete replace object with key by a tombstone in the rest service
+// obj is the last known state of the object, its uid and resourceversion let the service
+// ignore the delete if a newer object was created since, obj is nil if the state is unknown
+func (c *Cluster) delete(objType string, key string, obj interface{}) error {
+	item := BatchItem{Op: OpDelete, ObjType: objType, ResourceID: c.resourceID(objType, key)}
+	if obj != nil {
+		if m, err := meta.Accessor(obj); err == nil {
+			item.K8sUID = string(m.GetUID())
+			item.ResourceVersion = m.GetResourceVersion()
+		}
+		data, err := c.redact(objType, obj)
+		if err != nil {
+			return fmt.Errorf("failed to redact %s %s: %v", objType, key, err)
+		}
+		item.Object = data
+	}
+	if c != nil && c.Outbox != nil {
+		return c.Outbox.Add(item)
+	}
+	if c != nil && c.Batcher != nil {
+		c.Batcher.Add(objType+"/"+key, item)
+		return nil
+	}
+	status, body := SendDeleteRequest(item, RestSvcEndpoint+"v1.1/entity", c.name())
+	if status != http.StatusOK {
+		return fmt.Errorf("delete %s failed with status %d: %s", item.ResourceID, status, string(body))
+	}
+	return nil
+}
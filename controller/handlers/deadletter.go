@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/controller/metrics"
+)
+
+// DeadLetter is an event given up after all retries failed
+type DeadLetter struct {
+	Cluster  string    `json:"cluster"`
+	ObjType  string    `json:"objtype"`
+	Key      string    `json:"key"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+}
+
+// DeadLetterList keeps the most recent dead letters, the oldest ones are discarded when full
+type DeadLetterList struct {
+	size    int
+	letters []DeadLetter
+	mutex   sync.Mutex
+}
+
+// DeadLetters collects the events dropped by controllers, batchers and outboxes of all clusters
+var DeadLetters = NewDeadLetterList(1000)
+
+// NewDeadLetterList create list keeping up to size dead letters
+func NewDeadLetterList(size int) *DeadLetterList {
+	return &DeadLetterList{size: size}
+}
+
+// Add record a dropped event
+func (l *DeadLetterList) Add(cluster string, objType string, key string, attempts int, err error) {
+	log.Errorf("DeadLetterList.Add: give up %s %s of cluster %s after %d attempts: %v", objType, key, cluster, attempts, err)
+	metrics.DeadLetters.WithLabelValues(cluster, objType).Inc()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.letters = append(l.letters, DeadLetter{
+		Cluster:  cluster,
+		ObjType:  objType,
+		Key:      key,
+		Error:    err.Error(),
+		Attempts: attempts,
+		Time:     time.Now(),
+	})
+	if len(l.letters) > l.size {
+		l.letters = l.letters[len(l.letters)-l.size:]
+	}
+}
+
+// List returns a copy of the dead letters, oldest first
+func (l *DeadLetterList) List() []DeadLetter {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]DeadLetter{}, l.letters...)
+}
+
+// ServeHTTP returns the dead letters in json
+func (l *DeadLetterList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ret, _ := json.Marshal(map[string]interface{}{"objects": l.List()})
+	w.Write(ret)
+}
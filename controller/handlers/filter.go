@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// IgnoreLabel set to true on a namespace opts the namespace and its objects out of the collection
+const IgnoreLabel = "katlas.io/ignore"
+
+// Filter selects the objects collected from a cluster
+type Filter struct {
+	// IncludeNamespaces are glob patterns of the namespaces collected, all namespaces if empty
+	IncludeNamespaces []string `json:"includeNamespaces,omitempty"`
+	// ExcludeNamespaces are glob patterns of the namespaces not collected, applied after IncludeNamespaces
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// LabelSelectors per object type, e.g. pod: app=web
+	LabelSelectors map[string]string `json:"labelSelectors,omitempty"`
+	// FieldSelectors per object type, e.g. pod: status.phase=Running
+	FieldSelectors map[string]string `json:"fieldSelectors,omitempty"`
+}
+
+// Validate check patterns and selectors of the filter
+func (f *Filter) Validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, f.IncludeNamespaces...), f.ExcludeNamespaces...) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid namespace pattern %s: %v", pattern, err)
+		}
+	}
+	for objType, selector := range f.LabelSelectors {
+		_, err := labels.Parse(selector)
+		if err != nil {
+			return fmt.Errorf("invalid label selector for %s: %v", objType, err)
+		}
+	}
+	for objType, selector := range f.FieldSelectors {
+		_, err := fields.ParseSelector(selector)
+		if err != nil {
+			return fmt.Errorf("invalid field selector for %s: %v", objType, err)
+		}
+	}
+	return nil
+}
+
+// AllowsNamespace returns whether the namespace matches the include and exclude patterns
+func (f *Filter) AllowsNamespace(namespace string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.IncludeNamespaces) > 0 && !matchAny(f.IncludeNamespaces, namespace) {
+		return false
+	}
+	return !matchAny(f.ExcludeNamespaces, namespace)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored returns whether the labels of a namespace opt it out of the collection
+func ignored(namespaceLabels map[string]string) bool {
+	return namespaceLabels[IgnoreLabel] == "true"
+}
+
+// listOptions add the label and field selectors of objType to options of informers and synchronizers
+func (c *Cluster) listOptions(objType string, options v1.ListOptions) v1.ListOptions {
+	if c == nil || c.Filter == nil {
+		return options
+	}
+	if selector, ok := c.Filter.LabelSelectors[objType]; ok {
+		options.LabelSelector = selector
+	}
+	if selector, ok := c.Filter.FieldSelectors[objType]; ok {
+		options.FieldSelector = selector
+	}
+	return options
+}
+
+// allows returns whether obj passes the namespace filter and the namespace is not ignored
+// label and field selectors are applied by the api server when listing and watching
+func (c *Cluster) allows(objType string, obj interface{}) bool {
+	if c == nil {
+		return true
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return true
+	}
+	namespace := m.GetNamespace()
+	if objType == "namespace" {
+		namespace = m.GetName()
+		if ignored(m.GetLabels()) {
+			return false
+		}
+	} else if namespace != "" && c.NamespaceLabels != nil {
+		namespaceLabels, ok := c.NamespaceLabels(namespace)
+		if ok && ignored(namespaceLabels) {
+			return false
+		}
+	}
+	return namespace == "" || c.Filter.AllowsNamespace(namespace)
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	v1beta2 "k8s.io/api/apps/v1beta2"
@@ -17,20 +16,26 @@ import (
 )
 
 // DeploymentHandler is a sample implementation of Handler
-type DeploymentHandler struct{}
+type DeploymentHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetDeploymentInformer get index Informer to watch Deployment
-func GetDeploymentInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetDeploymentInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
 		// informer requires: ListFunc to take care of listing and watching
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("deployment", options)
 				// list all of the deployments (AppsV1beta2 resource) in the deafult namespace
 				return client.AppsV1beta2().Deployments(AppNamespace).List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("deployment", options)
 				// watch all of the deployments (AppsV1beta2 resource) in the default namespace
 				return client.AppsV1beta2().Deployments(AppNamespace).Watch(options)
 			},
@@ -83,15 +88,13 @@ func (t *DeploymentHandler) ObjectCreated(obj interface{}) error {
 		log.Error(err)
 	}
 	log.Debugf("    Deployment: %s, \n", j)
-	SendJSONQueryWithRetries(deployment, RestSvcEndpoint+"v1.1/entity?objtype=deployment")
-	return nil
+	return t.Cluster.upsert("deployment", deployment)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *DeploymentHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("DeploymentHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/deployment/deployment:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return t.Cluster.delete("deployment", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -101,7 +104,18 @@ func (t *DeploymentHandler) ObjectUpdated(objOld, objNew interface{}) error {
 }
 
 // DeploymentSynchronize sync all Deployments periodically in case missing events
-func DeploymentSynchronize(client kubernetes.Interface) {
-	clusterdeploymentslist, _ := client.AppsV1beta2().Deployments(AppNamespace).List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusterdeploymentslist.Items, RestSvcEndpoint+"v1/sync/deployment")
+func DeploymentSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusterdeploymentslist, err := client.AppsV1beta2().Deployments(AppNamespace).List(cluster.listOptions("deployment", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("DeploymentSynchronize: failed to list deployments: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusterdeploymentslist.Items {
+		objs = append(objs, &clusterdeploymentslist.Items[i])
+	}
+	err = cluster.sync("deployment", objs)
+	if err != nil {
+		log.Errorf("DeploymentSynchronize: %v", err)
+	}
 }
@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"strings"
-
 	log "github.com/Sirupsen/logrus"
 	ext_v1beta1 "k8s.io/api/extensions/v1beta1"
 	//metav1 "k8s.io/apimachinery/pkg/resources/meta/v1"
@@ -15,20 +13,26 @@ import (
 )
 
 // IngressHandler is a sample implementation of Handler
-type IngressHandler struct{}
+type IngressHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetIngressInformer get index Informer to watch Ingress
-func GetIngressInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetIngressInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
 		// informer requires: ListFunc to take care of listing and watching
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("ingress", options)
 				// list all of the ingresses (ExtensionsV1beta1 resource) in the deafult ingress
 				return client.ExtensionsV1beta1().Ingresses(AppNamespace).List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("ingress", options)
 				// watch all of the ingresses (ExtensionsV1beta1 resource) in the default ingress
 				return client.ExtensionsV1beta1().Ingresses(AppNamespace).Watch(options)
 			},
@@ -60,15 +64,13 @@ func (t *IngressHandler) ObjectCreated(obj interface{}) error {
 	// assert the type to a Ingress object to pull out relevant data
 	ingress := obj.(*ext_v1beta1.Ingress)
 	log.Infof("    ingressmeta: %+v", ingress)
-	SendJSONQueryWithRetries(ingress, RestSvcEndpoint+"v1.1/entity?objtype=ingress")
-	return nil
+	return t.Cluster.upsert("ingress", ingress)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *IngressHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("IngressHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/ingress/ingress:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return t.Cluster.delete("ingress", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -78,7 +80,18 @@ func (t *IngressHandler) ObjectUpdated(objOld, objNew interface{}) error {
 }
 
 // IngressSynchronize sync all Ingresses periodically in case missing events
-func IngressSynchronize(client kubernetes.Interface) {
-	clusteringresseslist, _ := client.ExtensionsV1beta1().Ingresses(AppNamespace).List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusteringresseslist.Items, RestSvcEndpoint+"v1/sync/ingress")
+func IngressSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusteringresseslist, err := client.ExtensionsV1beta1().Ingresses(AppNamespace).List(cluster.listOptions("ingress", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("IngressSynchronize: failed to list ingresss: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusteringresseslist.Items {
+		objs = append(objs, &clusteringresseslist.Items[i])
+	}
+	err = cluster.sync("ingress", objs)
+	if err != nil {
+		log.Errorf("IngressSynchronize: %v", err)
+	}
 }
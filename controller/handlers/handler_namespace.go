@@ -15,20 +15,26 @@ import (
 )
 
 // NamespaceHandler is a sample implementation of Handler
-type NamespaceHandler struct{}
+type NamespaceHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetNamespaceInformer get index Informer to watch Namespace
-func GetNamespaceInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetNamespaceInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
 		// informer requires: ListFunc to take care of listing and watching
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("namespace", options)
 				// list all of the namespaces (core resource) in the deafult namespace
 				return client.CoreV1().Namespaces().List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("namespace", options)
 				// watch all of the namespaces (core resource) in the default namespace
 				return client.CoreV1().Namespaces().Watch(options)
 			},
@@ -73,15 +79,13 @@ func (t *NamespaceHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateNamespace(namespace) {
 		return errors.New("Could not validate namespace object " + namespace.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(namespace, RestSvcEndpoint+"v1.1/entity?objtype=namespace")
-	return nil
+	return t.Cluster.upsert("namespace", namespace)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *NamespaceHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("NamespaceHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/namespace/namespace:" + ClusterName + ":" + key)
-	return nil
+	return t.Cluster.delete("namespace", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -91,7 +95,18 @@ func (t *NamespaceHandler) ObjectUpdated(objOld, objNew interface{}) error {
 }
 
 // NamespaceSynchronize sync all Namespaces periodically in case missing events
-func NamespaceSynchronize(client kubernetes.Interface) {
-	clusternamespaceslist, _ := client.CoreV1().Namespaces().List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusternamespaceslist.Items, RestSvcEndpoint+"v1/sync/namespace")
+func NamespaceSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusternamespaceslist, err := client.CoreV1().Namespaces().List(cluster.listOptions("namespace", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("NamespaceSynchronize: failed to list namespaces: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusternamespaceslist.Items {
+		objs = append(objs, &clusternamespaceslist.Items[i])
+	}
+	err = cluster.sync("namespace", objs)
+	if err != nil {
+		log.Errorf("NamespaceSynchronize: %v", err)
+	}
 }
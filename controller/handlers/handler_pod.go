@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"errors"
-	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	core_v1 "k8s.io/api/core/v1"
@@ -16,10 +15,14 @@ import (
 )
 
 // PodHandler is a sample implementation of Handler
-type PodHandler struct{}
+type PodHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetPodInformer get index Informer to watch Pod
-func GetPodInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetPodInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	// the informer is responsible for listing and watching events for objects of a specific type
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
@@ -27,10 +30,12 @@ func GetPodInformer(client kubernetes.Interface) cache.SharedIndexInformer {
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("pod", options)
 				// list all of the pods (core resource) in the deafult namespace
 				return client.CoreV1().Pods(AppNamespace).List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("pod", options)
 				// watch all of the pods (core resource) in the default namespace
 				return client.CoreV1().Pods(AppNamespace).Watch(options)
 			},
@@ -78,15 +83,13 @@ func (t *PodHandler) ObjectCreated(obj interface{}) error {
 		return errors.New("Could not validate pod object " + pod.ObjectMeta.Name)
 	}
 	// send the object to the rest service
-	SendJSONQueryWithRetries(pod, RestSvcEndpoint+"v1.1/entity?objtype=pod")
-	return nil
+	return t.Cluster.upsert("pod", pod)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *PodHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("PodHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/pod/pod:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return t.Cluster.delete("pod", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -98,7 +101,18 @@ func (t *PodHandler) ObjectUpdated(objOld, objNew interface{}) error {
 // PodSynchronize synchronize the objects in dgraph with the cluster to account for drift
 // e.g. if there were network issues and some events weren't received,
 // or if the api crashes while processing some events
-func PodSynchronize(client kubernetes.Interface) {
-	clusterpodslist, _ := client.CoreV1().Pods(AppNamespace).List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusterpodslist.Items, RestSvcEndpoint+"v1/sync/pod")
+func PodSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusterpodslist, err := client.CoreV1().Pods(AppNamespace).List(cluster.listOptions("pod", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("PodSynchronize: failed to list pods: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusterpodslist.Items {
+		objs = append(objs, &clusterpodslist.Items[i])
+	}
+	err = cluster.sync("pod", objs)
+	if err != nil {
+		log.Errorf("PodSynchronize: %v", err)
+	}
 }
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"errors"
-	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"k8s.io/api/apps/v1beta2"
@@ -16,20 +15,26 @@ import (
 )
 
 // ReplicaSetHandler is a sample implementation of Handler
-type ReplicaSetHandler struct{}
+type ReplicaSetHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetReplicaSetInformer get index Informer to watch ReplicaSet
-func GetReplicaSetInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetReplicaSetInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
 		// informer requires: ListFunc to take care of listing and watching
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("replicaset", options)
 				// list all of the pods (core resource) in the deafult namespace
 				return client.AppsV1beta2().ReplicaSets(AppNamespace).List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("replicaset", options)
 				// watch all of the pods (core resource) in the default namespace
 				return client.AppsV1beta2().ReplicaSets(AppNamespace).Watch(options)
 			},
@@ -77,15 +82,13 @@ func (t *ReplicaSetHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateReplicaSet(replicaset) {
 		return errors.New("Could not validate replicaset object " + replicaset.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(replicaset, RestSvcEndpoint+"v1.1/entity?objtype=replicaset")
-	return nil
+	return t.Cluster.upsert("replicaset", replicaset)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *ReplicaSetHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("ReplicaSetHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/replicaset/replicaset:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return t.Cluster.delete("replicaset", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -95,7 +98,18 @@ func (t *ReplicaSetHandler) ObjectUpdated(objOld, objNew interface{}) error {
 }
 
 // ReplicaSetSynchronize sync all ReplicaSets periodically in case missing events
-func ReplicaSetSynchronize(client kubernetes.Interface) {
-	clusterreplicasetslist, _ := client.AppsV1beta2().ReplicaSets(AppNamespace).List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusterreplicasetslist.Items, RestSvcEndpoint+"v1/sync/replicaset")
+func ReplicaSetSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusterreplicasetslist, err := client.AppsV1beta2().ReplicaSets(AppNamespace).List(cluster.listOptions("replicaset", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("ReplicaSetSynchronize: failed to list replicasets: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusterreplicasetslist.Items {
+		objs = append(objs, &clusterreplicasetslist.Items[i])
+	}
+	err = cluster.sync("replicaset", objs)
+	if err != nil {
+		log.Errorf("ReplicaSetSynchronize: %v", err)
+	}
 }
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"errors"
-	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	core_v1 "k8s.io/api/core/v1"
@@ -16,20 +15,26 @@ import (
 )
 
 // ServiceHandler is a sample implementation of Handler
-type ServiceHandler struct{}
+type ServiceHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetServiceInformer get index Informer to watch Service
-func GetServiceInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetServiceInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
 		// informer requires: ListFunc to take care of listing and watching
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("service", options)
 				// list all of the pods (core resource) in the deafult namespace
 				return client.CoreV1().Services(AppNamespace).List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("service", options)
 				// watch all of the pods (core resource) in the default namespace
 				return client.CoreV1().Services(AppNamespace).Watch(options)
 			},
@@ -78,15 +83,13 @@ func (t *ServiceHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateService(service) {
 		return errors.New("Could not validate service object " + service.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(service, RestSvcEndpoint+"v1.1/entity?objtype=service")
-	return nil
+	return t.Cluster.upsert("service", service)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *ServiceHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("ServiceHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/service/service:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return t.Cluster.delete("service", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -96,7 +99,18 @@ func (t *ServiceHandler) ObjectUpdated(objOld, objNew interface{}) error {
 }
 
 // ServiceSynchronize sync all Services periodically in case missing events
-func ServiceSynchronize(client kubernetes.Interface) {
-	clusterserviceslist, _ := client.CoreV1().Services(AppNamespace).List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusterserviceslist.Items, RestSvcEndpoint+"v1/sync/service")
+func ServiceSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusterserviceslist, err := client.CoreV1().Services(AppNamespace).List(cluster.listOptions("service", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("ServiceSynchronize: failed to list services: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusterserviceslist.Items {
+		objs = append(objs, &clusterserviceslist.Items[i])
+	}
+	err = cluster.sync("service", objs)
+	if err != nil {
+		log.Errorf("ServiceSynchronize: %v", err)
+	}
 }
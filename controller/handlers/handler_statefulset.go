@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"errors"
-	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
@@ -16,20 +15,26 @@ import (
 )
 
 // StatefulSetHandler is a sample implementation of Handler
-type StatefulSetHandler struct{}
+type StatefulSetHandler struct {
+	// Cluster the handled objects belong to
+	Cluster *Cluster
+}
 
 // GetStatefulSetInformer get index Informer to watch StatefulSet
-func GetStatefulSetInformer(client kubernetes.Interface) cache.SharedIndexInformer {
+// label and field selectors of the cluster filter are applied when listing and watching
+func GetStatefulSetInformer(client kubernetes.Interface, cluster *Cluster) cache.SharedIndexInformer {
 	informer := cache.NewSharedIndexInformer(
 		// the ListWatch contains two different functions that our
 		// informer requires: ListFunc to take care of listing and watching
 		// the resources we want to handle
 		&cache.ListWatch{
 			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				options = cluster.listOptions("statefulset", options)
 				// list all of the statefulsets (apps resource) in the deafult namespace
 				return client.AppsV1().StatefulSets(AppNamespace).List(options)
 			},
 			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				options = cluster.listOptions("statefulset", options)
 				// watch all of the statefulsets (apps resource) in the default namespace
 				return client.AppsV1().StatefulSets(AppNamespace).Watch(options)
 			},
@@ -78,15 +83,13 @@ func (t *StatefulSetHandler) ObjectCreated(obj interface{}) error {
 	if !ValidateStatefulSet(statefulset) {
 		return errors.New("Could not validate statefulset object " + statefulset.ObjectMeta.Name)
 	}
-	SendJSONQueryWithRetries(statefulset, RestSvcEndpoint+"v1.1/entity?objtype=statefulset")
-	return nil
+	return t.Cluster.upsert("statefulset", statefulset)
 }
 
 // ObjectDeleted is called when an object is deleted
 func (t *StatefulSetHandler) ObjectDeleted(obj interface{}, key string) error {
 	log.Info("StatefulSetHandler.ObjectDeleted")
-	SendDeleteRequest(RestSvcEndpoint + "v1/entity/statefulset/statefulset:" + ClusterName + ":" + strings.Replace(key, "/", ":", -1))
-	return nil
+	return t.Cluster.delete("statefulset", key, obj)
 }
 
 // ObjectUpdated is called when an object is updated
@@ -96,7 +99,18 @@ func (t *StatefulSetHandler) ObjectUpdated(objOld, objNew interface{}) error {
 }
 
 // StatefulSetSynchronize sync all StatefulSets periodically in case missing events
-func StatefulSetSynchronize(client kubernetes.Interface) {
-	clusterstatefulsetslist, _ := client.AppsV1().StatefulSets(AppNamespace).List(v1.ListOptions{})
-	SendJSONQueryWithRetries(clusterstatefulsetslist.Items, RestSvcEndpoint+"v1/sync/statefulset")
+func StatefulSetSynchronize(client kubernetes.Interface, cluster *Cluster) {
+	clusterstatefulsetslist, err := client.AppsV1().StatefulSets(AppNamespace).List(cluster.listOptions("statefulset", v1.ListOptions{}))
+	if err != nil {
+		log.Errorf("StatefulSetSynchronize: failed to list statefulsets: %v", err)
+		return
+	}
+	objs := []interface{}{}
+	for i := range clusterstatefulsetslist.Items {
+		objs = append(objs, &clusterstatefulsetslist.Items[i])
+	}
+	err = cluster.sync("statefulset", objs)
+	if err != nil {
+		log.Errorf("StatefulSetSynchronize: %v", err)
+	}
 }
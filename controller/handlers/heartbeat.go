@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Version of the collector reported in heartbeats, set at build time with
+// -ldflags "-X github.com/intuit/katlas/controller/handlers.Version=<version>"
+var Version = "dev"
+
+// Heartbeat tells the rest service the collector of a cluster is alive
+type Heartbeat struct {
+	Version string `json:"version"`
+	// Informers reports whether the cache of each object type is synced
+	Informers map[string]bool `json:"informers"`
+}
+
+// Heartbeat send a heartbeat of the cluster with the sync status of its informers,
+// the rest service reports clusters without recent heartbeat as stale
+func (c *Cluster) Heartbeat(informers map[string]bool) error {
+	hb := Heartbeat{Version: Version, Informers: informers}
+	status, body := SendJSONQuery(hb, RestSvcEndpoint+"v1.1/cluster/"+c.name()+"/heartbeat", c.name())
+	if status != http.StatusOK {
+		return fmt.Errorf("heartbeat of cluster %s failed with status %d: %s", c.name(), status, string(body))
+	}
+	return nil
+}
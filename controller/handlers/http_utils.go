@@ -1,22 +1,16 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
-	time "time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/client"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	//"reflect"
-	//"github.com/dgraph-io/dgo/y"
-	"net/http/httputil"
 )
 
 // AppNamespace used for only monitor assets in a specific namespace
@@ -37,90 +31,51 @@ type Handler interface {
 	ObjectUpdated(objOld, objNew interface{}) error
 }
 
-// SendJSONQuery send requests to REST api
-func SendJSONQuery(obj interface{}, url string) (int, []byte) {
-	//url := "http://localhost:8011/create"
-
-	s, err := json.Marshal(obj)
-	if err != nil {
-		log.Error("failed to marshal object in SendJSONQuery")
-		log.Error(err)
-	}
-	log.Infof("sent to %s:\n    %s", url, string(s))
-	payload := bytes.NewBuffer(s)
-
-	req, _ := http.NewRequest("POST", url, payload)
-	req.Close = true
-	req.Header.Add("Cache-Control", "no-cache")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", os.Getenv("AUTH_HEADER"))
-	req.Header.Add("clustername", ClusterName)
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Error(err)
-		return 404, nil
-	}
+// restClient of the REST service sending the objects of cluster, a single attempt per request unless opts
+// set a retry
+func restClient(cluster string, opts ...client.Option) *client.Client {
+	return client.New(RestSvcEndpoint, append([]client.Option{
+		client.WithHTTPClient(Client),
+		client.WithAuthorization(os.Getenv("AUTH_HEADER")),
+		client.WithCluster(cluster),
+		client.WithRetry(client.Retry{}),
+	}, opts...)...)
+}
 
-	defer res.Body.Close()
-	body, _ := ioutil.ReadAll(res.Body)
+// SendJSONQuery send requests to REST api
+func SendJSONQuery(obj interface{}, url string, cluster string) (int, []byte) {
+	return send(http.MethodPost, obj, url, cluster)
+}
 
-	log.Infof("%s response %+v\n", url, res)
-	log.Infof("%s body: %s\n", url, string(body))
-	log.Info("*************************************************************************")
-	requestDump, err := httputil.DumpRequest(req, true)
-	if err != nil {
-		fmt.Println(err)
-	}
-	log.Info(string(requestDump))
-	return res.StatusCode, body
+// SendDeleteRequest send request to delete k8s objects, obj is sent as json body if not nil
+func SendDeleteRequest(obj interface{}, url string, cluster string) (int, []byte) {
+	return send(http.MethodDelete, obj, url, cluster)
 }
 
-// SendDeleteRequest send request to delete k8s objects
-func SendDeleteRequest(url string) (int, []byte) {
-	req, _ := http.NewRequest("DELETE", url, nil)
-	req.Close = true
-	req.Header.Add("Cache-Control", "no-cache")
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", os.Getenv("AUTH_HEADER"))
-	// Fetch Request
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Error(err)
-		return 404, nil
-	}
-	defer res.Body.Close()
-	body, _ := ioutil.ReadAll(res.Body)
-	log.Infof("%s response %+v\n", url, res)
-	log.Infof("%s body: %s\n", url, string(body))
-	log.Info("*************************************************************************")
-	requestDump, err := httputil.DumpRequest(req, true)
-	if err != nil {
-		fmt.Println(err)
+// SendJSONQueryWithRetries retry requests if the service is unreachable or unavailable
+func SendJSONQueryWithRetries(obj interface{}, url string, cluster string) ([]byte, error) {
+	status, body := send(http.MethodPost, obj, url, cluster, client.WithRetry(syncRetry))
+	if status == http.StatusOK {
+		return body, nil
 	}
-	log.Info(string(requestDump))
-	return res.StatusCode, body
+	return nil, fmt.Errorf("sending object to %s failed too many times, last status %d: %s", url, status, string(body))
 }
 
-// SendJSONQueryWithRetries retry requests if error occurs
-func SendJSONQueryWithRetries(obj interface{}, url string) ([]byte, error) {
-	// try sending the query 5 times and if it fails
-	status, body := SendJSONQuery(obj, url)
-	maxTries := 5
-	cur := 0
-	for status != 200 && cur < maxTries {
-		time.Sleep(2000 * time.Millisecond)
-		status, body = SendJSONQuery(obj, url)
-		cur = cur + 1
+// send obj to url, return the status and the body of the response, 503 if the service could not be reached
+func send(method string, obj interface{}, url string, cluster string, opts ...client.Option) (int, []byte) {
+	log.Infof("%s %s", method, url)
+	status, body, err := restClient(cluster, opts...).Do(context.Background(), method, url, nil, obj)
+	if e, ok := err.(*client.Error); ok {
+		log.Errorf("%s %s failed: %v", method, url, e)
+		// errors reported in the body of a 200 response get their status
+		return e.StatusCode, e.Body
 	}
-	fmt.Println()
-	time.Sleep(100 * time.Millisecond)
-
-	if status == 200 {
-		return body, nil
+	if err != nil {
+		log.Errorf("%s %s failed: %v", method, url, err)
+		return http.StatusBadRequest, []byte(err.Error())
 	}
-	return nil, errors.New("sending object failed too many times")
-
+	log.Debugf("%s response %d: %s", url, status, string(body))
+	return status, body
 }
 
 // GetKubernetesClient retrieve the Kubernetes cluster client from outside of the cluster
@@ -150,3 +105,24 @@ func GetKubernetesClient() kubernetes.Interface {
 	log.Info("Successfully constructed k8s client")
 	return client
 }
+
+// NewKubernetesClient build the Kubernetes client for the given kubeconfig file and context
+// the current context is used if context is empty, in cluster config is used if kubeconfig is empty
+func NewKubernetesClient(kubeconfig string, context string) (kubernetes.Interface, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig == "" && context == "" {
+		config, err = rest.InClusterConfig()
+	} else {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		if kubeconfig != "" {
+			rules.ExplicitPath = kubeconfig
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/controller/metrics"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// outboxSegmentSize is the size after which a new segment file is started
+	outboxSegmentSize = 16 << 20
+	outboxSegmentExt  = ".log"
+	outboxCursorFile  = "cursor"
+	// outboxMaxRetryInterval caps the wait between deliveries while the rest service is down
+	outboxMaxRetryInterval = time.Minute
+)
+
+// OutboxRecord is an event persisted in the outbox until the rest service accepts it
+type OutboxRecord struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Item BatchItem `json:"item"`
+}
+
+// Outbox is a write ahead queue on disk for the events of a cluster
+// events are appended to segment files and replayed in order to the batch endpoint of the rest service,
+// the sequence of the last delivered event is kept in the cursor file so a restarted collector resumes where it stopped
+type Outbox struct {
+	cluster     string
+	dir         string
+	batchSize   int
+	segmentSize int64
+	mutex       sync.Mutex
+	// first sequence of every segment file in order, the last one is being written
+	segments []uint64
+	writer   *os.File
+	written  int64
+	nextSeq  uint64
+	acked    uint64
+	// reader of the segment starting at readerFirst, readSeq is the last sequence read
+	readerFile  *os.File
+	reader      *bufio.Reader
+	readerFirst uint64
+	readSeq     uint64
+	oldest      time.Time
+	notify      chan struct{}
+}
+
+// NewOutbox open or create the outbox of cluster in dir, events are delivered in batches of up to batchSize
+func NewOutbox(cluster string, dir string, batchSize int) (*Outbox, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	o := &Outbox{
+		cluster:     cluster,
+		dir:         dir,
+		batchSize:   batchSize,
+		segmentSize: outboxSegmentSize,
+		notify:      make(chan struct{}, 1),
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, outboxCursorFile))
+	if err == nil {
+		o.acked, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid outbox cursor in %s: %v", dir, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), outboxSegmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), outboxSegmentExt), 10, 64)
+		if err != nil {
+			log.Warnf("NewOutbox: ignore unknown file %s in %s", f.Name(), dir)
+			continue
+		}
+		o.segments = append(o.segments, first)
+	}
+	sort.Slice(o.segments, func(i, j int) bool { return o.segments[i] < o.segments[j] })
+	o.removeDelivered()
+	if len(o.segments) == 0 {
+		o.segments = []uint64{o.acked + 1}
+	}
+	last := o.segments[len(o.segments)-1]
+	o.nextSeq, o.written, err = recoverSegment(o.segmentPath(last), last)
+	if err != nil {
+		return nil, err
+	}
+	if o.nextSeq <= o.acked {
+		o.nextSeq = o.acked + 1
+	}
+	o.writer, err = os.OpenFile(o.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	o.readSeq = o.acked
+	if o.depth() > 0 {
+		log.Infof("NewOutbox: %d events of cluster %s pending in %s", o.depth(), cluster, dir)
+	}
+	return o, nil
+}
+
+// recoverSegment cut a record partially written before a crash at the end of segment
+// and return the sequence following its last record and the size of the segment
+func recoverSegment(path string, first uint64) (uint64, int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return first, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	next := first
+	size := bytes.LastIndexByte(data, '\n') + 1
+	for _, line := range bytes.Split(data[:size], []byte("\n")) {
+		record := OutboxRecord{}
+		if len(line) > 0 && json.Unmarshal(line, &record) == nil && record.Seq >= next {
+			next = record.Seq + 1
+		}
+	}
+	if size < len(data) {
+		log.Warnf("recoverSegment: truncate partial record at the end of %s", path)
+		err = os.Truncate(path, int64(size))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return next, int64(size), nil
+}
+
+func (o *Outbox) segmentPath(first uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d%s", first, outboxSegmentExt))
+}
+
+// depth returns the number of events not delivered yet
+func (o *Outbox) depth() uint64 {
+	return o.nextSeq - 1 - o.acked
+}
+
+// Add persist item in the outbox, the item is safe on disk when Add returns without error
+func (o *Outbox) Add(item BatchItem) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.writer == nil {
+		return errors.New("outbox of cluster " + o.cluster + " is closed")
+	}
+	record := OutboxRecord{Seq: o.nextSeq, Time: time.Now(), Item: item}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if o.written > 0 && o.written+int64(len(line)) > o.segmentSize {
+		err = o.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	_, err = o.writer.Write(line)
+	if err == nil {
+		err = o.writer.Sync()
+	}
+	if err != nil {
+		// drop what may have been written so the next record starts on a new line
+		o.writer.Truncate(o.written)
+		return err
+	}
+	o.written += int64(len(line))
+	if o.depth() == 0 {
+		o.oldest = record.Time
+	}
+	o.nextSeq++
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rotate close the current segment and start a new one
+func (o *Outbox) rotate() error {
+	err := o.writer.Close()
+	if err != nil {
+		return err
+	}
+	o.writer, err = os.OpenFile(o.segmentPath(o.nextSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		o.writer = nil
+		return err
+	}
+	o.segments = append(o.segments, o.nextSeq)
+	o.written = 0
+	return nil
+}
+
+// read returns up to max events following the last read event
+func (o *Outbox) read(max int) ([]OutboxRecord, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	records := []OutboxRecord{}
+	for len(records) < max && o.readSeq+1 < o.nextSeq {
+		if o.reader == nil {
+			err := o.openReader(o.segmentOf(o.readSeq + 1))
+			if err != nil {
+				return records, err
+			}
+		}
+		line, err := o.reader.ReadBytes('\n')
+		if err == io.EOF {
+			// end of segment, continue with the next one
+			next, ok := o.nextSegment(o.readerFirst)
+			if !ok {
+				break
+			}
+			err = o.openReader(next)
+			if err != nil {
+				return records, err
+			}
+			continue
+		}
+		if err != nil {
+			return records, err
+		}
+		record := OutboxRecord{}
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			log.Errorf("Outbox.read: skip corrupted record in %s: %v", o.segmentPath(o.readerFirst), err)
+			continue
+		}
+		if record.Seq <= o.readSeq {
+			continue
+		}
+		o.readSeq = record.Seq
+		records = append(records, record)
+	}
+	if len(records) > 0 {
+		// events are read once the previous ones are delivered, the first one is the oldest pending
+		o.oldest = records[0].Time
+	}
+	return records, nil
+}
+
+// segmentOf returns the first sequence of the segment holding seq
+func (o *Outbox) segmentOf(seq uint64) uint64 {
+	first := o.segments[0]
+	for _, s := range o.segments {
+		if s > seq {
+			break
+		}
+		first = s
+	}
+	return first
+}
+
+// nextSegment returns the segment following the one starting at first
+func (o *Outbox) nextSegment(first uint64) (uint64, bool) {
+	for _, s := range o.segments {
+		if s > first {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func (o *Outbox) openReader(first uint64) error {
+	o.closeReader()
+	f, err := os.Open(o.segmentPath(first))
+	if err != nil {
+		return err
+	}
+	o.readerFile = f
+	o.reader = bufio.NewReader(f)
+	o.readerFirst = first
+	return nil
+}
+
+func (o *Outbox) closeReader() {
+	if o.readerFile != nil {
+		o.readerFile.Close()
+	}
+	o.readerFile = nil
+	o.reader = nil
+}
+
+// ack record that all events up to seq are delivered and remove the segments no longer needed
+func (o *Outbox) ack(seq uint64) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	tmp := filepath.Join(o.dir, outboxCursorFile+".tmp")
+	err := ioutil.WriteFile(tmp, []byte(strconv.FormatUint(seq, 10)), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(o.dir, outboxCursorFile))
+	if err != nil {
+		return err
+	}
+	o.acked = seq
+	o.removeDelivered()
+	if o.depth() == 0 {
+		o.oldest = time.Time{}
+	}
+	return nil
+}
+
+// removeDelivered delete the segments whose events are all delivered, the last segment is always kept
+func (o *Outbox) removeDelivered() {
+	for len(o.segments) > 1 && o.segments[1] <= o.acked+1 {
+		err := os.Remove(o.segmentPath(o.segments[0]))
+		if err != nil && !os.IsNotExist(err) {
+			log.Errorf("Outbox.removeDelivered: %v", err)
+			return
+		}
+		o.segments = o.segments[1:]
+	}
+}
+
+// Stats returns the number of pending events and the age of the oldest one
+func (o *Outbox) Stats() (uint64, time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.depth() == 0 || o.oldest.IsZero() {
+		return o.depth(), 0
+	}
+	return o.depth(), time.Since(o.oldest)
+}
+
+func (o *Outbox) updateMetrics() {
+	depth, age := o.Stats()
+	metrics.OutboxDepth.WithLabelValues(o.cluster).Set(float64(depth))
+	metrics.OutboxOldestAge.WithLabelValues(o.cluster).Set(age.Seconds())
+}
+
+// Run deliver the events in order until stopCh is closed, delivery is retried with backoff while the service is down
+func (o *Outbox) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	retryInterval := time.Second
+	var inflight []OutboxRecord
+	for {
+		if len(inflight) == 0 {
+			var err error
+			inflight, err = o.read(o.batchSize)
+			if err != nil {
+				log.Errorf("Outbox.Run: failed to read outbox of cluster %s: %v", o.cluster, err)
+			}
+		}
+		if len(inflight) > 0 {
+			n, err := o.deliver(inflight)
+			if n > 0 {
+				ackErr := o.ack(inflight[n-1].Seq)
+				if ackErr != nil {
+					log.Errorf("Outbox.Run: failed to save cursor of cluster %s: %v", o.cluster, ackErr)
+				}
+				inflight = inflight[n:]
+			}
+			if err == nil {
+				retryInterval = time.Second
+				continue
+			}
+			log.Errorf("Outbox.Run: delivery for cluster %s failed, retry in %v: %v", o.cluster, retryInterval, err)
+			o.updateMetrics()
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(retryInterval):
+			}
+			retryInterval *= 2
+			if retryInterval > outboxMaxRetryInterval {
+				retryInterval = outboxMaxRetryInterval
+			}
+			continue
+		}
+		o.updateMetrics()
+		select {
+		case <-stopCh:
+			return
+		case <-o.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver send records to the batch endpoint and returns the number of records done
+// records rejected as invalid are dropped as they would block the outbox forever
+func (o *Outbox) deliver(records []OutboxRecord) (int, error) {
+	items := make([]BatchItem, 0, len(records))
+	for _, record := range records {
+		items = append(items, record.Item)
+	}
+	results, err := SendBatch(items, o.cluster)
+	if err != nil {
+		return 0, err
+	}
+	for i, result := range results {
+		if result.Status == http.StatusOK {
+			continue
+		}
+		if result.Status >= 400 && result.Status < 500 {
+			err := fmt.Errorf("%s rejected with status %d: %s", items[i].Op, result.Status, result.Error)
+			DeadLetters.Add(o.cluster, items[i].ObjType, itemKey(items[i]), 1, err)
+			continue
+		}
+		return i, fmt.Errorf("%s %s failed with status %d: %s", items[i].Op, items[i].ObjType, result.Status, result.Error)
+	}
+	return len(records), nil
+}
+
+// itemKey returns the resourceid of a delete or the namespace/name of an upserted object
+func itemKey(item BatchItem) string {
+	if item.ResourceID != "" {
+		return item.ResourceID
+	}
+	// objects read back from disk are plain maps
+	if obj, ok := item.Object.(map[string]interface{}); ok {
+		if meta, ok := obj["metadata"].(map[string]interface{}); ok {
+			if ns, ok := meta["namespace"].(string); ok && ns != "" {
+				return fmt.Sprintf("%s/%v", ns, meta["name"])
+			}
+			return fmt.Sprintf("%v", meta["name"])
+		}
+	}
+	key, _ := cache.MetaNamespaceKeyFunc(item.Object)
+	return key
+}
+
+// Close release the files of the outbox, pending events stay on disk
+func (o *Outbox) Close() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.closeReader()
+	if o.writer != nil {
+		o.writer.Close()
+		o.writer = nil
+	}
+	metrics.OutboxDepth.DeleteLabelValues(o.cluster)
+	metrics.OutboxOldestAge.DeleteLabelValues(o.cluster)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Redaction actions
+const (
+	// RedactDrop removes the field
+	RedactDrop = "drop"
+	// RedactHash replaces the value with its sha256, values can still be compared
+	RedactHash = "hash"
+	// RedactMask replaces the value with a fixed string
+	RedactMask = "mask"
+)
+
+// maskValue replaces masked values
+const maskValue = "****"
+
+// containerPaths are the pod specs holding containers in each kind
+var containerPaths = map[string]string{
+	"pod":         "spec",
+	"deployment":  "spec.template.spec",
+	"replicaset":  "spec.template.spec",
+	"statefulset": "spec.template.spec",
+}
+
+// DefaultRedactionRules strip env values of containers, the last applied configuration which repeats them, and Secret data
+var DefaultRedactionRules = defaultRedactionRules()
+
+func defaultRedactionRules() []RedactionRule {
+	rules := []RedactionRule{
+		{Kind: "secret", Path: "data", Action: RedactDrop},
+		{Kind: "secret", Path: "stringData", Action: RedactDrop},
+		{Kind: "secret", Path: "metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']", Action: RedactDrop},
+	}
+	for kind, spec := range containerPaths {
+		rules = append(rules,
+			RedactionRule{Kind: kind, Path: spec + ".containers[*].env[*].value", Action: RedactDrop},
+			RedactionRule{Kind: kind, Path: spec + ".initContainers[*].env[*].value", Action: RedactDrop},
+			RedactionRule{Kind: kind, Path: "metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']", Action: RedactDrop},
+		)
+	}
+	return rules
+}
+
+// DefaultRedactor applies DefaultRedactionRules, used by clusters without a Redactor
+var DefaultRedactor, _ = NewRedactor(DefaultRedactionRules)
+
+// RedactionRule transforms the field at Path of objects of Kind before they are sent
+// Path is JSONPath like, e.g. spec.containers[*].env[*].value or metadata.annotations['example.com/token'],
+// a * segment matches all keys of a map
+type RedactionRule struct {
+	// Kind is the object type, e.g. pod
+	Kind string `json:"kind"`
+	// Path of the fields in the json representation of the object
+	Path string `json:"path"`
+	// Action is drop, hash or mask
+	Action string `json:"action"`
+
+	segments []pathSegment
+}
+
+// pathSegment is a map key, an array index or a wildcard
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath split a JSONPath like expression in segments
+func parsePath(path string) ([]pathSegment, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	segments := []pathSegment{}
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+		case '[':
+			end := strings.Index(p, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in path %s", path)
+			}
+			s := p[1:end]
+			p = p[end+1:]
+			switch {
+			case s == "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+				segments = append(segments, pathSegment{key: s[1 : len(s)-1]})
+			default:
+				i, err := strconv.Atoi(s)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("invalid index [%s] in path %s", s, path)
+				}
+				segments = append(segments, pathSegment{index: i, isIndex: true})
+			}
+		default:
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			key := p[:end]
+			p = p[end:]
+			segments = append(segments, pathSegment{key: key, wildcard: key == "*"})
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return segments, nil
+}
+
+// Redactor applies redaction rules to objects before they leave the collector
+type Redactor struct {
+	rules map[string][]RedactionRule
+}
+
+// NewRedactor validate rules and build a redactor applying them
+func NewRedactor(rules []RedactionRule) (*Redactor, error) {
+	r := &Redactor{rules: make(map[string][]RedactionRule)}
+	for _, rule := range rules {
+		if rule.Kind == "" {
+			return nil, fmt.Errorf("missing kind in redaction rule for path %s", rule.Path)
+		}
+		switch rule.Action {
+		case RedactDrop, RedactHash, RedactMask:
+		default:
+			return nil, fmt.Errorf("invalid action %q in redaction rule for %s %s", rule.Action, rule.Kind, rule.Path)
+		}
+		segments, err := parsePath(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path in redaction rule for %s: %v", rule.Kind, err)
+		}
+		rule.segments = segments
+		kind := strings.ToLower(rule.Kind)
+		r.rules[kind] = append(r.rules[kind], rule)
+	}
+	return r, nil
+}
+
+// Redact returns obj with the rules of objType applied, obj is returned as is if objType has no rule
+// otherwise a generic json representation of obj is returned, obj itself is never modified
+func (r *Redactor) Redact(objType string, obj interface{}) (interface{}, error) {
+	rules := r.rules[objType]
+	if len(rules) == 0 {
+		return obj, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		doc = redactNode(doc, rule.segments, rule.Action)
+	}
+	return doc, nil
+}
+
+// redactNode applies action to the fields matching segments under node and returns the updated node
+func redactNode(node interface{}, segments []pathSegment, action string) interface{} {
+	seg := segments[0]
+	last := len(segments) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if seg.isIndex {
+			return n
+		}
+		keys := []string{seg.key}
+		if seg.wildcard {
+			keys = keys[:0]
+			for k := range n {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			v, ok := n[k]
+			if !ok {
+				continue
+			}
+			switch {
+			case !last:
+				n[k] = redactNode(v, segments[1:], action)
+			case action == RedactDrop:
+				delete(n, k)
+			default:
+				n[k] = redactValue(v, action)
+			}
+		}
+		return n
+	case []interface{}:
+		if !seg.wildcard && !seg.isIndex {
+			return n
+		}
+		result := n[:0]
+		for i, v := range n {
+			if seg.isIndex && i != seg.index {
+				result = append(result, v)
+				continue
+			}
+			switch {
+			case !last:
+				result = append(result, redactNode(v, segments[1:], action))
+			case action == RedactDrop:
+			default:
+				result = append(result, redactValue(v, action))
+			}
+		}
+		return result
+	}
+	return node
+}
+
+// redactValue returns the hashed or masked value
+func redactValue(v interface{}, action string) interface{} {
+	if action == RedactMask {
+		return maskValue
+	}
+	s, ok := v.(string)
+	if !ok {
+		data, _ := json.Marshal(v)
+		s = string(data)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// redact applies the redaction rules of the cluster, DefaultRedactor if none set
+func (c *Cluster) redact(objType string, obj interface{}) (interface{}, error) {
+	r := DefaultRedactor
+	if c != nil && c.Redactor != nil {
+		r = c.Redactor
+	}
+	return r.Redact(objType, obj)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Digest identifies an object and its version, the rest service compares digests with the stored objects
+type Digest = client.Digest
+
+// DigestResult lists the objects the rest service found stale or missing, and the ones it deleted
+type DigestResult = client.DigestResult
+
+// syncRetry of the digests, the unavailable service is retried for 10s
+var syncRetry = client.Retry{Max: 5, Wait: 2 * time.Second, MaxWait: 2 * time.Second}
+
+// sync send the digest of all objects of objType in the cluster, the rest service deletes the objects
+// not in the digest and replies which objects are stale or missing, only those are sent again
+func (c *Cluster) sync(objType string, objs []interface{}) error {
+	digest := []Digest{}
+	byID := make(map[string]interface{})
+	for _, obj := range objs {
+		if !c.allows(objType, obj) {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			continue
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			continue
+		}
+		rid := c.resourceID(objType, key)
+		digest = append(digest, Digest{ResourceID: rid, ResourceVersion: m.GetResourceVersion()})
+		byID[rid] = obj
+	}
+	result, err := restClient(c.name(), client.WithRetry(syncRetry)).SyncDigest(context.Background(), objType, digest)
+	if err != nil {
+		return fmt.Errorf("%s digest failed: %v", objType, err)
+	}
+	log.Infof("Cluster.sync: %d %s objects in %s, %d stale, %d missing, %d deleted",
+		len(digest), objType, c.name(), len(result.Stale), len(result.Missing), len(result.Deleted))
+
+	failed := 0
+	var lastErr error
+	for _, rid := range append(result.Stale, result.Missing...) {
+		obj, ok := byID[rid]
+		if !ok {
+			continue
+		}
+		err = c.upsert(objType, obj)
+		if err != nil {
+			failed++
+			lastErr = err
+			log.Errorf("Cluster.sync: failed to send %s: %v", rid, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d %s objects failed to sync, last error: %v", failed, len(result.Stale)+len(result.Missing), objType, lastErr)
+	}
+	return nil
+}
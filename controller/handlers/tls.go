@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Client sends the requests to the REST service, replaced by ConfigureTLS
+var Client = http.DefaultClient
+
+// ConfigureTLS make the requests to the REST service trust the CA bundle caFile, the system roots if empty,
+// and present the client certificate certFile with its key keyFile if set (mTLS)
+func ConfigureTLS(caFile, certFile, keyFile string) error {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     config,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConns:        100,
+	}
+	Client = &http.Client{Transport: transport}
+	batchClient = &http.Client{Transport: transport, Timeout: time.Minute}
+	return nil
+}
@@ -0,0 +1,133 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/intuit/katlas/controller/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Config of the leader election for a watched cluster
+type Config struct {
+	// Namespace and Name of the coordination Lease
+	Namespace string
+	Name      string
+	// Identity of this replica in the Lease
+	Identity string
+	// LeaseDuration is how long standbys wait before taking over a lease not renewed
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader retries to renew before giving up leadership
+	RenewDeadline time.Duration
+	// RetryPeriod is the wait between two attempts to acquire or renew
+	RetryPeriod time.Duration
+}
+
+// invalidNameChars are the characters not allowed in a Lease name
+var invalidNameChars = regexp.MustCompile("[^a-z0-9.-]+")
+
+// LeaseName returns the name of the Lease electing the leader of cluster
+func LeaseName(cluster string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(cluster), "-")
+	return strings.Trim("katlas-collector-"+name, "-.")
+}
+
+// NewConfig returns the leader election config of cluster
+// the Lease is created in LEADER_ELECTION_NAMESPACE, default to POD_NAMESPACE then default,
+// durations are read from LEADER_ELECTION_LEASE_DURATION, LEADER_ELECTION_RENEW_DEADLINE and LEADER_ELECTION_RETRY_PERIOD
+func NewConfig(cluster string) Config {
+	namespace := os.Getenv("LEADER_ELECTION_NAMESPACE")
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "katlas-collector"
+	}
+	return Config{
+		Namespace:     namespace,
+		Name:          LeaseName(cluster),
+		Identity:      fmt.Sprintf("%s_%d", hostname, os.Getpid()),
+		LeaseDuration: durationFromEnv("LEADER_ELECTION_LEASE_DURATION", 15*time.Second),
+		RenewDeadline: durationFromEnv("LEADER_ELECTION_RENEW_DEADLINE", 10*time.Second),
+		RetryPeriod:   durationFromEnv("LEADER_ELECTION_RETRY_PERIOD", 2*time.Second),
+	}
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || d <= 0 {
+		return defaultValue
+	}
+	return d
+}
+
+// Run campaign for the Lease until stopCh is closed, lead is called each time this replica becomes leader
+// with a channel closed when the leadership is lost, the replica then goes back to standby and campaigns again
+func Run(client kubernetes.Interface, config Config, stopCh <-chan struct{}, lead func(leadCh <-chan struct{})) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: config.Namespace,
+			Name:      config.Name,
+		},
+		Client: client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: config.Identity,
+		},
+	}
+	logger := log.WithField("lease", config.Namespace+"/"+config.Name)
+	for {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: config.LeaseDuration,
+			RenewDeadline: config.RenewDeadline,
+			RetryPeriod:   config.RetryPeriod,
+			Name:          config.Name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logger.Infof("leader.Run: %s started leading", config.Identity)
+					metrics.Leader.WithLabelValues(config.Name).Set(1)
+					lead(ctx.Done())
+				},
+				OnStoppedLeading: func() {
+					logger.Infof("leader.Run: %s is not leading", config.Identity)
+					metrics.Leader.WithLabelValues(config.Name).Set(0)
+				},
+				OnNewLeader: func(identity string) {
+					logger.Infof("leader.Run: %s is the leader", identity)
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		// returns when the leadership is lost or stopCh is closed
+		elector.Run(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	handlers "github.com/intuit/katlas/controller/handlers"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	cache "k8s.io/client-go/tools/cache"
@@ -15,6 +20,17 @@ import (
 	"k8s.io/client-go/util/workqueue"
 )
 
+// maxRetries of failed events before they go to the dead letters, set by MAX_RETRIES
+var maxRetries = getMaxRetries()
+
+func getMaxRetries() int {
+	n, err := strconv.Atoi(os.Getenv("MAX_RETRIES"))
+	if err != nil || n < 0 {
+		return 5
+	}
+	return n
+}
+
 // GetKubernetesClient retrieve the Kubernetes cluster client from outside of the cluster
 func GetKubernetesClient() kubernetes.Interface {
 	// construct the path to resolve to `~/.kube/config`
@@ -45,9 +61,7 @@ func GetKubernetesClient() kubernetes.Interface {
 }
 
 // CreateController to build handler base on type
-func CreateController(objType string) *Controller {
-	client := GetKubernetesClient()
-
+func CreateController(objType string, client kubernetes.Interface, cluster *handlers.Cluster) *Controller {
 	var informer cache.SharedIndexInformer
 	var handlerc handlers.Handler
 
@@ -56,41 +70,54 @@ func CreateController(objType string) *Controller {
 	// so that it can be handled in the handler
 	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
 
+	// construct the Controller object which has all of the necessary components to
+	// handle logging, connections, informing (listing and watching), the queue,
+	// and the handler
+	controller := &Controller{
+		logger:      log.WithField("cluster", cluster.Name),
+		clientset:   client,
+		queue:       queue,
+		name:        objType,
+		cluster:     cluster.Name,
+		maxRetries:  maxRetries,
+		finalStates: make(map[string]interface{}),
+	}
+
 	switch objType {
 	case "Pod":
 		// create the informer so that we can not only list resources
 		// but also watch them for all pods in the default namespace
-		informer = handlers.GetPodInformer(client)
+		informer = handlers.GetPodInformer(client, cluster)
 
 		// add event handlers to handle the three types of events for resources:
 		//  - adding new resources
 		//  - updating existing resources
 		//  - deleting resources
-		handlerc = &handlers.PodHandler{}
+		handlerc = &handlers.PodHandler{Cluster: cluster}
 		//return informer
 	case "Service":
-		informer = handlers.GetServiceInformer(client)
-		handlerc = &handlers.ServiceHandler{}
+		informer = handlers.GetServiceInformer(client, cluster)
+		handlerc = &handlers.ServiceHandler{Cluster: cluster}
 
 	case "Namespace":
-		informer = handlers.GetNamespaceInformer(client)
-		handlerc = &handlers.NamespaceHandler{}
+		informer = handlers.GetNamespaceInformer(client, cluster)
+		handlerc = &handlers.NamespaceHandler{Cluster: cluster}
 
 	case "Deployment":
-		informer = handlers.GetDeploymentInformer(client)
-		handlerc = &handlers.DeploymentHandler{}
+		informer = handlers.GetDeploymentInformer(client, cluster)
+		handlerc = &handlers.DeploymentHandler{Cluster: cluster}
 
 	case "ReplicaSet":
-		informer = handlers.GetReplicaSetInformer(client)
-		handlerc = &handlers.ReplicaSetHandler{}
+		informer = handlers.GetReplicaSetInformer(client, cluster)
+		handlerc = &handlers.ReplicaSetHandler{Cluster: cluster}
 
 	case "Ingress":
-		informer = handlers.GetIngressInformer(client)
-		handlerc = &handlers.IngressHandler{}
+		informer = handlers.GetIngressInformer(client, cluster)
+		handlerc = &handlers.IngressHandler{Cluster: cluster}
 
 	case "StatefulSet":
-		informer = handlers.GetStatefulSetInformer(client)
-		handlerc = &handlers.StatefulSetHandler{}
+		informer = handlers.GetStatefulSetInformer(client, cluster)
+		handlerc = &handlers.StatefulSetHandler{Cluster: cluster}
 	}
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -120,73 +147,176 @@ func CreateController(objType string) *Controller {
 			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 			log.Infof("Delete %s: %s", objType, key)
 			if err == nil {
+				// keep the final state, the object is gone from the indexer when the key is processed
+				controller.setFinalState(key, obj)
 				queue.Add(key)
 			}
 		},
 	})
 
-	// construct the Controller object which has all of the necessary components to
-	// handle logging, connections, informing (listing and watching), the queue,
-	// and the handler
-	controller := Controller{
-		logger:    log.NewEntry(log.New()),
-		clientset: client,
-		informer:  informer,
-		queue:     queue,
-		handler:   handlerc,
-		name:      objType,
+	controller.informer = informer
+	controller.handler = handlerc
+
+	return controller
+}
+
+// synchronizers sync the objects of each type with the database
+var synchronizers = map[string]func(kubernetes.Interface, *handlers.Cluster){
+	"Namespace":   handlers.NamespaceSynchronize,
+	"StatefulSet": handlers.StatefulSetSynchronize,
+	"Deployment":  handlers.DeploymentSynchronize,
+	"ReplicaSet":  handlers.ReplicaSetSynchronize,
+	"Pod":         handlers.PodSynchronize,
+	"Service":     handlers.ServiceSynchronize,
+	"Ingress":     handlers.IngressSynchronize,
+}
+
+// syncInterval returns the sync interval of objType from SYNC_INTERVAL_<TYPE>, e.g. SYNC_INTERVAL_POD,
+// default to SYNC_INTERVAL then 1h
+func syncInterval(objType string) time.Duration {
+	for _, name := range []string{"SYNC_INTERVAL_" + strings.ToUpper(objType), "SYNC_INTERVAL"} {
+		if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+			return d
+		}
+	}
+	return time.Hour
+}
+
+// Synchronizer periodically sync resources of a cluster with database until stopCh is closed
+// every object type is synced on its own interval, see syncInterval
+func Synchronizer(client kubernetes.Interface, cluster *handlers.Cluster, stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, objType := range objTypes {
+		wg.Add(1)
+		go func(objType string, interval time.Duration) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(interval):
+				}
+				synchronizers[objType](client, cluster)
+			}
+		}(objType, syncInterval(objType))
 	}
+	wg.Wait()
+}
 
-	return &controller
+// heartbeatInterval returns the interval of heartbeats from HEARTBEAT_INTERVAL, default 1m
+func heartbeatInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("HEARTBEAT_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Minute
 }
 
-// Synchronizer periodically sync resources with database
-func Synchronizer() {
-	client := GetKubernetesClient()
+// Heartbeats send a heartbeat of the cluster with the sync status of the informers
+// of the controllers every heartbeatInterval until stopCh is closed
+func Heartbeats(cluster *handlers.Cluster, controllers []*Controller, stopCh <-chan struct{}) {
+	interval := heartbeatInterval()
 	for {
-		time.Sleep(time.Hour)
-		handlers.NamespaceSynchronize(client)
-		handlers.StatefulSetSynchronize(client)
-		handlers.DeploymentSynchronize(client)
-		handlers.ReplicaSetSynchronize(client)
-		handlers.PodSynchronize(client)
-		handlers.ServiceSynchronize(client)
-		handlers.IngressSynchronize(client)
+		informers := make(map[string]bool, len(controllers))
+		for _, controller := range controllers {
+			informers[strings.ToLower(controller.name)] = controller.HasSynced()
+		}
+		err := cluster.Heartbeat(informers)
+		if err != nil {
+			log.Errorf("Heartbeats: %v", err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
 	}
 }
 
+// serveMetrics expose prometheus metrics and dead letters of the collector on METRICS_ADDR, default :8012
+func serveMetrics() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		addr = ":8012"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/prometheus_metrics", promhttp.Handler())
+	mux.Handle("/deadletters", handlers.DeadLetters)
+	log.Infof("Metrics served on %s", addr)
+	log.Error(http.ListenAndServe(addr, mux))
+}
+
 // main code path
 func main() {
 
 	log.Info("Current namespace: ", os.Getenv("AppNamespace"))
-	podcontroller := CreateController("Pod")
-	svccontroller := CreateController("Service")
-	nscontroller := CreateController("Namespace")
-	depcontroller := CreateController("Deployment")
-	rscontroller := CreateController("ReplicaSet")
-	ingcontroller := CreateController("Ingress")
-	sscontroller := CreateController("StatefulSet")
 
 	// use a channel to synchronize the finalization for a graceful shutdown
 	stopCh := make(chan struct{})
-	defer close(stopCh)
 
 	// log.SetLevel(log.DebugLevel)
 
-	// start sync task
-	go Synchronizer()
-	// run the controller loop to process items
-	go podcontroller.Run(stopCh)
-	go svccontroller.Run(stopCh)
-	go nscontroller.Run(stopCh)
-	go depcontroller.Run(stopCh)
-	go rscontroller.Run(stopCh)
-	go ingcontroller.Run(stopCh)
-	go sscontroller.Run(stopCh)
+	go serveMetrics()
+
+	// trust a private CA and authenticate with a client certificate (mTLS) to the REST service
+	if caFile, certFile, keyFile := os.Getenv("CA_BUNDLE"), os.Getenv("CLIENT_CERT"), os.Getenv("CLIENT_KEY"); caFile != "" || certFile != "" {
+		if err := handlers.ConfigureTLS(caFile, certFile, keyFile); err != nil {
+			log.Fatalf("failed to load tls config: %v", err)
+		}
+	}
+
+	if path := os.Getenv("REDACTION_CONFIG"); path != "" {
+		r, err := LoadRedactor(path)
+		if err != nil {
+			log.Fatalf("failed to load redaction rules %s: %v", path, err)
+		}
+		redactor = r
+	}
+
+	// with leader election, replicas compete for a lease per watched cluster in the cluster the collector runs in
+	var leaseClient kubernetes.Interface
+	if os.Getenv("LEADER_ELECTION") == "true" {
+		leaseClient = GetKubernetesClient()
+	}
+
+	// closed once all watchers are stopped
+	done := make(chan struct{})
+	if path := os.Getenv("CLUSTERS_CONFIG"); path != "" {
+		// watch every cluster listed in the config file, clusters can be
+		// added or removed from the file without restarting the others
+		manager := NewClusterManager(path, leaseClient)
+		go func() {
+			manager.Run(stopCh)
+			close(done)
+		}()
+	} else {
+		// single cluster mode, watch the cluster the collector runs in
+		config := ClusterConfig{Name: handlers.ClusterName}
+		if path := os.Getenv("FILTER_CONFIG"); path != "" {
+			filter, err := LoadFilter(path)
+			if err != nil {
+				log.Fatalf("failed to load filter %s: %v", path, err)
+			}
+			config.Filter = filter
+		}
+		watcher, err := NewClusterWatcher(config, GetKubernetesClient(), leaseClient)
+		if err != nil {
+			log.Fatalf("failed to create watcher for cluster %s: %v", handlers.ClusterName, err)
+		}
+		watcher.Start()
+		go func() {
+			<-stopCh
+			watcher.Stop()
+			close(done)
+		}()
+	}
 	// use a channel to handle OS signals to terminate and gracefully shut
 	// down processing
 	sigTerm := make(chan os.Signal, 1)
 	signal.Notify(sigTerm, syscall.SIGTERM)
 	signal.Notify(sigTerm, syscall.SIGINT)
 	<-sigTerm
+	// wait for the watchers to stop so the outboxes save their cursor and the batchers flush
+	log.Info("Stopping, waiting for the cluster watchers")
+	close(stopCh)
+	<-done
 }
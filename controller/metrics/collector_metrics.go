@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//Track Collector related Metrics
+
+var (
+	//OutboxDepth ...The number of events waiting in the outbox of a cluster
+	OutboxDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "katlas_collector_outbox_depth",
+		Help: "The number of events waiting in the outbox of a cluster",
+	}, []string{"cluster"})
+	//OutboxOldestAge ...The age in seconds of the oldest event waiting in the outbox of a cluster
+	OutboxOldestAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "katlas_collector_outbox_oldest_age_seconds",
+		Help: "The age in seconds of the oldest event waiting in the outbox of a cluster",
+	}, []string{"cluster"})
+	//DeadLetters ...The total number of events given up after all retries failed
+	DeadLetters = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "katlas_collector_dead_letters",
+		Help: "The total number of events given up after all retries failed",
+	}, []string{"cluster", "objtype"})
+	//Leader ...Whether this replica leads the collection behind a lease, 1 if leading
+	Leader = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "katlas_collector_leader",
+		Help: "Whether this replica leads the collection behind a lease, 1 if leading",
+	}, []string{"lease"})
+)
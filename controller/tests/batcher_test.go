@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+)
+
+// batchServer records the received batches and fails the items of objtype "fail"
+type batchServer struct {
+	batches [][]handlers.BatchItem
+	mutex   sync.Mutex
+}
+
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	items := []handlers.BatchItem{}
+	json.NewDecoder(r.Body).Decode(&items)
+	s.mutex.Lock()
+	s.batches = append(s.batches, items)
+	s.mutex.Unlock()
+	results := []handlers.BatchResult{}
+	code := http.StatusOK
+	for i, item := range items {
+		if item.ObjType == "fail" {
+			results = append(results, handlers.BatchResult{Index: i, Status: http.StatusInternalServerError, Error: "failed"})
+			code = http.StatusMultiStatus
+			continue
+		}
+		results = append(results, handlers.BatchResult{Index: i, Status: http.StatusOK})
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": code, "objects": results})
+}
+
+// withBatchServer point the handlers to a batchServer, call the returned func to restore
+func withBatchServer() (*batchServer, func()) {
+	s := &batchServer{}
+	server := httptest.NewServer(s)
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = server.URL + "/"
+	return s, func() {
+		handlers.RestSvcEndpoint = endpoint
+		server.Close()
+	}
+}
+
+func TestBatcherCoalesce(t *testing.T) {
+	s, done := withBatchServer()
+	defer done()
+
+	b := handlers.NewBatcher(testcluster, time.Hour, 100)
+	b.Add("pod/ns/a", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	b.Add("pod/ns/b", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	b.Add("pod/ns/a", handlers.BatchItem{Op: handlers.OpDelete, ObjType: "pod", ResourceID: "pod:testcluster:ns:a"})
+	if b.Len() != 2 {
+		t.Errorf("expected 2 pending items, got %d", b.Len())
+	}
+
+	err := b.Flush()
+	if err != nil {
+		t.Errorf("error flushing batch: %v", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("expected no pending items after flush, got %d", b.Len())
+	}
+	if len(s.batches) != 1 || len(s.batches[0]) != 2 {
+		t.Fatalf("expected a single batch of 2 items, got %v", s.batches)
+	}
+	// the delete replaced the first upsert but kept its position
+	if s.batches[0][0].Op != handlers.OpDelete || s.batches[0][1].Op != handlers.OpUpsert {
+		t.Errorf("unexpected batch content: %v", s.batches[0])
+	}
+}
+
+func TestBatcherMaxSize(t *testing.T) {
+	s, done := withBatchServer()
+	defer done()
+
+	b := handlers.NewBatcher(testcluster, time.Hour, 2)
+	b.Add("pod/ns/a", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	if len(s.batches) != 0 {
+		t.Errorf("expected no batch before max size is reached, got %d", len(s.batches))
+	}
+	b.Add("pod/ns/b", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	if len(s.batches) != 1 || b.Len() != 0 {
+		t.Errorf("expected batch to be flushed when max size is reached")
+	}
+}
+
+func TestBatcherRetryFailedItems(t *testing.T) {
+	s, done := withBatchServer()
+	defer done()
+
+	b := handlers.NewBatcher(testcluster, time.Hour, 100)
+	b.Add("pod/ns/a", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	b.Add("fail/ns/b", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "fail"})
+
+	err := b.Flush()
+	if err == nil {
+		t.Error("expected error for failed batch item")
+	}
+	// only the failed item is kept for the next batch
+	if b.Len() != 1 {
+		t.Errorf("expected 1 pending item after failure, got %d", b.Len())
+	}
+	b.Flush()
+	if len(s.batches) != 2 || len(s.batches[1]) != 1 || s.batches[1][0].ObjType != "fail" {
+		t.Errorf("expected failed item to be resent alone, got %v", s.batches)
+	}
+
+	// failed item is dropped after the retry limit
+	for i := 0; i < 10; i++ {
+		b.Flush()
+	}
+	if b.Len() != 0 {
+		t.Errorf("expected failed item to be dropped, got %d pending", b.Len())
+	}
+	letters := handlers.DeadLetters.List()
+	if len(letters) == 0 || letters[len(letters)-1].Key != "fail/ns/b" {
+		t.Errorf("expected dropped item in dead letters, got %v", letters)
+	}
+}
+
+func TestBatcherServiceDown(t *testing.T) {
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = "http://127.0.0.1:1/"
+	defer func() { handlers.RestSvcEndpoint = endpoint }()
+
+	b := handlers.NewBatcher(testcluster, time.Hour, 100)
+	b.Add("pod/ns/a", handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	err := b.Flush()
+	if err == nil {
+		t.Error("expected error when service is down")
+	}
+	if b.Len() != 1 {
+		t.Errorf("expected item to be kept when service is down, got %d pending", b.Len())
+	}
+}
@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/intuit/katlas/controller/handlers"
@@ -151,3 +153,52 @@ func TestGetKubernetesClient(t *testing.T) {
 	}
 
 }
+
+var testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster1
+  cluster:
+    server: https://cluster1.example.com
+- name: cluster2
+  cluster:
+    server: https://cluster2.example.com
+contexts:
+- name: context1
+  context:
+    cluster: cluster1
+    user: user1
+- name: context2
+  context:
+    cluster: cluster2
+    user: user2
+current-context: context1
+users:
+- name: user1
+  user:
+    token: token1
+- name: user2
+  user:
+    token: token2
+`
+
+func TestNewKubernetesClient(t *testing.T) {
+	f, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testKubeconfig)
+	f.Close()
+
+	for _, context := range []string{"", "context1", "context2"} {
+		client, err := handlers.NewKubernetesClient(f.Name(), context)
+		if err != nil || client == nil {
+			t.Errorf("failed to create client for context %q: %v", context, err)
+		}
+	}
+	_, err = handlers.NewKubernetesClient(f.Name(), "unknown")
+	if err == nil {
+		t.Error("expected error for unknown context")
+	}
+}
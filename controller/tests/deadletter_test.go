@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/intuit/katlas/controller/handlers"
+)
+
+func TestDeadLetterList(t *testing.T) {
+	l := handlers.NewDeadLetterList(2)
+	l.Add(testcluster, "pod", "ns/a", 6, errors.New("error a"))
+	l.Add(testcluster, "pod", "ns/b", 6, errors.New("error b"))
+	l.Add(testcluster, "service", "ns/c", 6, errors.New("error c"))
+
+	// oldest letters are discarded when the list is full
+	letters := l.List()
+	if len(letters) != 2 || letters[0].Key != "ns/b" || letters[1].Key != "ns/c" {
+		t.Errorf("unexpected dead letters: %v", letters)
+	}
+	if letters[1].ObjType != "service" || letters[1].Error != "error c" || letters[1].Cluster != testcluster {
+		t.Errorf("unexpected dead letter: %v", letters[1])
+	}
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest("GET", "/deadletters", nil))
+	resp := struct {
+		Objects []handlers.DeadLetter `json:"objects"`
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil || len(resp.Objects) != 2 {
+		t.Errorf("unexpected dead letters response: %s", w.Body.String())
+	}
+}
+
+// setFailureMode switch the failure mode of the test server
+func setFailureMode(t *testing.T, enabled bool) {
+	status, body := handlers.SendJSONQuery(nil, handlers.RestSvcEndpoint+"testing/fail?enabled="+strconv.FormatBool(enabled), testcluster)
+	if status != 200 {
+		t.Fatalf("failed to set failure mode of test server: %d %s", status, string(body))
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	podhandler := handlers.PodHandler{Cluster: &handlers.Cluster{Name: testcluster}}
+	pod := podtests[0].in
+
+	setFailureMode(t, true)
+	defer setFailureMode(t, false)
+	err := podhandler.ObjectCreated(pod)
+	if err == nil {
+		t.Error("expected error creating pod while the service fails")
+	}
+	err = podhandler.ObjectDeleted(nil, pod.Namespace+"/"+pod.Name)
+	if err == nil {
+		t.Error("expected error deleting pod while the service fails")
+	}
+
+	setFailureMode(t, false)
+	err = podhandler.ObjectCreated(pod)
+	if err != nil {
+		t.Errorf("error creating pod : %v", err)
+	}
+	err = podhandler.ObjectDeleted(nil, pod.Namespace+"/"+pod.Name)
+	if err != nil {
+		t.Errorf("error deleting pod : %v", err)
+	}
+}
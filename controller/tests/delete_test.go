@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteServer records the deletes received on /v1.1/entity
+func deleteServer(deletes *[]handlers.BatchItem) (*httptest.Server, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/v1.1/entity" {
+			http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		item := handlers.BatchItem{}
+		json.NewDecoder(r.Body).Decode(&item)
+		*deletes = append(*deletes, item)
+		w.WriteHeader(http.StatusOK)
+	}))
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = server.URL + "/"
+	return server, func() {
+		handlers.RestSvcEndpoint = endpoint
+		server.Close()
+	}
+}
+
+func TestDeleteWithFinalState(t *testing.T) {
+	deletes := []handlers.BatchItem{}
+	_, done := deleteServer(&deletes)
+	defer done()
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-0#1",
+			Namespace:       "team-a",
+			UID:             "6f1a2b3c",
+			ResourceVersion: "42",
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name: "web",
+			Env:  []v1.EnvVar{{Name: "PASSWORD", Value: "secret"}},
+		}}},
+	}
+	podhandler := handlers.PodHandler{Cluster: &handlers.Cluster{Name: testcluster}}
+	err := podhandler.ObjectDeleted(pod, "team-a/web-0#1")
+	if err != nil {
+		t.Fatalf("error deleting pod: %v", err)
+	}
+	if len(deletes) != 1 {
+		t.Fatalf("expected 1 delete, got %d", len(deletes))
+	}
+	d := deletes[0]
+	if d.ObjType != "pod" || d.ResourceID != "pod:testcluster:team-a:web-0#1" {
+		t.Errorf("unexpected objtype %s or resourceid %s", d.ObjType, d.ResourceID)
+	}
+	if d.K8sUID != "6f1a2b3c" || d.ResourceVersion != "42" {
+		t.Errorf("expected uid 6f1a2b3c and resourceversion 42, got %s and %s", d.K8sUID, d.ResourceVersion)
+	}
+	if d.Object == nil {
+		t.Error("expected the final state of the pod to be sent")
+	}
+	if s := jsonString(t, d.Object); s == "" || strings.Contains(s, `"value":"secret"`) {
+		t.Errorf("expected final state to be redacted, got %s", s)
+	}
+
+	// the final state is unknown, e.g. the collector restarted before processing the delete
+	err = podhandler.ObjectDeleted(nil, "team-a/web-1")
+	if err != nil {
+		t.Fatalf("error deleting pod: %v", err)
+	}
+	if len(deletes) != 2 || deletes[1].ResourceID != "pod:testcluster:team-a:web-1" || deletes[1].Object != nil {
+		t.Errorf("expected delete by resourceid only, got %+v", deletes[1:])
+	}
+}
+
+func TestDeleteBatched(t *testing.T) {
+	s, done := withBatchServer()
+	defer done()
+
+	cluster := &handlers.Cluster{Name: testcluster, Batcher: handlers.NewBatcher(testcluster, time.Hour, 100)}
+	svchandler := handlers.ServiceHandler{Cluster: cluster}
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a", UID: "abc", ResourceVersion: "7"}}
+	err := svchandler.ObjectDeleted(svc, "team-a/web")
+	if err != nil {
+		t.Fatalf("error deleting service: %v", err)
+	}
+	cluster.Batcher.Flush()
+	if len(s.batches) != 1 || len(s.batches[0]) != 1 {
+		t.Fatalf("expected a single batch of 1 item, got %v", s.batches)
+	}
+	item := s.batches[0][0]
+	if item.Op != handlers.OpDelete || item.K8sUID != "abc" || item.ResourceVersion != "7" {
+		t.Errorf("unexpected batch item %+v", item)
+	}
+}
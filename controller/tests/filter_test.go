@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testfilter = &handlers.Filter{
+	IncludeNamespaces: []string{"team-*", "default"},
+	ExcludeNamespaces: []string{"team-secret*"},
+	LabelSelectors:    map[string]string{"pod": "app=web"},
+}
+
+func filterPod(name, namespace string, labels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			ResourceVersion: "1",
+			Labels:          labels,
+		},
+	}
+}
+
+func TestFilterAllowsNamespace(t *testing.T) {
+	namespaces := map[string]bool{
+		"default":       true,
+		"team-a":        true,
+		"team-secret":   false,
+		"team-secret-b": false,
+		"kube-system":   false,
+	}
+	for namespace, expected := range namespaces {
+		if allowed := testfilter.AllowsNamespace(namespace); allowed != expected {
+			t.Errorf("expected namespace %s allowed %v, got %v", namespace, expected, allowed)
+		}
+	}
+	var nofilter *handlers.Filter
+	if !nofilter.AllowsNamespace("kube-system") {
+		t.Error("expected all namespaces allowed without filter")
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	if err := testfilter.Validate(); err != nil {
+		t.Errorf("unexpected error validating filter: %v", err)
+	}
+	invalid := []*handlers.Filter{
+		{IncludeNamespaces: []string{"team-["}},
+		{LabelSelectors: map[string]string{"pod": "app in (web"}},
+		{FieldSelectors: map[string]string{"pod": "status.phase"}},
+	}
+	for _, filter := range invalid {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("expected error validating filter %+v", filter)
+		}
+	}
+}
+
+func TestFilterObjectCreated(t *testing.T) {
+	cluster := &handlers.Cluster{
+		Name:    testcluster,
+		Batcher: handlers.NewBatcher(testcluster, time.Hour, 100),
+		Filter:  testfilter,
+		NamespaceLabels: func(namespace string) (map[string]string, bool) {
+			if namespace == "team-optout" {
+				return map[string]string{handlers.IgnoreLabel: "true"}, true
+			}
+			return nil, false
+		},
+	}
+	podhandler := handlers.PodHandler{Cluster: cluster}
+	podhandler.ObjectCreated(filterPod("kept", "team-a", nil))
+	podhandler.ObjectCreated(filterPod("excluded", "team-secret", nil))
+	podhandler.ObjectCreated(filterPod("notincluded", "kube-system", nil))
+	podhandler.ObjectCreated(filterPod("ignored", "team-optout", nil))
+	if cluster.Batcher.Len() != 1 {
+		t.Errorf("expected only 1 pod to be sent, got %d", cluster.Batcher.Len())
+	}
+
+	nshandler := handlers.NamespaceHandler{Cluster: cluster}
+	nshandler.ObjectCreated(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:            "team-b",
+		ResourceVersion: "1",
+		Labels:          map[string]string{handlers.IgnoreLabel: "true"},
+	}})
+	if cluster.Batcher.Len() != 1 {
+		t.Errorf("expected namespace with %s label not to be sent, got %d items", handlers.IgnoreLabel, cluster.Batcher.Len())
+	}
+}
+
+func TestFilterSynchronize(t *testing.T) {
+	s, done := withSyncServer(nil)
+	defer done()
+
+	web := map[string]string{"app": "web"}
+	client := fake.NewSimpleClientset(
+		filterPod("web", "team-a", web),
+		filterPod("db", "team-a", map[string]string{"app": "db"}),
+		filterPod("secret", "team-secret", web),
+		filterPod("system", "kube-system", web),
+	)
+	handlers.PodSynchronize(client, &handlers.Cluster{Name: testcluster, Filter: testfilter})
+
+	if len(s.digests) != 1 || len(s.digests[0]) != 1 || s.digests[0][0].ResourceID != "pod:testcluster:team-a:web" {
+		t.Errorf("expected only pod web in the digest, got %v", s.digests)
+	}
+	if names := s.upsertedNames(); len(names) != 1 || names[0] != "web" {
+		t.Errorf("expected only pod web to be synced, got %v", names)
+	}
+}
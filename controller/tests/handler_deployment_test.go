@@ -94,11 +94,11 @@ func TestDeployment(t *testing.T) {
 		}
 	}
 
-	handlers.DeploymentSynchronize(client)
+	handlers.DeploymentSynchronize(client, &handlers.Cluster{Name: testcluster})
 
 	t.Log("Deployments synced")
 
-	deploymentinformer := handlers.GetDeploymentInformer(client)
+	deploymentinformer := handlers.GetDeploymentInformer(client, nil)
 	if deploymentinformer == nil {
 		t.Error("error creating deployment informer")
 	}
@@ -77,11 +77,11 @@ func TestIngress(t *testing.T) {
 		}
 	}
 
-	handlers.IngressSynchronize(client)
+	handlers.IngressSynchronize(client, &handlers.Cluster{Name: testcluster})
 
 	t.Log("Ingresses synced")
 
-	ingressinformer := handlers.GetIngressInformer(client)
+	ingressinformer := handlers.GetIngressInformer(client, nil)
 	if ingressinformer == nil {
 		t.Error("error creating ingress informer")
 	}
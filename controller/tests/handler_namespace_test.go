@@ -53,12 +53,12 @@ func TestNamespace(t *testing.T) {
 	for i, test := range namespacetests {
 		_ = i
 		testnamespace := test.in
-		a, err := client.Core().Namespaces().Create(testnamespace)
+		a, err := client.CoreV1().Namespaces().Create(testnamespace)
 		if err != nil {
 			t.Errorf("error injecting namespace add: %v", err)
 		}
 
-		listnamespaces, err := client.Core().Namespaces().List(metav1.ListOptions{})
+		listnamespaces, err := client.CoreV1().Namespaces().List(metav1.ListOptions{})
 
 		t.Logf("Namespaces: %s\n", listnamespaces.String())
 
@@ -72,10 +72,10 @@ func TestNamespace(t *testing.T) {
 		}
 	}
 
-	handlers.NamespaceSynchronize(client)
+	handlers.NamespaceSynchronize(client, &handlers.Cluster{Name: testcluster})
 	t.Log("Namespaces synced")
 
-	namespaceinformer := handlers.GetNamespaceInformer(client)
+	namespaceinformer := handlers.GetNamespaceInformer(client, nil)
 	if namespaceinformer == nil {
 		t.Error("error creating namespace informer")
 	}
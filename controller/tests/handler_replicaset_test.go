@@ -86,10 +86,10 @@ func TestReplicaSet(t *testing.T) {
 		}
 	}
 
-	handlers.ReplicaSetSynchronize(client)
+	handlers.ReplicaSetSynchronize(client, &handlers.Cluster{Name: testcluster})
 	t.Log("ReplicaSets synced")
 
-	replicasetinformer := handlers.GetReplicaSetInformer(client)
+	replicasetinformer := handlers.GetReplicaSetInformer(client, nil)
 	if replicasetinformer == nil {
 		t.Error("error creating replicaset informer")
 	}
@@ -77,10 +77,10 @@ func TestStatefulset(t *testing.T) {
 		}
 	}
 
-	handlers.StatefulSetSynchronize(client)
+	handlers.StatefulSetSynchronize(client, &handlers.Cluster{Name: testcluster})
 	t.Log("StatefulSets synced")
 
-	statefulsetinformer := handlers.GetStatefulSetInformer(client)
+	statefulsetinformer := handlers.GetStatefulSetInformer(client, nil)
 	if statefulsetinformer == nil {
 		t.Error("error creating statefulset informer")
 	}
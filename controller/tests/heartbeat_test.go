@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/intuit/katlas/controller/handlers"
+)
+
+func TestHeartbeat(t *testing.T) {
+	var path, clusterHeader string
+	hb := handlers.Heartbeat{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		clusterHeader = r.Header.Get("clustername")
+		json.NewDecoder(r.Body).Decode(&hb)
+		w.Write([]byte(`{"status":200}`))
+	}))
+	defer server.Close()
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = server.URL + "/"
+	defer func() { handlers.RestSvcEndpoint = endpoint }()
+
+	cluster := &handlers.Cluster{Name: testcluster}
+	err := cluster.Heartbeat(map[string]bool{"pod": true, "service": false})
+	if err != nil {
+		t.Fatalf("error sending heartbeat: %v", err)
+	}
+	if path != "/v1.1/cluster/testcluster/heartbeat" || clusterHeader != testcluster {
+		t.Errorf("unexpected heartbeat path %s or cluster %s", path, clusterHeader)
+	}
+	if hb.Version != handlers.Version || !hb.Informers["pod"] || hb.Informers["service"] {
+		t.Errorf("unexpected heartbeat %+v", hb)
+	}
+
+	server.Close()
+	if err := cluster.Heartbeat(nil); err == nil {
+		t.Error("expected error when the rest service is unreachable")
+	}
+}
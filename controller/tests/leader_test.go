@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/leader"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testLeaderConfig(identity string) leader.Config {
+	return leader.Config{
+		Namespace:     "default",
+		Name:          leader.LeaseName(testcluster),
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+}
+
+// leaders tracks which replicas are leading
+type leaders struct {
+	leading map[string]bool
+	mutex   sync.Mutex
+}
+
+func (l *leaders) run(client *fake.Clientset, identity string, stopCh <-chan struct{}) {
+	go leader.Run(client, testLeaderConfig(identity), stopCh, func(leadCh <-chan struct{}) {
+		l.mutex.Lock()
+		l.leading[identity] = true
+		l.mutex.Unlock()
+		<-leadCh
+		l.mutex.Lock()
+		l.leading[identity] = false
+		l.mutex.Unlock()
+	})
+}
+
+// current returns the replicas leading
+func (l *leaders) current() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	ids := []string{}
+	for id, leading := range l.leading {
+		if leading {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// waitFor poll until identity is the only leader or timeout
+func (l *leaders) waitFor(identity string) bool {
+	for i := 0; i < 50; i++ {
+		ids := l.current()
+		if len(ids) == 1 && ids[0] == identity {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestLeaderElection(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	l := &leaders{leading: map[string]bool{}}
+	stop1 := make(chan struct{})
+	stop2 := make(chan struct{})
+	defer close(stop2)
+
+	l.run(client, "replica1", stop1)
+	if !l.waitFor("replica1") {
+		t.Fatalf("expected replica1 to lead, leaders are %v", l.current())
+	}
+	l.run(client, "replica2", stop2)
+
+	// the standby does not take over while the leader renews the lease
+	time.Sleep(2 * time.Second)
+	if ids := l.current(); len(ids) != 1 || ids[0] != "replica1" {
+		t.Errorf("expected replica1 to keep leading, leaders are %v", ids)
+	}
+
+	// the standby takes over once the leader stops
+	close(stop1)
+	if !l.waitFor("replica2") {
+		t.Errorf("expected replica2 to take over, leaders are %v", l.current())
+	}
+}
+
+func TestLeaderInvalidConfig(t *testing.T) {
+	config := testLeaderConfig("replica1")
+	config.RenewDeadline = 2 * config.LeaseDuration
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	err := leader.Run(fake.NewSimpleClientset(), config, stopCh, func(leadCh <-chan struct{}) {})
+	if err == nil {
+		t.Error("expected error for renew deadline longer than lease duration")
+	}
+}
+
+func TestLeaseName(t *testing.T) {
+	names := map[string]string{
+		"minikube":               "katlas-collector-minikube",
+		"Prod_West/2":            "katlas-collector-prod-west-2",
+		"cluster.k8s.local":      "katlas-collector-cluster.k8s.local",
+		"admins@dev-cluster-ppd": "katlas-collector-admins-dev-cluster-ppd",
+	}
+	for cluster, expected := range names {
+		if name := leader.LeaseName(cluster); name != expected {
+			t.Errorf("expected lease name %s for cluster %s, got %s", expected, cluster, name)
+		}
+	}
+}
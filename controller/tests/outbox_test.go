@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+)
+
+// waitForDepth poll the outbox until depth events are pending or timeout
+func waitForDepth(o *handlers.Outbox, depth uint64) bool {
+	for i := 0; i < 50; i++ {
+		if d, _ := o.Stats(); d == depth {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestOutboxReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// service is down, events are kept on disk
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = "http://127.0.0.1:1/"
+	o, err := handlers.NewOutbox(testcluster, dir, 100)
+	if err != nil {
+		t.Fatalf("error creating outbox: %v", err)
+	}
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		o.Run(stopCh)
+		close(stopped)
+	}()
+	o.Add(handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+	o.Add(handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "service"})
+	o.Add(handlers.BatchItem{Op: handlers.OpDelete, ObjType: "pod", ResourceID: "pod:testcluster:ns:a"})
+	time.Sleep(200 * time.Millisecond)
+	depth, age := o.Stats()
+	if depth != 3 || age <= 0 {
+		t.Errorf("expected 3 pending events with an age, got %d %v", depth, age)
+	}
+	close(stopCh)
+	<-stopped
+	o.Close()
+	handlers.RestSvcEndpoint = endpoint
+
+	// restarted collector replays the events in order once the service is back
+	s, done := withBatchServer()
+	defer done()
+	o, err = handlers.NewOutbox(testcluster, dir, 100)
+	if err != nil {
+		t.Fatalf("error reopening outbox: %v", err)
+	}
+	if depth, _ := o.Stats(); depth != 3 {
+		t.Errorf("expected 3 pending events after restart, got %d", depth)
+	}
+	stopCh = make(chan struct{})
+	go o.Run(stopCh)
+	if !waitForDepth(o, 0) {
+		t.Fatal("outbox not drained")
+	}
+	close(stopCh)
+	s.mutex.Lock()
+	items := []handlers.BatchItem{}
+	for _, batch := range s.batches {
+		items = append(items, batch...)
+	}
+	s.mutex.Unlock()
+	if len(items) != 3 || items[0].ObjType != "pod" || items[1].ObjType != "service" || items[2].Op != handlers.OpDelete {
+		t.Errorf("unexpected events replayed: %v", items)
+	}
+
+	// delivered events are not replayed again
+	o, err = handlers.NewOutbox(testcluster, dir, 100)
+	if err != nil {
+		t.Fatalf("error reopening outbox: %v", err)
+	}
+	if depth, _ := o.Stats(); depth != 0 {
+		t.Errorf("expected no pending events, got %d", depth)
+	}
+}
+
+func TestOutboxPartialRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	o, err := handlers.NewOutbox(testcluster, dir, 100)
+	if err != nil {
+		t.Fatalf("error creating outbox: %v", err)
+	}
+	o.Add(handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "pod"})
+
+	// simulate a crash in the middle of a write
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(segments) != 1 {
+		t.Fatalf("expected a single segment, got %v", segments)
+	}
+	f, _ := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte(`{"seq":2,"ti`))
+	f.Close()
+
+	o, err = handlers.NewOutbox(testcluster, dir, 100)
+	if err != nil {
+		t.Fatalf("error reopening outbox: %v", err)
+	}
+	o.Add(handlers.BatchItem{Op: handlers.OpUpsert, ObjType: "service"})
+	if depth, _ := o.Stats(); depth != 2 {
+		t.Errorf("expected 2 pending events, got %d", depth)
+	}
+
+	s, done := withBatchServer()
+	defer done()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go o.Run(stopCh)
+	if !waitForDepth(o, 0) {
+		t.Fatal("outbox not drained")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.batches) != 1 || len(s.batches[0]) != 2 {
+		t.Errorf("expected the 2 complete events in one batch, got %v", s.batches)
+	}
+}
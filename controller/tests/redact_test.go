@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func redactPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web",
+			Namespace:       "team-a",
+			ResourceVersion: "1",
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"password":"secret"}`,
+				"example.com/token": "token",
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  "web",
+				Image: "web:1",
+				Env: []v1.EnvVar{
+					{Name: "PASSWORD", Value: "secret"},
+					{Name: "FROM_SECRET", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{Key: "password"}}},
+				},
+			}},
+		},
+	}
+}
+
+// jsonString returns the json encoding of obj
+func jsonString(t *testing.T, obj interface{}) string {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("error marshaling %v: %v", obj, err)
+	}
+	return string(data)
+}
+
+func TestRedactDefaultRules(t *testing.T) {
+	pod := redactPod()
+	obj, err := handlers.DefaultRedactor.Redact("pod", pod)
+	if err != nil {
+		t.Fatalf("error redacting pod: %v", err)
+	}
+	s := jsonString(t, obj)
+	if strings.Contains(s, `"value":"secret"`) || strings.Contains(s, "last-applied-configuration") {
+		t.Errorf("expected env values and last applied configuration to be dropped, got %s", s)
+	}
+	for _, kept := range []string{"PASSWORD", "FROM_SECRET", "secretKeyRef", "web:1", "example.com/token"} {
+		if !strings.Contains(s, kept) {
+			t.Errorf("expected %s to be kept, got %s", kept, s)
+		}
+	}
+	// the original object is not modified
+	if pod.Spec.Containers[0].Env[0].Value != "secret" {
+		t.Error("expected original pod to be unchanged")
+	}
+
+	secret := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "creds"},
+		"data":     map[string]interface{}{"password": "c2VjcmV0"},
+	}
+	obj, err = handlers.DefaultRedactor.Redact("secret", secret)
+	if err != nil {
+		t.Fatalf("error redacting secret: %v", err)
+	}
+	if s := jsonString(t, obj); strings.Contains(s, "c2VjcmV0") {
+		t.Errorf("expected secret data to be dropped, got %s", s)
+	}
+
+	// kinds without rules are sent as is
+	service := &v1.Service{}
+	if obj, _ := handlers.DefaultRedactor.Redact("service", service); obj != service {
+		t.Errorf("expected service to be unchanged, got %v", obj)
+	}
+}
+
+func TestRedactActions(t *testing.T) {
+	r, err := handlers.NewRedactor([]handlers.RedactionRule{
+		{Kind: "pod", Path: "$.metadata.annotations['example.com/token']", Action: handlers.RedactHash},
+		{Kind: "pod", Path: "spec.containers[0].image", Action: handlers.RedactMask},
+		{Kind: "pod", Path: "spec.containers[*].env[1]", Action: handlers.RedactDrop},
+	})
+	if err != nil {
+		t.Fatalf("error creating redactor: %v", err)
+	}
+	obj, err := r.Redact("pod", redactPod())
+	if err != nil {
+		t.Fatalf("error redacting pod: %v", err)
+	}
+	s := jsonString(t, obj)
+	// sha256 of "token"
+	if !strings.Contains(s, "sha256:3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0") {
+		t.Errorf("expected annotation to be hashed, got %s", s)
+	}
+	if !strings.Contains(s, `"image":"****"`) {
+		t.Errorf("expected image to be masked, got %s", s)
+	}
+	if strings.Contains(s, "FROM_SECRET") || !strings.Contains(s, "PASSWORD") {
+		t.Errorf("expected only the second env var to be dropped, got %s", s)
+	}
+}
+
+func TestRedactInvalidRules(t *testing.T) {
+	invalid := []handlers.RedactionRule{
+		{Path: "data", Action: handlers.RedactDrop},
+		{Kind: "pod", Path: "spec", Action: "encrypt"},
+		{Kind: "pod", Path: "", Action: handlers.RedactDrop},
+		{Kind: "pod", Path: "spec.containers[x]", Action: handlers.RedactDrop},
+		{Kind: "pod", Path: "spec.containers[0", Action: handlers.RedactDrop},
+	}
+	for _, rule := range invalid {
+		if _, err := handlers.NewRedactor([]handlers.RedactionRule{rule}); err == nil {
+			t.Errorf("expected error for rule %+v", rule)
+		}
+	}
+}
+
+func TestRedactSent(t *testing.T) {
+	s, done := withSyncServer(nil)
+	defer done()
+
+	cluster := &handlers.Cluster{Name: testcluster}
+	podhandler := handlers.PodHandler{Cluster: cluster}
+	err := podhandler.ObjectCreated(redactPod())
+	if err != nil {
+		t.Errorf("error creating pod: %v", err)
+	}
+	handlers.PodSynchronize(fake.NewSimpleClientset(redactPod()), cluster)
+	if len(s.upserts) != 2 {
+		t.Fatalf("expected an upsert by event and one by sync, got %d", len(s.upserts))
+	}
+	for _, body := range s.upserts {
+		if strings.Contains(body, `"value":"secret"`) || !strings.Contains(body, "PASSWORD") {
+			t.Errorf("expected env values to be redacted, got %s", body)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/intuit/katlas/controller/handlers"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// syncServer answers digests from its stored versions like the rest service and records the upserted objects
+type syncServer struct {
+	stored  map[string]string
+	digests [][]handlers.Digest
+	upserts []string
+	mutex   sync.Mutex
+}
+
+func (s *syncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if strings.HasSuffix(r.URL.Path, "/digest") {
+		digest := []handlers.Digest{}
+		json.NewDecoder(r.Body).Decode(&digest)
+		s.digests = append(s.digests, digest)
+		result := handlers.DigestResult{Stale: []string{}, Missing: []string{}, Deleted: []string{}}
+		source := map[string]bool{}
+		for _, d := range digest {
+			source[d.ResourceID] = true
+			version, ok := s.stored[d.ResourceID]
+			if !ok {
+				result.Missing = append(result.Missing, d.ResourceID)
+				continue
+			}
+			v1, _ := strconv.Atoi(d.ResourceVersion)
+			v2, _ := strconv.Atoi(version)
+			if v1 > v2 {
+				result.Stale = append(result.Stale, d.ResourceID)
+			}
+		}
+		for rid := range s.stored {
+			if !source[rid] {
+				result.Deleted = append(result.Deleted, rid)
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	s.upserts = append(s.upserts, string(body))
+	w.WriteHeader(http.StatusOK)
+}
+
+// upsertedNames returns the sorted names of the upserted objects
+func (s *syncServer) upsertedNames() []string {
+	names := []string{}
+	for _, body := range s.upserts {
+		obj := v1.Pod{}
+		json.Unmarshal([]byte(body), &obj)
+		names = append(names, obj.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withSyncServer point the handlers to a syncServer storing the given versions, call the returned func to restore
+func withSyncServer(stored map[string]string) (*syncServer, func()) {
+	s := &syncServer{stored: stored}
+	server := httptest.NewServer(s)
+	endpoint := handlers.RestSvcEndpoint
+	handlers.RestSvcEndpoint = server.URL + "/"
+	return s, func() {
+		handlers.RestSvcEndpoint = endpoint
+		server.Close()
+	}
+}
+
+func syncPod(name, version string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", ResourceVersion: version}}
+}
+
+func TestSyncDigest(t *testing.T) {
+	s, done := withSyncServer(map[string]string{
+		"pod:testcluster:team-a:uptodate": "5",
+		"pod:testcluster:team-a:stale":    "5",
+		"pod:testcluster:team-a:gone":     "5",
+	})
+	defer done()
+
+	client := fake.NewSimpleClientset(syncPod("uptodate", "5"), syncPod("stale", "6"), syncPod("new", "1"))
+	handlers.PodSynchronize(client, &handlers.Cluster{Name: testcluster})
+
+	if len(s.digests) != 1 || len(s.digests[0]) != 3 {
+		t.Fatalf("expected a single digest of 3 pods, got %v", s.digests)
+	}
+	for _, d := range s.digests[0] {
+		if !strings.HasPrefix(d.ResourceID, "pod:testcluster:team-a:") || d.ResourceVersion == "" {
+			t.Errorf("unexpected digest entry %+v", d)
+		}
+	}
+	// only stale and missing objects are sent
+	if names := s.upsertedNames(); len(names) != 2 || names[0] != "new" || names[1] != "stale" {
+		t.Errorf("expected pods new and stale to be sent, got %v", names)
+	}
+}
+
+func TestSyncUpToDate(t *testing.T) {
+	s, done := withSyncServer(map[string]string{"pod:testcluster:team-a:uptodate": "5"})
+	defer done()
+
+	handlers.PodSynchronize(fake.NewSimpleClientset(syncPod("uptodate", "5")), &handlers.Cluster{Name: testcluster})
+	if len(s.upserts) != 0 {
+		t.Errorf("expected no object to be sent, got %v", s.upserts)
+	}
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/controller/handlers"
+)
+
+// issueCert create a certificate for cn signed by parent, a self signed CA if parent is nil
+func issueCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tls")
+	defer os.RemoveAll(dir)
+	ca, caKey := issueCert(t, "katlas-ca", nil, nil)
+	serverCert, serverKey := issueCert(t, "katlas-service", ca, caKey)
+	client, clientKey := issueCert(t, testcluster, ca, caKey)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", ca.Raw)
+	writePEM(t, filepath.Join(dir, "client.pem"), "CERTIFICATE", client.Raw)
+	keyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	writePEM(t, filepath.Join(dir, "client-key.pem"), "EC PRIVATE KEY", keyDER)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	var commonName string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonName = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Write([]byte(`{"status":200}`))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+	client0 := handlers.Client
+	defer func() { handlers.Client = client0 }()
+
+	// the service certificate is not trusted by the system roots
+	if status, _ := handlers.SendJSONQuery(map[string]string{}, server.URL+"/v1.1/entity", testcluster); status != http.StatusServiceUnavailable {
+		t.Errorf("expected the request without ca bundle to fail, got %d", status)
+	}
+	// trusted but without client certificate
+	if err := handlers.ConfigureTLS(filepath.Join(dir, "ca.pem"), "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := handlers.SendJSONQuery(map[string]string{}, server.URL+"/v1.1/entity", testcluster); status != http.StatusServiceUnavailable {
+		t.Errorf("expected the request without client certificate to fail, got %d", status)
+	}
+	err := handlers.ConfigureTLS(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := handlers.SendJSONQuery(map[string]string{}, server.URL+"/v1.1/entity", testcluster); status != http.StatusOK {
+		t.Errorf("mTLS request failed with %d: %s", status, body)
+	}
+	if commonName != testcluster {
+		t.Errorf("unexpected client certificate %s", commonName)
+	}
+
+	if err := handlers.ConfigureTLS(filepath.Join(dir, "missing.pem"), "", ""); err == nil {
+		t.Error("expected error for a missing ca bundle")
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
 	//"github.com/dgraph-io/dgo/y"
@@ -17,6 +19,10 @@ import (
 
 var inCluster = false
 
+// failRequests makes the entity, delete and batch endpoints fail with 500 while set, see Fail
+var failRequests = os.Getenv("FAIL_REQUESTS") == "true"
+var failMutex sync.RWMutex
+
 type baseStruct struct {
 	Name         string `json:"name"`
 	Objtype      string `json:"objtype,omitempty"`
@@ -208,12 +214,128 @@ func DeleteHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// BatchHandler acknowledges every item of a batch
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+	var items []map[string]interface{}
+	err = json.Unmarshal(body, &items)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "Failed to convert to JSON output", http.StatusBadRequest)
+		return
+	}
+	log.Infof("batch of %d items received", len(items))
+	results := make([]map[string]interface{}, 0, len(items))
+	for i := range items {
+		results = append(results, map[string]interface{}{"index": i, "status": http.StatusOK})
+	}
+	ret, _ := json.Marshal(map[string]interface{}{"status": http.StatusOK, "objects": results})
+	w.Write(ret)
+}
+
+// EntityHandlerV1_1 acknowledges an object sent by the collector
+func EntityHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "error reading body", http.StatusBadRequest)
+		return
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(body, &obj)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, "Failed to convert to JSON output", http.StatusBadRequest)
+		return
+	}
+	objtype := r.URL.Query().Get("objtype")
+	log.Infof("%s received", objtype)
+	w.Write([]byte("object " + objtype + " successfully received in entity"))
+}
+
+// DeleteHandlerV1_1 acknowledges a delete with the last known state of the object
+func DeleteHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req["objtype"] == nil || req["resourceid"] == nil {
+		http.Error(w, "objtype and resourceid are required", http.StatusBadRequest)
+		return
+	}
+	log.Infof("delete of %v version %v received", req["resourceid"], req["resourceversion"])
+	w.Write([]byte(fmt.Sprintf("object %v successfully received for delete", req["resourceid"])))
+}
+
+// DigestHandler reports every object of a digest as missing so the collector sends them all
+func DigestHandler(w http.ResponseWriter, r *http.Request) {
+	var digest []map[string]string
+	err := json.NewDecoder(r.Body).Decode(&digest)
+	if err != nil {
+		http.Error(w, "Failed to convert to JSON output", http.StatusBadRequest)
+		return
+	}
+	missing := []string{}
+	for _, d := range digest {
+		missing = append(missing, d["resourceid"])
+	}
+	log.Infof("%s digest of %d objects received", mux.Vars(r)["metadata"], len(digest))
+	ret, _ := json.Marshal(map[string]interface{}{"status": http.StatusOK, "stale": []string{}, "missing": missing, "deleted": []string{}})
+	w.Write(ret)
+}
+
+// HeartbeatHandler acknowledges the heartbeat of a cluster
+func HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	var hb map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&hb)
+	if err != nil {
+		http.Error(w, "Failed to convert to JSON output", http.StatusBadRequest)
+		return
+	}
+	log.Infof("heartbeat of cluster %s version %v received", mux.Vars(r)["name"], hb["version"])
+	ret, _ := json.Marshal(map[string]interface{}{"status": http.StatusOK})
+	w.Write(ret)
+}
+
+// Fail switch the failure mode on or off so tests can check how the collector handles errors
+// e.g. POST /testing/fail?enabled=true
+func Fail(w http.ResponseWriter, r *http.Request) {
+	failMutex.Lock()
+	failRequests = r.URL.Query().Get("enabled") == "true"
+	failMutex.Unlock()
+	log.Infof("failure mode set to %v", r.URL.Query().Get("enabled") == "true")
+	w.Write([]byte("failure mode set"))
+}
+
+// failing wraps handler to return 500 while the failure mode is on
+func failing(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		failMutex.RLock()
+		fail := failRequests
+		failMutex.RUnlock()
+		if fail {
+			http.Error(w, "failure mode is on", http.StatusInternalServerError)
+			return
+		}
+		handler(w, r)
+	}
+}
+
 func serve() {
 	router := mux.NewRouter()
-	router.HandleFunc("/v1/entity/{metadata}", EntityHandler).Methods("GET", "POST", "DELETE")
+	router.HandleFunc("/v1/entity/{metadata}", failing(EntityHandler)).Methods("GET", "POST", "DELETE")
 	router.HandleFunc("/v1/query", QueryHandler).Methods("GET", "POST")
 	router.HandleFunc("/v1/sync", SyncHandler).Methods("GET", "POST")
-	router.HandleFunc("/v1/entity/{metadata}/{resourceid}", DeleteHandler).Methods("DELETE")
+	router.HandleFunc("/v1/entity/{metadata}/{resourceid}", failing(DeleteHandler)).Methods("DELETE")
+	router.HandleFunc("/v1.1/entity", failing(EntityHandlerV1_1)).Methods("POST")
+	router.HandleFunc("/v1.1/entity", failing(DeleteHandlerV1_1)).Methods("DELETE")
+	router.HandleFunc("/v1.1/entities:batch", failing(BatchHandler)).Methods("POST")
+	router.HandleFunc("/v1.1/sync/{metadata}/digest", failing(DigestHandler)).Methods("POST")
+	router.HandleFunc("/v1.1/cluster/{name}/heartbeat", failing(HeartbeatHandler)).Methods("POST")
+	router.HandleFunc("/testing/fail", Fail).Methods("POST")
 	router.HandleFunc("/health", Health).Methods("GET")
 	log.Infof("Service started on port 8011")
 	if inCluster {
@@ -1,22 +1,24 @@
 package apis
 
 import (
+	"context"
 	//"fmt"
 	"testing"
 
-	log "github.com/Sirupsen/logrus"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/intuit/katlas/service/db"
 	"github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
 func init() {
 	dc := db.NewDGClient("127.0.0.1:9080")
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
 }
 
 func TestMetricsDgraphNumKeywordQueries(t *testing.T) {
@@ -35,7 +37,7 @@ func TestMetricsDgraphNumKeywordQueries(t *testing.T) {
 	m := map[string][]string{
 		"keyword": {"pod"},
 	}
-	_, _ = s.GetQueryResult(m)
+	_, _ = s.GetQueryResult(context.Background(), m)
 
 	expectedDgraphNumKeywordQueries := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumKeywordQueries)
@@ -53,7 +55,7 @@ func TestMetricsDgraphNumKeyValueQueries(t *testing.T) {
 	m := map[string][]string{
 		"name": {"pod01"},
 	}
-	_, _ = s.GetQueryResult(m)
+	_, _ = s.GetQueryResult(context.Background(), m)
 
 	expectedDgraphNumKeyValueQueries := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumKeyValueQueries)
@@ -70,7 +72,7 @@ func TestMetricsDgraphNumQSL(t *testing.T) {
 	q := `
                 cluster{*}
         `
-	_, _ = qslSvc.CreateDgraphQuery(q, false)
+	_, _ = qslSvc.CreateDgraphQuery(context.Background(), q, false)
 
 	expectedDgraphNumQSL := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumQSL)
@@ -88,8 +90,8 @@ func TestMetricsDgraphCreateEntity(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid, _ := s.CreateEntity("k8snode", node)
-	defer s.DeleteEntity(nid)
+	nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
+	defer s.DeleteEntity(context.Background(), nid)
 	expectedDgraphNumCreateEntity := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumCreateEntity)
 	assert.Equal(t, expectedDgraphNumCreateEntity, nextCounter-prevCounter, "DgraphNumCreateEntity is not equal to expected.")
@@ -106,9 +108,9 @@ func TestMetricsDgraphGetEntity(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid, _ := s.CreateEntity("k8snode", node)
-	defer s.DeleteEntity(nid)
-	_, _ = s.GetEntity(nid)
+	nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
+	defer s.DeleteEntity(context.Background(), nid)
+	_, _ = s.GetEntity(context.Background(), nid)
 
 	expectedDgraphNumGetEntity := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumGetEntity)
@@ -126,10 +128,10 @@ func TestMetricsDgraphUpdateEntity(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid, _ := s.CreateEntity("k8snode", node)
-	defer s.DeleteEntity(nid)
+	nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
+	defer s.DeleteEntity(context.Background(), nid)
 	update := make(map[string]interface{})
-	s.UpdateEntity(nid, update)
+	s.UpdateEntity(context.Background(), nid, update)
 
 	expectedDgraphNumUpdateEntity := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumUpdateEntity)
@@ -150,8 +152,8 @@ func TestMetricsDgraphDeleteEntity(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid, _ := s.CreateEntity("k8snode", node)
-	s.DeleteEntity(nid)
+	nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
+	s.DeleteEntity(context.Background(), nid)
 	expectedDgraphNumDeleteEntity = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumDeleteEntity)
 	assert.Equal(t, expectedDgraphNumDeleteEntity, nextCounter-prevCounter, "DgraphNumDeleteEntity is not equal to expected.")
@@ -164,8 +166,8 @@ func TestMetricsDgraphDeleteEntity(t *testing.T) {
 		"name":       "test-node-metrics",
 		"resourceid": "noderid",
 	}
-	s.CreateEntity("k8snode", nodenew)
-	_ = s.DeleteEntityByResourceID("k8snode", "noderid")
+	s.CreateEntity(context.Background(), "k8snode", nodenew)
+	_ = s.DeleteEntityByResourceID(context.Background(), "k8snode", "noderid")
 	expectedDgraphNumDeleteEntity = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumDeleteEntity)
 	assert.Equal(t, expectedDgraphNumDeleteEntity, nextCounter-prevCounter, "DgraphNumDeleteEntity is not equal to expected.")
@@ -179,7 +181,7 @@ func TestMetricsDgraphUpdateEdge(t *testing.T) {
 	defer dc.Close()
 	s := NewEntityService(dc)
 	var pid, nid string
-	s.CreateOrDeleteEdge("k8spod", pid, "k8snode", nid, "runsOn", 0)
+	s.CreateOrDeleteEdge(context.Background(), "k8spod", pid, "k8snode", nid, "runsOn", 0)
 
 	expectedDgraphNumUpdateEdge := 1.0
 	nextCounter := util.ReadCounter(metrics.DgraphNumUpdateEdge)
@@ -0,0 +1,249 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/intuit/katlas/service/metrics"
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// StaleAfter is the time without heartbeat after which a cluster is stale
+var StaleAfter = 5 * time.Minute
+
+// Heartbeat is posted periodically by the collector of a cluster
+type Heartbeat struct {
+	// Version of the collector
+	Version string `json:"version"`
+	// Informers reports whether the cache of each object type is synced
+	Informers map[string]bool `json:"informers"`
+}
+
+// RecordHeartbeat store the time the collector of the cluster was last seen with its version and informers status,
+// the cluster is created if it does not exist yet
+func (s *ClusterService) RecordHeartbeat(ctx context.Context, name string, hb Heartbeat) (map[string]interface{}, error) {
+	cluster, err := s.GetCluster(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	informers, _ := json.Marshal(hb.Informers)
+	data := map[string]interface{}{
+		util.LastSeen:         now(),
+		util.CollectorVersion: hb.Version,
+		util.InformersSynced:  string(informers),
+	}
+	if cluster == nil {
+		data[util.ObjType] = util.Cluster
+		data[util.Name] = name
+		data[util.ResourceID] = util.Cluster + ":" + name
+		_, err = NewEntityService(s.dbclient).CreateEntity(ctx, util.Cluster, data)
+	} else {
+		err = s.updateCluster(ctx, cluster[util.UID].(string), data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.staleMu.Lock()
+	if s.stale[name] {
+		delete(s.stale, name)
+		metrics.KatlasStaleClusters.Set(float64(len(s.stale)))
+		log.Infof("cluster %s is not stale anymore", name)
+	}
+	s.staleMu.Unlock()
+	data[util.Name] = name
+	return data, nil
+}
+
+// CheckSnapshot return ErrSnapshotOutdated if a snapshot of the cluster taken after taken was ingested, so an older
+// snapshot is refused before it reverts the cluster, or ErrPurgeRunning while the cluster is purged
+func (s *ClusterService) CheckSnapshot(ctx context.Context, name string, taken time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.snapshotCluster(ctx, name, taken)
+	return err
+}
+
+// RecordSnapshot store the time a snapshot of the cluster was taken once it is ingested, the cluster is created
+// if it does not exist yet. It is checked again so the time of a newer snapshot ingested meanwhile is kept
+func (s *ClusterService) RecordSnapshot(ctx context.Context, name string, taken time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster, err := s.snapshotCluster(ctx, name, taken)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		util.SnapshotTime: taken.UTC().Format(time.RFC3339),
+	}
+	if cluster == nil {
+		data[util.ObjType] = util.Cluster
+		data[util.Name] = name
+		data[util.ResourceID] = util.Cluster + ":" + name
+		_, err = NewEntityService(s.dbclient).CreateEntity(ctx, util.Cluster, data)
+		return err
+	}
+	return s.updateCluster(ctx, cluster[util.UID].(string), data)
+}
+
+// snapshotCluster return the cluster a snapshot taken at taken is ingested for, nil if it does not exist yet
+func (s *ClusterService) snapshotCluster(ctx context.Context, name string, taken time.Time) (map[string]interface{}, error) {
+	if s.running[name] {
+		return nil, ErrPurgeRunning
+	}
+	cluster, err := s.GetCluster(ctx, name)
+	if err != nil || cluster == nil {
+		return nil, err
+	}
+	if last, ok := cluster[util.SnapshotTime].(string); ok {
+		if t, err := time.Parse(time.RFC3339, last); err == nil && taken.Before(t) {
+			return nil, ErrSnapshotOutdated
+		}
+	}
+	return cluster, nil
+}
+
+// StaleClusters return the active clusters whose collector was not seen for longer than StaleAfter,
+// clusters whose collector never sent a heartbeat are not reported
+func (s *ClusterService) StaleClusters(ctx context.Context) ([]map[string]interface{}, error) {
+	q := fmt.Sprintf(`
+	{
+		objects(func: has(%s)) @filter(eq(objtype, "%s")) {
+			uid
+			name
+			%s
+			%s
+			%s
+			%s
+		}
+	}`, util.LastSeen, util.Cluster, util.LastSeen, util.CollectorVersion, util.InformersSynced, util.ClusterStatus)
+	node, err := s.dbclient.ExecuteDgraphQuery(ctx, q)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	deadline := time.Now().Add(-StaleAfter)
+	clusters := []map[string]interface{}{}
+	names := make(map[string]bool)
+	objs, _ := node[util.Objects].([]interface{})
+	for _, obj := range objs {
+		cluster := obj.(map[string]interface{})
+		if cluster[util.ClusterStatus] == ClusterDecommissioned {
+			continue
+		}
+		lastSeen, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", cluster[util.LastSeen]))
+		if err != nil || !lastSeen.Before(deadline) {
+			continue
+		}
+		clusters = append(clusters, cluster)
+		names[fmt.Sprintf("%v", cluster[util.Name])] = true
+	}
+	s.staleMu.Lock()
+	s.stale = names
+	s.staleMu.Unlock()
+	metrics.KatlasStaleClusters.Set(float64(len(names)))
+	return clusters, nil
+}
+
+// WatchStaleness look for stale clusters every interval to keep the stale clusters gauge up to date, until ctx is done
+func (s *ClusterService) WatchStaleness(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clusters, err := s.StaleClusters(ctx)
+		if err == nil && len(clusters) > 0 {
+			log.Warnf("%d clusters without heartbeat for more than %s", len(clusters), StaleAfter)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FlagStale set stale to true on the objects of a query response belonging to a stale cluster
+func (s *ClusterService) FlagStale(ctx context.Context, response map[string]interface{}) {
+	s.staleMu.RLock()
+	stale := make(map[string]bool, len(s.stale))
+	for name := range s.stale {
+		stale[name] = true
+	}
+	s.staleMu.RUnlock()
+	if len(stale) == 0 {
+		return
+	}
+	objs, _ := response[util.Objects].([]interface{})
+	// objects without resourceid in the response are looked up by uid
+	byUID := make(map[string]map[string]interface{})
+	for _, o := range objs {
+		obj, ok := o.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := objectCluster(obj); ok {
+			if stale[name] {
+				obj[util.Stale] = true
+			}
+		} else if uid, ok := obj[util.UID].(string); ok {
+			byUID[uid] = obj
+		}
+	}
+	if len(byUID) == 0 {
+		return
+	}
+	uids := make([]string, 0, len(byUID))
+	for uid := range byUID {
+		uids = append(uids, uid)
+	}
+	q := fmt.Sprintf(`
+	{
+		objects(func: uid(%s)) {
+			uid
+			resourceid
+		}
+	}`, strings.Join(uids, ","))
+	node, err := s.dbclient.ExecuteDgraphQuery(ctx, q)
+	if err != nil {
+		log.Errorf("failed to flag objects of stale clusters: %v", err)
+		return
+	}
+	found, _ := node[util.Objects].([]interface{})
+	for _, o := range found {
+		obj := o.(map[string]interface{})
+		if name, ok := objectCluster(obj); ok && stale[name] {
+			byUID[obj[util.UID].(string)][util.Stale] = true
+		}
+	}
+}
+
+// objectCluster return the cluster of an object from its resourceid in format cluster:name or objtype:cluster:...
+// or from its cluster edge
+func objectCluster(obj map[string]interface{}) (string, bool) {
+	if rid, ok := obj[util.ResourceID].(string); ok {
+		parts := strings.Split(rid, ":")
+		if parts[0] == util.Cluster && len(parts) == 2 {
+			return parts[1], true
+		}
+		if len(parts) > 2 {
+			return parts[1], true
+		}
+		return "", true
+	}
+	switch c := obj[util.Cluster].(type) {
+	case map[string]interface{}:
+		name, ok := c[util.Name].(string)
+		return name, ok
+	case []interface{}:
+		if len(c) > 0 {
+			if m, ok := c[0].(map[string]interface{}); ok {
+				name, ok := m[util.Name].(string)
+				return name, ok
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,376 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/metrics"
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Cluster status
+const (
+	ClusterActive         = "active"
+	ClusterDecommissioned = "decommissioned"
+)
+
+// Purge status
+const (
+	PurgeRunning = "running"
+	PurgeDone    = "done"
+	PurgeFailed  = "failed"
+)
+
+// PurgeBatchSize number of entities deleted per transaction while purging a cluster
+var PurgeBatchSize = 500
+
+// cluster names are used in resourceids and queries
+var clusterNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+
+// Errors returned by the cluster service
+var (
+	ErrInvalidClusterName = Invalid("invalid cluster name")
+	ErrClusterNotFound    = NotFound("cluster not found")
+	ErrClusterActive      = Conflict("cluster must be decommissioned before it is purged")
+	ErrPurgeRunning       = Conflict("purge of cluster is running")
+	ErrSnapshotOutdated   = Conflict("snapshot is older than the last snapshot ingested for the cluster")
+)
+
+// ClusterMetadata describes a registered cluster
+type ClusterMetadata struct {
+	Region      string `json:"region,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+}
+
+// PurgeProgress reports the progress of the purge of a cluster
+type PurgeProgress struct {
+	Cluster string `json:"cluster"`
+	// Status is running, done or failed, empty if the cluster was never purged
+	Status  string `json:"status,omitempty"`
+	Purged  int    `json:"purged"`
+	Started string `json:"started,omitempty"`
+	Updated string `json:"updated,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ClusterService register, decommission and purge clusters
+type ClusterService struct {
+	dbclient db.IDGClient
+	// purges running in this process by cluster name
+	mu      sync.Mutex
+	running map[string]bool
+	// stale clusters found by the last check
+	staleMu sync.RWMutex
+	stale   map[string]bool
+}
+
+// NewClusterService creates a new ClusterService with the given dgraph client.
+func NewClusterService(dc db.IDGClient) *ClusterService {
+	return &ClusterService{dbclient: dc, running: make(map[string]bool), stale: make(map[string]bool)}
+}
+
+// clusterFields are returned for a cluster
+var clusterFields = []string{util.UID, util.ObjType, util.Name, util.ResourceID, util.ResourceVersion,
+	util.Region, util.Environment, util.ClusterOwner, util.ClusterStatus, util.DecommissionedAt,
+	util.PurgeStatus, util.PurgedCount, util.PurgeStarted, util.PurgeUpdated, util.PurgeError,
+	util.LastSeen, util.CollectorVersion, util.InformersSynced, util.SnapshotTime}
+
+// GetCluster return the cluster with given name, nil if not found
+func (s *ClusterService) GetCluster(ctx context.Context, name string) (map[string]interface{}, error) {
+	if !clusterNameRegex.MatchString(name) {
+		return nil, ErrInvalidClusterName
+	}
+	q := fmt.Sprintf(`
+	{
+		objects(func: eq(resourceid, "%s:%s")) @filter(eq(objtype, "%s")) {
+			%s
+		}
+	}`, util.Cluster, name, util.Cluster, fieldList(clusterFields))
+	node, err := s.dbclient.ExecuteDgraphQuery(ctx, q)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	objs, _ := node[util.Objects].([]interface{})
+	if len(objs) == 0 {
+		return nil, nil
+	}
+	cluster := objs[0].(map[string]interface{})
+	if _, ok := cluster[util.ClusterStatus]; !ok {
+		// created by a collector without registration
+		cluster[util.ClusterStatus] = ClusterActive
+	}
+	return cluster, nil
+}
+
+// RegisterCluster create or update the cluster with given metadata, the cluster becomes active
+func (s *ClusterService) RegisterCluster(ctx context.Context, name string, meta ClusterMetadata) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[name] {
+		return "", ErrPurgeRunning
+	}
+	cluster, err := s.GetCluster(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	data := map[string]interface{}{
+		util.ObjType:       util.Cluster,
+		util.Name:          name,
+		util.ResourceID:    util.Cluster + ":" + name,
+		util.ClusterStatus: ClusterActive,
+	}
+	for k, v := range map[string]string{util.Region: meta.Region, util.Environment: meta.Environment, util.ClusterOwner: meta.Owner} {
+		if v != "" {
+			data[k] = v
+		}
+	}
+	if cluster == nil {
+		return NewEntityService(s.dbclient).CreateEntity(ctx, util.Cluster, data)
+	}
+	// a decommissioned cluster registered again becomes active, the last purge is kept for reference
+	uid := cluster[util.UID].(string)
+	err = s.updateCluster(ctx, uid, data)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("cluster %s registered", name)
+	return uid, nil
+}
+
+// DecommissionCluster mark the cluster with given name decommissioned, its entities are kept until it is purged
+func (s *ClusterService) DecommissionCluster(ctx context.Context, name string) (map[string]interface{}, error) {
+	cluster, err := s.GetCluster(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, ErrClusterNotFound
+	}
+	if cluster[util.ClusterStatus] != ClusterDecommissioned {
+		cluster[util.ClusterStatus] = ClusterDecommissioned
+		cluster[util.DecommissionedAt] = now()
+		err = s.updateCluster(ctx, cluster[util.UID].(string), map[string]interface{}{
+			util.ClusterStatus:    ClusterDecommissioned,
+			util.DecommissionedAt: cluster[util.DecommissionedAt],
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("cluster %s decommissioned", name)
+	}
+	return cluster, nil
+}
+
+// StartPurge start to delete in background all entities of the decommissioned cluster with given name,
+// a failed or interrupted purge is resumed where it stopped, the progress is returned
+func (s *ClusterService) StartPurge(ctx context.Context, name string) (*PurgeProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster, err := s.GetCluster(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, ErrClusterNotFound
+	}
+	if cluster[util.ClusterStatus] != ClusterDecommissioned {
+		return nil, ErrClusterActive
+	}
+	progress := purgeProgress(name, cluster)
+	if s.running[name] {
+		return progress, nil
+	}
+	if progress.Status != PurgeRunning && progress.Status != PurgeFailed {
+		// new purge
+		progress.Purged = 0
+		progress.Started = now()
+	}
+	progress.Status = PurgeRunning
+	progress.Error = ""
+	progress.Updated = now()
+	err = s.saveProgress(ctx, cluster[util.UID].(string), progress)
+	if err != nil {
+		return nil, err
+	}
+	s.running[name] = true
+	started := *progress
+	Background.Go(func(ctx context.Context) {
+		s.purge(ctx, cluster[util.UID].(string), progress)
+	})
+	return &started, nil
+}
+
+// GetPurgeProgress return the progress of the purge of the cluster with given name
+func (s *ClusterService) GetPurgeProgress(ctx context.Context, name string) (*PurgeProgress, error) {
+	cluster, err := s.GetCluster(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, ErrClusterNotFound
+	}
+	return purgeProgress(name, cluster), nil
+}
+
+// ResumePurges restart purges which were running when the service stopped
+func (s *ClusterService) ResumePurges(ctx context.Context) error {
+	q := fmt.Sprintf(`
+	{
+		objects(func: eq(%s, "%s")) @filter(eq(objtype, "%s")) {
+			name
+		}
+	}`, util.PurgeStatus, PurgeRunning, util.Cluster)
+	node, err := s.dbclient.ExecuteDgraphQuery(ctx, q)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	objs, _ := node[util.Objects].([]interface{})
+	for _, obj := range objs {
+		name, _ := obj.(map[string]interface{})[util.Name].(string)
+		_, err = s.StartPurge(ctx, name)
+		if err != nil {
+			log.Errorf("failed to resume purge of cluster %s: %v", name, err)
+			continue
+		}
+		log.Infof("purge of cluster %s resumed", name)
+	}
+	return nil
+}
+
+// purge delete entities pointing to the cluster then its tombstones in batches, saving progress after each batch,
+// a purge canceled by ctx stays running to be resumed after restart
+func (s *ClusterService) purge(ctx context.Context, uid string, progress *PurgeProgress) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, progress.Cluster)
+		s.mu.Unlock()
+	}()
+	queries := []string{
+		// entities with an edge to the cluster
+		fmt.Sprintf(`
+		{
+			cluster(func: uid(%s)) {
+				objects: ~cluster (first: %d) {
+					uid
+				}
+			}
+		}`, uid, PurgeBatchSize),
+		// tombstones keep the cluster in their resourceid only
+		fmt.Sprintf(`
+		{
+			objects(func: eq(objtype, "%s"), first: %d) @filter(regexp(resourceid, /^[^:]+:%s:/)) {
+				uid
+			}
+		}`, util.Tombstone, PurgeBatchSize, regexp.QuoteMeta(progress.Cluster)),
+	}
+	for _, q := range queries {
+		for {
+			uids, err := s.nextBatch(ctx, q)
+			if err == nil && len(uids) == 0 {
+				break
+			}
+			if err == nil {
+				err = s.dbclient.DeleteEntities(ctx, uids)
+			}
+			if err != nil && ctx.Err() != nil {
+				// shutting down, the purge is resumed by the next start
+				log.Infof("purge of cluster %s interrupted after %d entities", progress.Cluster, progress.Purged)
+				return
+			}
+			if err != nil {
+				log.Errorf("purge of cluster %s failed: %v", progress.Cluster, err)
+				progress.Status = PurgeFailed
+				progress.Error = err.Error()
+				progress.Updated = now()
+				s.saveProgress(ctx, uid, progress)
+				return
+			}
+			metrics.DgraphNumDeleteEntity.Add(float64(len(uids)))
+			progress.Purged += len(uids)
+			progress.Updated = now()
+			err = s.saveProgress(ctx, uid, progress)
+			if err != nil {
+				log.Errorf("failed to save purge progress of cluster %s: %v", progress.Cluster, err)
+			}
+			log.Debugf("purged %d entities of cluster %s", progress.Purged, progress.Cluster)
+		}
+	}
+	progress.Status = PurgeDone
+	progress.Updated = now()
+	err := s.saveProgress(ctx, uid, progress)
+	if err != nil {
+		log.Errorf("failed to save purge progress of cluster %s: %v", progress.Cluster, err)
+	}
+	log.Infof("purge of cluster %s done, %d entities deleted", progress.Cluster, progress.Purged)
+}
+
+// nextBatch return uids of the next objects to purge found by query q
+func (s *ClusterService) nextBatch(ctx context.Context, q string) ([]string, error) {
+	node, err := s.dbclient.ExecuteDgraphQuery(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	objs, _ := node[util.Objects].([]interface{})
+	if clusters, ok := node[util.Cluster].([]interface{}); ok && len(clusters) > 0 {
+		objs, _ = clusters[0].(map[string]interface{})[util.Objects].([]interface{})
+	}
+	uids := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		if uid, ok := obj.(map[string]interface{})[util.UID].(string); ok {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+// saveProgress store the purge progress on the cluster
+func (s *ClusterService) saveProgress(ctx context.Context, uid string, progress *PurgeProgress) error {
+	return s.updateCluster(ctx, uid, map[string]interface{}{
+		util.PurgeStatus:  progress.Status,
+		util.PurgedCount:  progress.Purged,
+		util.PurgeStarted: progress.Started,
+		util.PurgeUpdated: progress.Updated,
+		util.PurgeError:   progress.Error,
+	})
+}
+
+// updateCluster update fields of the cluster with given uid
+func (s *ClusterService) updateCluster(ctx context.Context, uid string, data map[string]interface{}) error {
+	metrics.DgraphNumUpdateEntity.Inc()
+	return s.dbclient.UpdateEntity(ctx, uid, data)
+}
+
+// purgeProgress read the purge progress stored on the cluster
+func purgeProgress(name string, cluster map[string]interface{}) *PurgeProgress {
+	progress := &PurgeProgress{Cluster: name}
+	progress.Status, _ = cluster[util.PurgeStatus].(string)
+	progress.Started, _ = cluster[util.PurgeStarted].(string)
+	progress.Updated, _ = cluster[util.PurgeUpdated].(string)
+	progress.Error, _ = cluster[util.PurgeError].(string)
+	if count, ok := cluster[util.PurgedCount].(float64); ok {
+		progress.Purged = int(count)
+	}
+	return progress
+}
+
+// fieldList join fields for a dgraph query block
+func fieldList(fields []string) string {
+	list := ""
+	for _, f := range fields {
+		list += f + "\n"
+	}
+	return list
+}
+
+// now return current time in RFC3339
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
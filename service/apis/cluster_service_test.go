@@ -0,0 +1,158 @@
+package apis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/service/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterPurge(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewClusterService(dc)
+	e := NewEntityService(dc)
+	q := NewQueryService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term", "trigram"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "purgestatus", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "cluster", Type: "uid", Reverse: true})
+
+	_, err := s.RegisterCluster(context.Background(), "purge cluster", ClusterMetadata{})
+	assert.Equal(t, ErrInvalidClusterName, err)
+
+	uid, err := s.RegisterCluster(context.Background(), "purgecluster", ClusterMetadata{Region: "us-west-2", Environment: "dev", Owner: "team-a"})
+	assert.Nil(t, err)
+	cluster, _ := s.GetCluster(context.Background(), "purgecluster")
+	if assert.NotNil(t, cluster, "cluster not registered") {
+		assert.Equal(t, uid, cluster["uid"])
+		assert.Equal(t, "us-west-2", cluster["region"])
+		assert.Equal(t, "team-a", cluster["clusterowner"])
+		assert.Equal(t, ClusterActive, cluster["clusterstatus"])
+	}
+	for i := 0; i < 5; i++ {
+		e.CreateEntity(context.Background(), "k8spurge", map[string]interface{}{
+			"objtype":    "k8spurge",
+			"name":       "obj" + strconv.Itoa(i),
+			"resourceid": "k8spurge:purgecluster:obj" + strconv.Itoa(i),
+			"cluster":    map[string]interface{}{"uid": uid},
+		})
+	}
+	e.DeleteEntityWithTombstone(context.Background(), "k8spurge", "k8spurge:purgecluster:obj0", "", "", nil)
+
+	// active clusters are not purged
+	_, err = s.StartPurge(context.Background(), "purgecluster")
+	assert.Equal(t, ErrClusterActive, err)
+
+	_, err = s.DecommissionCluster(context.Background(), "purgecluster")
+	assert.Nil(t, err)
+	PurgeBatchSize = 2
+	progress, err := s.StartPurge(context.Background(), "purgecluster")
+	assert.Nil(t, err)
+	assert.Equal(t, PurgeRunning, progress.Status)
+	for i := 0; i < 50 && progress.Status == PurgeRunning; i++ {
+		time.Sleep(100 * time.Millisecond)
+		progress, _ = s.GetPurgeProgress(context.Background(), "purgecluster")
+	}
+	assert.Equal(t, PurgeDone, progress.Status)
+	assert.Equal(t, 5, progress.Purged)
+
+	for _, objtype := range []string{"k8spurge", "tombstone"} {
+		n, _ := q.GetQueryResult(context.Background(), map[string][]string{"objtype": {objtype}, "resourceid": {"k8spurge:purgecluster:obj0"}})
+		assert.Equal(t, 0, len(n["objects"].([]interface{})), objtype+" not purged")
+	}
+	cluster, _ = s.GetCluster(context.Background(), "purgecluster")
+	if assert.NotNil(t, cluster, "cluster deleted by purge") {
+		assert.Equal(t, ClusterDecommissioned, cluster["clusterstatus"])
+		e.DeleteEntity(context.Background(), cluster["uid"].(string))
+	}
+}
+
+func TestClusterHeartbeat(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewClusterService(dc)
+	e := NewEntityService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term", "trigram"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+
+	cluster, err := s.RecordHeartbeat(context.Background(), "hbcluster", Heartbeat{Version: "v1.2.0", Informers: map[string]bool{"pod": true}})
+	assert.Nil(t, err)
+	assert.Equal(t, "hbcluster", cluster["name"])
+	stored, _ := s.GetCluster(context.Background(), "hbcluster")
+	if assert.NotNil(t, stored, "cluster not created by heartbeat") {
+		defer e.DeleteEntity(context.Background(), stored["uid"].(string))
+		assert.Equal(t, "v1.2.0", stored["collectorversion"])
+		assert.Equal(t, `{"pod":true}`, stored["informerssynced"])
+	}
+
+	StaleAfter = 5 * time.Minute
+	stale, err := s.StaleClusters(context.Background())
+	assert.Nil(t, err)
+	for _, c := range stale {
+		assert.NotEqual(t, "hbcluster", c["name"], "cluster stale right after heartbeat")
+	}
+
+	// every heartbeat is too old
+	StaleAfter = -time.Minute
+	defer func() { StaleAfter = 5 * time.Minute }()
+	stale, _ = s.StaleClusters(context.Background())
+	names := []interface{}{}
+	for _, c := range stale {
+		names = append(names, c["name"])
+	}
+	assert.Contains(t, names, "hbcluster")
+
+	response := map[string]interface{}{
+		"objects": []interface{}{
+			map[string]interface{}{"resourceid": "pod:hbcluster:default:web"},
+			map[string]interface{}{"resourceid": "pod:othercluster:default:web"},
+			map[string]interface{}{"name": "web", "cluster": map[string]interface{}{"name": "hbcluster"}},
+		},
+	}
+	s.FlagStale(context.Background(), response)
+	objs := response["objects"].([]interface{})
+	assert.Equal(t, true, objs[0].(map[string]interface{})["stale"])
+	assert.Nil(t, objs[1].(map[string]interface{})["stale"])
+	assert.Equal(t, true, objs[2].(map[string]interface{})["stale"])
+
+	// a new heartbeat clears the flag
+	s.RecordHeartbeat(context.Background(), "hbcluster", Heartbeat{Version: "v1.2.0"})
+	response["objects"] = []interface{}{map[string]interface{}{"resourceid": "pod:hbcluster:default:web"}}
+	s.FlagStale(context.Background(), response)
+	assert.Nil(t, response["objects"].([]interface{})[0].(map[string]interface{})["stale"])
+}
+
+func TestClusterSnapshot(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewClusterService(dc)
+	e := NewEntityService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term", "trigram"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+
+	taken := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, s.RecordSnapshot(context.Background(), "snapcluster", taken))
+	stored, _ := s.GetCluster(context.Background(), "snapcluster")
+	if assert.NotNil(t, stored, "cluster not created by snapshot") {
+		defer e.DeleteEntity(context.Background(), stored["uid"].(string))
+		assert.Equal(t, "2019-03-01T12:00:00Z", stored["snapshottime"])
+	}
+
+	// an older snapshot is refused, a newer one recorded
+	assert.Equal(t, ErrSnapshotOutdated, s.CheckSnapshot(context.Background(), "snapcluster", taken.Add(-time.Hour)))
+	assert.Nil(t, s.CheckSnapshot(context.Background(), "snapcluster", taken.Add(time.Hour)))
+	assert.Equal(t, ErrSnapshotOutdated, s.RecordSnapshot(context.Background(), "snapcluster", taken.Add(-time.Hour)))
+	assert.Nil(t, s.RecordSnapshot(context.Background(), "snapcluster", taken.Add(time.Hour)))
+	stored, _ = s.GetCluster(context.Background(), "snapcluster")
+	if assert.NotNil(t, stored) {
+		assert.Equal(t, "2019-03-01T13:00:00Z", stored["snapshottime"])
+	}
+}
@@ -0,0 +1,191 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/intuit/katlas/service/util"
+	"github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExportPageSize number of entities read per query while exporting
+var ExportPageSize = 1000
+
+// ErrMetadataNotFound is returned for an object type without metadata, an invalid parameter of the request
+var ErrMetadataNotFound = Invalid("metadata not found")
+
+// ExportEntities pass to emit the entities of the types objtypes, all types of the metadata if empty, in cluster if not
+// empty. Entities keep their fields with the relationships of the metadata given by the resourceid of the related
+// entities, in the format ImportEntity reads. All types are exported in the order of their relationships so entities
+// are imported after the entities they refer to
+func (s EntityService) ExportEntities(ctx context.Context, objtypes []string, cluster string, emit func(map[string]interface{}) error) error {
+	metas, err := s.getAllMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	if len(objtypes) == 0 {
+		objtypes = exportOrder(metas)
+	}
+	for _, objtype := range objtypes {
+		meta, ok := metas[objtype]
+		if !ok {
+			return ErrMetadataNotFound
+		}
+		fields := make(map[string]MetadataField, len(meta.Fields))
+		for _, f := range meta.Fields {
+			fields[f.FieldName] = f
+		}
+		after := ""
+		for {
+			page, err := s.dbclient.GetPageByClusterAndType(ctx, objtype, cluster, after, ExportPageSize)
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			objs, _ := page[util.Objects].([]interface{})
+			for _, obj := range objs {
+				o := obj.(map[string]interface{})
+				after = o[util.UID].(string)
+				if err = emit(exportEntity(o, fields)); err != nil {
+					return err
+				}
+			}
+			if len(objs) < ExportPageSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// ImportEntity create or update an entity in the format of ExportEntities, the related entities are found by
+// their resourceid and created if not imported yet. Importing the same entity again is ignored as its version
+// is not higher than the stored one
+func (s EntityService) ImportEntity(ctx context.Context, data map[string]interface{}) (string, error) {
+	meta, _ := data[util.ObjType].(string)
+	fs, err := NewMetaService(s.dbclient).GetMetadataFields(ctx, meta)
+	if err != nil {
+		return "", err
+	}
+	if len(fs) == 0 {
+		return "", ErrMetadataNotFound
+	}
+	for _, field := range fs {
+		if field.FieldType != util.Relationship {
+			continue
+		}
+		switch rel := data[field.FieldName].(type) {
+		case string:
+			data[field.FieldName] = map[string]interface{}{util.ResourceID: rel}
+		case []interface{}:
+			rels := make([]interface{}, 0, len(rel))
+			for _, rid := range rel {
+				rels = append(rels, map[string]interface{}{util.ResourceID: rid})
+			}
+			data[field.FieldName] = rels
+		}
+	}
+	return s.CreateEntity(ctx, meta, data)
+}
+
+// getAllMetadata return the metadata by name
+func (s EntityService) getAllMetadata(ctx context.Context) (map[string]Metadata, error) {
+	qm := map[string][]string{util.ObjType: {util.Metadata}, util.Limit: {strconv.Itoa(MaximumLimit)}}
+	ret, err := NewQueryService(s.dbclient).GetQueryResult(ctx, qm)
+	if err != nil {
+		return nil, err
+	}
+	metas := make(map[string]Metadata)
+	for _, obj := range ret[util.Objects].([]interface{}) {
+		var metadata Metadata
+		if err = mapstructure.Decode(obj, &metadata); err != nil {
+			return nil, err
+		}
+		metas[metadata.Name] = metadata
+	}
+	return metas, nil
+}
+
+// exportEntity convert a stored entity to its exported form
+func exportEntity(obj map[string]interface{}, fields map[string]MetadataField) map[string]interface{} {
+	entity := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		field, ok := fields[k]
+		switch {
+		case k == util.UID || k == util.VersionNumber:
+		case ok && field.FieldType == util.Relationship:
+			rids := edgeResourceIDs(v)
+			if strings.EqualFold(field.Cardinality, util.Many) {
+				entity[k] = rids
+			} else if len(rids) > 0 {
+				entity[k] = rids[0]
+			}
+		case ok && field.FieldType == util.JSON:
+			// json fields are stored as string
+			var value interface{}
+			if s, isString := v.(string); isString && json.Unmarshal([]byte(s), &value) == nil {
+				v = value
+			}
+			entity[k] = v
+		case len(edgeResourceIDs(v)) > 0:
+			// edges outside of the metadata can't be imported
+		default:
+			entity[k] = v
+		}
+	}
+	return entity
+}
+
+// edgeResourceIDs return the resourceids of the entities at an edge, nil if v is not an edge
+func edgeResourceIDs(v interface{}) []interface{} {
+	switch e := v.(type) {
+	case map[string]interface{}:
+		if rid, ok := e[util.ResourceID]; ok {
+			return []interface{}{rid}
+		}
+	case []interface{}:
+		var rids []interface{}
+		for _, item := range e {
+			rids = append(rids, edgeResourceIDs(item)...)
+		}
+		return rids
+	}
+	return nil
+}
+
+// exportOrder sort the types so each type comes after the types of its relationships
+func exportOrder(metas map[string]Metadata) []string {
+	names := make([]string, 0, len(metas))
+	for name := range metas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	order := make([]string, 0, len(names))
+	visited := make(map[string]bool, len(names))
+	var visit func(name string)
+	visit = func(name string) {
+		meta, ok := metas[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, f := range meta.Fields {
+			if f.FieldType != util.Relationship {
+				continue
+			}
+			// owner of pod may be of several types
+			for _, ref := range strings.Split(f.RefDataType, ",") {
+				visit(strings.TrimSpace(ref))
+			}
+		}
+		order = append(order, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return order
+}
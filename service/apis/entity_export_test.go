@@ -0,0 +1,128 @@
+package apis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportOrder(t *testing.T) {
+	rel := func(name, ref string) MetadataField {
+		return MetadataField{FieldName: name, FieldType: util.Relationship, RefDataType: ref}
+	}
+	metas := map[string]Metadata{
+		"pod":        {Name: "pod", Fields: []MetadataField{rel("namespace", "namespace"), rel("owner", "replicaset,daemonset")}},
+		"replicaset": {Name: "replicaset", Fields: []MetadataField{rel("namespace", "namespace")}},
+		"daemonset":  {Name: "daemonset", Fields: []MetadataField{rel("cluster", "cluster")}},
+		"namespace":  {Name: "namespace", Fields: []MetadataField{rel("cluster", "cluster")}},
+		"cluster":    {Name: "cluster"},
+	}
+	order := exportOrder(metas)
+	index := make(map[string]int)
+	for i, name := range order {
+		index[name] = i
+	}
+	assert.Equal(t, 5, len(order))
+	assert.True(t, index["cluster"] < index["namespace"])
+	assert.True(t, index["namespace"] < index["replicaset"])
+	assert.True(t, index["replicaset"] < index["pod"])
+	assert.True(t, index["daemonset"] < index["pod"])
+}
+
+func TestExportEntity(t *testing.T) {
+	fields := map[string]MetadataField{
+		"namespace":   {FieldName: "namespace", FieldType: util.Relationship, Cardinality: util.One},
+		"application": {FieldName: "application", FieldType: util.Relationship, Cardinality: util.Many},
+		"labels":      {FieldName: "labels", FieldType: util.JSON},
+	}
+	obj := map[string]interface{}{
+		util.UID:           "0x12",
+		util.VersionNumber: 7,
+		"objtype":          "pod",
+		"resourceid":       "pod:c1:ns1:p1",
+		"resourceversion":  "7",
+		"namespace":        map[string]interface{}{"resourceid": "namespace:c1:ns1"},
+		"application":      []interface{}{map[string]interface{}{"resourceid": "application:a1"}},
+		"labels":           `{"app":"a1"}`,
+		"runsOn":           []interface{}{map[string]interface{}{"resourceid": "node:c1:n1"}},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"objtype":         "pod",
+		"resourceid":      "pod:c1:ns1:p1",
+		"resourceversion": "7",
+		"namespace":       "namespace:c1:ns1",
+		"application":     []interface{}{"application:a1"},
+		"labels":          map[string]interface{}{"app": "a1"},
+	}, exportEntity(obj, fields))
+}
+
+func TestExportImport(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewEntityService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "cluster", Type: "uid", Reverse: true})
+	meta := func(name string, fields ...interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"name":    name,
+			"objtype": "metadata",
+			"fields": append([]interface{}{
+				map[string]interface{}{"fieldname": "name", "fieldtype": "string", "cardinality": "one"},
+				map[string]interface{}{"fieldname": "objtype", "fieldtype": "string", "cardinality": "one"},
+				map[string]interface{}{"fieldname": "resourceid", "fieldtype": "string", "cardinality": "one"},
+			}, fields...),
+		}
+	}
+	mid1, _ := s.CreateEntity(context.Background(), "metadata", meta("exportcluster"))
+	defer s.DeleteEntity(context.Background(), mid1)
+	mid2, _ := s.CreateEntity(context.Background(), "metadata", meta("exportnode",
+		map[string]interface{}{"fieldname": "cluster", "fieldtype": "relationship", "refdatatype": "exportcluster", "cardinality": "one"},
+		map[string]interface{}{"fieldname": "labels", "fieldtype": "json", "cardinality": "one"}))
+	defer s.DeleteEntity(context.Background(), mid2)
+
+	// node imported before its cluster, which is created on the fly
+	nid, err := s.ImportEntity(context.Background(), map[string]interface{}{
+		"objtype":         "exportnode",
+		"name":            "n1",
+		"resourceid":      "exportnode:c1:n1",
+		"resourceversion": "3",
+		"cluster":         "exportcluster:c1",
+		"labels":          map[string]interface{}{"zone": "a"},
+	})
+	assert.Nil(t, err)
+	defer s.DeleteEntity(context.Background(), nid)
+	cid, err := s.ImportEntity(context.Background(), map[string]interface{}{
+		"objtype":         "exportcluster",
+		"name":            "c1",
+		"resourceid":      "exportcluster:c1",
+		"resourceversion": "1",
+	})
+	assert.Nil(t, err)
+	defer s.DeleteEntity(context.Background(), cid)
+	_, err = s.ImportEntity(context.Background(), map[string]interface{}{"objtype": "unknown", "resourceid": "unknown:x"})
+	assert.Equal(t, ErrMetadataNotFound, err)
+
+	var exported []map[string]interface{}
+	err = s.ExportEntities(context.Background(), []string{"exportnode"}, "", func(entity map[string]interface{}) error {
+		exported = append(exported, entity)
+		return nil
+	})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(exported)) {
+		assert.Equal(t, "exportcluster:c1", exported[0]["cluster"])
+		assert.Equal(t, map[string]interface{}{"zone": "a"}, exported[0]["labels"])
+		assert.Equal(t, "3", exported[0]["resourceversion"])
+	}
+
+	// importing the export again is idempotent
+	again, err := s.ImportEntity(context.Background(), exported[0])
+	assert.Nil(t, err)
+	assert.Equal(t, nid, again)
+	assert.Equal(t, ErrMetadataNotFound, s.ExportEntities(context.Background(), []string{"unknown"}, "", nil))
+}
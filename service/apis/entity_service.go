@@ -1,39 +1,42 @@
 package apis
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 	"time"
 
 	"fmt"
-	log "github.com/Sirupsen/logrus"
 	"github.com/cenkalti/backoff"
 	"github.com/intuit/katlas/service/db"
 	"github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
 	"reflect"
+	"strconv"
 )
 
-// KeyMutex lock single object by resourceid
-// It will retry to get lock and expire after certain time
-var mutex = util.NewKeyMutex(time.Minute, 1000)
+// Background runs the syncs and purges going on after their request returned, the server waits for it on shutdown
+var Background = util.NewWorkGroup()
 
 // IEntityService define interfaces to manipulate data
 type IEntityService interface {
 	// get entity return the object with specified ID
-	GetEntity(uid string) (map[string]interface{}, error)
+	GetEntity(ctx context.Context, uid string) (map[string]interface{}, error)
 	// remove object with given ID
-	DeleteEntity(uid string) error
+	DeleteEntity(ctx context.Context, uid string) error
 	// remove object with given ID
-	DeleteEntityByResourceID(rid string) error
+	DeleteEntityByResourceID(ctx context.Context, rid string) error
+	// replace object with given resourceid by a tombstone
+	DeleteEntityWithTombstone(ctx context.Context, meta string, rid string, k8sUID string, resourceVersion string, lastState []byte) error
 	// save new entity to the storage
-	CreateEntity(meta string, data map[string]interface{}) (string, error)
+	CreateEntity(ctx context.Context, meta string, data map[string]interface{}) (string, error)
 	// update entity with given ID in the storage
-	UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext)
+	UpdateEntity(ctx context.Context, uuid string, data map[string]interface{}, option ...util.OptionContext)
 	// create or remove relationship between entities by given IDs
-	CreateOrDeleteEdge(fromUID string, toUID string, rel string, op db.Action) error
+	CreateOrDeleteEdge(ctx context.Context, fromUID string, toUID string, rel string, op db.Action) error
 	// sync data between source and underlying database
-	SyncEntities(meta string, data map[string]interface{}) error
+	SyncEntities(ctx context.Context, meta string, data map[string]interface{}) error
 }
 
 // EntityService provides service for controller and frontend by implement IEntityService interface
@@ -47,23 +50,23 @@ func NewEntityService(dc db.IDGClient) *EntityService {
 }
 
 // GetEntity get entity return the object with specified ID
-func (s EntityService) GetEntity(uuid string) (map[string]interface{}, error) {
+func (s EntityService) GetEntity(ctx context.Context, uuid string) (map[string]interface{}, error) {
 	metrics.DgraphNumGetEntity.Inc()
-	return s.dbclient.GetEntity(uuid)
+	return s.dbclient.GetEntity(ctx, uuid)
 }
 
 // DeleteEntity remove object with given ID
-func (s EntityService) DeleteEntity(uuid string) error {
+func (s EntityService) DeleteEntity(ctx context.Context, uuid string) error {
 	metrics.DgraphNumDeleteEntity.Inc()
-	return s.dbclient.DeleteEntity(uuid)
+	return s.dbclient.DeleteEntity(ctx, uuid)
 }
 
 // DeleteEntityByResourceID remove object by given resourceid
-func (s EntityService) DeleteEntityByResourceID(meta string, rid string) error {
+func (s EntityService) DeleteEntityByResourceID(ctx context.Context, meta string, rid string) error {
 	metrics.DgraphNumDeleteEntity.Inc()
 	qm := map[string][]string{util.ResourceID: {rid}, util.ObjType: {meta}, util.Print: {util.ResourceID}}
 	queryService := NewQueryService(s.dbclient)
-	node, err := queryService.GetQueryResult(qm)
+	node, err := queryService.GetQueryResult(ctx, qm)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -71,7 +74,7 @@ func (s EntityService) DeleteEntityByResourceID(meta string, rid string) error {
 	if len(node[util.Objects].([]interface{})) > 0 {
 		// got existing object id
 		for _, obj := range node[util.Objects].([]interface{}) {
-			err = s.dbclient.DeleteEntity(obj.(map[string]interface{})[util.UID].(string))
+			err = s.dbclient.DeleteEntity(ctx, obj.(map[string]interface{})[util.UID].(string))
 			if err != nil {
 				return err
 			}
@@ -81,8 +84,80 @@ func (s EntityService) DeleteEntityByResourceID(meta string, rid string) error {
 	return nil
 }
 
+// DeleteEntityWithTombstone replace object of type meta with resourceid rid by a tombstone recording its deletion
+// the tombstone keeps the resourceid and version so late upserts of older versions are ignored,
+// the delete is ignored if the stored object is newer than resourceVersion, e.g. it was created again.
+// The versions are compared again by the upsert writing the tombstone, so a concurrent write wins if newer
+func (s EntityService) DeleteEntityWithTombstone(ctx context.Context, meta string, rid string, k8sUID string, resourceVersion string, lastState []byte) error {
+	metrics.DgraphNumDeleteEntity.Inc()
+	tombstone := map[string]interface{}{
+		util.ObjType:        util.Tombstone,
+		util.DeletedObjType: meta,
+		util.ResourceID:     rid,
+		util.Name:           rid[strings.LastIndex(rid, ":")+1:],
+		util.DeletedAt:      time.Now().UTC().Format(time.RFC3339),
+	}
+	if k8sUID != "" {
+		tombstone[util.K8sUID] = k8sUID
+	}
+	if len(lastState) > 0 {
+		tombstone[util.LastState] = string(lastState)
+	}
+	qm := map[string][]string{util.ResourceID: {rid}, util.ObjType: {meta}, util.Print: {util.ResourceID + "," + util.ResourceVersion}}
+	queryService := NewQueryService(s.dbclient)
+	node, err := queryService.GetQueryResult(ctx, qm)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	objs := node[util.Objects].([]interface{})
+	if len(objs) == 0 {
+		// nothing to delete, still record the tombstone to ignore late upserts
+		if resourceVersion != "" {
+			tombstone[util.ResourceVersion] = resourceVersion
+		}
+		tombstone[util.UID] = "_:A"
+		_, err = s.dbclient.CreateEntity(ctx, util.Tombstone, tombstone)
+		return err
+	}
+	for _, obj := range objs {
+		current, _ := obj.(map[string]interface{})[util.ResourceVersion].(string)
+		if resourceVersion != "" && compareVersion(current, resourceVersion) > 0 {
+			log.Infof("ignore delete of %s %s version %s, stored version %s is newer", meta, rid, resourceVersion, current)
+			continue
+		}
+		tombstone[util.ResourceVersion] = current
+		if resourceVersion != "" {
+			tombstone[util.ResourceVersion] = resourceVersion
+		}
+		uid := obj.(map[string]interface{})[util.UID].(string)
+		operation := func() error {
+			return s.dbclient.CreateTombstone(ctx, uid, tombstone)
+		}
+		err = backoff.Retry(operation, backoff.WithContext(backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount), ctx))
+		if err != nil {
+			return err
+		}
+		log.Infof("%s %s deleted successfully, tombstone recorded", meta, rid)
+	}
+	return nil
+}
+
+// compareVersion compare two resource versions numerically, returns 1 if a is newer, -1 if b is newer, 0 otherwise
+func compareVersion(a, b string) int {
+	va, _ := strconv.ParseInt(a, 10, 64)
+	vb, _ := strconv.ParseInt(b, 10, 64)
+	if va > vb {
+		return 1
+	}
+	if va < vb {
+		return -1
+	}
+	return 0
+}
+
 // CreateEntity save new entity to the storage
-func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (string, error) {
+func (s EntityService) CreateEntity(ctx context.Context, meta string, data map[string]interface{}) (string, error) {
 	metrics.DgraphNumCreateEntity.Inc()
 	cluster := data[util.Cluster]
 	ns := data[util.Namespace]
@@ -91,7 +166,7 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 	}
 
 	m := NewMetaService(s.dbclient)
-	fs, err := m.GetMetadataFields(meta)
+	fs, err := m.GetMetadataFields(ctx, meta)
 	if err != nil {
 		log.Debug(err)
 		return "", err
@@ -121,7 +196,7 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 					uidMaps := []map[string]interface{}{}
 					for _, rel := range data[field.FieldName].([]interface{}) {
 						dataMap := buildDataMap(data[util.K8sObj], rel, field.RefDataType, cluster, ns)
-						uid, err := s.getUIDFromRelData(dataMap, field.RefDataType)
+						uid, err := s.getUIDFromRelData(ctx, dataMap, field.RefDataType)
 						if err != nil {
 							log.Error(err)
 							return "", err
@@ -137,7 +212,7 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 						field.RefDataType = data[util.OwnerType].(string)
 					}
 					dataMap := buildDataMap(data[util.K8sObj], data[field.FieldName], field.RefDataType, cluster, ns)
-					uid, err := s.getUIDFromRelData(dataMap, field.RefDataType)
+					uid, err := s.getUIDFromRelData(ctx, dataMap, field.RefDataType)
 					if err != nil {
 						log.Error(err)
 						return "", err
@@ -151,88 +226,136 @@ func (s EntityService) CreateEntity(meta string, data map[string]interface{}) (s
 	if _, ok := data[util.UID]; !ok {
 		data[util.UID] = "_:A"
 	}
-	if mutex.TryLock(data[util.ResourceID]) {
-		defer mutex.Unlock(data[util.ResourceID])
-		var uuid string
-		operation := func() error {
-			uuid, err = s.dbclient.CreateEntity(meta, data)
-			return err
-		}
-		err := backoff.Retry(operation, backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount))
-		if err != nil {
-			return "", err
-		}
-		return uuid, nil
+	// the upsert of another replica writing the same resourceid conflicts, the aborted one is retried
+	var uuid string
+	operation := func() error {
+		uuid, err = s.dbclient.CreateEntity(ctx, meta, data)
+		return err
+	}
+	err = backoff.Retry(operation, backoff.WithContext(backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount), ctx))
+	if err != nil {
+		return "", err
 	}
-	return "", fmt.Errorf("can't get resource lock, ignore after timeout reached")
+	return uuid, nil
 }
 
 // SyncEntities ...
-func (s EntityService) SyncEntities(meta string, data []map[string]interface{}) error {
+func (s EntityService) SyncEntities(ctx context.Context, meta string, data []map[string]interface{}) error {
 	// get all objects from database base on meta and k8 cluster
 	if len(data) > 0 {
-		objs, err := s.dbclient.GetAllByClusterAndType(meta, data[0][util.Cluster].(string))
-		if err != nil {
-			log.Error(err)
-			return err
-		}
-		// if obj not present in input, remove it from database
-		if len(objs[util.Objects].([]interface{})) > 0 {
-			for _, obj := range objs[util.Objects].([]interface{}) {
-				uid := obj.(map[string]interface{})[util.UID].(string)
-				rid := obj.(map[string]interface{})[util.ResourceID].(string)
-				name := obj.(map[string]interface{})[util.Name].(string)
-				var ns interface{}
-				if strings.Count(rid, ":") == 3 {
-					ns = strings.Split(rid, ":")[2]
-				}
-				found := false
-				for _, d := range data {
-					if name == d[util.Name].(string) && ns == d[util.Namespace] {
-						found = true
-					}
-				}
-				if !found {
-					s.dbclient.DeleteEntity(uid)
-					log.Debugf("entity %s deleted by sync", rid)
-				}
-			}
+		return s.SyncClusterEntities(ctx, meta, data[0][util.Cluster].(string), data)
+	}
+	return nil
+}
+
+// SyncClusterEntities replace all objects of type meta in cluster by data, objects not in data are deleted
+// even if data is empty. data is compared with the storage like a digest so only stale and missing objects are written
+func (s EntityService) SyncClusterEntities(ctx context.Context, meta string, cluster string, data []map[string]interface{}) error {
+	digest := make([]EntityDigest, 0, len(data))
+	for _, d := range data {
+		if _, ok := d[util.ResourceID]; !ok {
+			d[util.ResourceID] = getResourceID(meta, d)
 		}
-		// create or update from input
-		for _, d := range data {
-			s.CreateEntity(meta, d)
+		version, _ := d[util.ResourceVersion].(string)
+		digest = append(digest, EntityDigest{ResourceID: fmt.Sprintf("%v", d[util.ResourceID]), ResourceVersion: version})
+	}
+	diff, err := s.DiffEntities(ctx, meta, cluster, digest)
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]bool, len(diff.Stale)+len(diff.Missing))
+	for _, rid := range append(diff.Stale, diff.Missing...) {
+		changed[rid] = true
+	}
+	// create or update the changed objects only
+	for _, d := range data {
+		if changed[fmt.Sprintf("%v", d[util.ResourceID])] {
+			s.CreateEntity(ctx, meta, d)
 		}
 	}
+	log.Debugf("%s sync of %d objects, %d stale, %d missing, %d deleted", meta, len(data), len(diff.Stale), len(diff.Missing), len(diff.Deleted))
 	return nil
 }
 
+// EntityDigest identifies an object and its version in the source
+type EntityDigest struct {
+	ResourceID      string `json:"resourceid"`
+	ResourceVersion string `json:"resourceversion"`
+}
+
+// SyncDiff lists the resourceids found different between a digest and the storage
+type SyncDiff struct {
+	// Stale objects are stored with an older version
+	Stale []string `json:"stale"`
+	// Missing objects are not stored
+	Missing []string `json:"missing"`
+	// Deleted objects were stored but not in the digest, they are replaced by tombstones
+	Deleted []string `json:"deleted"`
+}
+
+// DiffEntities compare the digest of all objects of type meta in cluster with the storage,
+// objects not in the digest are deleted, stale and missing objects are returned so only those are sent
+func (s EntityService) DiffEntities(ctx context.Context, meta string, cluster string, digest []EntityDigest) (*SyncDiff, error) {
+	objs, err := s.dbclient.GetAllByClusterAndType(ctx, meta, cluster)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	stored := make(map[string]string)
+	for _, obj := range objs[util.Objects].([]interface{}) {
+		rid, _ := obj.(map[string]interface{})[util.ResourceID].(string)
+		version, _ := obj.(map[string]interface{})[util.ResourceVersion].(string)
+		stored[rid] = version
+	}
+	diff := &SyncDiff{Stale: []string{}, Missing: []string{}, Deleted: []string{}}
+	source := make(map[string]bool, len(digest))
+	for _, d := range digest {
+		source[d.ResourceID] = true
+		version, ok := stored[d.ResourceID]
+		if !ok {
+			diff.Missing = append(diff.Missing, d.ResourceID)
+		} else if compareVersion(d.ResourceVersion, version) > 0 {
+			diff.Stale = append(diff.Stale, d.ResourceID)
+		}
+	}
+	for rid := range stored {
+		if source[rid] {
+			continue
+		}
+		err = s.DeleteEntityWithTombstone(ctx, meta, rid, "", "", nil)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		diff.Deleted = append(diff.Deleted, rid)
+		log.Debugf("entity %s deleted by sync", rid)
+	}
+	return diff, nil
+}
+
 // CreateOrDeleteEdge create or remove edge
-func (s EntityService) CreateOrDeleteEdge(fromType string, fromUID string, toType, toUID string, rel string, op db.Action) error {
+func (s EntityService) CreateOrDeleteEdge(ctx context.Context, fromType string, fromUID string, toType, toUID string, rel string, op db.Action) error {
 	// TODO:
 	// validate base on metadata
 	// if err := metadata.Validate(fromType, toType, rel); err != nil {
 	// 	return nil, err
 	// }
 	metrics.DgraphNumUpdateEdge.Inc()
-	return s.dbclient.CreateOrDeleteEdge(fromType, fromUID, toType, toUID, rel, op)
+	return s.dbclient.CreateOrDeleteEdge(ctx, fromType, fromUID, toType, toUID, rel, op)
 
 }
 
 // UpdateEntity update entity
-func (s EntityService) UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext) error {
-	if mutex.TryLock(uuid) {
-		defer mutex.Unlock(uuid)
-		operation := func() error {
-			return s.dbclient.UpdateEntity(uuid, data, option...)
-		}
-		err := backoff.Retry(operation, backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount))
-		if err != nil {
-			return err
-		}
-		metrics.DgraphNumUpdateEntity.Inc()
-		return nil
+func (s EntityService) UpdateEntity(ctx context.Context, uuid string, data map[string]interface{}, option ...util.OptionContext) error {
+	operation := func() error {
+		return s.dbclient.UpdateEntity(ctx, uuid, data, option...)
 	}
-	return fmt.Errorf("can't get resource lock to update %s, ignore after timeout reached", uuid)
+	err := backoff.Retry(operation, backoff.WithContext(backoff.WithMaxRetries(util.NewBackOff(), util.RetryCount), ctx))
+	if err != nil {
+		return err
+	}
+	metrics.DgraphNumUpdateEntity.Inc()
+	return nil
 }
 
 // build resourceid
@@ -288,7 +411,7 @@ func buildDataMap(k8sObj interface{}, relData interface{}, relType string, clust
 }
 
 // get uid from relationship object, if object not present, create it
-func (s EntityService) getUIDFromRelData(data map[string]interface{}, objType string) (*string, error) {
+func (s EntityService) getUIDFromRelData(ctx context.Context, data map[string]interface{}, objType string) (*string, error) {
 	if _, ok := data[util.UID]; ok {
 		id := data[util.UID].(string)
 		return &id, nil
@@ -296,7 +419,7 @@ func (s EntityService) getUIDFromRelData(data map[string]interface{}, objType st
 	// query by ResourceID to get uid
 	qm := map[string][]string{util.ResourceID: {data[util.ResourceID].(string)}, util.ObjType: {objType}, util.Print: {util.ResourceID}}
 	queryService := NewQueryService(s.dbclient)
-	node, err := queryService.GetQueryResult(qm)
+	node, err := queryService.GetQueryResult(ctx, qm)
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -307,7 +430,7 @@ func (s EntityService) getUIDFromRelData(data map[string]interface{}, objType st
 		uid = node[util.Objects].([]interface{})[0].(map[string]interface{})[util.UID].(string)
 	} else {
 		// create new object
-		uid, err = s.CreateEntity(objType, data)
+		uid, err = s.CreateEntity(ctx, objType, data)
 		if err != nil {
 			log.Error(err)
 			return nil, err
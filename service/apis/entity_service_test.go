@@ -1,11 +1,16 @@
 package apis
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"os/exec"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/intuit/katlas/service/db"
 	"github.com/stretchr/testify/assert"
@@ -22,12 +27,13 @@ func TestCreateEntity(t *testing.T) {
 		"labels":  "testingnode02",
 	}
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	nid, _ := s.CreateEntity("k8snode", node)
-	defer s.DeleteEntity(nid)
-	n, _ := s.GetEntity(nid)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
+	defer s.DeleteEntity(context.Background(), nid)
+	n, _ := s.GetEntity(context.Background(), nid)
 	o := n["objects"].([]interface{})[0].(map[string]interface{})
 	if val, ok := o["labels"]; ok {
 		assert.Equal(t, val, "testingnode02", "node label not equals to testnode02")
@@ -46,23 +52,101 @@ func TestDeleteEntityByRid(t *testing.T) {
 		"labels":     "testingnode02",
 		"resourceid": "noderid",
 	}
-	s.CreateEntity("k8snode", node)
-	err := s.DeleteEntityByResourceID("k8snode", "noderid")
+	s.CreateEntity(context.Background(), "k8snode", node)
+	err := s.DeleteEntityByResourceID(context.Background(), "k8snode", "noderid")
 	assert.Nil(t, err)
 	dc.Close()
 }
 
+func TestDeleteEntityWithTombstone(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewEntityService(dc)
+	q := NewQueryService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	node := map[string]interface{}{
+		"objtype":         "k8snode",
+		"name":            "node03",
+		"resourceid":      "k8snode:node03",
+		"resourceversion": "10",
+	}
+	s.CreateEntity(context.Background(), "k8snode", node)
+
+	// delete of an older version is ignored
+	err := s.DeleteEntityWithTombstone(context.Background(), "k8snode", "k8snode:node03", "abc-123", "9", nil)
+	assert.Nil(t, err)
+	qm := map[string][]string{"resourceid": {"k8snode:node03"}, "objtype": {"k8snode"}}
+	n, _ := q.GetQueryResult(context.Background(), qm)
+	assert.Equal(t, 1, len(n["objects"].([]interface{})), "object deleted by an older version")
+
+	err = s.DeleteEntityWithTombstone(context.Background(), "k8snode", "k8snode:node03", "abc-123", "11", []byte(`{"name":"node03"}`))
+	assert.Nil(t, err)
+	n, _ = q.GetQueryResult(context.Background(), qm)
+	assert.Equal(t, 0, len(n["objects"].([]interface{})), "object not deleted")
+	qm = map[string][]string{"resourceid": {"k8snode:node03"}, "objtype": {"tombstone"}}
+	n, _ = q.GetQueryResult(context.Background(), qm)
+	objs := n["objects"].([]interface{})
+	if assert.Equal(t, 1, len(objs), "tombstone not recorded") {
+		tombstone := objs[0].(map[string]interface{})
+		assert.Equal(t, "k8snode", tombstone["deletedobjtype"])
+		assert.Equal(t, "abc-123", tombstone["k8suid"])
+		assert.Equal(t, "11", tombstone["resourceversion"])
+		defer s.DeleteEntity(context.Background(), tombstone["uid"].(string))
+	}
+
+	// late upsert of an older version does not bring the object back
+	node["resourceversion"] = "10"
+	s.CreateEntity(context.Background(), "k8snode", node)
+	qm = map[string][]string{"resourceid": {"k8snode:node03"}, "objtype": {"k8snode"}}
+	n, _ = q.GetQueryResult(context.Background(), qm)
+	assert.Equal(t, 0, len(n["objects"].([]interface{})), "stale upsert replaced the tombstone")
+}
+
+func TestDiffEntities(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewEntityService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "cluster", Type: "uid"})
+	for _, n := range []map[string]interface{}{
+		{"name": "uptodate", "resourceversion": "5"},
+		{"name": "stale", "resourceversion": "5"},
+		{"name": "gone", "resourceversion": "5"},
+	} {
+		n["objtype"] = "k8sdiff"
+		n["resourceid"] = "k8sdiff:diffcluster:" + n["name"].(string)
+		n["cluster"] = map[string]interface{}{"objtype": "cluster", "name": "diffcluster"}
+		uid, _ := s.CreateEntity(context.Background(), "k8sdiff", n)
+		defer s.DeleteEntity(context.Background(), uid)
+	}
+	diff, err := s.DiffEntities(context.Background(), "k8sdiff", "diffcluster", []EntityDigest{
+		{ResourceID: "k8sdiff:diffcluster:uptodate", ResourceVersion: "5"},
+		{ResourceID: "k8sdiff:diffcluster:stale", ResourceVersion: "6"},
+		{ResourceID: "k8sdiff:diffcluster:new", ResourceVersion: "1"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k8sdiff:diffcluster:stale"}, diff.Stale)
+	assert.Equal(t, []string{"k8sdiff:diffcluster:new"}, diff.Missing)
+	assert.Equal(t, []string{"k8sdiff:diffcluster:gone"}, diff.Deleted)
+}
+
 func TestCreateEntityWithMeta(t *testing.T) {
 	dc := db.NewDGClient("127.0.0.1:9080")
 	defer dc.Close()
 	s := NewEntityService(dc)
 	q := NewQueryService(dc)
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "namespace", Type: "uid"})
-	dc.CreateSchema(db.Schema{Predicate: "cluster", Type: "uid"})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "namespace", Type: "uid"})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "cluster", Type: "uid"})
 
 	podMeta := `{
 		"name": "pod",
@@ -113,7 +197,7 @@ func TestCreateEntityWithMeta(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	s.CreateEntity("metadata", dataMap)
+	s.CreateEntity(context.Background(), "metadata", dataMap)
 	// create namespace meta
 	nsMeta := `{
 		"name": "namespace",
@@ -138,7 +222,7 @@ func TestCreateEntityWithMeta(t *testing.T) {
 	}`
 	nsMap := make(map[string]interface{})
 	json.Unmarshal([]byte(nsMeta), &nsMap)
-	s.CreateEntity("metadata", nsMap)
+	s.CreateEntity(context.Background(), "metadata", nsMap)
 	clusterMeta := `{
 		"name": "cluster",
         "objtype" : "metadata",
@@ -155,19 +239,19 @@ func TestCreateEntityWithMeta(t *testing.T) {
 	}`
 	clMap := make(map[string]interface{})
 	json.Unmarshal([]byte(clusterMeta), &clMap)
-	s.CreateEntity("metadata", clMap)
+	s.CreateEntity(context.Background(), "metadata", clMap)
 
 	list := []string{"pod", "cluster", "namespace"}
 	for _, n := range list {
 		// query to get created pod metadata
 		qm := map[string][]string{"name": {n}, "objtype": {"metadata"}}
-		n, _ := q.GetQueryResult(qm)
+		n, _ := q.GetQueryResult(context.Background(), qm)
 		o := n["objects"].([]interface{})[0].(map[string]interface{})
 		// cleanup after test
-		defer s.DeleteEntity(o["uid"].(string))
+		defer s.DeleteEntity(context.Background(), o["uid"].(string))
 		for _, fields := range o["fields"].([]interface{}) {
 			rid := fields.(map[string]interface{})["uid"]
-			defer s.DeleteEntity(rid.(string))
+			defer s.DeleteEntity(context.Background(), rid.(string))
 		}
 	}
 
@@ -189,18 +273,18 @@ func TestCreateEntityWithMeta(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	uid, err := s.CreateEntity("pod", podMap)
+	uid, err := s.CreateEntity(context.Background(), "pod", podMap)
 	if err != nil {
 		panic(err)
 	}
 	podMap["resourceversion"] = "132"
 	podMap["namespace"] = "default"
 	podMap["cluster"] = "cluster01"
-	s.CreateEntity("pod", podMap)
+	s.CreateEntity(context.Background(), "pod", podMap)
 
-	s.DeleteEntityByResourceID("namespace", "namespace:cluster01:default")
-	s.DeleteEntityByResourceID("cluster", "cluster:cluster01")
-	s.dbclient.DeleteEntity(uid)
+	s.DeleteEntityByResourceID(context.Background(), "namespace", "namespace:cluster01:default")
+	s.DeleteEntityByResourceID(context.Background(), "cluster", "cluster:cluster01")
+	s.dbclient.DeleteEntity(context.Background(), uid)
 }
 
 func TestSyncEntities(t *testing.T) {
@@ -210,11 +294,12 @@ func TestSyncEntities(t *testing.T) {
 	s := NewEntityService(dc)
 	q := NewQueryService(dc)
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "namespace", Type: "uid"})
-	dc.CreateSchema(db.Schema{Predicate: "cluster", Type: "uid"})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "namespace", Type: "uid"})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "cluster", Type: "uid"})
 
 	podMeta := `{
 		"name": "pod",
@@ -265,7 +350,7 @@ func TestSyncEntities(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	s.CreateEntity("metadata", dataMap)
+	s.CreateEntity(context.Background(), "metadata", dataMap)
 	// create namespace meta
 	nsMeta := `{
 		"name": "namespace",
@@ -290,7 +375,7 @@ func TestSyncEntities(t *testing.T) {
 	}`
 	nsMap := make(map[string]interface{})
 	json.Unmarshal([]byte(nsMeta), &nsMap)
-	s.CreateEntity("metadata", nsMap)
+	s.CreateEntity(context.Background(), "metadata", nsMap)
 	clusterMeta := `{
 		"name": "cluster",
         "objtype" : "metadata",
@@ -307,19 +392,19 @@ func TestSyncEntities(t *testing.T) {
 	}`
 	clMap := make(map[string]interface{})
 	json.Unmarshal([]byte(clusterMeta), &clMap)
-	s.CreateEntity("metadata", clMap)
+	s.CreateEntity(context.Background(), "metadata", clMap)
 
 	list := []string{"pod", "cluster", "namespace"}
 	for _, n := range list {
 		// query to get created pod metadata
 		qm := map[string][]string{"name": {n}, "objtype": {"metadata"}}
-		n, _ := q.GetQueryResult(qm)
+		n, _ := q.GetQueryResult(context.Background(), qm)
 		o := n["objects"].([]interface{})[0].(map[string]interface{})
 		// cleanup after test
-		defer s.DeleteEntity(o["uid"].(string))
+		defer s.DeleteEntity(context.Background(), o["uid"].(string))
 		for _, fields := range o["fields"].([]interface{}) {
 			rid := fields.(map[string]interface{})["uid"]
-			defer s.DeleteEntity(rid.(string))
+			defer s.DeleteEntity(context.Background(), rid.(string))
 		}
 	}
 
@@ -341,15 +426,15 @@ func TestSyncEntities(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	uid, err := s.CreateEntity("pod", podMap)
+	uid, err := s.CreateEntity(context.Background(), "pod", podMap)
 	if err != nil {
 		panic(err)
 	}
 	podMap["cluster"] = "cluster01"
 	podMap["namespace"] = "default01"
-	s.SyncEntities("pod", []map[string]interface{}{podMap})
+	s.SyncEntities(context.Background(), "pod", []map[string]interface{}{podMap})
 
-	pods, _ := s.GetEntity(uid)
+	pods, _ := s.GetEntity(context.Background(), uid)
 	o := pods["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "131", o["resourceversion"].(string), "pod got unexpected update")
 
@@ -357,9 +442,9 @@ func TestSyncEntities(t *testing.T) {
 	podMap["resourceversion"] = "132"
 	podMap["cluster"] = "cluster01"
 	podMap["namespace"] = "default01"
-	s.SyncEntities("pod", []map[string]interface{}{podMap})
+	s.SyncEntities(context.Background(), "pod", []map[string]interface{}{podMap})
 
-	pod2, _ := s.GetEntity(uid)
+	pod2, _ := s.GetEntity(context.Background(), uid)
 	o = pod2["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "132", o["resourceversion"].(string), "pod got unexpected update")
 
@@ -367,12 +452,14 @@ func TestSyncEntities(t *testing.T) {
 	podMap["cluster"] = "cluster01"
 	podMap["namespace"] = "default01"
 	podMap["name"] = "pod02"
-	s.SyncEntities("pod", []map[string]interface{}{podMap})
+	// a renamed object has a new resourceid
+	delete(podMap, "resourceid")
+	s.SyncEntities(context.Background(), "pod", []map[string]interface{}{podMap})
 	qm := map[string][]string{"name": {"pod01"}, "objtype": {"pod"}}
-	n, _ := q.GetQueryResult(qm)
+	n, _ := q.GetQueryResult(context.Background(), qm)
 	assert.Equal(t, 0, len(n["objects"].([]interface{})), "pod01 still exist")
 	qm2 := map[string][]string{"name": {"pod02"}, "objtype": {"pod"}}
-	n2, _ := q.GetQueryResult(qm2)
+	n2, _ := q.GetQueryResult(context.Background(), qm2)
 	o = n2["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "pod02", o["name"].(string), "pod got unexpected creation")
 
@@ -384,39 +471,42 @@ func TestSyncEntities(t *testing.T) {
 		"objtype":         "namespace",
 		"resourceversion": "0",
 	}
-	s.SyncEntities("namespace", []map[string]interface{}{nsData})
+	s.SyncEntities(context.Background(), "namespace", []map[string]interface{}{nsData})
 	qm3 := map[string][]string{"name": {"default01"}, "objtype": {"namespace"}}
-	n3, _ := q.GetQueryResult(qm3)
+	n3, _ := q.GetQueryResult(context.Background(), qm3)
 	o3 := n3["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "default01", o3["name"].(string), "namespace default01 updated")
 
 	nsData["cluster"] = "cluster01"
 	nsData["name"] = "default02"
-	s.SyncEntities("namespace", []map[string]interface{}{nsData})
+	delete(nsData, "resourceid")
+	s.SyncEntities(context.Background(), "namespace", []map[string]interface{}{nsData})
 	qm4 := map[string][]string{"name": {"default01"}, "objtype": {"namespace"}}
-	n4, _ := q.GetQueryResult(qm4)
+	n4, _ := q.GetQueryResult(context.Background(), qm4)
 	assert.Equal(t, 0, len(n4["objects"].([]interface{})), "default namespace still exist")
 	qm5 := map[string][]string{"name": {"default02"}, "objtype": {"namespace"}}
-	n5, _ := q.GetQueryResult(qm5)
+	n5, _ := q.GetQueryResult(context.Background(), qm5)
 	o5 := n5["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "default02", o5["name"].(string), "namespace got unexpected creation")
-	s.dbclient.DeleteEntity(o5["uid"].(string))
+	s.dbclient.DeleteEntity(context.Background(), o5["uid"].(string))
 
-	pod3, err := s.GetEntity(uid)
+	pod3, err := s.GetEntity(context.Background(), uid)
 	if err != nil {
 		assert.Fail(t, "Failed to get created pod")
 	}
-	fs, _ := ms.GetMetadataFields("pod")
+	fs, _ := ms.GetMetadataFields(context.Background(), "pod")
 	for _, f := range fs {
 		if f.FieldType == "relationship" {
 			for _, o := range pod3["objects"].([]interface{}) {
-				for _, r := range o.(map[string]interface{})[f.FieldName].([]interface{}) {
-					s.dbclient.DeleteEntity(r.(map[string]interface{})["uid"].(string))
+				// the tombstone of pod01 has no relationships
+				rels, _ := o.(map[string]interface{})[f.FieldName].([]interface{})
+				for _, r := range rels {
+					s.dbclient.DeleteEntity(context.Background(), r.(map[string]interface{})["uid"].(string))
 				}
 			}
 		}
 	}
-	s.dbclient.DeleteEntity(uid)
+	s.dbclient.DeleteEntity(context.Background(), uid)
 
 }
 
@@ -424,9 +514,10 @@ func TestMultiCreateEntity(t *testing.T) {
 	dc := db.NewDGClient("127.0.0.1:9080")
 	q := NewQueryService(dc)
 	defer dc.Close()
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
 	s := NewEntityService(dc)
 	var wg sync.WaitGroup
 	rest := make(chan string)
@@ -440,7 +531,7 @@ func TestMultiCreateEntity(t *testing.T) {
 				"label":      version,
 				"resourceid": "cluster:ns:multinode",
 			}
-			nid, _ := s.CreateEntity("k8snode", node)
+			nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
 			rest <- nid
 		}(strconv.Itoa(i))
 	}
@@ -455,7 +546,7 @@ func TestMultiCreateEntity(t *testing.T) {
 				"resourceid":      "cluster:ns:multinode2",
 				"resourceversion": version,
 			}
-			nid, _ := s.CreateEntity("k8snode", node)
+			nid, _ := s.CreateEntity(context.Background(), "k8snode", node)
 			rest <- nid
 		}(strconv.Itoa(i))
 	}
@@ -467,11 +558,86 @@ func TestMultiCreateEntity(t *testing.T) {
 	}()
 	wg.Wait()
 	qm := map[string][]string{"resourceid": {"cluster:ns:multinode"}, "objtype": {"k8snode"}}
-	n, _ := q.GetQueryResult(qm)
+	n, _ := q.GetQueryResult(context.Background(), qm)
 	o := n["objects"].([]interface{})
 	assert.Equal(t, 1, len(o), "only one object expect to be created with same resourceid")
-	s.DeleteEntityByResourceID("k8snode", "cluster:ns:multinode")
-	s.DeleteEntityByResourceID("k8snode", "cluster:ns:multinode2")
+	s.DeleteEntityByResourceID(context.Background(), "k8snode", "cluster:ns:multinode")
+	s.DeleteEntityByResourceID(context.Background(), "k8snode", "cluster:ns:multinode2")
+}
+
+// replicaEnv is set to "<replica>:<start in unix ns>" on the test binary run as a replica by TestMultiReplicaCreateEntity
+const replicaEnv = "KATLAS_TEST_REPLICA"
+
+// replicas of the service run in their own processes and only share the store
+func TestMultiReplicaCreateEntity(t *testing.T) {
+	if replica := os.Getenv(replicaEnv); replica != "" {
+		runReplica(t, replica)
+		return
+	}
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+
+	// the replicas start writing at the same time
+	start := time.Now().Add(2 * time.Second).UnixNano()
+	var cmds []*exec.Cmd
+	var outs []*bytes.Buffer
+	for i := 0; i < 4; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMultiReplicaCreateEntity$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d:%d", replicaEnv, i, start))
+		out := &bytes.Buffer{}
+		cmd.Stdout = out
+		cmd.Stderr = out
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+		outs = append(outs, out)
+	}
+	for i, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("replica %d: %v\n%s", i, err, outs[i])
+		}
+	}
+	q := NewQueryService(dc)
+	qm := map[string][]string{"resourceid": {"cluster:replicanode"}, "objtype": {"k8snode"}}
+	n, _ := q.GetQueryResult(context.Background(), qm)
+	objs := n["objects"].([]interface{})
+	if assert.Equal(t, 1, len(objs), "only one object expect to be created across replicas") {
+		assert.Equal(t, "39", objs[0].(map[string]interface{})["resourceversion"], "newest version not kept")
+	}
+	NewEntityService(dc).DeleteEntityByResourceID(context.Background(), "k8snode", "cluster:replicanode")
+}
+
+// runReplica write versions replica, replica+4, ... of the same object concurrently from this process
+func runReplica(t *testing.T, replica string) {
+	var id int
+	var start int64
+	if _, err := fmt.Sscanf(replica, "%d:%d", &id, &start); err != nil {
+		t.Fatal(err)
+	}
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewEntityService(dc)
+	time.Sleep(time.Until(time.Unix(0, start)))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(version string) {
+			defer wg.Done()
+			node := map[string]interface{}{
+				"objtype":         "k8snode",
+				"name":            "replicanode",
+				"resourceid":      "cluster:replicanode",
+				"resourceversion": version,
+			}
+			_, err := s.CreateEntity(context.Background(), "k8snode", node)
+			assert.Nil(t, err)
+		}(strconv.Itoa(id + 4*i))
+	}
+	wg.Wait()
 }
 
 func TestCreateRelByUid(t *testing.T) {
@@ -480,11 +646,12 @@ func TestCreateRelByUid(t *testing.T) {
 	s := NewEntityService(dc)
 	q := NewQueryService(dc)
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "namespace", Type: "uid"})
-	dc.CreateSchema(db.Schema{Predicate: "cluster", Type: "uid"})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "namespace", Type: "uid"})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "cluster", Type: "uid"})
 
 	podMeta := `{
 		"name": "pod",
@@ -535,7 +702,7 @@ func TestCreateRelByUid(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	s.CreateEntity("metadata", dataMap)
+	s.CreateEntity(context.Background(), "metadata", dataMap)
 	// create namespace meta
 	nsMeta := `{
 		"name": "namespace",
@@ -560,7 +727,7 @@ func TestCreateRelByUid(t *testing.T) {
 	}`
 	nsMap := make(map[string]interface{})
 	json.Unmarshal([]byte(nsMeta), &nsMap)
-	s.CreateEntity("metadata", nsMap)
+	s.CreateEntity(context.Background(), "metadata", nsMap)
 	clusterMeta := `{
 		"name": "cluster",
         "objtype" : "metadata",
@@ -577,26 +744,26 @@ func TestCreateRelByUid(t *testing.T) {
 	}`
 	clMap := make(map[string]interface{})
 	json.Unmarshal([]byte(clusterMeta), &clMap)
-	s.CreateEntity("metadata", clMap)
+	s.CreateEntity(context.Background(), "metadata", clMap)
 
 	list := []string{"pod", "cluster", "namespace"}
 	for _, n := range list {
 		// query to get created pod metadata
 		qm := map[string][]string{"name": {n}, "objtype": {"metadata"}}
-		n, _ := q.GetQueryResult(qm)
+		n, _ := q.GetQueryResult(context.Background(), qm)
 		o := n["objects"].([]interface{})[0].(map[string]interface{})
 		// cleanup after test
-		defer s.DeleteEntity(o["uid"].(string))
+		defer s.DeleteEntity(context.Background(), o["uid"].(string))
 		for _, fields := range o["fields"].([]interface{}) {
 			rid := fields.(map[string]interface{})["uid"]
-			defer s.DeleteEntity(rid.(string))
+			defer s.DeleteEntity(context.Background(), rid.(string))
 		}
 	}
 
 	// create namespace
 	ns := map[string]interface{}{"name": "ns01", "cluster": "c01", "objtype": "namespace"}
-	uid, err := s.CreateEntity("namespace", ns)
-	defer s.dbclient.DeleteEntity(uid)
+	uid, err := s.CreateEntity(context.Background(), "namespace", ns)
+	defer s.dbclient.DeleteEntity(context.Background(), uid)
 
 	// create pod data
 	pod := `{
@@ -612,41 +779,42 @@ func TestCreateRelByUid(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	uid2, err := s.CreateEntity("pod", podMap)
+	uid2, err := s.CreateEntity(context.Background(), "pod", podMap)
 	if err != nil {
 		panic(err)
 	}
 
-	pods, err := s.GetEntity(uid2)
+	pods, err := s.GetEntity(context.Background(), uid2)
 	if err != nil {
 		assert.Fail(t, "Failed to get created pod")
 	}
 	o2 := pods["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, uid, o2["namespace"].([]interface{})[0].(map[string]interface{})["uid"], "pod's namespace should be linked to existing one")
-	s.dbclient.DeleteEntity(uid2)
-	s.DeleteEntityByResourceID("cluster", "cluster:c01")
+	s.dbclient.DeleteEntity(context.Background(), uid2)
+	s.DeleteEntityByResourceID(context.Background(), "cluster", "cluster:c01")
 }
 
 func TestEntityUpdate(t *testing.T) {
 	dc := db.NewDGClient("127.0.0.1:9080")
 	defer dc.Close()
 	s := NewEntityService(dc)
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
 	pod := map[string]interface{}{
 		"name":       "pod03",
 		"resourceid": "pod:pod03",
 		"objtype":    "pod",
 	}
-	pid, _ := s.CreateEntity("pod", pod)
-	s.UpdateEntity(pid, map[string]interface{}{"name": "pod04"})
-	pods, _ := s.GetEntity(pid)
+	pid, _ := s.CreateEntity(context.Background(), "pod", pod)
+	s.UpdateEntity(context.Background(), pid, map[string]interface{}{"name": "pod04"})
+	pods, _ := s.GetEntity(context.Background(), pid)
 	o := pods["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "pod04", o["name"], "pod name should be updated")
 	// try update with lower resource version
-	s.UpdateEntity(pid, map[string]interface{}{"name": "pod05", "resourceversion": "0"})
-	pods, _ = s.GetEntity(pid)
+	s.UpdateEntity(context.Background(), pid, map[string]interface{}{"name": "pod05", "resourceversion": "0"})
+	pods, _ = s.GetEntity(context.Background(), pid)
 	o = pods["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, "pod04", o["name"], "pod should not be updated due to version conflict")
 	ns := map[string]interface{}{
@@ -654,10 +822,10 @@ func TestEntityUpdate(t *testing.T) {
 		"resourceid": "ns:ns01",
 		"objtype":    "namespace",
 	}
-	nid, _ := s.CreateEntity("namespace", ns)
+	nid, _ := s.CreateEntity(context.Background(), "namespace", ns)
 	// update with relationship
-	s.UpdateEntity(pid, map[string]interface{}{"ns": map[string]string{"uid": nid}})
-	pods, _ = s.GetEntity(pid)
+	s.UpdateEntity(context.Background(), pid, map[string]interface{}{"ns": map[string]string{"uid": nid}})
+	pods, _ = s.GetEntity(context.Background(), pid)
 	o = pods["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, nid, o["ns"].([]interface{})[0].(map[string]interface{})["uid"], "pod name should be updated with edge")
 	ns2 := map[string]interface{}{
@@ -665,12 +833,42 @@ func TestEntityUpdate(t *testing.T) {
 		"resourceid": "ns:ns02",
 		"objtype":    "namespace",
 	}
-	nid2, _ := s.CreateEntity("namespace", ns2)
-	s.UpdateEntity(pid, map[string]interface{}{"ns": map[string]string{"uid": nid2}})
-	pods, _ = s.GetEntity(pid)
+	nid2, _ := s.CreateEntity(context.Background(), "namespace", ns2)
+	s.UpdateEntity(context.Background(), pid, map[string]interface{}{"ns": map[string]string{"uid": nid2}})
+	pods, _ = s.GetEntity(context.Background(), pid)
 	o = pods["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, nid2, o["ns"].([]interface{})[0].(map[string]interface{})["uid"], "pod name should be updated with edge")
-	defer s.DeleteEntity(pid)
-	defer s.DeleteEntity(nid)
-	defer s.DeleteEntity(nid2)
+	defer s.DeleteEntity(context.Background(), pid)
+	defer s.DeleteEntity(context.Background(), nid)
+	defer s.DeleteEntity(context.Background(), nid2)
+}
+
+// BenchmarkCreateEntity measures the write path of the collectors, half of the writes update an existing object
+func BenchmarkCreateEntity(b *testing.B) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	s := NewEntityService(dc)
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+
+	uids := map[string]bool{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		uid, err := s.CreateEntity(context.Background(), "k8sbenchmark", map[string]interface{}{
+			"objtype":         "k8sbenchmark",
+			"name":            fmt.Sprintf("pod%d", i/2),
+			"resourceid":      fmt.Sprintf("k8sbenchmark:pod%d", i/2),
+			"resourceversion": strconv.Itoa(i),
+			"status":          "Running",
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		uids[uid] = true
+	}
+	b.StopTimer()
+	for uid := range uids {
+		s.DeleteEntity(context.Background(), uid)
+	}
 }
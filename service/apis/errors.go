@@ -0,0 +1,92 @@
+package apis
+
+import (
+	"fmt"
+)
+
+// Code of an error, tells clients what failed without parsing the message
+type Code string
+
+// codes of the errors of the services, the REST APIs map them to their http status
+const (
+	// CodeNotFound the resource of the request does not exist
+	CodeNotFound Code = "NotFound"
+	// CodeInvalid the request is malformed or its parameters are not valid
+	CodeInvalid Code = "Invalid"
+	// CodeConflict the request conflicts with the state of the resource
+	CodeConflict Code = "Conflict"
+	// CodeUnavailable dgraph or a lock could not be reached in time, the request may be retried
+	CodeUnavailable Code = "Unavailable"
+	// CodeUnauthorized the request has no valid credentials
+	CodeUnauthorized Code = "Unauthorized"
+	// CodeForbidden the caller is not allowed to do the request, e.g. outside its scopes
+	CodeForbidden Code = "Forbidden"
+)
+
+// Error of the services with its code, Details are fields for the clients to act on the error
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+	// Err is the cause of the error if any
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithDetails add a detail to a new error and return it, the shared errors such as ErrClusterNotFound must not be changed
+func (e *Error) WithDetails(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = map[string]interface{}{}
+	}
+	e.Details[key] = value
+	return e
+}
+
+// NotFound return an error of a resource that does not exist
+func NotFound(format string, a ...interface{}) *Error {
+	return newError(CodeNotFound, nil, format, a...)
+}
+
+// Invalid return an error of a malformed request or parameter
+func Invalid(format string, a ...interface{}) *Error {
+	return newError(CodeInvalid, nil, format, a...)
+}
+
+// Conflict return an error of a request conflicting with the state of the resource
+func Conflict(format string, a ...interface{}) *Error {
+	return newError(CodeConflict, nil, format, a...)
+}
+
+// Unavailable return an error of a dependency that could not be reached, caused by err if not nil
+func Unavailable(err error, format string, a ...interface{}) *Error {
+	return newError(CodeUnavailable, err, format, a...)
+}
+
+// Unauthorized return an error of a request without valid credentials
+func Unauthorized(format string, a ...interface{}) *Error {
+	return newError(CodeUnauthorized, nil, format, a...)
+}
+
+// Forbidden return an error of a caller not allowed to do the request
+func Forbidden(format string, a ...interface{}) *Error {
+	return newError(CodeForbidden, nil, format, a...)
+}
+
+func newError(code Code, err error, format string, a ...interface{}) *Error {
+	msg := fmt.Sprintf(format, a...)
+	if err != nil {
+		msg += ": " + err.Error()
+	}
+	return &Error{Code: code, Message: msg, Err: err}
+}
+
+// CodeOf return the code of err, empty if err is not an *Error
+func CodeOf(err error) Code {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return ""
+}
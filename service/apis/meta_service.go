@@ -1,34 +1,37 @@
 package apis
 
 import (
+	"context"
 	"fmt"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/hashicorp/golang-lru"
 	"github.com/intuit/katlas/service/db"
 	"github.com/intuit/katlas/service/util"
 	"github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
 	"strings"
 )
 
 // IMetaService define interfaces for metadata
 type IMetaService interface {
 	// Get metadata by name
-	GetMetadata(name string) (*Metadata, error)
+	GetMetadata(ctx context.Context, name string) (*Metadata, error)
 	// Create new metadata
-	CreateMetadata(data Metadata) (string, error)
+	CreateMetadata(ctx context.Context, data Metadata) (string, error)
 	// Delete metadata
-	DeleteMetadata(name string) error
+	DeleteMetadata(ctx context.Context, name string) error
 	// Update metadata
-	UpdateMetadata(name string, data map[string]interface{}) error
+	UpdateMetadata(ctx context.Context, name string, data map[string]interface{}) error
 	// Get all metadata fields
-	GetMetadataFields(name string) ([]MetadataField, error)
+	GetMetadataFields(ctx context.Context, name string) ([]MetadataField, error)
 	// Create schema
-	CreateSchema(sm db.Schema) error
+	CreateSchema(ctx context.Context, sm db.Schema) error
 	// Drop a schema
-	DropSchema(name string) error
+	DropSchema(ctx context.Context, name string) error
 	// Remove schema from cache
 	RemoveSchemaCache(cache *lru.Cache)
+	// Define the type of the entities and set it and the resource version number on the entities without them
+	SyncEntityType(ctx context.Context) error
 }
 
 // MetaService implements IMetaService interface
@@ -62,12 +65,12 @@ type MetadataField struct {
 }
 
 // GetMetadata get entity return the object with specified ID
-func (s MetaService) GetMetadata(name string) (*Metadata, error) {
+func (s MetaService) GetMetadata(ctx context.Context, name string) (*Metadata, error) {
 	//var n Metadata
 	qm := map[string][]string{util.Name: {name}, util.ObjType: {util.Metadata}}
 	// Get metadata by name
 	queryService := NewQueryService(s.dbclient)
-	metas, err := queryService.GetQueryResult(qm)
+	metas, err := queryService.GetQueryResult(ctx, qm)
 	if err != nil {
 		return nil, err
 	}
@@ -89,11 +92,11 @@ func NewMetaService(dc db.IDGClient) *MetaService {
 }
 
 // GetMetadataFields EntityService will call this method to get all fields to verify and create edge accordingly
-func (s MetaService) GetMetadataFields(name string) ([]MetadataField, error) {
+func (s MetaService) GetMetadataFields(ctx context.Context, name string) ([]MetadataField, error) {
 	qm := map[string][]string{util.Name: {name}, util.ObjType: {util.Metadata}}
 	// Get metadata by name
 	queryService := NewQueryService(s.dbclient)
-	metas, err := queryService.GetQueryResult(qm)
+	metas, err := queryService.GetQueryResult(ctx, qm)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +116,7 @@ func (s MetaService) GetMetadataFields(name string) ([]MetadataField, error) {
 func CheckKeys(keys []string, data map[string]interface{}) error {
 	for k := range keys {
 		if _, ok := data[keys[k]]; !ok {
-			return fmt.Errorf("%q doesn't exist", keys[k])
+			return Invalid("%q doesn't exist", keys[k])
 		}
 	}
 	return nil
@@ -131,12 +134,12 @@ func SetDefaultKey(dkMap map[string]interface{}, data map[string]interface{}) er
 }
 
 // CreateMetadata save new metadata to the storage
-func (s MetaService) CreateMetadata(data map[string]interface{}) (string, error) {
+func (s MetaService) CreateMetadata(ctx context.Context, data map[string]interface{}) (string, error) {
 	queryService := NewQueryService(s.dbclient)
 	qm := map[string][]string{util.Name: {data[util.Name].(string)}, util.ObjType: {util.Metadata}}
-	metas, _ := queryService.GetQueryResult(qm)
+	metas, _ := queryService.GetQueryResult(ctx, qm)
 	if len(metas[util.Objects].([]interface{})) > 0 {
-		return "", fmt.Errorf("metadata %s already exist, creation failed", data[util.Name].(string))
+		return "", Conflict("metadata %s already exist, creation failed", data[util.Name].(string))
 	}
 	var rkeys = []string{util.Name, util.Fields, util.ObjType}
 	err := CheckKeys(rkeys, data)
@@ -145,7 +148,7 @@ func (s MetaService) CreateMetadata(data map[string]interface{}) (string, error)
 	}
 	fMap, ok := data[util.Fields].([]interface{})
 	if !ok {
-		return "", fmt.Errorf("error in metadata field")
+		return "", Invalid("error in metadata field")
 	}
 
 	if len(fMap) > 0 {
@@ -163,7 +166,7 @@ func (s MetaService) CreateMetadata(data map[string]interface{}) (string, error)
 		}
 	}
 	e := NewEntityService(s.dbclient)
-	uid, err := e.CreateEntity(util.Metadata, data)
+	uid, err := e.CreateEntity(ctx, util.Metadata, data)
 
 	if err != nil {
 		log.Error(err)
@@ -173,13 +176,34 @@ func (s MetaService) CreateMetadata(data map[string]interface{}) (string, error)
 }
 
 // CreateSchema creates schema
-func (s MetaService) CreateSchema(sm db.Schema) error {
-	return s.dbclient.CreateSchema(sm)
+func (s MetaService) CreateSchema(ctx context.Context, sm db.Schema) error {
+	return s.dbclient.CreateSchema(ctx, sm)
 }
 
 // DropSchema to remove schema
-func (s MetaService) DropSchema(name string) error {
-	return s.dbclient.DropSchema(name)
+func (s MetaService) DropSchema(ctx context.Context, name string) error {
+	return s.dbclient.DropSchema(ctx, name)
+}
+
+// SyncEntityType define the dgraph type of the entities with all the predicates of the schema
+// and set it and the resource version number on the entities written without them by a previous version
+func (s MetaService) SyncEntityType(ctx context.Context) error {
+	err := s.dbclient.SyncEntityType(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := s.dbclient.TypeEntities(ctx)
+	if n > 0 {
+		log.Infof("%s type set on %d entities", db.EntityType, n)
+	}
+	if err != nil {
+		return err
+	}
+	n, err = s.dbclient.NumberVersions(ctx)
+	if n > 0 {
+		log.Infof("%s set on %d entities", util.VersionNumber, n)
+	}
+	return err
 }
 
 // RemoveSchemaCache to clean lru cache
@@ -188,11 +212,11 @@ func (s MetaService) RemoveSchemaCache(cache *lru.Cache) {
 }
 
 // DeleteMetadata to remove metadata if not been referenced by others
-func (s MetaService) DeleteMetadata(name string) error {
+func (s MetaService) DeleteMetadata(ctx context.Context, name string) error {
 	qm := map[string][]string{util.ObjType: {util.Metadata}}
 	// Get metadata by name
 	queryService := NewQueryService(s.dbclient)
-	metas, err := queryService.GetQueryResult(qm)
+	metas, err := queryService.GetQueryResult(ctx, qm)
 	if err != nil {
 		return err
 	}
@@ -205,7 +229,7 @@ func (s MetaService) DeleteMetadata(name string) error {
 		}
 		for _, field := range metadata.Fields {
 			if strings.Contains(field.RefDataType, name) {
-				return fmt.Errorf("not able to delete metadata %s which is referenced by %s", name, metadata.Name)
+				return Conflict("not able to delete metadata %s which is referenced by %s", name, metadata.Name)
 			}
 		}
 		if metadata.Name == name {
@@ -213,20 +237,20 @@ func (s MetaService) DeleteMetadata(name string) error {
 		}
 	}
 	for _, field := range target.Fields {
-		err = s.dbclient.DeleteEntity(field.UID)
+		err = s.dbclient.DeleteEntity(ctx, field.UID)
 		if err != nil {
 			return err
 		}
 	}
-	return s.dbclient.DeleteEntity(target.UID)
+	return s.dbclient.DeleteEntity(ctx, target.UID)
 }
 
 // UpdateMetadata update metadata fields
 // The payload can include either new fields or existing fields
-func (s MetaService) UpdateMetadata(name string, data map[string]interface{}) error {
+func (s MetaService) UpdateMetadata(ctx context.Context, name string, data map[string]interface{}) error {
 	qm := map[string][]string{util.Name: {name}, util.ObjType: {util.Metadata}}
 	queryService := NewQueryService(s.dbclient)
-	metas, err := queryService.GetQueryResult(qm)
+	metas, err := queryService.GetQueryResult(ctx, qm)
 	if err != nil {
 		return err
 	}
@@ -252,8 +276,8 @@ func (s MetaService) UpdateMetadata(name string, data map[string]interface{}) er
 			}
 		}
 		e := NewEntityService(s.dbclient)
-		err := e.UpdateEntity(metadata.UID, data, util.OptionContext{ReplaceListOrEdge: false})
+		err := e.UpdateEntity(ctx, metadata.UID, data, util.OptionContext{ReplaceListOrEdge: false})
 		return err
 	}
-	return fmt.Errorf("metadata %s not found", name)
+	return NotFound("metadata %s not found", name)
 }
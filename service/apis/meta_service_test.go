@@ -1,6 +1,7 @@
 package apis
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -42,29 +43,30 @@ func TestMetaService(t *testing.T) {
 		]
 	}`
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
 	// create pod metadata
 	dataMap := make(map[string]interface{})
 	err := json.Unmarshal([]byte(podMeta), &dataMap)
 	if err != nil {
 		panic(err)
 	}
-	m.CreateMetadata(dataMap)
+	m.CreateMetadata(context.Background(), dataMap)
 	// query to get created pod metadata
 	qm := map[string][]string{"name": {"pod_metadata"}, "objtype": {"metadata"}}
-	n, _ := q.GetQueryResult(qm)
+	n, _ := q.GetQueryResult(context.Background(), qm)
 	o := n["objects"].([]interface{})[0].(map[string]interface{})
 	// cleanup after test
-	defer e.DeleteEntity(o["uid"].(string))
+	defer e.DeleteEntity(context.Background(), o["uid"].(string))
 	assert.Equal(t, o["name"], "pod_metadata", "query return doesn't match pod_metadata")
 	for _, fields := range o["fields"].([]interface{}) {
 		rid := fields.(map[string]interface{})["uid"]
-		defer e.DeleteEntity(rid.(string))
+		defer e.DeleteEntity(context.Background(), rid.(string))
 	}
 	// get all fields
-	fs, err := m.GetMetadataFields("pod_metadata")
+	fs, err := m.GetMetadataFields(context.Background(), "pod_metadata")
 	if err != nil {
 		assert.Fail(t, "Failed to get meta fields")
 	}
@@ -103,16 +105,17 @@ func TestDeleteMetadata(t *testing.T) {
 		]
 	}`
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
 	// create pod metadata
 	dataMap := make(map[string]interface{})
 	err := json.Unmarshal([]byte(podMeta), &dataMap)
 	if err != nil {
 		panic(err)
 	}
-	m.CreateMetadata(dataMap)
+	m.CreateMetadata(context.Background(), dataMap)
 	// create referenced metadata
 	k8container := `{
 		"name": "k8container",
@@ -131,17 +134,17 @@ func TestDeleteMetadata(t *testing.T) {
 	if err != nil {
 		panic(err)
 	}
-	m.CreateMetadata(cmap)
+	m.CreateMetadata(context.Background(), cmap)
 	// delete fail due to meta been referenced
-	error := m.DeleteMetadata("k8container")
+	error := m.DeleteMetadata(context.Background(), "k8container")
 	assert.NotNil(t, error)
 	// remove pod metadata
-	error = m.DeleteMetadata("pod_metadata")
+	error = m.DeleteMetadata(context.Background(), "pod_metadata")
 	qm := map[string][]string{"name": {"pod_metadata"}, "objtype": {"metadata"}}
-	n, _ := q.GetQueryResult(qm)
+	n, _ := q.GetQueryResult(context.Background(), qm)
 	assert.Empty(t, n["objects"])
 	// clean
-	m.DeleteMetadata("k8container")
+	m.DeleteMetadata(context.Background(), "k8container")
 }
 
 func TestMetadataUpdate(t *testing.T) {
@@ -169,32 +172,33 @@ func TestMetadataUpdate(t *testing.T) {
 		]
 	}`
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
 	// create pod metadata
 	dataMap := make(map[string]interface{})
 	err := json.Unmarshal([]byte(podMeta), &dataMap)
 	if err != nil {
 		panic(err)
 	}
-	m.CreateMetadata(dataMap)
+	m.CreateMetadata(context.Background(), dataMap)
 	fs := make([]interface{}, 0)
 	f := map[string]interface{}{
 		"fieldname": "name",
 		"fieldtype": "string",
 	}
 	fs = append(fs, f)
-	m.UpdateMetadata("pod_metadata", map[string]interface{}{
+	m.UpdateMetadata(context.Background(), "pod_metadata", map[string]interface{}{
 		"fields": fs,
 	})
 	qm := map[string][]string{"name": {"pod_metadata"}, "objtype": {"metadata"}}
-	n, _ := q.GetQueryResult(qm)
+	n, _ := q.GetQueryResult(context.Background(), qm)
 	o := n["objects"].([]interface{})[0].(map[string]interface{})
 	var metadata Metadata
 	mapstructure.Decode(o, &metadata)
 	for _, f := range metadata.Fields {
 		assert.Equal(t, "string", f.FieldType, "fieldtype should updated to string")
 	}
-	m.DeleteMetadata("pod_metadata")
+	m.DeleteMetadata(context.Background(), "pod_metadata")
 }
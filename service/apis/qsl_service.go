@@ -1,7 +1,7 @@
 package apis
 
 import (
-	"errors"
+	"context"
 	"regexp"
 	"strings"
 	"time"
@@ -9,10 +9,10 @@ import (
 
 	"crypto/rand"
 	"fmt"
-	log "github.com/Sirupsen/logrus"
 	"github.com/intuit/katlas/service/db"
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
 	"strconv"
 )
 
@@ -28,7 +28,10 @@ type QSLService struct {
 }
 
 // MaximumLimit define pagination limit
-const MaximumLimit = 10000
+var MaximumLimit = 10000
+
+// DefaultLimit is the page size when the query has no limit
+var DefaultLimit = 1000
 
 // IsAlphaNum determine if string is made up of only alphanumeric characters
 func IsAlphaNum(s string) bool {
@@ -51,12 +54,12 @@ func IsStar(s string) bool {
 }
 
 // GetMetadata - get a list of the fields supoorted for this object type
-func (qa *QSLService) GetMetadata(objtype string) ([]MetadataField, error) {
+func (qa *QSLService) GetMetadata(ctx context.Context, objtype string) ([]MetadataField, error) {
 	m := NewMetaService(qa.DBclient)
-	metafieldslist, err := m.GetMetadataFields(objtype)
+	metafieldslist, err := m.GetMetadataFields(ctx, objtype)
 	if err != nil {
 		log.Error(err)
-		return []MetadataField{}, errors.New("Failed to connect to dgraph to get metadata")
+		return []MetadataField{}, Unavailable(err, "Failed to connect to dgraph to get metadata")
 	}
 
 	if len(metafieldslist) == 0 {
@@ -103,14 +106,14 @@ func CreateFiltersQuery(filterlist string) (string, string, error) {
 			case util.Offset:
 				paginate += "," + splitval[0] + ": " + splitval[1]
 			default:
-				return "", "", errors.New("Invalid pagination filters in " + filterlist)
+				return "", "", Invalid("Invalid pagination filters in %s", filterlist)
 			}
 			val, err := strconv.Atoi(splitval[1])
 			if err != nil {
-				return "", "", errors.New("Pagination format error " + filterlist)
+				return "", "", Invalid("Pagination format error %s", filterlist)
 			}
 			if splitval[0] == util.Limit && val > MaximumLimit {
-				return "", "", fmt.Errorf("pagination exceeding maxiumum limit %d", MaximumLimit)
+				return "", "", Invalid("pagination exceeding maxiumum limit %d", MaximumLimit)
 			}
 		}
 		// get rid of the first comma
@@ -148,7 +151,7 @@ func CreateFiltersQuery(filterlist string) (string, string, error) {
 			// should be 4 elements in matches
 			// the whole string, key, operator, value
 			if len(matches) < 4 {
-				return "", "", errors.New("Invalid filters in " + filterlist)
+				return "", "", Invalid("Invalid filters in %s", filterlist)
 			}
 
 			keyname := matches[1]
@@ -162,7 +165,7 @@ func CreateFiltersQuery(filterlist string) (string, string, error) {
 				keyname = tmp[0]
 				value = "/\"" + tmp[1] + "\" *: *" + value + "/"
 				if operator != "=" && operator != "~=" {
-					return "", "", errors.New("Filter on json type can only use equal or regexp operator " + filterlist)
+					return "", "", Invalid("Filter on json type can only use equal or regexp operator %s", filterlist)
 				}
 				operator = "~="
 			} else {
@@ -174,7 +177,7 @@ func CreateFiltersQuery(filterlist string) (string, string, error) {
 
 			// if the value is a string make sure it has quotes on both sides
 			if string(value[0]) == "\"" && !(string(value[len(value)-1]) == "\"") {
-				return "", "", errors.New("Invalid filters in " + filterlist)
+				return "", "", Invalid("Invalid filters in %s", filterlist)
 			}
 
 			// if keyname is count filter, add prefix cnt_ to the var name
@@ -227,7 +230,7 @@ func CreateFieldsQuery(fieldlist string, metafieldslist []MetadataField, tabs in
 			}
 			return returnlist, nil
 		}
-		return nil, errors.New("Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both [" + fieldlist + "]")
+		return nil, Invalid("Fields may be a string of * indicating how many levels, or a list of fields @field1,@field2,... not both [%s]", fieldlist)
 
 	}
 	splitlist := strings.Split(fieldlist, ",")
@@ -242,11 +245,11 @@ func CreateFieldsQuery(fieldlist string, metafieldslist []MetadataField, tabs in
 			if IsAlphaNum(item[1:]) {
 				returnlist = append(returnlist, strings.Repeat("\t", tabs+1)+item[1:])
 			} else {
-				return nil, errors.New("Field names must be composed of only alphanumeric characters [" + item[1:] + "]")
+				return nil, Invalid("Field names must be composed of only alphanumeric characters [%s]", item[1:])
 			}
 
 		} else {
-			return nil, errors.New("Field names must be prefixed with @ sign and followed by an alphanumeric field name [" + item + "]")
+			return nil, Invalid("Field names must be prefixed with @ sign and followed by an alphanumeric field name [%s]", item)
 		}
 
 	}
@@ -257,7 +260,8 @@ func CreateFieldsQuery(fieldlist string, metafieldslist []MetadataField, tabs in
 }
 
 // CreateDgraphQuery translates the querystring to a dgraph query
-func (qa *QSLService) CreateDgraphQuery(query string, cntOnly bool) (string, error) {
+// the Scopes of option restrict every block to the entities the caller may access
+func (qa *QSLService) CreateDgraphQuery(ctx context.Context, query string, cntOnly bool, option ...util.OptionContext) (string, error) {
 	log.Info("Received Query: ", strings.Split(query, "}."))
 	metrics.DgraphNumQSL.Inc()
 
@@ -273,15 +277,16 @@ func (qa *QSLService) CreateDgraphQuery(query string, cntOnly bool) (string, err
 	edgeTemplate := "\t$RELATION @filter(eq(objtype, $OBJTYPE) $FILTERSFUNC)"
 	pageTemplate := "{ objects(func: uid(A)$PAGINATE) {"
 	brakets := []string{"}", "}"}
+	scope := ScopeFilter(scopeOption(option))
 
-	root, objType, rootCntFilter, err := qa.buildRootQuery(splitQuery[0], rootTemplate, true)
+	root, objType, rootCntFilter, err := qa.buildRootQuery(ctx, splitQuery[0], rootTemplate, true, scope)
 	if err != nil {
 		return "", err
 	}
 	parentType := objType
 	edgeCntFilters := []string{}
 	for i := 1; i < len(splitQuery); i++ {
-		edges, ptype, edgeCntFilter, err := qa.buildEdgeQuery(splitQuery[i], edgeTemplate, parentType, true)
+		edges, ptype, edgeCntFilter, err := qa.buildEdgeQuery(ctx, splitQuery[i], edgeTemplate, parentType, true, scope)
 		if err != nil {
 			return "", err
 		}
@@ -293,14 +298,14 @@ func (qa *QSLService) CreateDgraphQuery(query string, cntOnly bool) (string, err
 		}
 	}
 	root = append(root, brakets...)
-	pages, _, _, err := qa.buildRootQuery(splitQuery[0], pageTemplate, cntOnly)
+	pages, _, _, err := qa.buildRootQuery(ctx, splitQuery[0], pageTemplate, cntOnly, scope)
 	if err != nil {
 		return "", err
 	}
 	root = append(root, pages...)
 	parentType = objType
 	for i := 1; i < len(splitQuery); i++ {
-		edges, ptype, _, err := qa.buildEdgeQuery(splitQuery[i], edgeTemplate, parentType, cntOnly)
+		edges, ptype, _, err := qa.buildEdgeQuery(ctx, splitQuery[i], edgeTemplate, parentType, cntOnly, scope)
 		if err != nil {
 			return "", err
 		}
@@ -318,7 +323,7 @@ func (qa *QSLService) CreateDgraphQuery(query string, cntOnly bool) (string, err
 	return strings.Join(root, "\n"), nil
 }
 
-func (qa *QSLService) buildRootQuery(qry string, template string, cntOnly bool) ([]string, string, string, error) {
+func (qa *QSLService) buildRootQuery(ctx context.Context, qry string, template string, cntOnly bool, scope string) ([]string, string, string, error) {
 	ret := []string{template}
 
 	objType, filters, fields, err := parseQuery(qry)
@@ -326,7 +331,7 @@ func (qa *QSLService) buildRootQuery(qry string, template string, cntOnly bool)
 		return nil, "", "", err
 	}
 	// create var for dgraph if filter has count
-	cntFilterQry, err := qa.getCntFilter(filters, objType)
+	cntFilterQry, err := qa.getCntFilter(ctx, filters, objType)
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -335,6 +340,14 @@ func (qa *QSLService) buildRootQuery(qry string, template string, cntOnly bool)
 	if err != nil {
 		return nil, "", "", err
 	}
+	// restrict the root to the scope of the caller
+	if scope != "" {
+		if ff == "" {
+			ff = "@filter(" + scope + ")"
+		} else {
+			ff = "@filter((" + ff[8:len(ff)-1] + ") and " + scope + ")"
+		}
+	}
 	// replace the filters and object type and add the list of fields
 	ret[0] = strings.Replace(ret[0], "$FILTERSFUNC", ff, -1)
 	ret[0] = strings.Replace(ret[0], "$OBJTYPE", objType, -1)
@@ -345,7 +358,7 @@ func (qa *QSLService) buildRootQuery(qry string, template string, cntOnly bool)
 		}
 	} else {
 		// get metadata fields for projection
-		metafieldslist, err := qa.GetMetadata(objType)
+		metafieldslist, err := qa.GetMetadata(ctx, objType)
 		if err != nil {
 			return nil, "", "", err
 		}
@@ -358,38 +371,38 @@ func (qa *QSLService) buildRootQuery(qry string, template string, cntOnly bool)
 			if pag != "" {
 				ret[0] = strings.Replace(ret[0], "$PAGINATE", pag, -1)
 			} else {
-				ret[0] = strings.Replace(ret[0], "$PAGINATE", ",first:1000,offset:0", -1)
+				ret[0] = strings.Replace(ret[0], "$PAGINATE", fmt.Sprintf(",first:%d,offset:0", DefaultLimit), -1)
 			}
 		}
 	}
 	return ret, objType, cntFilterQry, nil
 }
 
-func (qa *QSLService) buildEdgeQuery(qry string, template string, parent string, cntOnly bool) ([]string, string, string, error) {
+func (qa *QSLService) buildEdgeQuery(ctx context.Context, qry string, template string, parent string, cntOnly bool, scope string) ([]string, string, string, error) {
 	ret := []string{template}
 	objType, filters, fields, err := parseQuery(qry)
 	if err != nil {
 		return nil, "", "", err
 	}
 	// get a list of the metadata fields for this object type
-	metafieldslist, err := qa.GetMetadata(objType)
+	metafieldslist, err := qa.GetMetadata(ctx, objType)
 	if err != nil {
-		return nil, "", "", errors.New("Failed to connect to dgraph to get metadata")
+		return nil, "", "", err
 	}
 
 	// declare relation variable
-	relation, err := qa.getRelationName(objType, parent)
+	relation, err := qa.getRelationName(ctx, objType, parent)
 	if err != nil {
 		return nil, "", "", err
 	}
 
 	// no relation found between the two objects
 	if relation == "" {
-		return nil, "", "", errors.New("no relation found between " + objType + " and " + parent)
+		return nil, "", "", Invalid("no relation found between %s and %s", objType, parent)
 	}
 
 	// create var for dgraph if filter has count
-	cntFilterQry, err := qa.getCntFilter(filters, objType)
+	cntFilterQry, err := qa.getCntFilter(ctx, filters, objType)
 	if err != nil {
 		return nil, "", "", err
 	}
@@ -397,7 +410,14 @@ func (qa *QSLService) buildEdgeQuery(qry string, template string, parent string,
 	if err != nil {
 		return nil, "", "", err
 	}
-	if len(ff) > 0 {
+	if scope != "" {
+		// group the filters so their or does not bypass the scope
+		if len(ff) > 0 {
+			ff = "and (" + ff[8:len(ff)-1] + ") and " + scope
+		} else {
+			ff = "and " + scope
+		}
+	} else if len(ff) > 0 {
 		ff = "and" + ff[8:len(ff)-1]
 	}
 	// replace filters and object type accordingly
@@ -414,7 +434,7 @@ func (qa *QSLService) buildEdgeQuery(qry string, template string, parent string,
 		if len(pag) > 1 {
 			ret[0] += "(" + pag[1:] + ")"
 		} else {
-			ret[0] += "(first:1000,offset:0)"
+			ret[0] += fmt.Sprintf("(first:%d,offset:0)", DefaultLimit)
 		}
 		ret[0] += "{"
 		fl, err := CreateFieldsQuery(fields, metafieldslist, 1)
@@ -432,7 +452,7 @@ func parseQuery(qry string) (string, string, string, error) {
 	matches := r.FindStringSubmatch(qry)
 	if len(matches) < 2 {
 		log.Error("Malformed Query received: " + qry)
-		return "", "", "", errors.New("Malformed Query: " + qry)
+		return "", "", "", Invalid("Malformed Query: %s", qry)
 	}
 	// extract the values of the form objtype[filters]fields and assign to individual variables
 	objType := strings.ToLower(matches[1])
@@ -441,7 +461,7 @@ func parseQuery(qry string) (string, string, string, error) {
 	return objType, strings.Replace(filters, "/", "\\/", -1), fields, nil
 }
 
-func (qa *QSLService) getCntFilter(query, objType string) (string, error) {
+func (qa *QSLService) getCntFilter(ctx context.Context, query, objType string) (string, error) {
 	ret := ""
 	// create var for dgraph if filter has count
 	if strings.Contains(query, "count(") {
@@ -451,7 +471,7 @@ func (qa *QSLService) getCntFilter(query, objType string) (string, error) {
 		seq := fmt.Sprintf("%x%x", unix32bits, buff)
 		tmp := query[strings.Index(query, "count(")+6:]
 		relType := strings.ToLower(tmp[:strings.Index(tmp, ")")])
-		relation, err := qa.getRelationName(relType, objType)
+		relation, err := qa.getRelationName(ctx, relType, objType)
 		if err != nil {
 			return "", err
 		}
@@ -461,11 +481,11 @@ func (qa *QSLService) getCntFilter(query, objType string) (string, error) {
 	return ret, nil
 }
 
-func (qa *QSLService) getRelationName(objType string, parent string) (string, error) {
+func (qa *QSLService) getRelationName(ctx context.Context, objType string, parent string) (string, error) {
 	// get a list of the metadata fields for this object type
-	metafieldslist, err := qa.GetMetadata(objType)
+	metafieldslist, err := qa.GetMetadata(ctx, objType)
 	if err != nil {
-		return "", errors.New("Failed to connect to dgraph to get metadata")
+		return "", err
 	}
 
 	// declare relation variable
@@ -491,10 +511,10 @@ func (qa *QSLService) getRelationName(objType string, parent string) (string, er
 	if !found {
 		// if not, see if we can find the relation from the parent to this object
 		m := NewMetaService(qa.DBclient)
-		metafieldslist2, err := m.GetMetadataFields(parent)
+		metafieldslist2, err := m.GetMetadataFields(ctx, parent)
 		if err != nil {
 			log.Error(err)
-			return "", errors.New("Failed to connect to dgraph to get metadata")
+			return "", Unavailable(err, "Failed to connect to dgraph to get metadata")
 		}
 		for _, item := range metafieldslist2 {
 			if item.FieldType == "relationship" {
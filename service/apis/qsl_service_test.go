@@ -1,6 +1,7 @@
 package apis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
 )
 
 // FResult values is the expected output, err is the expected error
@@ -226,6 +228,13 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tk8sobj",
 			"\tobjtype",
 			"\tname",
+			"\tregion",
+			"\tenvironment",
+			"\tclusterowner",
+			"\tclusterstatus",
+			"\tlastseen",
+			"\tcollectorversion",
+			"\tsnapshottime",
 			"\tuid",
 			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"opa\") or eq(name,\"default\") )(first:1000,offset:0){",
 			"\t	objtype",
@@ -255,6 +264,13 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tcreationtime",
 			"\tk8sobj",
 			"\tobjtype",
+			"\tregion",
+			"\tenvironment",
+			"\tclusterowner",
+			"\tclusterstatus",
+			"\tlastseen",
+			"\tcollectorversion",
+			"\tsnapshottime",
 			"\tuid",
 			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"opa\") and eq(k8sobj,\"k8sobj\") )(first:1000,offset:0){",
 			"\tk8sobj",
@@ -284,6 +300,13 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tobjtype",
 			"\tname",
 			"\tresourceid",
+			"\tregion",
+			"\tenvironment",
+			"\tclusterowner",
+			"\tclusterstatus",
+			"\tlastseen",
+			"\tcollectorversion",
+			"\tsnapshottime",
 			"\tuid",
 			"\t~cluster @filter(eq(objtype, namespace) and eq(name,\"default\") )(first:1000,offset:0){",
 			"\texpand(_all_){",
@@ -319,6 +342,13 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tobjtype",
 			"\tname",
 			"\tresourceid",
+			"\tregion",
+			"\tenvironment",
+			"\tclusterowner",
+			"\tclusterstatus",
+			"\tlastseen",
+			"\tcollectorversion",
+			"\tsnapshottime",
 			"\tuid",
 			"}",
 			"}",
@@ -344,6 +374,13 @@ func TestCreateDgraphQuery(t *testing.T) {
 			"\tresourceversion",
 			"\tcreationtime",
 			"\tk8sobj",
+			"\tregion",
+			"\tenvironment",
+			"\tclusterowner",
+			"\tclusterstatus",
+			"\tlastseen",
+			"\tcollectorversion",
+			"\tsnapshottime",
 			"\tuid",
 			"}",
 			"}",
@@ -464,11 +501,11 @@ func TestCreateDgraphQuery(t *testing.T) {
 	var jsonData []map[string]interface{}
 	json.Unmarshal(meta, &jsonData)
 	for _, data := range jsonData {
-		metaSvc.CreateMetadata(data)
+		metaSvc.CreateMetadata(context.Background(), data)
 	}
 
 	for k, v := range tests {
-		output, err := qslSvc.CreateDgraphQuery(k, false)
+		output, err := qslSvc.CreateDgraphQuery(context.Background(), k, false)
 		if err != nil {
 			if v.err != nil {
 				if err.Error() != v.err.Error() {
@@ -498,3 +535,51 @@ func TestCreateDgraphQuery(t *testing.T) {
 	}
 
 }
+
+func TestCreateDgraphQueryScoped(t *testing.T) {
+	scopes := []util.Scope{{Cluster: "c1", Namespaces: []string{"ns1", "ns2"}}, {Cluster: "c2.k8s.local"}}
+	scope := `regexp(resourceid, /^([^:]+:c1:(ns1|ns2):|namespace:c1:(ns1|ns2)$|[^:]+:c2\.k8s\.local(:|$))/)`
+	if f := ScopeFilter(scopes); f != scope {
+		t.Errorf("scope filter incorrect\n expected: %s\n real: %s", scope, f)
+	}
+	if f := ScopeFilter(nil); f != "" {
+		t.Errorf("unrestricted scope filter incorrect: %s", f)
+	}
+	if f := ScopeFilter([]util.Scope{}); f != `regexp(resourceid, /^$/)` {
+		t.Errorf("empty scope filter incorrect: %s", f)
+	}
+
+	tests := map[string]string{
+		`pod{*}`: strings.Join([]string{
+			"{ A as var(func: eq(objtype, pod)) @filter(" + scope + ") @cascade {",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"{ objects(func: uid(A)) {",
+			"\tcount(uid)",
+			"}",
+			"}",
+		}, "\n"),
+		// the scope applies to all the filters joined by or
+		`pod[@name="web"||@name="api"]{*}`: strings.Join([]string{
+			"{ A as var(func: eq(objtype, pod)) @filter(( eq(name,\"web\") or eq(name,\"api\") ) and " + scope + ") @cascade {",
+			"\tcount(uid)",
+			"}",
+			"}",
+			"{ objects(func: uid(A)) {",
+			"\tcount(uid)",
+			"}",
+			"}",
+		}, "\n"),
+	}
+	// count only root queries do not read metadata
+	qslSvc := NewQSLService(nil)
+	for k, v := range tests {
+		output, err := qslSvc.CreateDgraphQuery(context.Background(), k, true, util.OptionContext{Scopes: scopes})
+		if err != nil {
+			t.Errorf("query error\n input: %s\n err: %s", k, err.Error())
+		} else if output != v {
+			t.Errorf("query incorrect\n input: %s\n testquery: \n%s\n realquery: \n%s", k, v, output)
+		}
+	}
+}
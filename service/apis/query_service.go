@@ -1,15 +1,16 @@
 package apis
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"bytes"
-	log "github.com/Sirupsen/logrus"
 	"github.com/intuit/katlas/service/db"
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
 )
 
 //QueryParamKeyword ...param for keyword query
@@ -17,7 +18,7 @@ const QueryParamKeyword = "keyword"
 
 //IQueryService ...define interfaces to query data
 type IQueryService interface {
-	GetQueryResult(queryMap map[string][]string) (map[string]interface{}, error)
+	GetQueryResult(ctx context.Context, queryMap map[string][]string, option ...util.OptionContext) (map[string]interface{}, error)
 }
 
 //QueryService ...
@@ -30,33 +31,33 @@ func NewQueryService(dc db.IDGClient) *QueryService {
 	return &QueryService{dc}
 }
 
-//GetQueryResult ...Api to get Query Results
-func (s QueryService) GetQueryResult(queryMap map[string][]string) (map[string]interface{}, error) {
+//GetQueryResult ...Api to get Query Results, restricted to the Scopes of option if any
+func (s QueryService) GetQueryResult(ctx context.Context, queryMap map[string][]string, option ...util.OptionContext) (map[string]interface{}, error) {
 	var err error
-	// default limit is 1000
-	limit, offset := 1000, 0
+	scope := ScopeFilter(scopeOption(option))
+	// default limit is DefaultLimit
+	limit, offset := DefaultLimit, 0
 	// limit should be number and less than 10000
 	if val, ok := queryMap[util.Limit]; ok {
 		limit, err = strconv.Atoi(val[0])
 		if err != nil || limit > MaximumLimit {
-			return nil, fmt.Errorf("pagination format error or exceeding maxiumum limit %d", MaximumLimit)
+			return nil, Invalid("pagination format error or exceeding maxiumum limit %d", MaximumLimit)
 		}
 	}
 	// offset should be number
 	if val, ok := queryMap[util.Offset]; ok {
 		offset, err = strconv.Atoi(val[0])
 		if err != nil {
-			return nil, err
+			return nil, Invalid("offset %q is not a number", val[0])
 		}
 	}
 	// keyword search
 	if val, ok := queryMap[QueryParamKeyword]; ok {
 		if val[0] == "" {
-			err := fmt.Errorf("Value not specified for Query Param [%s]", QueryParamKeyword)
-			return nil, err
+			return nil, Invalid("Value not specified for Query Param [%s]", QueryParamKeyword)
 		}
 		// generate queries include count query
-		q, cntQry, err := s.getQueryResultByKeyword(val[0], limit, offset)
+		q, cntQry, err := s.getQueryResultByKeyword(ctx, val[0], limit, offset, scope)
 		metrics.DgraphNumKeywordQueries.Inc()
 		if err != nil {
 			metrics.DgraphNumKeywordQueriesErr.Inc()
@@ -64,13 +65,13 @@ func (s QueryService) GetQueryResult(queryMap map[string][]string) (map[string]i
 			return nil, err
 		}
 		// execute query to get result
-		ret, err := s.dbclient.GetQueryResult(cntQry)
+		ret, err := s.dbclient.GetQueryResult(ctx, cntQry)
 		if err != nil {
 			log.Debug(err)
 			return nil, err
 		}
 		total := GetTotalCnt(ret)
-		ret, err = s.dbclient.GetQueryResult(q)
+		ret, err = s.dbclient.GetQueryResult(ctx, q)
 		if err != nil {
 			log.Debug(err)
 			return nil, err
@@ -80,19 +81,18 @@ func (s QueryService) GetQueryResult(queryMap map[string][]string) (map[string]i
 	}
 	// key value query
 	if len(queryMap) == 0 {
-		err := fmt.Errorf("Query Params not specified")
-		return nil, err
+		return nil, Invalid("Query Params not specified")
 	}
-	q, cntQry := getQueryResultByKeyValue(queryMap, limit, offset)
+	q, cntQry := getQueryResultByKeyValue(queryMap, limit, offset, scope)
 	metrics.DgraphNumKeyValueQueries.Inc()
-	ret, err := s.dbclient.GetQueryResult(cntQry)
+	ret, err := s.dbclient.GetQueryResult(ctx, cntQry)
 	if err != nil {
 		metrics.DgraphNumKeyValueQueriesErr.Inc()
 		log.Debug(err)
 		return nil, err
 	}
 	total := GetTotalCnt(ret)
-	ret, err = s.dbclient.GetQueryResult(q)
+	ret, err = s.dbclient.GetQueryResult(ctx, q)
 	if err != nil {
 		log.Debug(err)
 		return nil, err
@@ -114,8 +114,8 @@ func GetTotalCnt(data map[string]interface{}) float64 {
 }
 
 // Keyword query http://<dgraph ip:port>/v1/query?keyword=pod
-func (s QueryService) getQueryResultByKeyword(keyword string, limit, offset int) (string, string, error) {
-	smds, err := s.dbclient.GetSchemaFromCache(db.LruCache)
+func (s QueryService) getQueryResultByKeyword(ctx context.Context, keyword string, limit, offset int, scope string) (string, string, error) {
+	smds, err := s.dbclient.GetSchemaFromCache(ctx, db.LruCache)
 	if err != nil {
 		log.Debug(err)
 		return "", "", err
@@ -151,21 +151,25 @@ func (s QueryService) getQueryResultByKeyword(keyword string, limit, offset int)
 		}
 	}
 
+	filterStr := ""
+	if scope != "" {
+		filterStr = "@filter(" + scope + ") "
+	}
 	cntOnlyStatements := make([]string, len(statements))
 	copy(cntOnlyStatements, statements)
-	cntTemplate := `objects(func: uid(%s)) { %s }`
-	cntQuery := fmt.Sprintf(cntTemplate, buf.String(), "count(uid)")
+	cntTemplate := `objects(func: uid(%s)) %s{ %s }`
+	cntQuery := fmt.Sprintf(cntTemplate, buf.String(), filterStr, "count(uid)")
 	cntOnlyStatements = append(cntOnlyStatements, cntQuery)
 	cntOnlyStatements = append(cntOnlyStatements, "}")
-	template := `objects(func: uid(%s), first:%d,offset:%d) { %s }`
-	query := fmt.Sprintf(template, buf.String(), limit, offset, "uid expand(_all_) { uid expand(_all_) }")
+	template := `objects(func: uid(%s), first:%d,offset:%d) %s{ %s }`
+	query := fmt.Sprintf(template, buf.String(), limit, offset, filterStr, "uid expand(_all_) { uid expand(_all_) }")
 	statements = append(statements, query)
 	statements = append(statements, "}")
 	return strings.Join(statements, "\n"), strings.Join(cntOnlyStatements, "\n"), nil
 }
 
 // Key-Value query http://<dgraph ip:port>/v1/query?name=pod01&objtype=Pod
-func getQueryResultByKeyValue(queryMap map[string][]string, limit, offset int) (string, string) {
+func getQueryResultByKeyValue(queryMap map[string][]string, limit, offset int, scope string) (string, string) {
 	//Only indexed fields can be filtered on
 	//Time must be in correct format "2018-10-18 14:36:32 -0700 PDT"
 	qps := []string{}
@@ -188,6 +192,9 @@ func getQueryResultByKeyValue(queryMap map[string][]string, limit, offset int) (
 	funcStr = fmt.Sprintf("(func:%s, first:%d, offset:%d) ", qps[0], limit, offset)
 	cntStr := fmt.Sprintf("(func:%s)", qps[0])
 	filters := qps[1:]
+	if scope != "" {
+		filters = append(filters, scope)
+	}
 	if len(filters) > 0 {
 		filterStr = "@filter(" + strings.Join(filters, " AND ") + ")"
 	}
@@ -1,14 +1,15 @@
 package apis
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
 	"testing"
 
-	log "github.com/Sirupsen/logrus"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/intuit/katlas/service/db"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,7 +45,7 @@ func TestGetQueryResultByKeyValue(t *testing.T) {
 
 	//Get QueryResult
 	qr := make(map[string]interface{})
-	qr, err := s.GetQueryResult(m)
+	qr, err := s.GetQueryResult(context.Background(), m)
 	if err != nil {
 		log.Errorf("Query result err: [%v]\n", err)
 
@@ -91,7 +92,7 @@ func TestGetQueryResultByKeywordSearch(t *testing.T) {
 
 	//Get QueryResult
 	qr := make(map[string]interface{})
-	qr, err = s.GetQueryResult(m)
+	qr, err = s.GetQueryResult(context.Background(), m)
 	if err != nil {
 		log.Errorf("Test Get Query result err: [%v]\n", err)
 
@@ -113,13 +114,13 @@ func createPod(dc *db.DGClient, ms *MetaService) (uid string) {
 		"ip":              "172.20.32.128",
 	}
 	// create index for query
-	dc.CreateSchema(db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term", "trigram"}})
-	dc.CreateSchema(db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term", "trigram"}})
-	dc.CreateSchema(db.Schema{Predicate: "ip", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term", "trigram"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term", "trigram"}})
+	dc.CreateSchema(context.Background(), db.Schema{Predicate: "ip", Type: "string", Index: true, Tokenizer: []string{"term"}})
 
-	pid, _ := s.CreateEntity("K8sPod", pod)
+	pid, _ := s.CreateEntity(context.Background(), "K8sPod", pod)
 
-	p, _ := s.GetEntity(pid)
+	p, _ := s.GetEntity(context.Background(), pid)
 	o := p["objects"].([]interface{})[0].(map[string]interface{})
 	if val, ok := o["name"]; ok {
 		log.Infof("name: [%v]\n", val)
@@ -131,5 +132,5 @@ func createPod(dc *db.DGClient, ms *MetaService) (uid string) {
 
 func deletePod(dc *db.DGClient, ms *MetaService, uid string) {
 	s := NewEntityService(dc)
-	s.DeleteEntity(uid)
+	s.DeleteEntity(context.Background(), uid)
 }
@@ -0,0 +1,50 @@
+package apis
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/intuit/katlas/service/util"
+)
+
+// ScopeFilter translates the scopes of a caller to a dgraph function matching the
+// resourceid of the entities they may access, empty if scopes is nil (unrestricted)
+// e.g. [{c1 [ns1 ns2]}] -> regexp(resourceid, /^([^:]+:c1:(ns1|ns2):|namespace:c1:(ns1|ns2)$)/)
+func ScopeFilter(scopes []util.Scope) string {
+	if scopes == nil {
+		return ""
+	}
+	alternatives := []string{}
+	for _, s := range scopes {
+		cluster := "[^:]+"
+		if s.Cluster != "*" {
+			cluster = regexp.QuoteMeta(s.Cluster)
+		}
+		if len(s.Namespaces) == 0 {
+			alternatives = append(alternatives, "[^:]+:"+cluster+"(:|$)")
+			continue
+		}
+		namespaces := make([]string, len(s.Namespaces))
+		for i, ns := range s.Namespaces {
+			namespaces[i] = regexp.QuoteMeta(ns)
+		}
+		ns := "(" + strings.Join(namespaces, "|") + ")"
+		alternatives = append(alternatives, "[^:]+:"+cluster+":"+ns+":", "namespace:"+cluster+":"+ns+"$")
+	}
+	// no scope matches no resourceid
+	if len(alternatives) == 0 {
+		return "regexp(" + util.ResourceID + ", /^$/)"
+	}
+	pattern := "^(" + strings.Join(alternatives, "|") + ")"
+	// escape the delimiter of dgraph regular expressions
+	pattern = strings.Replace(pattern, "/", "\\/", -1)
+	return "regexp(" + util.ResourceID + ", /" + pattern + "/)"
+}
+
+// scopeOption returns the scopes of the first option, nil if none
+func scopeOption(option []util.OptionContext) []util.Scope {
+	if len(option) == 0 {
+		return nil
+	}
+	return option[0].Scopes
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// APIKey is a static credential sent as "Authorization: ApiKey <key>" or in the X-API-Key header
+type APIKey struct {
+	// Key in clear, or its sha256 in hex in SHA256 so the config file does not hold the key
+	Key    string `json:"key,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Identity
+}
+
+// APIKeyAuthenticator authenticate callers with static API keys
+type APIKeyAuthenticator struct {
+	// identities by sha256 of the key
+	keys map[[sha256.Size]byte]*Identity
+}
+
+// NewAPIKeyAuthenticator create an authenticator accepting keys
+func NewAPIKeyAuthenticator(keys []APIKey) (*APIKeyAuthenticator, error) {
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]*Identity)}
+	for i := range keys {
+		k := keys[i]
+		if k.Subject == "" {
+			return nil, fmt.Errorf("missing subject of api key %d", i)
+		}
+		var sum [sha256.Size]byte
+		switch {
+		case k.Key != "":
+			sum = sha256.Sum256([]byte(k.Key))
+		case k.SHA256 != "":
+			b, err := hex.DecodeString(k.SHA256)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("invalid sha256 of api key of %s", k.Subject)
+			}
+			copy(sum[:], b)
+		default:
+			return nil, fmt.Errorf("missing key of %s", k.Subject)
+		}
+		id := k.Identity
+		a.keys[sum] = &id
+	}
+	return a, nil
+}
+
+// Authenticate find the identity of the API key of the request
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	key := credentials(r, "ApiKey")
+	if key == "" {
+		key = r.Header.Get("X-API-Key")
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	sum := sha256.Sum256([]byte(key))
+	for k, id := range a.keys {
+		if subtle.ConstantTimeCompare(k[:], sum[:]) == 1 {
+			return id, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid api key")
+}
@@ -0,0 +1,178 @@
+// Package auth authenticates callers of the REST API with static API keys, JWT bearer tokens
+// or client certificates
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/intuit/katlas/service/apis"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scopes granted to callers
+const (
+	// ScopeRead allows GET requests, e.g. browsers and query clients
+	ScopeRead = "read"
+	// ScopeWrite allows requests changing data, e.g. collectors
+	ScopeWrite = "write"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request has no credentials it handles
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity of an authenticated caller
+type Identity struct {
+	Subject string   `json:"subject"`
+	Groups  []string `json:"groups,omitempty"`
+	Scopes  []string `json:"scopes"`
+}
+
+// HasScope check if the identity was granted scope
+func (id *Identity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorWriter write the error of a request rejected by a middleware, the REST API passes the writer of its
+// other errors so rejected requests get the same body
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, err error)
+
+// Authenticator find the identity of the caller from the credentials of a request
+// ErrNoCredentials let the next authenticator try, any other error rejects the request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+type contextKey struct{}
+
+// FromContext return the identity of the caller stored by the middleware, nil if authentication is disabled
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
+
+// NewContext return a copy of ctx holding identity id
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// requiredScope of a request, read for GET and HEAD, write otherwise
+func requiredScope(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return ScopeRead
+	}
+	return ScopeWrite
+}
+
+// Middleware reject requests without valid credentials with 401 and requests missing the scope
+// of their method with 403, the identity of the caller is stored in the request context.
+// Paths in public, e.g. health checks, and CORS preflight requests are not authenticated
+func Middleware(authenticators []Authenticator, writeError ErrorWriter, public ...string) func(http.Handler) http.Handler {
+	publicPaths := make(map[string]bool, len(public))
+	for _, p := range public {
+		publicPaths[p] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicPaths[r.URL.Path] || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			id, err := authenticate(authenticators, r)
+			if err != nil {
+				log.Infof("%s %s rejected: %v", r.Method, r.URL.Path, err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="katlas"`)
+				writeError(w, r, apis.Unauthorized("authentication required: %v", err))
+				return
+			}
+			if scope := requiredScope(r); !id.HasScope(scope) {
+				log.Infof("%s %s rejected: %s has no %s scope", r.Method, r.URL.Path, id.Subject, scope)
+				writeError(w, r, apis.Forbidden("%s scope required", scope))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+		})
+	}
+}
+
+// authenticate try authenticators in order until one finds credentials
+func authenticate(authenticators []Authenticator, r *http.Request) (*Identity, error) {
+	for _, a := range authenticators {
+		id, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return id, err
+	}
+	return nil, ErrNoCredentials
+}
+
+// Config of the authenticators, loaded from the file given by the authConfig flag
+type Config struct {
+	// APIKeys are static keys, e.g. for collectors
+	APIKeys []APIKey `json:"apiKeys"`
+	// JWT validates bearer tokens, disabled if nil
+	JWT *JWTConfig `json:"jwt,omitempty"`
+	// ClientCert accepts the client certificates verified with the clientCA flag, disabled if nil
+	ClientCert *ClientCertConfig `json:"clientCert,omitempty"`
+}
+
+// LoadConfig read the authentication config file at path
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Authenticators build the authenticators of the config, client certificates first then API keys
+func (c *Config) Authenticators() ([]Authenticator, error) {
+	authenticators := []Authenticator{}
+	if c.ClientCert != nil {
+		authenticators = append(authenticators, NewClientCertAuthenticator(*c.ClientCert))
+	}
+	if len(c.APIKeys) > 0 {
+		a, err := NewAPIKeyAuthenticator(c.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	if c.JWT != nil {
+		a, err := NewJWTAuthenticator(*c.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	if len(authenticators) == 0 {
+		return nil, errors.New("no api keys, jwt nor client certificates configured")
+	}
+	return authenticators, nil
+}
+
+// credentials return the credentials of scheme in the Authorization header, empty if another scheme is used
+func credentials(r *http.Request, scheme string) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > len(scheme) && strings.EqualFold(h[:len(scheme)], scheme) && h[len(scheme)] == ' ' {
+		return strings.TrimSpace(h[len(scheme)+1:])
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeError stands for the error writer of the REST API, 401 for the Unauthorized errors, 403 for the others
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusForbidden
+	if apis.CodeOf(err) == apis.CodeUnauthorized {
+		status = http.StatusUnauthorized
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign create a token with claims signed by key
+func sign(t *testing.T, key crypto.Signer, kid string, claims map[string]interface{}) string {
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sha256Sum(signed))
+		assert.Nil(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, sha256Sum(signed))
+		assert.Nil(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+// writeJWKS write the public keys in a jwks file and return its path
+func writeJWKS(t *testing.T, dir string, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	keys := []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	path := filepath.Join(dir, "jwks.json")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestMiddleware(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "auth")
+	defer os.RemoveAll(dir)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	config := &Config{
+		APIKeys: []APIKey{
+			{Key: "collector-key", Identity: Identity{Subject: "collector", Scopes: []string{ScopeWrite}}},
+			// sha256 of "browser-key"
+			{SHA256: "82c971973ccbf22b209995e2c1505e04201d2a488e19d471feb69662b8fb93d0", Identity: Identity{Subject: "dashboard", Scopes: []string{ScopeRead}}},
+		},
+		JWT: &JWTConfig{JWKS: writeJWKS(t, dir, rsaKey, ecKey), Issuer: "https://issuer", Audience: "katlas"},
+	}
+	authenticators, err := config.Authenticators()
+	assert.Nil(t, err)
+
+	var caller *Identity
+	handler := Middleware(authenticators, writeError, "/health")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = FromContext(r.Context())
+	}))
+	request := func(method, path, authorization string) int {
+		caller = nil
+		r := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	claims := func(sub, scope string, exp time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"sub": sub, "scope": scope, "iss": "https://issuer", "aud": []string{"katlas"},
+			"exp": time.Now().Add(exp).Unix(), "groups": []string{"team-a"},
+		}
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/health", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", "ApiKey wrong-key"))
+
+	// collector keys can write but not read
+	assert.Equal(t, http.StatusOK, request("POST", "/v1.1/entity", "ApiKey collector-key"))
+	if assert.NotNil(t, caller) {
+		assert.Equal(t, "collector", caller.Subject)
+	}
+	assert.Equal(t, http.StatusForbidden, request("GET", "/v1/query", "ApiKey collector-key"))
+
+	// keys configured by hash, also accepted in the X-API-Key header
+	r := httptest.NewRequest("GET", "/v1/query", nil)
+	r.Header.Set("X-API-Key", "browser-key")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.NotNil(t, caller) {
+		assert.Equal(t, "dashboard", caller.Subject)
+	}
+
+	// browsers get read only tokens
+	browser := sign(t, rsaKey, "rsa1", claims("alice", "read", time.Hour))
+	assert.Equal(t, http.StatusOK, request("GET", "/v1/query", "Bearer "+browser))
+	if assert.NotNil(t, caller) {
+		assert.Equal(t, "alice", caller.Subject)
+		assert.Equal(t, []string{"team-a"}, caller.Groups)
+	}
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/v1.1/entity", "Bearer "+browser))
+
+	ec := sign(t, ecKey, "ec1", claims("collector", "read write", time.Hour))
+	assert.Equal(t, http.StatusOK, request("POST", "/v1.1/entity", "Bearer "+ec))
+
+	// expired, tampered, unknown key, wrong audience
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", "Bearer "+sign(t, rsaKey, "rsa1", claims("alice", "read", -time.Hour))))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", "Bearer "+browser[:len(browser)-4]+"AAAA"))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", "Bearer "+sign(t, rsaKey, "other", claims("alice", "read", time.Hour))))
+	wrongAudience := claims("alice", "read", time.Hour)
+	wrongAudience["aud"] = "other"
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", "Bearer "+sign(t, rsaKey, "rsa1", wrongAudience)))
+	// a token signed by the EC key can not claim the RSA key
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/v1/query", "Bearer "+sign(t, ecKey, "rsa1", claims("alice", "read", time.Hour))))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := (&Config{}).Authenticators()
+	assert.NotNil(t, err)
+	_, err = NewAPIKeyAuthenticator([]APIKey{{Key: "key"}})
+	assert.NotNil(t, err, "api key without subject")
+	_, err = NewAPIKeyAuthenticator([]APIKey{{SHA256: "abc", Identity: Identity{Subject: "s"}}})
+	assert.NotNil(t, err, "invalid sha256")
+	_, err = NewJWTAuthenticator(JWTConfig{JWKS: "/nonexistent/jwks.json"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClientCertConfig of the authentication of callers by the client certificate verified by the mTLS handshake
+type ClientCertConfig struct {
+	// Scopes granted to all the certificates, default write for collectors
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// ClientCertAuthenticator authenticate callers by their verified client certificate,
+// the subject is its common name and the groups its organizational units
+type ClientCertAuthenticator struct {
+	scopes []string
+}
+
+// NewClientCertAuthenticator create an authenticator accepting the client certificates verified by the server
+func NewClientCertAuthenticator(config ClientCertConfig) *ClientCertAuthenticator {
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeWrite}
+	}
+	return &ClientCertAuthenticator{scopes: scopes}
+}
+
+// Authenticate find the identity in the client certificate of the request
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	cert := clientCertificate(r)
+	if cert == nil || cert.Subject.CommonName == "" {
+		return nil, ErrNoCredentials
+	}
+	return &Identity{
+		Subject: cert.Subject.CommonName,
+		Groups:  cert.Subject.OrganizationalUnit,
+		Scopes:  a.scopes,
+	}, nil
+}
+
+// clientCertificate return the client certificate verified by the TLS handshake, nil if none
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// ClusterFromCertificate derive the cluster of the requests sent with a verified client certificate
+// from its common name: the clustername header is set to it if missing, requests for another cluster
+// are rejected with 403 so a collector can only write to its own cluster. The scopes of the caller are
+// narrowed to the cluster too, so the clusters found in the payloads, e.g. the batch items, the imported
+// entities or the cluster field of the v1 entities, are checked against it. It runs after the policy middleware
+func ClusterFromCertificate(writeError ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert := clientCertificate(r)
+			if cert == nil || cert.Subject.CommonName == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cluster := cert.Subject.CommonName
+			switch r.Header.Get(util.ClusterName) {
+			case "":
+				r.Header.Set(util.ClusterName, cluster)
+			case cluster:
+			default:
+				log.Infof("%s %s rejected: %s header %s does not match certificate of %s", r.Method, r.URL.Path, util.ClusterName, r.Header.Get(util.ClusterName), cluster)
+				writeError(w, r, apis.Forbidden("%s header does not match the client certificate", util.ClusterName))
+				return
+			}
+			scopes := narrowScopes(ScopesFromContext(r.Context()), cluster)
+			if len(scopes) == 0 {
+				log.Infof("%s %s rejected: cluster %s of the certificate not granted", r.Method, r.URL.Path, cluster)
+				writeError(w, r, apis.Forbidden("cluster %s of the client certificate not granted", cluster))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewScopesContext(r.Context(), scopes)))
+		})
+	}
+}
+
+// narrowScopes restrict scopes, nil if unrestricted, to cluster
+func narrowScopes(scopes []util.Scope, cluster string) []util.Scope {
+	if scopes == nil {
+		return []util.Scope{{Cluster: cluster}}
+	}
+	narrowed := []util.Scope{}
+	for _, s := range scopes {
+		if s.Cluster == "*" || s.Cluster == cluster {
+			narrowed = append(narrowed, util.Scope{Cluster: cluster, Namespaces: s.Namespaces})
+		}
+	}
+	return narrowed
+}
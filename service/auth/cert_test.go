@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// issue a certificate for cn signed by parent, self signed CA if parent is nil
+func issue(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{"collectors"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert, key
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca, caKey := issue(t, "katlas-ca", nil, nil)
+	client, clientKey := issue(t, "cluster01", ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	var caller *Identity
+	var cluster string
+	// the handler checks the cluster of the payload like the entity, batch and import handlers
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = FromContext(r.Context())
+		cluster = r.Header.Get(util.ClusterName)
+		var payload struct {
+			Cluster   string `json:"cluster"`
+			Namespace string `json:"namespace"`
+		}
+		if json.NewDecoder(r.Body).Decode(&payload) == nil && !Allows(r.Context(), payload.Cluster, payload.Namespace) {
+			writeError(w, r, ErrOutOfScope)
+		}
+	})
+	policy := &Policy{Subjects: map[string][]util.Scope{
+		"cluster01": {{Cluster: "*", Namespaces: []string{"team-a"}}},
+		"cluster03": {{Cluster: "cluster04"}},
+	}}
+	authenticate := Middleware([]Authenticator{NewClientCertAuthenticator(ClientCertConfig{})}, writeError)
+	server := httptest.NewUnstartedServer(authenticate(ClusterFromCertificate(writeError)(handler)))
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+	withPolicy := httptest.NewUnstartedServer(authenticate(policy.Middleware(writeError)(ClusterFromCertificate(writeError)(handler))))
+	withPolicy.TLS = server.TLS
+	withPolicy.StartTLS()
+	defer withPolicy.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	roots.AddCert(withPolicy.Certificate())
+	clientWith := func(cert *x509.Certificate, key *ecdsa.PrivateKey) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		}}}
+	}
+	withCert := clientWith(client, clientKey)
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	send := func(c *http.Client, url, method, clusterHeader, body string) int {
+		caller, cluster = nil, ""
+		r, _ := http.NewRequest(method, url+"/v1.1/entity", strings.NewReader(body))
+		if clusterHeader != "" {
+			r.Header.Set(util.ClusterName, clusterHeader)
+		}
+		res, err := c.Do(r)
+		if !assert.Nil(t, err) {
+			return 0
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	request := func(c *http.Client, method, clusterHeader string) int {
+		return send(c, server.URL, method, clusterHeader, "")
+	}
+
+	assert.Equal(t, http.StatusOK, request(withCert, "POST", ""))
+	if assert.NotNil(t, caller) {
+		assert.Equal(t, "cluster01", caller.Subject)
+		assert.Equal(t, []string{"collectors"}, caller.Groups)
+	}
+	assert.Equal(t, "cluster01", cluster, "cluster taken from the certificate")
+	assert.Equal(t, http.StatusOK, request(withCert, "POST", "cluster01"))
+	assert.Equal(t, http.StatusForbidden, request(withCert, "POST", "cluster02"))
+	// client certificates only get the write scope by default
+	assert.Equal(t, http.StatusForbidden, request(withCert, "GET", ""))
+	assert.Equal(t, http.StatusUnauthorized, request(withoutCert, "POST", "cluster01"))
+
+	// the cluster of the payload is checked against the certificate too
+	assert.Equal(t, http.StatusOK, send(withCert, server.URL, "POST", "", `{"cluster": "cluster01", "namespace": "default"}`))
+	assert.Equal(t, http.StatusForbidden, send(withCert, server.URL, "POST", "", `{"cluster": "cluster02", "namespace": "default"}`))
+	assert.Equal(t, http.StatusForbidden, send(withCert, server.URL, "POST", "cluster01", `{"cluster": "cluster02"}`))
+
+	// within the scopes granted by the policy
+	assert.Equal(t, http.StatusOK, send(withCert, withPolicy.URL, "POST", "", `{"cluster": "cluster01", "namespace": "team-a"}`))
+	assert.Equal(t, http.StatusForbidden, send(withCert, withPolicy.URL, "POST", "", `{"cluster": "cluster01", "namespace": "team-b"}`))
+	assert.Equal(t, http.StatusForbidden, send(withCert, withPolicy.URL, "POST", "", `{"cluster": "cluster02", "namespace": "team-a"}`))
+	other, otherKey := issue(t, "cluster03", ca, caKey)
+	assert.Equal(t, http.StatusForbidden, send(clientWith(other, otherKey), withPolicy.URL, "POST", "", `{"cluster": "cluster04"}`), "cluster of the certificate not granted")
+}
+
+func TestNarrowScopes(t *testing.T) {
+	assert.Equal(t, []util.Scope{{Cluster: "c1"}}, narrowScopes(nil, "c1"))
+	assert.Equal(t, []util.Scope{{Cluster: "c1", Namespaces: []string{"a"}}, {Cluster: "c1"}},
+		narrowScopes([]util.Scope{{Cluster: "*", Namespaces: []string{"a"}}, {Cluster: "c1"}, {Cluster: "c2"}}, "c1"))
+	assert.Empty(t, narrowScopes([]util.Scope{{Cluster: "c2"}}, "c1"))
+}
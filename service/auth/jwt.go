@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTConfig of the validation of bearer tokens
+type JWTConfig struct {
+	// JWKS is the path of the JSON Web Key Set holding the public keys signing the tokens
+	JWKS string `json:"jwks"`
+	// Issuer and Audience expected in the tokens, not checked if empty
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	// GroupsClaim holds the groups of the caller, default groups
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+}
+
+// leeway allowed on the expiry and not before times for clock skew
+const leeway = time.Minute
+
+// jwk is a public key of a JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// JWTAuthenticator authenticate callers with JWT bearer tokens signed with RS256 or ES256
+// by a key of a local JWKS file
+type JWTAuthenticator struct {
+	config JWTConfig
+	keys   map[string]crypto.PublicKey
+}
+
+// NewJWTAuthenticator load the keys of the JWKS file of config
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	data, err := ioutil.ReadFile(config.JWKS)
+	if err != nil {
+		return nil, err
+	}
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwks %s: %v", config.JWKS, err)
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	a := &JWTAuthenticator{config: config, keys: make(map[string]crypto.PublicKey)}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s in jwks %s: %v", k.Kid, config.JWKS, err)
+		}
+		a.keys[k.Kid] = key
+	}
+	if len(a.keys) == 0 {
+		return nil, fmt.Errorf("no signing key in jwks %s", config.JWKS)
+	}
+	return a, nil
+}
+
+// publicKey decode the RSA or P-256 key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Authenticate validate the bearer token of the request, the identity is the sub claim,
+// scopes come from the scope claim (space separated) or the scp claim (list)
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token := credentials(r, "Bearer")
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		id.Scopes = strings.Fields(scope)
+	} else {
+		id.Scopes = stringList(claims["scp"])
+	}
+	id.Groups = stringList(claims[a.config.GroupsClaim])
+	return id, nil
+}
+
+// verify check the signature and the registered claims of token and return its claims
+func (a *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	key, ok := a.keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	hashed := sha256Sum(parts[0] + "." + parts[1])
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed, sig) != nil {
+			return nil, errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 ||
+			!ecdsa.Verify(k, hashed, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, errors.New("invalid token signature")
+		}
+	}
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	if a.config.Issuer != "" && claims["iss"] != a.config.Issuer {
+		return nil, errors.New("invalid token issuer")
+	}
+	if a.config.Audience != "" && !contains(stringList(claims["aud"]), a.config.Audience) {
+		return nil, errors.New("invalid token audience")
+	}
+	return claims, nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+func sha256Sum(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+// stringList return a claim holding a string or a list of strings as a list
+func stringList(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return []string{c}
+	case []interface{}:
+		list := make([]string, 0, len(c))
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
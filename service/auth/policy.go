@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrOutOfScope is returned when a caller accesses an entity outside its scopes
+var ErrOutOfScope = apis.Forbidden("entity outside the clusters and namespaces of the caller")
+
+// Policy grants callers access to clusters and namespaces by subject or group,
+// a caller gets the scopes of its subject and of all its groups.
+// e.g. {"groups": {"team-a": [{"cluster": "prod", "namespaces": ["team-a"]}], "admins": [{"cluster": "*"}]}}
+type Policy struct {
+	Subjects map[string][]util.Scope `json:"subjects,omitempty"`
+	Groups   map[string][]util.Scope `json:"groups,omitempty"`
+}
+
+// LoadPolicy read the policy file at path
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	for _, grants := range []map[string][]util.Scope{p.Subjects, p.Groups} {
+		for name, scopes := range grants {
+			for _, s := range scopes {
+				if s.Cluster == "" || strings.Contains(s.Cluster, ":") {
+					return nil, fmt.Errorf("invalid cluster %q in policy of %s", s.Cluster, name)
+				}
+				for _, ns := range s.Namespaces {
+					if ns == "" || ns == "*" || strings.Contains(ns, ":") {
+						return nil, fmt.Errorf("invalid namespace %q in policy of %s", ns, name)
+					}
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// ScopesOf return the scopes granted to id, nil if one of them is unrestricted
+// i.e. any cluster without namespace restriction
+func (p *Policy) ScopesOf(id *Identity) []util.Scope {
+	scopes := append([]util.Scope{}, p.Subjects[id.Subject]...)
+	for _, g := range id.Groups {
+		scopes = append(scopes, p.Groups[g]...)
+	}
+	for _, s := range scopes {
+		if s.Cluster == "*" && len(s.Namespaces) == 0 {
+			return nil
+		}
+	}
+	return scopes
+}
+
+type scopesKey struct{}
+
+// ScopesFromContext return the scopes of the caller stored by the policy middleware,
+// nil if the caller is unrestricted or no policy is configured
+func ScopesFromContext(ctx context.Context) []util.Scope {
+	scopes, _ := ctx.Value(scopesKey{}).([]util.Scope)
+	return scopes
+}
+
+// NewScopesContext return a copy of ctx holding the scopes of the caller
+func NewScopesContext(ctx context.Context, scopes []util.Scope) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// Middleware store the scopes of the caller authenticated by the authentication middleware
+// in the request context, callers without any scope are rejected with 403
+func (p *Policy) Middleware(writeError ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := FromContext(r.Context())
+			// public paths
+			if id == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			scopes := p.ScopesOf(id)
+			if scopes != nil && len(scopes) == 0 {
+				log.Infof("%s %s rejected: no policy for %s", r.Method, r.URL.Path, id.Subject)
+				writeError(w, r, apis.Forbidden("no cluster or namespace granted to %s", id.Subject))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewScopesContext(r.Context(), scopes)))
+		})
+	}
+}
+
+// Allows check if the caller may access entities of namespace in cluster,
+// an empty namespace stands for entities not in a namespace, e.g. nodes
+func Allows(ctx context.Context, cluster, namespace string) bool {
+	scopes := ScopesFromContext(ctx)
+	if scopes == nil {
+		return true
+	}
+	if cluster == "" {
+		return false
+	}
+	for _, s := range scopes {
+		if s.Cluster != "*" && s.Cluster != cluster {
+			continue
+		}
+		if len(s.Namespaces) == 0 || (namespace != "" && contains(s.Namespaces, namespace)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsCluster check if the caller may access all the entities of cluster
+func AllowsCluster(ctx context.Context, cluster string) bool {
+	return Allows(ctx, cluster, "")
+}
+
+// AllowsResourceID check if the caller may access the entity with resourceid
+// objtype:cluster:namespace:name, objtype:cluster:name, namespace:cluster:name or cluster:name
+func AllowsResourceID(ctx context.Context, rid string) bool {
+	if ScopesFromContext(ctx) == nil {
+		return true
+	}
+	parts := strings.Split(rid, ":")
+	switch {
+	case len(parts) == 2 && parts[0] == util.Cluster:
+		return AllowsCluster(ctx, parts[1])
+	case len(parts) == 3 && parts[0] == util.Namespace:
+		return Allows(ctx, parts[1], parts[2])
+	case len(parts) == 3:
+		return AllowsCluster(ctx, parts[1])
+	case len(parts) == 4:
+		return Allows(ctx, parts[1], parts[2])
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "policy")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	ioutil.WriteFile(path, []byte(`{
+		"subjects": {"collector-prod": [{"cluster": "prod"}]},
+		"groups": {
+			"team-a": [{"cluster": "prod", "namespaces": ["team-a"]}, {"cluster": "*", "namespaces": ["shared"]}],
+			"admins": [{"cluster": "*"}]
+		}
+	}`), 0600)
+	policy, err := LoadPolicy(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, policy.ScopesOf(&Identity{Subject: "root", Groups: []string{"team-a", "admins"}}), "admins are unrestricted")
+	assert.Equal(t, []util.Scope{}, policy.ScopesOf(&Identity{Subject: "nobody"}))
+	assert.Equal(t, []util.Scope{{Cluster: "prod"}}, policy.ScopesOf(&Identity{Subject: "collector-prod"}))
+
+	var ctx context.Context
+	handler := policy.Middleware(writeError)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	request := func(id *Identity) int {
+		ctx = nil
+		r := httptest.NewRequest("GET", "/v1/qsl/pod", nil)
+		if id != nil {
+			r = r.WithContext(NewContext(r.Context(), id))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusForbidden, request(&Identity{Subject: "nobody"}))
+	assert.Equal(t, http.StatusOK, request(nil), "public paths have no identity")
+	assert.True(t, AllowsResourceID(ctx, "pod:dev:default:web"))
+
+	assert.Equal(t, http.StatusOK, request(&Identity{Subject: "alice", Groups: []string{"team-a"}}))
+	assert.True(t, AllowsResourceID(ctx, "pod:prod:team-a:web"))
+	assert.True(t, AllowsResourceID(ctx, "namespace:prod:team-a"))
+	assert.True(t, AllowsResourceID(ctx, "deployment:dev:shared:db"))
+	assert.False(t, AllowsResourceID(ctx, "pod:prod:team-b:web"))
+	assert.False(t, AllowsResourceID(ctx, "node:prod:node1"), "nodes are not in a namespace")
+	assert.False(t, AllowsResourceID(ctx, "cluster:prod"))
+	assert.False(t, AllowsResourceID(ctx, "application:web"))
+	assert.False(t, AllowsCluster(ctx, "prod"))
+	assert.True(t, Allows(ctx, "prod", "team-a"))
+
+	assert.Equal(t, http.StatusOK, request(&Identity{Subject: "collector-prod"}))
+	assert.True(t, AllowsCluster(ctx, "prod"))
+	assert.True(t, AllowsResourceID(ctx, "node:prod:node1"))
+	assert.True(t, AllowsResourceID(ctx, "cluster:prod"))
+	assert.False(t, AllowsResourceID(ctx, "pod:dev:default:web"))
+
+	ioutil.WriteFile(path, []byte(`{"groups": {"team-a": [{"cluster": "prod", "namespaces": ["*"]}]}}`), 0600)
+	_, err = LoadPolicy(path)
+	assert.NotNil(t, err, "namespace wildcard")
+}
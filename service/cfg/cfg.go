@@ -1,24 +1,206 @@
 //Package cfg - contains all global configuration that should only be set once at the startup
 package cfg
 
-import "flag"
+import (
+	"flag"
+	"strings"
+	"time"
+)
 
 type (
-	serverCfg struct {
-		ServerType   string
-		EnvNamespace string
-		DgraphHost   string
+	// Config of the service, read from the YAML file of the config flag, then overridden by
+	// KATLAS_<SECTION>_<FIELD> environment variables, e.g. KATLAS_SERVER_ADDRESS, and by the flags set
+	Config struct {
+		EnvNamespace string          `yaml:"envNamespace"`
+		Server       ServerConfig    `yaml:"server"`
+		Dgraph       DgraphConfig    `yaml:"dgraph"`
+		Query        QueryConfig     `yaml:"query"`
+		Cache        CacheConfig     `yaml:"cache"`
+		Bootstrap    BootstrapConfig `yaml:"bootstrap"`
+		Auth         AuthConfig      `yaml:"auth"`
+		Cluster      ClusterConfig   `yaml:"cluster"`
+	}
+
+	// ServerConfig of the http server
+	ServerConfig struct {
+		// Address the server listens on, e.g. :8011
+		Address string `yaml:"address"`
+		// Type is http or https
+		Type string `yaml:"type"`
+		// TLSCert and TLSKey of the https server
+		TLSCert string `yaml:"tlsCert"`
+		TLSKey  string `yaml:"tlsKey"`
+		// ClientCA is the CA bundle verifying client certificates (mTLS), no client certificate if empty
+		ClientCA string `yaml:"clientCA"`
+		// ClientCertOptional accepts clients without certificate, e.g. browsers using tokens
+		ClientCertOptional bool `yaml:"clientCertOptional"`
+		// ClusterFromCert derives the cluster of collector requests from the common name of their client certificate
+		ClusterFromCert bool `yaml:"clusterFromCert"`
+		// ReadTimeout, WriteTimeout and IdleTimeout of the connections, no timeout if 0
+		ReadTimeout  time.Duration `yaml:"readTimeout"`
+		WriteTimeout time.Duration `yaml:"writeTimeout"`
+		IdleTimeout  time.Duration `yaml:"idleTimeout"`
+		// RequestTimeout is the deadline of the requests, their queries to dgraph are canceled and 504 returned
+		// when it is reached, no deadline if 0
+		RequestTimeout time.Duration `yaml:"requestTimeout"`
+		// EndpointTimeouts override RequestTimeout for the paths starting with a key, the longest key matching wins
+		EndpointTimeouts map[string]time.Duration `yaml:"endpointTimeouts"`
+		// ShutdownDelay is the time the server keeps serving after SIGTERM while /readyz fails, so kubernetes
+		// stops routing requests to it
+		ShutdownDelay time.Duration `yaml:"shutdownDelay"`
+		// ShutdownTimeout is the maximum wait for the in-flight requests and background syncs on shutdown
+		ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	}
+
+	// DgraphConfig of the connection to the dgraph alphas
+	DgraphConfig struct {
+		// Hosts of the alphas, requests are spread over them
+		Hosts []string `yaml:"hosts"`
+		// CA, Cert and Key enable TLS to dgraph, ServerName overrides the verified host name
+		CA         string `yaml:"ca"`
+		Cert       string `yaml:"cert"`
+		Key        string `yaml:"key"`
+		ServerName string `yaml:"serverName"`
+		// MaxRecvMsgSize is the maximum size of a response in bytes
+		MaxRecvMsgSize int `yaml:"maxRecvMsgSize"`
+		// RetryCount of the mutations aborted by a conflict
+		RetryCount int `yaml:"retryCount"`
+	}
+
+	// QueryConfig of the pagination of query results
+	QueryConfig struct {
+		// DefaultLimit is the page size when no limit is given
+		DefaultLimit int `yaml:"defaultLimit"`
+		// MaximumLimit is the largest page size allowed
+		MaximumLimit int `yaml:"maximumLimit"`
+	}
+
+	// CacheConfig of the in memory caches
+	CacheConfig struct {
+		// SchemaSize is the number of entries of the schema cache
+		SchemaSize int `yaml:"schemaSize"`
+	}
+
+	// BootstrapConfig of the files loaded at startup
+	BootstrapConfig struct {
+		// Schema of the dgraph predicates
+		Schema string `yaml:"schema"`
+		// Metadata of the object types
+		Metadata string `yaml:"metadata"`
+		// OpenAPI document served at /openapi.json
+		OpenAPI string `yaml:"openapi"`
+	}
+
+	// AuthConfig of the authentication and authorization of requests
+	AuthConfig struct {
+		// Config is the path of the authentication config, requests are not authenticated if empty
+		Config string `yaml:"config"`
+		// Policy is the path of the policy granting clusters and namespaces to callers, unrestricted if empty
+		Policy string `yaml:"policy"`
+	}
+
+	// ClusterConfig of the monitoring of clusters
+	ClusterConfig struct {
+		// StaleAfter is the time without heartbeat after which a cluster is stale
+		StaleAfter time.Duration `yaml:"staleAfter"`
 	}
 )
 
 var (
 	//ServerCfg ...All Config var related to Rest API Server
-	ServerCfg serverCfg
+	ServerCfg = Defaults()
+	// configFile is the path of the YAML config file
+	configFile string
 )
 
+// Defaults return the config used for the values not set in the file, the environment or the flags
+func Defaults() Config {
+	return Config{
+		Server: ServerConfig{
+			Address:         ":8011",
+			Type:            "http",
+			TLSCert:         "server.crt",
+			TLSKey:          "server.key",
+			ClusterFromCert: true,
+			RequestTimeout:  time.Minute,
+			EndpointTimeouts: map[string]time.Duration{
+				"/v1/sync":   5 * time.Minute,
+				"/v1.1/sync": 5 * time.Minute,
+				// the whole inventory may be exported or imported
+				"/v1.1/export": 0,
+				"/v1.1/import": 0,
+			},
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Dgraph: DgraphConfig{
+			Hosts:          []string{"127.0.0.1:9080"},
+			MaxRecvMsgSize: 20 * 1024 * 1024,
+			RetryCount:     20,
+		},
+		Query: QueryConfig{
+			DefaultLimit: 1000,
+			MaximumLimit: 10000,
+		},
+		Cache: CacheConfig{
+			SchemaSize: 10,
+		},
+		Bootstrap: BootstrapConfig{
+			Schema:   "data/dbschema.json",
+			Metadata: "data/meta.json",
+			OpenAPI:  "data/openapi.json",
+		},
+		Cluster: ClusterConfig{
+			StaleAfter: 5 * time.Minute,
+		},
+	}
+}
+
+// stringList is a flag holding a comma separated list
+type stringList struct {
+	list *[]string
+}
+
+func (s stringList) String() string {
+	if s.list == nil {
+		return ""
+	}
+	return strings.Join(*s.list, ",")
+}
+
+func (s stringList) Set(v string) error {
+	*s.list = splitList(v)
+	return nil
+}
+
+func splitList(v string) []string {
+	list := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func init() {
 
-	flag.StringVar(&ServerCfg.EnvNamespace, "envNamespace", "", "EnvNamespace for the cluster service is deployed in")
-	flag.StringVar(&ServerCfg.ServerType, "serverType", "http", "Mode the Rest Service runs in - Secure/Insecure")
-	flag.StringVar(&ServerCfg.DgraphHost, "dgraphHost", "127.0.0.1:9080", "Mode the Rest Service runs in - Secure/Insecure")
+	flag.StringVar(&configFile, "config", "", "Path of the YAML config file, overridden by KATLAS_* env variables and flags")
+	flag.StringVar(&ServerCfg.EnvNamespace, "envNamespace", ServerCfg.EnvNamespace, "EnvNamespace for the cluster service is deployed in")
+	flag.StringVar(&ServerCfg.Server.Type, "serverType", ServerCfg.Server.Type, "Mode the Rest Service runs in - Secure/Insecure")
+	flag.StringVar(&ServerCfg.Server.Address, "address", ServerCfg.Server.Address, "Address the Rest Service listens on")
+	flag.DurationVar(&ServerCfg.Server.RequestTimeout, "requestTimeout", ServerCfg.Server.RequestTimeout, "Deadline of the requests not overridden by server.endpointTimeouts, no deadline if 0")
+	flag.DurationVar(&ServerCfg.Cluster.StaleAfter, "staleAfter", ServerCfg.Cluster.StaleAfter, "Time without heartbeat from its collector after which a cluster is stale")
+	flag.StringVar(&ServerCfg.Auth.Config, "authConfig", ServerCfg.Auth.Config, "Path of the api keys and jwt config authenticating requests, no authentication if empty")
+	flag.StringVar(&ServerCfg.Auth.Policy, "policyConfig", ServerCfg.Auth.Policy, "Path of the policy restricting callers to clusters and namespaces, requires authConfig, unrestricted if empty")
+	flag.Var(stringList{&ServerCfg.Dgraph.Hosts}, "dgraphHost", "Comma separated hosts of the dgraph alphas")
+	flag.StringVar(&ServerCfg.Server.TLSCert, "tlsCert", ServerCfg.Server.TLSCert, "Certificate of the https server")
+	flag.StringVar(&ServerCfg.Server.TLSKey, "tlsKey", ServerCfg.Server.TLSKey, "Private key of the https server")
+	flag.StringVar(&ServerCfg.Server.ClientCA, "clientCA", ServerCfg.Server.ClientCA, "CA bundle verifying the client certificates of https requests (mTLS), client certificates not requested if empty")
+	flag.BoolVar(&ServerCfg.Server.ClientCertOptional, "clientCertOptional", ServerCfg.Server.ClientCertOptional, "Accept https requests without client certificate when clientCA is set")
+	flag.BoolVar(&ServerCfg.Server.ClusterFromCert, "clusterFromCert", ServerCfg.Server.ClusterFromCert, "Take the cluster of requests with a client certificate from its common name")
+	flag.StringVar(&ServerCfg.Dgraph.CA, "dgraphCA", ServerCfg.Dgraph.CA, "CA bundle verifying the dgraph server, TLS to dgraph is enabled if dgraphCA or dgraphCert is set")
+	flag.StringVar(&ServerCfg.Dgraph.Cert, "dgraphCert", ServerCfg.Dgraph.Cert, "Client certificate presented to dgraph")
+	flag.StringVar(&ServerCfg.Dgraph.Key, "dgraphKey", ServerCfg.Dgraph.Key, "Private key of the client certificate presented to dgraph")
+	flag.StringVar(&ServerCfg.Dgraph.ServerName, "dgraphServerName", ServerCfg.Dgraph.ServerName, "Host name of the dgraph certificate, host of dgraphHost if empty")
 }
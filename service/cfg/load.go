@@ -0,0 +1,163 @@
+package cfg
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix of the environment variables overriding the config
+const EnvPrefix = "KATLAS"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load build ServerCfg from the defaults, the YAML file of the config flag, the environment and the flags
+// set on the command line, in increasing priority, and validate it. flag.Parse must be called first
+func Load() error {
+	// the flags write into ServerCfg, keep the ones set to apply them last
+	set := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	config := Defaults()
+	if configFile != "" {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("config file: %v", err)
+		}
+		if err = yaml.UnmarshalStrict(data, &config); err != nil {
+			return fmt.Errorf("config file %s: %v", configFile, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&config).Elem(), EnvPrefix, os.LookupEnv); err != nil {
+		return err
+	}
+	ServerCfg = config
+	for name, value := range set {
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("flag -%s: %v", name, err)
+		}
+	}
+	return ServerCfg.Validate()
+}
+
+// applyEnv override the fields of v with the variables <prefix>_<FIELD>, FIELD being the upper case yaml name
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := prefix + "_" + strings.ToUpper(strings.Split(field.Tag.Get("yaml"), ",")[0])
+		f := v.Field(i)
+		if f.Kind() == reflect.Struct {
+			if err := applyEnv(f, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(f, value); err != nil {
+			return fmt.Errorf("env %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// setValue parse value into f, lists are comma separated and maps are key=value pairs merged into the map
+func setValue(f reflect.Value, value string) error {
+	var err error
+	switch {
+	case f.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(value)
+	case f.Kind() == reflect.Int:
+		var n int
+		n, err = strconv.Atoi(value)
+		f.SetInt(int64(n))
+	case f.Kind() == reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		f.SetBool(b)
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+		f.Set(reflect.ValueOf(splitList(value)))
+	case f.Kind() == reflect.Map && f.Type().Key().Kind() == reflect.String:
+		if f.IsNil() {
+			f.Set(reflect.MakeMap(f.Type()))
+		}
+		for _, pair := range splitList(value) {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return fmt.Errorf("invalid value %q, expected key=value pairs", value)
+			}
+			elem := reflect.New(f.Type().Elem()).Elem()
+			if err := setValue(elem, kv[1]); err != nil {
+				return err
+			}
+			f.SetMapIndex(reflect.ValueOf(kv[0]), elem)
+		}
+	default:
+		return fmt.Errorf("can not set a %s from the environment", f.Type())
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q", value)
+	}
+	return nil
+}
+
+// Validate check the config, the error lists all the invalid fields
+func (c Config) Validate() error {
+	errs := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Server.Address != "", "server.address is required")
+	check(c.Server.Type == "http" || c.Server.Type == "https", "server.type must be http or https, got %q", c.Server.Type)
+	if c.Server.Type == "https" {
+		check(fileExists(c.Server.TLSCert), "server.tlsCert %q not found", c.Server.TLSCert)
+		check(fileExists(c.Server.TLSKey), "server.tlsKey %q not found", c.Server.TLSKey)
+	}
+	check(c.Server.ClientCA == "" || fileExists(c.Server.ClientCA), "server.clientCA %q not found", c.Server.ClientCA)
+	check(c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0, "server timeouts can not be negative")
+	check(c.Server.RequestTimeout >= 0, "server.requestTimeout can not be negative")
+	for path, d := range c.Server.EndpointTimeouts {
+		check(strings.HasPrefix(path, "/") && d >= 0, "server.endpointTimeouts %q must be a path with a timeout not negative", path)
+	}
+	check(c.Server.ShutdownDelay >= 0, "server.shutdownDelay can not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout must be positive")
+	check(len(c.Dgraph.Hosts) > 0, "dgraph.hosts is required")
+	check(c.Dgraph.CA == "" || fileExists(c.Dgraph.CA), "dgraph.ca %q not found", c.Dgraph.CA)
+	check((c.Dgraph.Cert == "") == (c.Dgraph.Key == ""), "dgraph.cert and dgraph.key go together")
+	check(c.Dgraph.MaxRecvMsgSize > 0, "dgraph.maxRecvMsgSize must be positive")
+	check(c.Dgraph.RetryCount >= 0, "dgraph.retryCount can not be negative")
+	check(c.Query.DefaultLimit > 0, "query.defaultLimit must be positive")
+	check(c.Query.MaximumLimit >= c.Query.DefaultLimit, "query.maximumLimit %d is lower than query.defaultLimit %d", c.Query.MaximumLimit, c.Query.DefaultLimit)
+	check(c.Cache.SchemaSize > 0, "cache.schemaSize must be positive")
+	check(fileExists(c.Bootstrap.Schema), "bootstrap.schema %q not found", c.Bootstrap.Schema)
+	check(fileExists(c.Bootstrap.Metadata), "bootstrap.metadata %q not found", c.Bootstrap.Metadata)
+	check(fileExists(c.Bootstrap.OpenAPI), "bootstrap.openapi %q not found", c.Bootstrap.OpenAPI)
+	check(c.Auth.Config == "" || fileExists(c.Auth.Config), "auth.config %q not found", c.Auth.Config)
+	check(c.Auth.Policy == "" || c.Auth.Config != "", "auth.policy requires auth.config to identify callers")
+	check(c.Cluster.StaleAfter > 0, "cluster.staleAfter must be positive")
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,91 @@
+package cfg
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cfg")
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"schema.json", "meta.json", "openapi.json"} {
+		ioutil.WriteFile(filepath.Join(dir, f), []byte("[]"), 0600)
+	}
+	configFile = filepath.Join(dir, "katlas.yaml")
+	defer func() { configFile = "" }()
+	ioutil.WriteFile(configFile, []byte(`
+envNamespace: dev
+server:
+  address: ":9000"
+  readTimeout: 30s
+  endpointTimeouts:
+    /v1.1/qsl: 2m
+dgraph:
+  hosts: [alpha1:9080, alpha2:9080]
+query:
+  maximumLimit: 5000
+bootstrap:
+  schema: `+filepath.Join(dir, "schema.json")+`
+  metadata: `+filepath.Join(dir, "meta.json")+`
+  openapi: `+filepath.Join(dir, "openapi.json")+`
+`), 0600)
+	os.Setenv("KATLAS_QUERY_DEFAULTLIMIT", "500")
+	os.Setenv("KATLAS_SERVER_ADDRESS", ":9001")
+	os.Setenv("KATLAS_CLUSTER_STALEAFTER", "10m")
+	os.Setenv("KATLAS_SERVER_ENDPOINTTIMEOUTS", "/v1.1/sync=1m, /v1/qsl=3m")
+	defer os.Unsetenv("KATLAS_SERVER_ENDPOINTTIMEOUTS")
+	defer os.Unsetenv("KATLAS_QUERY_DEFAULTLIMIT")
+	defer os.Unsetenv("KATLAS_SERVER_ADDRESS")
+	defer os.Unsetenv("KATLAS_CLUSTER_STALEAFTER")
+	// flags have the last word
+	flag.Set("dgraphHost", "alpha3:9080")
+
+	assert.Nil(t, Load())
+	assert.Equal(t, "dev", ServerCfg.EnvNamespace)
+	assert.Equal(t, ":9001", ServerCfg.Server.Address)
+	assert.Equal(t, 30*time.Second, ServerCfg.Server.ReadTimeout)
+	assert.Equal(t, "http", ServerCfg.Server.Type, "default kept")
+	assert.Equal(t, []string{"alpha3:9080"}, ServerCfg.Dgraph.Hosts)
+	assert.Equal(t, 500, ServerCfg.Query.DefaultLimit)
+	assert.Equal(t, 5000, ServerCfg.Query.MaximumLimit)
+	assert.Equal(t, 10*time.Minute, ServerCfg.Cluster.StaleAfter)
+	assert.Equal(t, time.Minute, ServerCfg.Server.RequestTimeout)
+	assert.Equal(t, 2*time.Minute, ServerCfg.Server.EndpointTimeouts["/v1.1/qsl"])
+	assert.Equal(t, time.Minute, ServerCfg.Server.EndpointTimeouts["/v1.1/sync"])
+	assert.Equal(t, 3*time.Minute, ServerCfg.Server.EndpointTimeouts["/v1/qsl"])
+	exportTimeout, ok := ServerCfg.Server.EndpointTimeouts["/v1.1/export"]
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), exportTimeout, "no deadline")
+
+	os.Setenv("KATLAS_QUERY_DEFAULTLIMIT", "many")
+	err := Load()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "KATLAS_QUERY_DEFAULTLIMIT")
+	}
+	os.Setenv("KATLAS_QUERY_DEFAULTLIMIT", "500")
+	for _, value := range []string{"/v1.1/sync", "/v1.1/sync=soon"} {
+		os.Setenv("KATLAS_SERVER_ENDPOINTTIMEOUTS", value)
+		err = Load()
+		if assert.NotNil(t, err, value) {
+			assert.Contains(t, err.Error(), "KATLAS_SERVER_ENDPOINTTIMEOUTS")
+		}
+	}
+	os.Setenv("KATLAS_SERVER_ENDPOINTTIMEOUTS", "/v1.1/sync=1m")
+	os.Setenv("KATLAS_QUERY_DEFAULTLIMIT", "8000")
+	os.Setenv("KATLAS_AUTH_POLICY", filepath.Join(dir, "policy.json"))
+	defer os.Unsetenv("KATLAS_AUTH_POLICY")
+	err = Load()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "query.maximumLimit 5000 is lower than query.defaultLimit 8000")
+		assert.Contains(t, err.Error(), "auth.policy requires auth.config")
+	}
+
+	ioutil.WriteFile(configFile, []byte("server:\n  adress: :9000\n"), 0600)
+	assert.NotNil(t, Load(), "unknown field")
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/intuit/katlas/client"
+	"gopkg.in/yaml.v2"
+)
+
+// metadataColumns of the fields of a metadata in table and csv output
+var metadataColumns = []string{"fieldname", "fieldtype", "refdatatype", "cardinality", "mandatory"}
+
+// stringList is a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// qsl run a QSL query, $$limit and $$offset of the query page the results
+func (c *cli) qsl(args []string) error {
+	fs := c.flags("qsl")
+	pos, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return errors.New("usage: katlasctl qsl <query>")
+	}
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	ret, err := cl.QSL(context.Background(), pos[0])
+	if err != nil {
+		return err
+	}
+	return c.print(entities(ret.Objects))
+}
+
+// query run a keyword query or a key/value query if the args are key=value pairs
+func (c *cli) query(args []string) error {
+	fs := c.flags("query")
+	fields := fs.String("print", "", "comma separated fields returned by a key/value query")
+	limit := fs.String("limit", "", "maximum number of objects returned")
+	pos, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) == 0 {
+		return errors.New("usage: katlasctl query <keyword> | <key=value>...")
+	}
+	q := url.Values{}
+	for _, arg := range pos {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) == 1 {
+			q.Set("keyword", arg)
+			continue
+		}
+		q.Add(kv[0], kv[1])
+	}
+	if *fields != "" {
+		q.Set("print", *fields)
+	}
+	if *limit != "" {
+		q.Set("limit", *limit)
+	}
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	ret, err := cl.Query(context.Background(), q)
+	if err != nil {
+		return err
+	}
+	return c.print(entities(ret.Objects))
+}
+
+// get an entity by uid or by resourceid
+func (c *cli) get(args []string) error {
+	fs := c.flags("get")
+	rid := fs.String("rid", "", "resourceid of the entity")
+	pos, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if (*rid == "") == (len(pos) == 0) {
+		return errors.New("usage: katlasctl get <uid> | get -rid <resourceid>")
+	}
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	var entity client.Entity
+	if *rid != "" {
+		entity, err = cl.GetEntityByResourceID(context.Background(), *rid)
+	} else {
+		entity, err = cl.GetEntity(context.Background(), pos[0])
+	}
+	if err != nil {
+		return err
+	}
+	return c.print(entities([]client.Entity{entity}))
+}
+
+// metadata list, get, create, update or delete metadata
+func (c *cli) metadata(args []string) error {
+	const use = "usage: katlasctl metadata list | get <name> | create -f <file> | update <name> -f <file> | delete <name>"
+	if len(args) == 0 {
+		return errors.New(use)
+	}
+	fs := c.flags("metadata " + args[0])
+	file := fs.String("f", "", "json or yaml file of the metadata, a list to create several, - for the standard input")
+	pos, err := c.parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	name := ""
+	if len(pos) > 0 {
+		name = url.PathEscape(pos[0])
+	}
+	var ret map[string]interface{}
+	switch {
+	case args[0] == "list":
+		names, err := cl.ListMetadata(context.Background())
+		if err != nil {
+			return err
+		}
+		objs := make([]map[string]interface{}, len(names))
+		for i, name := range names {
+			objs[i] = map[string]interface{}{"name": name}
+		}
+		return c.print(objs)
+	case args[0] == "get" && len(pos) == 1:
+		// printed as returned, with the fields client.Metadata does not have
+		if ret, err = call(cl, http.MethodGet, "v1.1/metadata/"+name, nil); err != nil {
+			return err
+		}
+		delete(ret, "status")
+		if c.output != Table && c.output != CSV {
+			return printValue(c.stdout, c.output, ret)
+		}
+		fields, _ := ret["fields"].([]interface{})
+		return printObjects(c.stdout, c.output, objectsOf(map[string]interface{}{"objects": fields}), metadataColumns)
+	case args[0] == "create" && len(pos) == 0, args[0] == "update" && len(pos) == 1:
+		var body interface{}
+		if body, err = c.decodeInput(*file); err != nil {
+			return err
+		}
+		path := "v1.1/metadata"
+		if args[0] == "update" {
+			path += "/" + name
+		}
+		if ret, err = call(cl, http.MethodPost, path, body); err != nil {
+			return err
+		}
+	case args[0] == "delete" && len(pos) == 1:
+		if ret, err = call(cl, http.MethodDelete, "v1.1/metadata/"+name, nil); err != nil {
+			return err
+		}
+	default:
+		return errors.New(use)
+	}
+	return c.printResult(ret)
+}
+
+// schema upsert or drop predicates of the dgraph schema
+func (c *cli) schema(args []string) error {
+	const use = "usage: katlasctl schema upsert -f <file> | drop <predicate>"
+	if len(args) == 0 {
+		return errors.New(use)
+	}
+	fs := c.flags("schema " + args[0])
+	file := fs.String("f", "", "json or yaml file of the predicate, a list to upsert several, - for the standard input")
+	pos, err := c.parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	var ret map[string]interface{}
+	switch {
+	case args[0] == "upsert" && len(pos) == 0:
+		var body interface{}
+		if body, err = c.decodeInput(*file); err != nil {
+			return err
+		}
+		ret, err = call(cl, http.MethodPost, "v1.1/schema", body)
+	case args[0] == "drop" && len(pos) == 1:
+		ret, err = call(cl, http.MethodDelete, "v1.1/schema/"+url.PathEscape(pos[0]), nil)
+	default:
+		return errors.New(use)
+	}
+	if err != nil {
+		return err
+	}
+	return c.printResult(ret)
+}
+
+// export stream the entities as NDJSON to a file or the standard output
+func (c *cli) export(args []string) error {
+	fs := c.flags("export")
+	var objtypes stringList
+	fs.Var(&objtypes, "objtype", "type of the entities exported, repeatable, all types if not set")
+	cluster := fs.String("cluster", "", "export only the entities of the cluster")
+	file := fs.String("f", "-", "file written, - for the standard output")
+	pos, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 0 {
+		return errors.New("usage: katlasctl export [-objtype <type>]... [-cluster <name>] [-f <file>]")
+	}
+	// exports take as long as the graph is large
+	c.timeout = 0
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	q := url.Values{"objtype": objtypes}
+	if *cluster != "" {
+		q.Set("cluster", *cluster)
+	}
+	// an export aborted by the service ends with an error instead of EOF, the client fails reading it
+	_, data, err := cl.Do(context.Background(), http.MethodGet, "v1.1/export", q, nil)
+	if err != nil {
+		return fmt.Errorf("export failed: %v", err)
+	}
+	out := c.stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// importEntities send the NDJSON of an export, the failed lines are printed and fail the command
+func (c *cli) importEntities(args []string) error {
+	fs := c.flags("import")
+	file := fs.String("f", "", "NDJSON file of an export, - for the standard input")
+	pos, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) > 0 {
+		return errors.New("usage: katlasctl import -f <file>")
+	}
+	body, err := c.readInput(*file)
+	if err != nil {
+		return err
+	}
+	c.timeout = 0
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	_, data, err := cl.Do(context.Background(), http.MethodPost, "v1.1/import", nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	var ret struct {
+		Imported int                      `json:"imported"`
+		Errors   []map[string]interface{} `json:"errors"`
+	}
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "%d entities imported\n", ret.Imported)
+	if len(ret.Errors) > 0 {
+		if c.columns == "" {
+			c.columns = "line,objtype,resourceid,status,error"
+		}
+		c.print(ret.Errors)
+		return fmt.Errorf("%d lines failed", len(ret.Errors))
+	}
+	return nil
+}
+
+// configure list, select and edit the contexts of the config
+func (c *cli) configure(args []string) error {
+	const use = "usage: katlasctl config get-contexts | current-context | use-context <name> | " +
+		"set-context <name> [-server <url>] [-apikey <key>] [-token <token>] [-ca <file>] [-cert <file> -key <file>] [-insecure] | " +
+		"delete-context <name>"
+	if len(args) == 0 {
+		return errors.New(use)
+	}
+	fs := c.flags("config " + args[0])
+	var ctx Context
+	fs.StringVar(&ctx.Server, "server", "", "url of the K-Atlas service")
+	fs.StringVar(&ctx.APIKey, "apikey", "", "API key")
+	fs.StringVar(&ctx.Token, "token", "", "JWT bearer token")
+	fs.StringVar(&ctx.CA, "ca", "", "CA bundle verifying the service certificate")
+	fs.StringVar(&ctx.Cert, "cert", "", "client certificate")
+	fs.StringVar(&ctx.Key, "key", "", "key of the client certificate")
+	fs.BoolVar(&ctx.Insecure, "insecure", false, "skip the verification of the service certificate")
+	pos, err := c.parse(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	name := ""
+	if len(pos) > 0 {
+		name = pos[0]
+	}
+	switch {
+	case args[0] == "get-contexts" && len(pos) == 0:
+		rows := make([]map[string]interface{}, 0, len(c.config.Contexts))
+		for _, ctx := range c.config.Contexts {
+			current := ""
+			if ctx.Name == c.config.CurrentContext {
+				current = "*"
+			}
+			rows = append(rows, map[string]interface{}{"current": current, "name": ctx.Name, "server": ctx.Server})
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i]["name"].(string) < rows[j]["name"].(string) })
+		return printObjects(c.stdout, c.output, rows, []string{"current", "name", "server"})
+	case args[0] == "current-context" && len(pos) == 0:
+		if c.config.CurrentContext == "" {
+			return errors.New("no current context")
+		}
+		fmt.Fprintln(c.stdout, c.config.CurrentContext)
+		return nil
+	case args[0] == "use-context" && len(pos) == 1:
+		if c.config.find(name) < 0 {
+			return fmt.Errorf("context %s not found", name)
+		}
+		c.config.CurrentContext = name
+	case args[0] == "set-context" && len(pos) == 1:
+		// flags not set keep the values of an existing context
+		if i := c.config.find(name); i >= 0 {
+			existing := c.config.Contexts[i]
+			fs.Visit(func(f *flag.Flag) { existing.set(f.Name, ctx) })
+			ctx = existing
+		}
+		if ctx.Server == "" {
+			return errors.New("-server required")
+		}
+		ctx.Name = name
+		c.config.setContext(ctx)
+		if c.config.CurrentContext == "" {
+			c.config.CurrentContext = name
+		}
+	case args[0] == "delete-context" && len(pos) == 1:
+		i := c.config.find(name)
+		if i < 0 {
+			return fmt.Errorf("context %s not found", name)
+		}
+		c.config.Contexts = append(c.config.Contexts[:i], c.config.Contexts[i+1:]...)
+		if c.config.CurrentContext == name {
+			c.config.CurrentContext = ""
+		}
+	default:
+		return errors.New(use)
+	}
+	return c.config.save(c.configPath)
+}
+
+// set the field of the flag name to its value in from
+func (ctx *Context) set(name string, from Context) {
+	switch name {
+	case "server":
+		ctx.Server = from.Server
+	case "apikey":
+		ctx.APIKey = from.APIKey
+	case "token":
+		ctx.Token = from.Token
+	case "ca":
+		ctx.CA = from.CA
+	case "cert":
+		ctx.Cert = from.Cert
+	case "key":
+		ctx.Key = from.Key
+	case "insecure":
+		ctx.Insecure = from.Insecure
+	}
+}
+
+// call send a request of the API without a method of the client, body is marshaled unless nil, and decode the
+// JSON response
+func call(cl *client.Client, method, path string, body interface{}) (map[string]interface{}, error) {
+	_, data, err := cl.Do(context.Background(), method, path, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]interface{})
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("invalid response of %s %s: %v", method, path, err)
+	}
+	return ret, nil
+}
+
+// entities as the objects printed
+func entities(list []client.Entity) []map[string]interface{} {
+	objs := make([]map[string]interface{}, len(list))
+	for i, entity := range list {
+		objs[i] = entity
+	}
+	return objs
+}
+
+// printResult print the objects of a write response, its message if it has none
+func (c *cli) printResult(ret map[string]interface{}) error {
+	if objs := objectsOf(ret); len(objs) > 0 {
+		return c.print(objs)
+	}
+	if msg, ok := ret["message"].(string); ok && (c.output == Table || c.output == CSV) {
+		fmt.Fprintln(c.stdout, msg)
+		return nil
+	}
+	return printValue(c.stdout, c.output, ret)
+}
+
+// decodeInput read a json or yaml file into the body of a request
+func (c *cli) decodeInput(name string) (interface{}, error) {
+	data, err := c.readInput(name)
+	if err != nil {
+		return nil, err
+	}
+	var body interface{}
+	if json.Unmarshal(data, &body) == nil {
+		return body, nil
+	}
+	if err = yaml.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("%s is neither json nor yaml: %v", name, err)
+	}
+	return jsonValue(body), nil
+}
+
+// jsonValue convert the maps decoded from yaml to maps with string keys
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			m[fmt.Sprintf("%v", k)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range value {
+			value[i] = jsonValue(item)
+		}
+	}
+	return v
+}
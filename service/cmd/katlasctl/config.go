@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// Config of katlasctl, the K-Atlas endpoints it talks to by context name
+	Config struct {
+		CurrentContext string    `yaml:"currentContext"`
+		Contexts       []Context `yaml:"contexts"`
+	}
+
+	// Context is a K-Atlas endpoint with the credentials to call it
+	Context struct {
+		Name   string `yaml:"name"`
+		Server string `yaml:"server"`
+		// APIKey is sent as Authorization: ApiKey, Token as Authorization: Bearer
+		APIKey string `yaml:"apiKey,omitempty"`
+		Token  string `yaml:"token,omitempty"`
+		// CA verifies the certificate of the server, Cert and Key are the client certificate (mTLS)
+		CA       string `yaml:"ca,omitempty"`
+		Cert     string `yaml:"cert,omitempty"`
+		Key      string `yaml:"key,omitempty"`
+		Insecure bool   `yaml:"insecure,omitempty"`
+	}
+)
+
+// configPath is KATLASCONFIG or ~/.katlas/config
+func configPath() string {
+	if path := os.Getenv("KATLASCONFIG"); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".katlas", "config")
+}
+
+// loadConfig read the config at path, empty if the file does not exist
+func loadConfig(path string) (*Config, error) {
+	c := &Config{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// save write the config to path, readable by the user only as it holds credentials
+func (c *Config) save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// context return the context of name, the current context if name is empty. KATLAS_SERVER, KATLAS_API_KEY and
+// KATLAS_TOKEN override the context, KATLAS_SERVER is enough without config
+func (c *Config) context(name string) (*Context, error) {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	ctx := &Context{}
+	if name != "" {
+		found := c.find(name)
+		if found < 0 {
+			return nil, fmt.Errorf("context %s not found", name)
+		}
+		*ctx = c.Contexts[found]
+	}
+	if server := os.Getenv("KATLAS_SERVER"); server != "" {
+		ctx.Server = server
+	}
+	if key := os.Getenv("KATLAS_API_KEY"); key != "" {
+		ctx.APIKey = key
+	}
+	if token := os.Getenv("KATLAS_TOKEN"); token != "" {
+		ctx.Token = token
+	}
+	if ctx.Server == "" {
+		return nil, fmt.Errorf("no server, set a context with katlasctl config set-context or KATLAS_SERVER")
+	}
+	return ctx, nil
+}
+
+// setContext add the context or replace the context of the same name
+func (c *Config) setContext(ctx Context) {
+	if i := c.find(ctx.Name); i >= 0 {
+		c.Contexts[i] = ctx
+		return
+	}
+	c.Contexts = append(c.Contexts, ctx)
+}
+
+// find return the index of the context of name, -1 if not found
+func (c *Config) find(name string) int {
+	for i, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return i
+		}
+	}
+	return -1
+}
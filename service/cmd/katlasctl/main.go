@@ -0,0 +1,190 @@
+// katlasctl is the command-line client of the K-Atlas service: queries, entities, metadata, schema,
+// export and import against the endpoints of the contexts of its config
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/intuit/katlas/client"
+)
+
+const usage = `Usage: katlasctl [flags] <command> [args]
+
+Commands:
+  qsl <query>                          run a QSL query, e.g. qsl 'cluster[@name="c1"].pod[@status="Running"]'
+  query <keyword> | <key=value>...     keyword or key/value query, -print selects the fields returned
+  get <uid> | get -rid <resourceid>    get an entity by uid or resourceid
+  metadata list|get|create|update|delete
+  schema upsert -f <file> | drop <predicate>
+  export [-objtype <type>]... [-cluster <name>] [-f <file>]
+  import -f <file>
+  config get-contexts|current-context|use-context|set-context|delete-context
+
+Flags:
+`
+
+// cli holds the global flags shared by the commands
+type cli struct {
+	configPath string
+	config     *Config
+	context    string
+	output     string
+	columns    string
+	timeout    time.Duration
+	stdin      io.Reader
+	stdout     io.Writer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// run the command of args
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	c := &cli{stdin: stdin, stdout: stdout}
+	fs := c.flags("katlasctl")
+	fs.StringVar(&c.configPath, "config", configPath(), "path of the config with the contexts")
+	fs.StringVar(&c.context, "context", "", "context to use instead of the current context")
+	fs.DurationVar(&c.timeout, "timeout", time.Minute, "timeout of the requests, 0 for none")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command required")
+	}
+	var err error
+	if c.config, err = loadConfig(c.configPath); err != nil {
+		return err
+	}
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "qsl":
+		return c.qsl(args)
+	case "query":
+		return c.query(args)
+	case "get":
+		return c.get(args)
+	case "metadata":
+		return c.metadata(args)
+	case "schema":
+		return c.schema(args)
+	case "export":
+		return c.export(args)
+	case "import":
+		return c.importEntities(args)
+	case "config":
+		return c.configure(args)
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown command %s", cmd)
+}
+
+// flags return a flag set of a command with the output flags, so they may follow the command
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.output, "o", c.orDefault(c.output, Table), "output format: table, json, yaml or csv")
+	fs.StringVar(&c.columns, "columns", c.columns, "comma separated columns of the table and csv output")
+	return fs
+}
+
+// parse the flags of a command, flags may follow its positional args, which are returned
+func (c *cli) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func (c *cli) orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// client of the selected context
+func (c *cli) client() (*client.Client, error) {
+	ctx, err := c.config.context(c.context)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(ctx, c.timeout)
+}
+
+// newClient of the server of ctx with its credentials, requests time out after timeout unless 0
+func newClient(ctx *Context, timeout time.Duration) (*client.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: ctx.Insecure}
+	if ctx.CA != "" {
+		pem, err := ioutil.ReadFile(ctx.CA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", ctx.CA)
+		}
+	}
+	if ctx.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(ctx.Cert, ctx.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	opts := []client.Option{client.WithHTTPClient(&http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	})}
+	switch {
+	case ctx.Token != "":
+		opts = append(opts, client.WithToken(ctx.Token))
+	case ctx.APIKey != "":
+		opts = append(opts, client.WithAPIKey(ctx.APIKey))
+	}
+	return client.New(ctx.Server, opts...), nil
+}
+
+// print the objects in the output format
+func (c *cli) print(objs []map[string]interface{}) error {
+	var columns []string
+	if c.columns != "" {
+		columns = strings.Split(c.columns, ",")
+	}
+	return printObjects(c.stdout, c.output, objs, columns)
+}
+
+// readInput read a file, the standard input if -
+func (c *cli) readInput(name string) ([]byte, error) {
+	if name == "" {
+		return nil, errors.New("-f <file> required")
+	}
+	if name == "-" {
+		return ioutil.ReadAll(c.stdin)
+	}
+	return ioutil.ReadFile(name)
+}
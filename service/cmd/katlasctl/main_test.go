@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/intuit/katlas/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// katlas fake service answering the requests of the tests
+func katlas(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == `/v1.1/qsl/cluster[@name="c1"].pod`:
+			assert.Equal(t, "ApiKey secret", r.Header.Get("Authorization"))
+			w.Write([]byte(`{"status": 200, "count": 2, "objects": [
+				{"uid": "0x1", "objtype": "pod", "name": "web", "resourceid": "pod:c1:ns:web", "namespace": {"name": "ns"}},
+				{"uid": "0x2", "objtype": "pod", "name": "db", "resourceid": "pod:c1:ns:db", "labels": ["a", "b"]}]}`))
+		case r.URL.Path == "/v1.1/qsl/pod[@bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": 400, "code": "Invalid", "message": "invalid qsl", "error": "invalid qsl", "requestid": "7f3a"}`))
+		case r.URL.Path == "/v1.1/query":
+			assert.Equal(t, "pod:c1:ns:web", r.URL.Query().Get("resourceid"))
+			w.Write([]byte(`{"status": 200, "objects": [{"uid": "0x1", "objtype": "pod", "name": "web"}]}`))
+		case r.URL.Path == "/v1.1/entity/0x9":
+			// error body of the former versions of the service
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status": 404, "error": "entity with id 0x9 not found"}`))
+		case r.URL.Path == "/v1.1/import":
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, 2, strings.Count(string(body), "\n"))
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write([]byte(`{"status": 207, "imported": 1, "errors": [{"line": 2, "objtype": "x", "status": 400, "error": "metadata not found"}]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+}
+
+func TestCommands(t *testing.T) {
+	server := katlas(t)
+	defer server.Close()
+	dir, _ := ioutil.TempDir("", "katlasctl")
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config")
+	ctl := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(append([]string{"-config", config}, args...), strings.NewReader(""), &out)
+		return out.String(), err
+	}
+
+	_, err := ctl("qsl", "pod")
+	assert.NotNil(t, err, "query without context")
+	_, err = ctl("config", "set-context", "local", "-server", server.URL, "-apikey", "secret")
+	assert.Nil(t, err)
+	out, _ := ctl("config", "current-context")
+	assert.Equal(t, "local\n", out)
+
+	out, err = ctl("qsl", `cluster[@name="c1"].pod`)
+	assert.Nil(t, err)
+	assert.Equal(t, "OBJTYPE  NAME  NAMESPACE  RESOURCEID     UID\n"+
+		"pod      web   ns         pod:c1:ns:web  0x1\n"+
+		"pod      db               pod:c1:ns:db   0x2\n", out)
+	out, err = ctl("qsl", `cluster[@name="c1"].pod`, "-o", "csv", "-columns", "name,labels")
+	assert.Nil(t, err)
+	assert.Equal(t, "name,labels\nweb,\ndb,\"a,b\"\n", out)
+	out, err = ctl("-o", "yaml", "get", "-rid", "pod:c1:ns:web")
+	assert.Nil(t, err)
+	assert.Equal(t, "- name: web\n  objtype: pod\n  uid: \"0x1\"\n", out)
+
+	_, err = ctl("qsl", "pod[@bad")
+	if assert.True(t, client.IsBadRequest(err), "%v", err) {
+		e := err.(*client.Error)
+		assert.Equal(t, "Invalid", e.Code)
+		assert.Equal(t, "invalid qsl", e.Message)
+		assert.Equal(t, "7f3a", e.RequestID)
+	}
+	_, err = ctl("get", "0x9")
+	assert.True(t, client.IsNotFound(err), "%v", err)
+	assert.EqualError(t, err, "katlas: 404 entity with id 0x9 not found")
+
+	ndjson := filepath.Join(dir, "export.ndjson")
+	ioutil.WriteFile(ndjson, []byte("{\"objtype\":\"pod\"}\n{\"objtype\":\"x\"}\n"), 0600)
+	out, err = ctl("import", "-f", ndjson)
+	assert.EqualError(t, err, "1 lines failed")
+	assert.Contains(t, out, "1 entities imported")
+	assert.Contains(t, out, "metadata not found")
+}
+
+func TestContexts(t *testing.T) {
+	c := &Config{}
+	c.setContext(Context{Name: "prod", Server: "https://katlas", Token: "t1"})
+	c.setContext(Context{Name: "dev", Server: "http://localhost:8011"})
+	c.setContext(Context{Name: "prod", Server: "https://katlas.prod", Token: "t2"})
+	assert.Equal(t, 2, len(c.Contexts))
+
+	_, err := c.context("")
+	assert.NotNil(t, err, "no current context")
+	ctx, err := c.context("prod")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://katlas.prod", ctx.Server)
+	_, err = c.context("qa")
+	assert.NotNil(t, err)
+
+	os.Setenv("KATLAS_TOKEN", "t3")
+	defer os.Unsetenv("KATLAS_TOKEN")
+	ctx, _ = c.context("prod")
+	assert.Equal(t, "t3", ctx.Token)
+	assert.Equal(t, "t2", c.Contexts[0].Token)
+}
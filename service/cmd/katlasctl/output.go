@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats
+const (
+	Table = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+	CSV   = "csv"
+)
+
+// defaultColumns of table and csv output, the columns no object has are left out
+var defaultColumns = []string{"objtype", "name", "namespace", "cluster", "resourceid", "uid"}
+
+// printObjects write the objects in format, table and csv have a row per object with the columns
+// or the default ones, json and yaml keep the whole objects
+func printObjects(w io.Writer, format string, objs []map[string]interface{}, columns []string) error {
+	switch format {
+	case JSON:
+		return printJSON(w, objs)
+	case YAML:
+		return printYAML(w, objs)
+	case Table, CSV:
+		if len(columns) == 0 {
+			columns = presentColumns(objs, defaultColumns)
+		}
+		rows := make([][]string, 0, len(objs))
+		for _, obj := range objs {
+			row := make([]string, len(columns))
+			for i, col := range columns {
+				row[i] = cell(obj[col])
+			}
+			rows = append(rows, row)
+		}
+		if format == CSV {
+			cw := csv.NewWriter(w)
+			cw.Write(columns)
+			cw.WriteAll(rows)
+			return cw.Error()
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown output format %s, use %s, %s, %s or %s", format, Table, JSON, YAML, CSV)
+}
+
+// printValue write a single value, e.g. a metadata, as json or yaml, as json for the table and csv formats
+func printValue(w io.Writer, format string, v interface{}) error {
+	if format == YAML {
+		return printYAML(w, v)
+	}
+	return printJSON(w, v)
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printYAML(w io.Writer, v interface{}) error {
+	// round trip through json so the keys keep their json names
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	if err = yaml.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	out, err := yaml.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// presentColumns return the columns at least one object has, all keys sorted if none of them
+func presentColumns(objs []map[string]interface{}, columns []string) []string {
+	present := make([]string, 0, len(columns))
+	for _, col := range columns {
+		for _, obj := range objs {
+			if _, ok := obj[col]; ok {
+				present = append(present, col)
+				break
+			}
+		}
+	}
+	if len(present) > 0 {
+		return present
+	}
+	keys := map[string]bool{}
+	for _, obj := range objs {
+		for k := range obj {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		present = append(present, k)
+	}
+	sort.Strings(present)
+	return present
+}
+
+// cell format a value for table and csv, related entities are shown by name and lists joined by comma
+func cell(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case map[string]interface{}:
+		for _, k := range []string{"name", "resourceid", "uid"} {
+			if s, ok := value[k].(string); ok {
+				return s
+			}
+		}
+	case []interface{}:
+		cells := make([]string, 0, len(value))
+		for _, item := range value {
+			cells = append(cells, cell(item))
+		}
+		return strings.Join(cells, ",")
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// objectsOf return the objects of a query response
+func objectsOf(ret map[string]interface{}) []map[string]interface{} {
+	list, _ := ret["objects"].([]interface{})
+	objs := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if obj, ok := item.(map[string]interface{}); ok {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
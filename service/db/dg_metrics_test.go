@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
 	"github.com/stretchr/testify/assert"
@@ -9,9 +10,10 @@ import (
 
 func init() {
 	dc := NewDGClient("127.0.0.1:9080")
-	dc.CreateSchema(Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
-	dc.CreateSchema(Schema{Predicate: "resourceid", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), Schema{Predicate: "name", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	dc.CreateSchema(context.Background(), Schema{Predicate: "resourceversionnum", Type: "int", Index: true, Tokenizer: []string{"int"}})
 }
 
 func TestMetricsDgraphNumQueries(t *testing.T) {
@@ -27,7 +29,7 @@ func TestMetricsDgraphNumQueries(t *testing.T) {
 
 	//GetQueryResult
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueries)
-	client.GetQueryResult(query)
+	client.GetQueryResult(context.Background(), query)
 	expectedDgraphNumQueries = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueries)
 	assert.Equal(t, expectedDgraphNumQueries, nextCounter-prevCounter, "DgraphNumQueries is not equal to expected.")
@@ -35,21 +37,21 @@ func TestMetricsDgraphNumQueries(t *testing.T) {
 	//GetEntity
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueries)
 	nid := "0x01"
-	_, _ = client.GetEntity(nid)
+	_, _ = client.GetEntity(context.Background(), nid)
 	expectedDgraphNumQueries = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueries)
 	assert.Equal(t, expectedDgraphNumQueries, nextCounter-prevCounter, "DgraphNumQueries is not equal to expected.")
 
 	//GetSchemaFromDB
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueries)
-	_, _ = client.GetSchemaFromDB()
+	_, _ = client.GetSchemaFromDB(context.Background())
 	expectedDgraphNumQueries = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueries)
 	assert.Equal(t, expectedDgraphNumQueries, nextCounter-prevCounter, "DgraphNumQueries is not equal to expected.")
 
 	//ExecuteDgraphQuery
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueries)
-	_, _ = client.ExecuteDgraphQuery(query)
+	_, _ = client.ExecuteDgraphQuery(context.Background(), query)
 	expectedDgraphNumQueries = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueries)
 	assert.Equal(t, expectedDgraphNumQueries, nextCounter-prevCounter, "DgraphNumQueries is not equal to expected.")
@@ -68,7 +70,7 @@ func TestMetricsDgraphNumQueriesErr(t *testing.T) {
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
-	client.GetQueryResult(query)
+	client.GetQueryResult(context.Background(), query)
 	expectedDgraphNumQueriesErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	assert.Equal(t, expectedDgraphNumQueriesErr, nextCounter-prevCounter, "DgraphNumQueriesErr is not equal to expected.")
@@ -78,7 +80,7 @@ func TestMetricsDgraphNumQueriesErr(t *testing.T) {
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
 	var nid = "nid"
-	_, _ = client.GetEntity(nid)
+	_, _ = client.GetEntity(context.Background(), nid)
 	expectedDgraphNumQueriesErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	assert.Equal(t, expectedDgraphNumQueriesErr, nextCounter-prevCounter, "DgraphNumQueriesErr is not equal to expected.")
@@ -87,7 +89,7 @@ func TestMetricsDgraphNumQueriesErr(t *testing.T) {
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
-	_, _ = client.GetSchemaFromDB()
+	_, _ = client.GetSchemaFromDB(context.Background())
 	expectedDgraphNumQueriesErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	assert.Equal(t, expectedDgraphNumQueriesErr, nextCounter-prevCounter, "DgraphNumQueriesErr is not equal to expected.")
@@ -96,7 +98,7 @@ func TestMetricsDgraphNumQueriesErr(t *testing.T) {
 	prevCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
-	_, _ = client.ExecuteDgraphQuery(query)
+	_, _ = client.ExecuteDgraphQuery(context.Background(), query)
 	expectedDgraphNumQueriesErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumQueriesErr)
 	assert.Equal(t, expectedDgraphNumQueriesErr, nextCounter-prevCounter, "DgraphNumQueriesErr is not equal to expected.")
@@ -112,7 +114,7 @@ func TestMetricsDgraphNumMutations(t *testing.T) {
 	//DeleteEntity
 	prevCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	uid := "0x12345"
-	client.DeleteEntity(uid)
+	client.DeleteEntity(context.Background(), uid)
 	expectedDgraphNumMutations = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	assert.Equal(t, expectedDgraphNumMutations, nextCounter-prevCounter, "DgraphNumMutations is not equal to expected.")
@@ -123,8 +125,8 @@ func TestMetricsDgraphNumMutations(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid1, _ := client.CreateEntity("k8snode", node1)
-	defer client.DeleteEntity(nid1)
+	nid1, _ := client.CreateEntity(context.Background(), "k8snode", node1)
+	defer client.DeleteEntity(context.Background(), nid1)
 	expectedDgraphNumMutations = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	assert.Equal(t, expectedDgraphNumMutations, nextCounter-prevCounter, "DgraphNumMutations is not equal to expected.")
@@ -132,7 +134,7 @@ func TestMetricsDgraphNumMutations(t *testing.T) {
 	//CreateOrDeleteEdge
 	prevCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	var pid, nodeid string
-	client.CreateOrDeleteEdge("k8spod", pid, "k8snode", nodeid, "runsOn", 0)
+	client.CreateOrDeleteEdge(context.Background(), "k8spod", pid, "k8snode", nodeid, "runsOn", 0)
 	expectedDgraphNumMutations = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	assert.Equal(t, expectedDgraphNumMutations, nextCounter-prevCounter, "DgraphNumMutations is not equal to expected.")
@@ -142,11 +144,11 @@ func TestMetricsDgraphNumMutations(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid2, _ := client.CreateEntity("k8snode", node2)
-	defer client.DeleteEntity(nid2)
+	nid2, _ := client.CreateEntity(context.Background(), "k8snode", node2)
+	defer client.DeleteEntity(context.Background(), nid2)
 	prevCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	update := make(map[string]interface{})
-	client.UpdateEntity(nid2, update)
+	client.UpdateEntity(context.Background(), nid2, update)
 	expectedDgraphNumMutations = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutations)
 	assert.Equal(t, expectedDgraphNumMutations, nextCounter-prevCounter, "DgraphNumMutations is not equal to expected.")
@@ -162,7 +164,7 @@ func TestMetricsDgraphNumMutationsErr(t *testing.T) {
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
 	uid := "0x12345"
-	client.DeleteEntity(uid)
+	client.DeleteEntity(context.Background(), uid)
 	expectedDgraphNumMutationsErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutationsErr)
 	assert.Equal(t, expectedDgraphNumMutationsErr, nextCounter-prevCounter, "DgraphNumMutationsErr is not equal to expected.")
@@ -175,8 +177,8 @@ func TestMetricsDgraphNumMutationsErr(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid1, _ := client.CreateEntity("k8snode", node1)
-	defer client.DeleteEntity(nid1)
+	nid1, _ := client.CreateEntity(context.Background(), "k8snode", node1)
+	defer client.DeleteEntity(context.Background(), nid1)
 	expectedDgraphNumMutationsErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutationsErr)
 	assert.Equal(t, expectedDgraphNumMutationsErr, nextCounter-prevCounter, "DgraphNumMutationsErr is not equal to expected.")
@@ -186,7 +188,7 @@ func TestMetricsDgraphNumMutationsErr(t *testing.T) {
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
 	var pid, nodeid string
-	client.CreateOrDeleteEdge("k8spod", pid, "k8snode", nodeid, "runsOn", 0)
+	client.CreateOrDeleteEdge(context.Background(), "k8spod", pid, "k8snode", nodeid, "runsOn", 0)
 	expectedDgraphNumMutationsErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutationsErr)
 	assert.Equal(t, expectedDgraphNumMutationsErr, nextCounter-prevCounter, "DgraphNumMutationsErr is not equal to expected.")
@@ -196,13 +198,13 @@ func TestMetricsDgraphNumMutationsErr(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid2, _ := client.CreateEntity("k8snode", node2)
-	defer client.DeleteEntity(nid2)
+	nid2, _ := client.CreateEntity(context.Background(), "k8snode", node2)
+	defer client.DeleteEntity(context.Background(), nid2)
 	prevCounter = util.ReadCounter(metrics.DgraphNumMutationsErr)
 	client = NewDGClient("127.0.0.1:9080")
 	client.Close()
 	update := make(map[string]interface{})
-	client.UpdateEntity(nid2, update)
+	client.UpdateEntity(context.Background(), nid2, update)
 	expectedDgraphNumMutationsErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumMutationsErr)
 	assert.Equal(t, expectedDgraphNumMutationsErr, nextCounter-prevCounter, "DgraphNumMutationsErr is not equal to expected.")
@@ -221,8 +223,8 @@ func TestMetricsDgraphNumCreateEntityErr(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid1, _ := client.CreateEntity("k8snode", node1)
-	defer client.DeleteEntity(nid1)
+	nid1, _ := client.CreateEntity(context.Background(), "k8snode", node1)
+	defer client.DeleteEntity(context.Background(), nid1)
 
 	expectedDgraphNumCreateEntityErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumCreateEntityErr)
@@ -240,14 +242,14 @@ func TestMetricsDgraphNumGetEntityErr(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid1, _ := client.CreateEntity("k8snode", node1)
-	defer client.DeleteEntity(nid1)
+	nid1, _ := client.CreateEntity(context.Background(), "k8snode", node1)
+	defer client.DeleteEntity(context.Background(), nid1)
 
 	//Get Entity
 	prevCounter = util.ReadCounter(metrics.DgraphNumGetEntityErr)
 	var nid string
 	client.Close()
-	_, _ = client.GetEntity(nid)
+	_, _ = client.GetEntity(context.Background(), nid)
 	expectedDgraphNumGetEntityErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumGetEntityErr)
 	assert.Equal(t, expectedDgraphNumGetEntityErr, nextCounter-prevCounter, "DgraphNumGetEntityErr is not equal to expected.")
@@ -263,14 +265,14 @@ func TestMetricsDgraphNumUpdateEntityErr(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid1, _ := client.CreateEntity("k8snode", node1)
-	defer client.DeleteEntity(nid1)
+	nid1, _ := client.CreateEntity(context.Background(), "k8snode", node1)
+	defer client.DeleteEntity(context.Background(), nid1)
 
 	//Update Entity
 	prevCounter = util.ReadCounter(metrics.DgraphNumUpdateEntityErr)
 	update := make(map[string]interface{})
 	client.Close()
-	client.UpdateEntity(nid1, update)
+	client.UpdateEntity(context.Background(), nid1, update)
 	expectedDgraphNumUpdateEntityErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumUpdateEntityErr)
 	assert.Equal(t, expectedDgraphNumUpdateEntityErr, nextCounter-prevCounter, "DgraphNumUpdateEntityErr is not equal to expected.")
@@ -286,11 +288,11 @@ func TestMetricsDgraphNumDeleteEntityErr(t *testing.T) {
 		"objtype": "k8snode",
 		"name":    "test-node-metrics",
 	}
-	nid1, _ := client.CreateEntity("k8snode", node1)
+	nid1, _ := client.CreateEntity(context.Background(), "k8snode", node1)
 
 	prevCounter = util.ReadCounter(metrics.DgraphNumDeleteEntityErr)
 	client.Close()
-	client.DeleteEntity(nid1)
+	client.DeleteEntity(context.Background(), nid1)
 	expectedDgraphNumDeleteEntityErr = 1.0
 	nextCounter = util.ReadCounter(metrics.DgraphNumDeleteEntityErr)
 	assert.Equal(t, expectedDgraphNumDeleteEntityErr, nextCounter-prevCounter, "DgraphNumDeleteEntityErr is not equal to expected.")
@@ -298,5 +300,5 @@ func TestMetricsDgraphNumDeleteEntityErr(t *testing.T) {
 
 func cleanup(nid string) {
 	client := NewDGClient("127.0.0.1:9080")
-	client.DeleteEntity(nid)
+	client.DeleteEntity(context.Background(), nid)
 }
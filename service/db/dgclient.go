@@ -3,19 +3,20 @@ package db
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 
 	"fmt"
-	log "github.com/Sirupsen/logrus"
 	"github.com/cenkalti/backoff"
-	"github.com/dgraph-io/dgo"
-	"github.com/dgraph-io/dgo/protos/api"
+	"github.com/dgraph-io/dgo/v2"
+	"github.com/dgraph-io/dgo/v2/protos/api"
 	"github.com/hashicorp/golang-lru"
 	"github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"reflect"
+	"google.golang.org/grpc/credentials"
 	"strconv"
 )
 
@@ -51,49 +52,87 @@ type Schema struct {
 
 // DGClient will run query or command on dgraph
 type DGClient struct {
-	conn *grpc.ClientConn
-	dc   *dgo.Dgraph
+	conns []*grpc.ClientConn
+	dc    *dgo.Dgraph
+	// predicates of the dgraph type of the entities
+	entityType *entityType
 }
 
 // IDGClient ... define interface to DGClient
 type IDGClient interface {
-	GetCacheContainsDBSchema() (*lru.Cache, error)
-	GetSchemaFromCache(cache *lru.Cache) ([]*api.SchemaNode, error)
+	GetCacheContainsDBSchema(ctx context.Context) (*lru.Cache, error)
+	GetSchemaFromCache(ctx context.Context, cache *lru.Cache) ([]*Schema, error)
 	RemoveDBSchemaFromCache(cache *lru.Cache)
-	GetSchemaFromDB() ([]*api.SchemaNode, error)
-	CreateSchema(sm Schema) error
-	DropSchema(name string) error
-	GetEntity(uuid string) (map[string]interface{}, error)
-	GetAllByClusterAndType(meta string, cluster string) (map[string]interface{}, error)
-	DeleteEntity(uuid string) error
-	CreateEntity(meta string, data map[string]interface{}) (string, error)
-	CreateOrDeleteEdge(fromType string, fromUID string, toType string, toUID string, rel string, op Action) error
-	UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext) error
-	GetQueryResult(query string) (map[string]interface{}, error)
+	GetSchemaFromDB(ctx context.Context) ([]*Schema, error)
+	CreateSchema(ctx context.Context, sm Schema) error
+	DropSchema(ctx context.Context, name string) error
+	GetEntity(ctx context.Context, uuid string) (map[string]interface{}, error)
+	GetAllByClusterAndType(ctx context.Context, meta string, cluster string) (map[string]interface{}, error)
+	GetPageByClusterAndType(ctx context.Context, meta string, cluster string, after string, limit int) (map[string]interface{}, error)
+	DeleteEntity(ctx context.Context, uuid string) error
+	DeleteEntities(ctx context.Context, uuids []string) error
+	CreateTombstone(ctx context.Context, uuid string, data map[string]interface{}) error
+	CreateEntity(ctx context.Context, meta string, data map[string]interface{}) (string, error)
+	CreateOrDeleteEdge(ctx context.Context, fromType string, fromUID string, toType string, toUID string, rel string, op Action) error
+	UpdateEntity(ctx context.Context, uuid string, data map[string]interface{}, option ...util.OptionContext) error
+	GetQueryResult(ctx context.Context, query string) (map[string]interface{}, error)
 	Close() error
-	ExecuteDgraphQuery(query string) (map[string]interface{}, error)
+	Ping(ctx context.Context) error
+	ExecuteDgraphQuery(ctx context.Context, query string) (map[string]interface{}, error)
+	SyncEntityType(ctx context.Context) error
+	TypeEntities(ctx context.Context) (int, error)
+	NumberVersions(ctx context.Context) (int, error)
 }
 
 // NewDGClient create client instance
 // TODO:
 // consider to return single client stub without close connection
 func NewDGClient(dgraphHost string) *DGClient {
-	// Dial a gRPC connection.
-	log.Infof("Connecting to dgraph [%s]", dgraphHost)
-	conn, err := grpc.Dial(dgraphHost,
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(20*1024*1024)),
-		grpc.WithInsecure())
+	return NewDGClients([]string{dgraphHost}, DGClientOptions{})
+}
 
-	if err != nil {
-		log.Fatal(err)
-	}
-	return &DGClient{
-		conn, dgo.NewDgraphClient(api.NewDgraphClient(conn)),
+// DefaultMaxRecvMsgSize is the maximum size of a dgraph response by default
+const DefaultMaxRecvMsgSize = 20 * 1024 * 1024
+
+// DGClientOptions of the connections to dgraph
+type DGClientOptions struct {
+	// TLS config of the connections, without TLS if nil
+	TLS *tls.Config
+	// MaxRecvMsgSize is the maximum size of a response, DefaultMaxRecvMsgSize if 0
+	MaxRecvMsgSize int
+}
+
+// NewDGClients create client instance spreading the requests over the alphas at dgraphHosts
+func NewDGClients(dgraphHosts []string, options DGClientOptions) *DGClient {
+	transport := grpc.WithInsecure()
+	if options.TLS != nil {
+		transport = grpc.WithTransportCredentials(credentials.NewTLS(options.TLS))
+	}
+	maxSize := options.MaxRecvMsgSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxRecvMsgSize
+	}
+	client := &DGClient{entityType: &entityType{}}
+	clients := []api.DgraphClient{}
+	for _, host := range dgraphHosts {
+		// Dial a gRPC connection.
+		log.Infof("Connecting to dgraph [%s], tls: %v", host, options.TLS != nil)
+		conn, err := grpc.Dial(host,
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxSize)),
+			transport)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+		client.conns = append(client.conns, conn)
+		clients = append(clients, api.NewDgraphClient(conn))
 	}
+	client.dc = dgo.NewDgraphClient(clients...)
+	return client
 }
 
 // GetEntity - get entity by uid
-func (s DGClient) GetEntity(uuid string) (map[string]interface{}, error) {
+func (s DGClient) GetEntity(ctx context.Context, uuid string) (map[string]interface{}, error) {
 	q := `
 		query qry($uuid: string) {
 			objects(func: uid($uuid)) {
@@ -105,7 +144,7 @@ func (s DGClient) GetEntity(uuid string) (map[string]interface{}, error) {
 			}
 		}
 	`
-	resp, err := s.dc.NewTxn().QueryWithVars(context.Background(), q, map[string]string{"$uuid": uuid})
+	resp, err := s.dc.NewTxn().QueryWithVars(ctx, q, map[string]string{"$uuid": uuid})
 	if err != nil {
 		metrics.DgraphNumGetEntityErr.Inc()
 		metrics.DgraphNumQueriesErr.Inc()
@@ -129,8 +168,7 @@ func (s DGClient) GetEntity(uuid string) (map[string]interface{}, error) {
 }
 
 // DeleteEntity - delete entity by uuid
-func (s DGClient) DeleteEntity(uuid string) error {
-	ctx := context.Background()
+func (s DGClient) DeleteEntity(ctx context.Context, uuid string) error {
 	txn := s.dc.NewTxn()
 	defer txn.Discard(ctx)
 	q := `
@@ -153,108 +191,116 @@ func (s DGClient) DeleteEntity(uuid string) error {
 	return nil
 }
 
-// CreateEntity - create entity
-func (s DGClient) CreateEntity(meta string, data map[string]interface{}) (string, error) {
-	mu := &api.Mutation{
-		CommitNow: false,
+// DeleteEntities - delete entities by uuid in a single transaction
+func (s DGClient) DeleteEntities(ctx context.Context, uuids []string) error {
+	if len(uuids) == 0 {
+		return nil
 	}
-	// query for check existing resource
-	q := fmt.Sprintf(`
-		{
-			objects(func: eq(resourceid, "%s")) {
-				uid
-				resourceid
-				name
-				objtype
-				resourceversion
-			}
-		}
-	`, data[util.ResourceID])
-	ctx := context.Background()
-
 	txn := s.dc.NewTxn()
 	defer txn.Discard(ctx)
-	current, ex := s.ExecuteDgraphQuery(q)
-	if ex != nil {
-		metrics.DgraphNumCreateEntityErr.Inc()
-		metrics.DgraphNumMutationsErr.Inc()
-		return "", ex
-	}
-	// check if object exist
-	if len(current[util.Objects].([]interface{})) > 0 {
-		// new version has to larger than old
-		valid := validateResourceVersion(current, data)
-		if !valid {
-			return current[util.Objects].([]interface{})[0].(map[string]interface{})[util.UID].(string), nil
-		}
-		uid := current[util.Objects].([]interface{})[0].(map[string]interface{})[util.UID].(string)
-		err := cleanListOrEdgesFields(ctx, uid, data, mu, txn)
-		if err != nil {
-			metrics.DgraphNumCreateEntityErr.Inc()
-			metrics.DgraphNumMutationsErr.Inc()
-			log.Error(err, data)
-			return "", err
-		}
-		data[util.UID] = uid
+	nodes := make([]map[string]interface{}, 0, len(uuids))
+	for _, uuid := range uuids {
+		nodes = append(nodes, map[string]interface{}{util.UID: uuid})
 	}
-	if _, ok := data[util.ResourceVersion]; !ok {
-		data[util.ResourceVersion] = "0"
+	delJSON, _ := json.Marshal(nodes)
+	mu := &api.Mutation{
+		CommitNow:  true,
+		DeleteJson: delJSON,
 	}
-	jsonData, _ := json.Marshal(data)
-	mu.SetJson = jsonData
-	resp, err := txn.Mutate(ctx, mu)
+	_, err := txn.Mutate(ctx, mu)
 	if err != nil {
-		metrics.DgraphNumCreateEntityErr.Inc()
+		metrics.DgraphNumDeleteEntityErr.Inc()
 		metrics.DgraphNumMutationsErr.Inc()
-		log.Error(err, data)
-		return "", err
+		log.Debug(err)
+		return err
 	}
-	e := txn.Commit(ctx)
-	if e != nil {
-		log.Errorf("%s, %v", e.Error(), data)
-		metrics.DgraphNumCreateEntityErr.Inc()
+	metrics.DgraphNumMutations.Inc()
+	return nil
+}
+
+// tombstoneQuery look up node, the entity $uid if its version is not higher than $version when the second %s is
+// the filter comparing them, the first declares $version then. The replaced block returns the node replaced by the tombstone
+const tombstoneQuery = `
+	query tombstone($uid: string%s) {
+		node as var(func: uid($uid)) %s
+		replaced(func: uid(node)) {
+			uid
+		}
+	}
+`
+
+// CreateTombstone - replace all predicates of entity uuid by the tombstone data in a single upsert request,
+// unless the stored version is higher than the version of the tombstone, e.g. the object was created again
+func (s DGClient) CreateTombstone(ctx context.Context, uuid string, data map[string]interface{}) error {
+	txn := s.dc.NewTxn()
+	defer txn.Discard(ctx)
+	data[util.UID] = "uid(node)"
+	q := fmt.Sprintf(tombstoneQuery, "", "")
+	vars := map[string]string{"$uid": uuid}
+	// the version number is deleted with the object, the upserts compare it to ignore older versions
+	if version, err := strconv.ParseInt(fmt.Sprintf("%v", data[util.ResourceVersion]), 10, 64); err == nil {
+		data[util.VersionNumber] = version
+		q = fmt.Sprintf(tombstoneQuery, ", $version: int", `@filter(NOT has(`+util.VersionNumber+`) OR le(`+util.VersionNumber+`, $version))`)
+		vars["$version"] = strconv.FormatInt(version, 10)
+	}
+	setJSON, _ := json.Marshal(withEntityType(data))
+	resp, err := txn.Do(ctx, &api.Request{
+		Query: q,
+		Vars:  vars,
+		Mutations: []*api.Mutation{
+			{Cond: "@if(gt(len(node), 0))", DelNquads: []byte("uid(node) * * .")},
+			{Cond: "@if(gt(len(node), 0))", SetJson: setJSON},
+		},
+		CommitNow: true,
+	})
+	data[util.UID] = uuid
+	if err != nil {
+		metrics.DgraphNumDeleteEntityErr.Inc()
 		metrics.DgraphNumMutationsErr.Inc()
-		return "", e
+		log.Debug(err)
+		return err
 	}
-	metrics.DgraphNumMutations.Inc()
-	log.Debugf("%s %s upsert with version %s successfully", meta, data[util.Name], data[util.ResourceVersion])
-	// return created blank node uid
-	if uid, ok := resp.Uids["A"]; ok {
-		return uid, nil
+	var result struct {
+		Replaced []struct {
+			UID string `json:"uid"`
+		} `json:"replaced"`
 	}
-	if uid, ok := resp.Uids["blank-0"]; ok {
-		return uid, nil
+	if err = json.Unmarshal(resp.GetJson(), &result); err != nil {
+		return err
 	}
-	return data[util.UID].(string), nil
+	if len(result.Replaced) == 0 {
+		log.Infof("ignore tombstone of %s version %v, stored version is newer", uuid, data[util.ResourceVersion])
+		return nil
+	}
+	metrics.DgraphNumMutations.Inc()
+	s.syncEntityTypeFor(ctx, data)
+	return nil
 }
 
-// cleanFields - remove fields from nodes
-func cleanListOrEdgesFields(ctx context.Context, uuid string, data map[string]interface{}, mu *api.Mutation, txn *dgo.Txn) error {
-	// array and edges not able to replace, have to set them to nil and create it again
-	delMap := make(map[string]interface{})
-	for k, v := range data {
-		if reflect.TypeOf(v).Kind() == reflect.Map || reflect.TypeOf(v).Kind() == reflect.Slice {
-			delMap[k] = nil
-		}
+// CreateEntity - create entity, or update the one with the same resourceid if the resource version is higher
+func (s DGClient) CreateEntity(ctx context.Context, meta string, data map[string]interface{}) (string, error) {
+	uid, written, err := s.upsert(ctx, upsert{
+		fn:                "eq(resourceid, $key)",
+		key:               fmt.Sprintf("%v", data[util.ResourceID]),
+		create:            true,
+		replaceListOrEdge: true,
+		cleanTombstone:    meta != util.Tombstone,
+	}, data)
+	if err != nil {
+		metrics.DgraphNumCreateEntityErr.Inc()
+		metrics.DgraphNumMutationsErr.Inc()
+		log.Error(err, data)
+		return "", err
 	}
-	if len(delMap) > 0 {
-		delMap[util.UID] = uuid
-		delJSON, _ := json.Marshal(delMap)
-		mu.DeleteJson = delJSON
-		_, err := txn.Mutate(ctx, mu)
-		if err != nil {
-			metrics.DgraphNumMutationsErr.Inc()
-			log.Error(err, data)
-			return err
-		}
-		mu.DeleteJson = nil
+	if written {
+		metrics.DgraphNumMutations.Inc()
+		log.Debugf("%s %s upsert with version %v successfully", meta, data[util.Name], data[util.ResourceVersion])
 	}
-	return nil
+	return uid, nil
 }
 
 // CreateOrDeleteEdge - create or remove edge
-func (s DGClient) CreateOrDeleteEdge(fromType string, fromUID string, toType string, toUID string, rel string, op Action) error {
-	ctx := context.Background()
+func (s DGClient) CreateOrDeleteEdge(ctx context.Context, fromType string, fromUID string, toType string, toUID string, rel string, op Action) error {
 	txn := s.dc.NewTxn()
 	defer txn.Discard(ctx)
 	// construct json string for create/delete edge
@@ -289,73 +335,32 @@ func (s DGClient) CreateOrDeleteEdge(fromType string, fromUID string, toType str
 }
 
 // UpdateEntity - update entity
-func (s DGClient) UpdateEntity(uuid string, data map[string]interface{}, option ...util.OptionContext) error {
-	data[util.UID] = uuid
-	mu := &api.Mutation{
-		CommitNow: false,
-	}
-	ctx := context.Background()
-	// query for check existing resource
-	q := fmt.Sprintf(`
-		{
-			objects(func: uid(%s)) {
-				uid
-				objtype
-				resourceversion
-			}
-		}
-	`, uuid)
-
-	txn := s.dc.NewTxn()
-	defer txn.Discard(ctx)
-	current, ex := s.ExecuteDgraphQuery(q)
-	if ex != nil {
+func (s DGClient) UpdateEntity(ctx context.Context, uuid string, data map[string]interface{}, option ...util.OptionContext) error {
+	uid, written, err := s.upsert(ctx, upsert{
+		fn:                "uid($key)",
+		key:               uuid,
+		replaceListOrEdge: len(option) == 0 || option[0].ReplaceListOrEdge,
+	}, data)
+	if err != nil {
 		metrics.DgraphNumUpdateEntityErr.Inc()
 		metrics.DgraphNumMutationsErr.Inc()
-		return ex
-	}
-	// check if object exist
-	if len(current[util.Objects].([]interface{})) > 0 {
-		// new version has to larger than old
-		valid := validateResourceVersion(current, data)
-		if !valid {
-			return backoff.Permanent(fmt.Errorf("resource %s updated by others with higher version, ignore this change", uuid))
-		}
-		if len(option) == 0 || option[0].ReplaceListOrEdge {
-			err := cleanListOrEdgesFields(ctx, uuid, data, mu, txn)
-			if err != nil {
-				metrics.DgraphNumUpdateEntityErr.Inc()
-				metrics.DgraphNumMutationsErr.Inc()
-				log.Error(err, data)
-				return err
-			}
-		}
-		jsonData, _ := json.Marshal(data)
-		mu.SetJson = jsonData
-		_, err := txn.Mutate(ctx, mu)
-		if err != nil {
-			metrics.DgraphNumUpdateEntityErr.Inc()
-			metrics.DgraphNumMutationsErr.Inc()
-			log.Error(err, data)
-			return err
-		}
-		e := txn.Commit(ctx)
-		if e != nil {
-			log.Errorf("%s, %v", e.Error(), data)
-			metrics.DgraphNumUpdateEntityErr.Inc()
-			metrics.DgraphNumMutationsErr.Inc()
-			return e
-		}
-		metrics.DgraphNumMutations.Inc()
-		log.Debugf("%s %s updated to version %s successfully", data[util.Name], uuid, data[util.ResourceVersion])
-		return nil
+		log.Error(err, data)
+		return err
+	}
+	if uid == "" {
+		return backoff.Permanent(fmt.Errorf("update failed, resource %s not found", uuid))
+	}
+	if !written {
+		return backoff.Permanent(fmt.Errorf("resource %s updated by others with higher version, ignore this change", uuid))
 	}
-	return backoff.Permanent(fmt.Errorf("update failed, resource %s not found", uuid))
+	metrics.DgraphNumMutations.Inc()
+	log.Debugf("%s %s updated to version %v successfully", data[util.Name], uuid, data[util.ResourceVersion])
+	return nil
 }
 
 // GetQueryResult - get Query Results
-func (s DGClient) GetQueryResult(query string) (map[string]interface{}, error) {
-	resp, err := s.dc.NewTxn().Query(context.Background(), query)
+func (s DGClient) GetQueryResult(ctx context.Context, query string) (map[string]interface{}, error) {
+	resp, err := s.dc.NewTxn().Query(ctx, query)
 	if err != nil {
 		metrics.DgraphNumQueriesErr.Inc()
 		log.Errorf("Query[%v] Error [%v]\n", query, err)
@@ -373,7 +378,7 @@ func (s DGClient) GetQueryResult(query string) (map[string]interface{}, error) {
 }
 
 // GetAllByClusterAndType - query to get result by filter edge
-func (s DGClient) GetAllByClusterAndType(meta string, cluster string) (map[string]interface{}, error) {
+func (s DGClient) GetAllByClusterAndType(ctx context.Context, meta string, cluster string) (map[string]interface{}, error) {
 	q := `
 	query qry($type: string, $cluster: string) 
 	{
@@ -381,12 +386,55 @@ func (s DGClient) GetAllByClusterAndType(meta string, cluster string) (map[strin
 			uid
 			name
 			resourceid
+			resourceversion
 			cluster @filter (eq(name, $cluster)) {
 				name
 			}
 		}
 	}`
-	resp, err := s.dc.NewTxn().QueryWithVars(context.Background(), q, map[string]string{"$type": meta, "$cluster": cluster})
+	resp, err := s.dc.NewTxn().QueryWithVars(ctx, q, map[string]string{"$type": meta, "$cluster": cluster})
+	if err != nil {
+		metrics.DgraphNumQueriesErr.Inc()
+		log.Errorf("Query[%v] Error [%v]\n", q, err)
+		return nil, err
+	}
+	metrics.DgraphNumQueries.Inc()
+
+	m := make(map[string]interface{})
+	err = json.Unmarshal(resp.Json, &m)
+	if err != nil {
+		log.Errorf("Query[%v] Error [%v]\n", q, err)
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetPageByClusterAndType - query the next limit entities of type meta after the uid after, in cluster if not empty,
+// with all their fields and the resourceid of the entities at their edges
+func (s DGClient) GetPageByClusterAndType(ctx context.Context, meta string, cluster string, after string, limit int) (map[string]interface{}, error) {
+	filter := `objs as var(func: eq(objtype, $type))`
+	if cluster != "" && meta == util.Cluster {
+		filter = `objs as var(func: eq(objtype, $type)) @filter(eq(name, $cluster))`
+	} else if cluster != "" {
+		filter = `var(func: eq(objtype, "` + util.Cluster + `")) @filter(eq(name, $cluster)) {
+			objs as ~cluster @filter(eq(objtype, $type))
+		}`
+	}
+	if after == "" {
+		after = "0x0"
+	}
+	q := fmt.Sprintf(`
+	query page($type: string, $cluster: string)
+	{
+		%s
+		objects(func: uid(objs), first: %d, after: %s) {
+			uid
+			expand(_all_) {
+				resourceid
+			}
+		}
+	}`, filter, limit, after)
+	resp, err := s.dc.NewTxn().QueryWithVars(ctx, q, map[string]string{"$type": meta, "$cluster": cluster})
 	if err != nil {
 		metrics.DgraphNumQueriesErr.Inc()
 		log.Errorf("Query[%v] Error [%v]\n", q, err)
@@ -404,10 +452,10 @@ func (s DGClient) GetAllByClusterAndType(meta string, cluster string) (map[strin
 }
 
 //GetCacheContainsDBSchema - Get cache which contains db schema
-func (s DGClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
+func (s DGClient) GetCacheContainsDBSchema(ctx context.Context) (*lru.Cache, error) {
 	//Add db schema to the cache
 	if !InitLruCacheDBSchema {
-		dbSchemaNodes, err := s.GetSchemaFromDB()
+		dbSchemaNodes, err := s.GetSchemaFromDB(ctx)
 		if err != nil {
 			log.Errorf("err: %v", err)
 			return nil, err
@@ -418,7 +466,7 @@ func (s DGClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
 		//Looks up a key's value from the cache
 		_, ok := LruCache.Get(CacheKey)
 		if !ok {
-			dbSchemaNodes, err := s.GetSchemaFromDB()
+			dbSchemaNodes, err := s.GetSchemaFromDB(ctx)
 			if err != nil {
 				log.Errorf("err: %v", err)
 				return nil, err
@@ -430,8 +478,8 @@ func (s DGClient) GetCacheContainsDBSchema() (*lru.Cache, error) {
 }
 
 //GetSchemaFromCache - Get db schema from cache
-func (s DGClient) GetSchemaFromCache(cache *lru.Cache) ([]*api.SchemaNode, error) {
-	cache, err := s.GetCacheContainsDBSchema()
+func (s DGClient) GetSchemaFromCache(ctx context.Context, cache *lru.Cache) ([]*Schema, error) {
+	cache, err := s.GetCacheContainsDBSchema(ctx)
 	if err != nil {
 		log.Errorf("err: %v", err)
 		return nil, err
@@ -442,24 +490,30 @@ func (s DGClient) GetSchemaFromCache(cache *lru.Cache) ([]*api.SchemaNode, error
 		return nil, err
 	}
 
-	dbSchemaNodes, ok := dbSchemaNodesInterface.([]*api.SchemaNode)
+	dbSchemaNodes, ok := dbSchemaNodesInterface.([]*Schema)
 	return dbSchemaNodes, nil
 }
 
 //GetSchemaFromDB - get all predicates
-func (s DGClient) GetSchemaFromDB() ([]*api.SchemaNode, error) {
+func (s DGClient) GetSchemaFromDB(ctx context.Context) ([]*Schema, error) {
 	q := `
 		schema {}
 	`
-	resp, err := s.dc.NewTxn().Query(context.Background(), q)
+	resp, err := s.dc.NewTxn().Query(ctx, q)
 	if err != nil {
 		metrics.DgraphNumQueriesErr.Inc()
 		log.Errorf("Query [%v] Error [%v]\n", q, err)
 		return nil, err
 	}
 	metrics.DgraphNumQueries.Inc()
-	smn := resp.Schema
-	return smn, nil
+	var result struct {
+		Schema []*Schema `json:"schema"`
+	}
+	if err = json.Unmarshal(resp.GetJson(), &result); err != nil {
+		log.Errorf("Query [%v] Error [%v]\n", q, err)
+		return nil, err
+	}
+	return result.Schema, nil
 }
 
 //RemoveDBSchemaFromCache - remove DBSchema key from the Cache
@@ -468,7 +522,7 @@ func (s DGClient) RemoveDBSchemaFromCache(cache *lru.Cache) {
 }
 
 // CreateSchema - create index
-func (s DGClient) CreateSchema(sm Schema) error {
+func (s DGClient) CreateSchema(ctx context.Context, sm Schema) error {
 	var buffer bytes.Buffer
 	buffer.WriteString(sm.Predicate)
 	buffer.WriteString(": ")
@@ -476,7 +530,8 @@ func (s DGClient) CreateSchema(sm Schema) error {
 		buffer.WriteString(sm.Type)
 
 	} else if sm.Type == util.UID {
-		buffer.WriteString(sm.Type)
+		// a uid predicate holds many edges, since dgraph 1.1 it is declared as a list for that
+		buffer.WriteString("[" + sm.Type + "]")
 		if sm.Count {
 			buffer.WriteString(" @count")
 		}
@@ -507,7 +562,6 @@ func (s DGClient) CreateSchema(sm Schema) error {
 		}
 	}
 	buffer.WriteString(" .")
-	ctx := context.Background()
 	err := s.dc.Alter(ctx, &api.Operation{Schema: buffer.String()})
 	if err != nil {
 		log.Debug(err)
@@ -516,10 +570,14 @@ func (s DGClient) CreateSchema(sm Schema) error {
 	return nil
 }
 
-// DropSchema remove db schema by name
-func (s DGClient) DropSchema(name string) error {
-	ctx := context.Background()
-	err := s.dc.Alter(ctx, &api.Operation{DropAttr: name})
+// DropSchema remove db schema by name, the predicate is removed from the entity type first
+func (s DGClient) DropSchema(ctx context.Context, name string) error {
+	err := s.syncEntityType(ctx, name)
+	if err != nil {
+		log.Debug(err)
+		return err
+	}
+	err = s.dc.Alter(ctx, &api.Operation{DropAttr: name})
 	if err != nil {
 		log.Debug(err)
 		return err
@@ -529,16 +587,30 @@ func (s DGClient) DropSchema(name string) error {
 
 // Close - destroy connection
 func (s DGClient) Close() error {
-	return s.conn.Close()
+	var err error
+	for _, conn := range s.conns {
+		if e := conn.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Ping run a trivial query to check dgraph is reachable
+func (s DGClient) Ping(ctx context.Context) error {
+	txn := s.dc.NewTxn()
+	defer txn.Discard(ctx)
+	_, err := txn.Query(ctx, `{ ping(func: uid(0x1)) { uid } }`)
+	return err
 }
 
 // ExecuteDgraphQuery - Takes a dgraph query as a string and executes on a dgraph instance
-func (s DGClient) ExecuteDgraphQuery(query string) (map[string]interface{}, error) {
+func (s DGClient) ExecuteDgraphQuery(ctx context.Context, query string) (map[string]interface{}, error) {
 
 	txn := s.dc.NewTxn()
-	defer txn.Discard(context.Background())
+	defer txn.Discard(ctx)
 
-	resp, err := txn.Query(context.Background(), query)
+	resp, err := txn.Query(ctx, query)
 	if err != nil {
 		metrics.DgraphNumQueriesErr.Inc()
 		log.Errorf("query err: %#v\n", err)
@@ -558,26 +630,3 @@ func (s DGClient) ExecuteDgraphQuery(query string) (map[string]interface{}, erro
 	return respjson, nil
 
 }
-
-// check resource version
-func validateResourceVersion(node, data map[string]interface{}) bool {
-	cv, hasVersion := node[util.Objects].([]interface{})[0].(map[string]interface{})[util.ResourceVersion]
-	var currentVersion int64
-	if hasVersion {
-		currentVersion, _ = strconv.ParseInt(cv.(string), 10, 64)
-	}
-	// check resourceversion
-	if version, ok := data[util.ResourceVersion]; ok {
-		inputVersion, _ := strconv.ParseInt(version.(string), 10, 64)
-		// input version less than or equal current version, ignore
-		if inputVersion <= currentVersion {
-			return false
-		}
-	} else {
-		// increase version
-		if hasVersion {
-			data[util.ResourceVersion] = strconv.FormatInt(currentVersion+1, 10)
-		}
-	}
-	return true
-}
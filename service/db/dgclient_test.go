@@ -1,11 +1,12 @@
 package db
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
-	log "github.com/Sirupsen/logrus"
 	lru "github.com/hashicorp/golang-lru"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,8 +19,8 @@ func TestDGClient(t *testing.T) {
 		"name":    "node01",
 		"labels":  "testingnode",
 	}
-	nid, _ := client.CreateEntity("K8sNode", node)
-	defer client.DeleteEntity(nid)
+	nid, _ := client.CreateEntity(context.Background(), "K8sNode", node)
+	defer client.DeleteEntity(context.Background(), nid)
 
 	// create pod
 	pod := map[string]interface{}{
@@ -32,14 +33,14 @@ func TestDGClient(t *testing.T) {
 		"status":          "Running",
 		"ip":              "172.20.32.128",
 	}
-	v, err := client.CreateEntity("K8sPod", pod)
+	v, err := client.CreateEntity(context.Background(), "K8sPod", pod)
 	if err != nil {
 		log.Fatalf("create testing data pod01 failed %v", err)
 	}
-	defer client.DeleteEntity(v)
+	defer client.DeleteEntity(context.Background(), v)
 
 	// get pod01 by uid
-	pod01, err := client.GetEntity(v)
+	pod01, err := client.GetEntity(context.Background(), v)
 	if err != nil {
 		log.Fatalf("failed to get pod01 entity %v", err)
 	}
@@ -47,9 +48,9 @@ func TestDGClient(t *testing.T) {
 	// assert resourceid is the same as input
 	assert.Equal(t, o2["resourceid"], "unique_id_of_pod", "pod01 resourceid not the same as input")
 	// create relationship
-	client.CreateOrDeleteEdge("K8sPod", v, "K8sNode", nid, "runsOn", create)
+	client.CreateOrDeleteEdge(context.Background(), "K8sPod", v, "K8sNode", nid, "runsOn", create)
 	// get pod again to check rel
-	pod01, _ = client.GetEntity(v)
+	pod01, _ = client.GetEntity(context.Background(), v)
 	o3 := pod01["objects"].([]interface{})[0].(map[string]interface{})
 	if val, ok := o3["runsOn"]; ok {
 		rel := val.([]interface{})[0].(map[string]interface{})
@@ -59,13 +60,13 @@ func TestDGClient(t *testing.T) {
 	// update pod01 status to Failed
 	update := make(map[string]interface{})
 	update["status"] = "Failed"
-	client.UpdateEntity(v, update)
-	pod01, _ = client.GetEntity(v)
+	client.UpdateEntity(context.Background(), v, update)
+	pod01, _ = client.GetEntity(context.Background(), v)
 	o4 := pod01["objects"].([]interface{})[0].(map[string]interface{})
 	assert.Equal(t, o4["status"], "Failed", "pod01 status not update to Failed")
 	// remove edges from pod01 to node01
-	client.CreateOrDeleteEdge("K8sPod", v, "K8sNode", nid, "runsOn", delete)
-	pod01, _ = client.GetEntity(v)
+	client.CreateOrDeleteEdge(context.Background(), "K8sPod", v, "K8sNode", nid, "runsOn", delete)
+	pod01, _ = client.GetEntity(context.Background(), v)
 	o5 := pod01["objects"].([]interface{})[0].(map[string]interface{})
 	val := o5["runsOn"]
 	if val != nil {
@@ -78,15 +79,15 @@ func TestCreateIndex(t *testing.T) {
 	s := Schema{Predicate: "testindex", Type: "string", Count: true, List: true, Index: true,
 		Upsert: true, Tokenizer: []string{"hash", "fulltext"},
 	}
-	err := client.CreateSchema(s)
+	err := client.CreateSchema(context.Background(), s)
 	assert.Nil(t, err)
-	client.DropSchema("testindex")
+	client.DropSchema(context.Background(), "testindex")
 }
 
 func TestGetSchemaFromDB(t *testing.T) {
 	client := NewDGClient("127.0.0.1:9080")
 	defer client.Close()
-	smds, err := client.GetSchemaFromDB()
+	smds, err := client.GetSchemaFromDB(context.Background())
 	if err != nil {
 		log.Fatalf("failed to get schema db %v", err)
 	}
@@ -107,7 +108,7 @@ func TestGetSchemaFromCache(t *testing.T) {
 	log.Infoln("LRU cache created with given size")
 	InitLruCacheDBSchema = false
 	//Get schema with fetching db
-	smds, err := client.GetSchemaFromCache(LruCache)
+	smds, err := client.GetSchemaFromCache(context.Background(), LruCache)
 	if err != nil {
 		log.Fatalf("failed to get schema from LruCache %v", err)
 	}
@@ -118,7 +119,7 @@ func TestGetSchemaFromCache(t *testing.T) {
 	assert.Nil(t, err)
 
 	//Get schema without fetching db
-	smds, err = client.GetSchemaFromCache(LruCache)
+	smds, err = client.GetSchemaFromCache(context.Background(), LruCache)
 	if err != nil {
 		log.Fatalf("failed to get schema from LruCache %v", err)
 	}
@@ -129,7 +130,7 @@ func TestGetSchemaFromCache(t *testing.T) {
 	client.RemoveDBSchemaFromCache(LruCache)
 
 	//Get schema again should fetch DB again
-	smds, err = client.GetSchemaFromCache(LruCache)
+	smds, err = client.GetSchemaFromCache(context.Background(), LruCache)
 	if err != nil {
 		log.Fatalf("failed to get schema from LruCache %v", err)
 	}
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/intuit/katlas/service/metrics"
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// EntityType is the dgraph type of all the nodes written by the service. Since dgraph 1.1 expand(_all_) and the
+// deletion of all the predicates of a node only cover the predicates of the type of the node, so the type lists
+// every predicate of the schema and is updated when a write adds predicates
+const EntityType = "Entity"
+
+// typeBatchSize is the number of nodes typed per transaction by TypeEntities
+const typeBatchSize = 1000
+
+// entityType keeps the predicates of EntityType as last written by this client
+type entityType struct {
+	mutex  sync.Mutex
+	fields map[string]bool
+}
+
+// covers return whether all the predicates of data and of the nodes nested in data are in the type
+func (t *entityType) covers(data map[string]interface{}) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.coversLocked(data)
+}
+
+func (t *entityType) coversLocked(data map[string]interface{}) bool {
+	for k, v := range data {
+		if k == util.UID || k == util.DgraphType || empty(v) {
+			continue
+		}
+		if !t.fields[k] {
+			return false
+		}
+		for _, node := range nestedNodes(v) {
+			if !t.coversLocked(node) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// empty return whether v is a value dgraph does not store
+func empty(v interface{}) bool {
+	switch e := v.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(e) == 0
+	case map[string]interface{}:
+		return len(e) == 0
+	}
+	return false
+}
+
+// nestedNodes return the nodes at the edge v, nil if v is not an edge
+func nestedNodes(v interface{}) []map[string]interface{} {
+	switch e := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{e}
+	case []interface{}:
+		nodes := []map[string]interface{}{}
+		for _, item := range e {
+			if node, ok := item.(map[string]interface{}); ok {
+				nodes = append(nodes, node)
+			}
+		}
+		return nodes
+	case []map[string]interface{}:
+		return e
+	}
+	return nil
+}
+
+// withEntityType return a copy of data with EntityType set on the node and on the nodes nested in data
+func withEntityType(data map[string]interface{}) map[string]interface{} {
+	typed := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		switch e := v.(type) {
+		case map[string]interface{}:
+			typed[k] = withEntityType(e)
+		case []interface{}:
+			items := make([]interface{}, len(e))
+			for i, item := range e {
+				if node, ok := item.(map[string]interface{}); ok {
+					item = withEntityType(node)
+				}
+				items[i] = item
+			}
+			typed[k] = items
+		case []map[string]interface{}:
+			items := make([]map[string]interface{}, len(e))
+			for i, node := range e {
+				items[i] = withEntityType(node)
+			}
+			typed[k] = items
+		default:
+			typed[k] = v
+		}
+	}
+	typed[util.DgraphType] = EntityType
+	return typed
+}
+
+// SyncEntityType define EntityType with all the predicates of the schema. The definition is read back until it
+// covers the schema so a replica writing an older definition concurrently does not drop the predicates of another
+func (s DGClient) SyncEntityType(ctx context.Context) error {
+	return s.syncEntityType(ctx, "")
+}
+
+// syncEntityType define EntityType with all the predicates of the schema but without
+func (s DGClient) syncEntityType(ctx context.Context, without string) error {
+	s.entityType.mutex.Lock()
+	defer s.entityType.mutex.Unlock()
+	for {
+		schema, err := s.GetSchemaFromDB(ctx)
+		if err != nil {
+			return err
+		}
+		fields := make(map[string]bool, len(schema))
+		var buffer bytes.Buffer
+		for _, sm := range schema {
+			if strings.HasPrefix(sm.Predicate, "dgraph.") || sm.Predicate == without {
+				continue
+			}
+			fields[sm.Predicate] = true
+			typ := sm.Type
+			if sm.List {
+				typ = "[" + typ + "]"
+			}
+			buffer.WriteString("\t" + sm.Predicate + ": " + typ + "\n")
+		}
+		if sameFields(fields, s.entityType.fields) {
+			return nil
+		}
+		err = s.dc.Alter(ctx, &api.Operation{Schema: "type " + EntityType + " {\n" + buffer.String() + "}"})
+		if err != nil {
+			log.Debug(err)
+			return err
+		}
+		s.entityType.fields = fields
+	}
+}
+
+func sameFields(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// syncEntityTypeFor update EntityType after data was written if data added predicates to the schema
+func (s DGClient) syncEntityTypeFor(ctx context.Context, data map[string]interface{}) {
+	if s.entityType.covers(data) {
+		return
+	}
+	if err := s.SyncEntityType(ctx); err != nil {
+		log.Warnf("failed to add the new predicates to the %s type: %v", EntityType, err)
+	}
+}
+
+// TypeEntities set EntityType on the nodes written before the service set it, i.e. by a dgraph 1.0 deployment,
+// and return the number of nodes typed. Entities have an objtype and the fields of metadata a fieldname
+func (s DGClient) TypeEntities(ctx context.Context) (int, error) {
+	q := fmt.Sprintf(`
+		{
+			entities as var(func: has(%[1]s), first: %[3]d) @filter(NOT has(%[2]s))
+			fields as var(func: has(%[4]s), first: %[3]d) @filter(NOT has(%[2]s))
+			objects(func: uid(entities, fields)) {
+				uid
+			}
+		}
+	`, util.ObjType, util.DgraphType, typeBatchSize, util.FieldName)
+	typed := 0
+	for {
+		resp, err := s.dc.NewTxn().Do(ctx, &api.Request{
+			Query: q,
+			Mutations: []*api.Mutation{
+				{Cond: "@if(gt(len(entities), 0))", SetNquads: []byte(`uid(entities) <` + util.DgraphType + `> "` + EntityType + `" .`)},
+				{Cond: "@if(gt(len(fields), 0))", SetNquads: []byte(`uid(fields) <` + util.DgraphType + `> "` + EntityType + `" .`)},
+			},
+			CommitNow: true,
+		})
+		if err != nil {
+			metrics.DgraphNumMutationsErr.Inc()
+			return typed, err
+		}
+		var result struct {
+			Objects []struct {
+				UID string `json:"uid"`
+			} `json:"objects"`
+		}
+		if err = json.Unmarshal(resp.GetJson(), &result); err != nil {
+			return typed, err
+		}
+		if len(result.Objects) == 0 {
+			return typed, nil
+		}
+		metrics.DgraphNumMutations.Inc()
+		typed += len(result.Objects)
+	}
+}
+
+// NumberVersions set the resource version as an int in resourceversionnum on the nodes written before the
+// service stored it, and return the number of nodes updated. Upserts compare resourceversionnum, a resource
+// version which is not a number is stored as 0 like they do
+func (s DGClient) NumberVersions(ctx context.Context) (int, error) {
+	q := fmt.Sprintf(`
+		{
+			objects(func: has(%[1]s), first: %[3]d) @filter(NOT has(%[2]s)) {
+				uid
+				%[1]s
+			}
+		}
+	`, util.ResourceVersion, util.VersionNumber, typeBatchSize)
+	numbered := 0
+	for {
+		txn := s.dc.NewTxn()
+		resp, err := txn.Query(ctx, q)
+		if err != nil {
+			txn.Discard(ctx)
+			return numbered, err
+		}
+		var result struct {
+			Objects []struct {
+				UID             string `json:"uid"`
+				ResourceVersion string `json:"resourceversion"`
+			} `json:"objects"`
+		}
+		if err = json.Unmarshal(resp.GetJson(), &result); err != nil {
+			txn.Discard(ctx)
+			return numbered, err
+		}
+		if len(result.Objects) == 0 {
+			txn.Discard(ctx)
+			return numbered, nil
+		}
+		var nquads bytes.Buffer
+		for _, o := range result.Objects {
+			version, _ := strconv.ParseInt(o.ResourceVersion, 10, 64)
+			fmt.Fprintf(&nquads, "<%s> <%s> \"%d\"^^<xs:int> .\n", o.UID, util.VersionNumber, version)
+		}
+		// a concurrent write of one of the nodes sets resourceversionnum too, one of the transactions is aborted
+		_, err = txn.Mutate(ctx, &api.Mutation{SetNquads: nquads.Bytes(), CommitNow: true})
+		if err != nil {
+			metrics.DgraphNumMutationsErr.Inc()
+			return numbered, err
+		}
+		metrics.DgraphNumMutations.Inc()
+		numbered += len(result.Objects)
+	}
+}
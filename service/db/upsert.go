@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/intuit/katlas/service/util"
+)
+
+// upsertQuery look up the node written by an upsert with the function %s of $key and older is the node if its
+// version is lower than $version. The second %s is for tombQuery. The objects block returns the node found and
+// the updated block the node written by the conditional mutations
+const upsertQuery = `
+	query upsert($key: string, $version: int) {
+		node as var(func: %s)
+		older as var(func: uid(node)) @filter(NOT has(` + util.VersionNumber + `) OR lt(` + util.VersionNumber + `, $version))
+		%s
+		objects(func: uid(node)) {
+			uid
+			resourceversion
+		}
+		updated(func: uid(older)) {
+			uid
+		}
+	}
+`
+
+// tombQuery look up tomb, the node if older is a tombstone. Dgraph rejects a query defining a variable which is
+// not used, so it is only part of the query when a mutation uses tomb
+const tombQuery = `tomb as var(func: uid(older)) @filter(eq(objtype, "` + util.Tombstone + `"))`
+
+// upsert of a node in a single request, the lookup, the comparison of the resource versions and the write are atomic
+type upsert struct {
+	// fn looking up the node by $key in the query
+	fn  string
+	key string
+	// create the node if not found
+	create bool
+	// replace the lists and edges of the node instead of adding to them
+	replaceListOrEdge bool
+	// the node becomes an object again if it is a tombstone
+	cleanTombstone bool
+}
+
+// upsertResult of the query blocks of the upsert
+type upsertResult struct {
+	Objects []struct {
+		UID             string `json:"uid"`
+		ResourceVersion string `json:"resourceversion"`
+	} `json:"objects"`
+	Updated []struct {
+		UID string `json:"uid"`
+	} `json:"updated"`
+}
+
+// upsert write data to the node looked up by u if the resource version of data is higher than the stored one,
+// or create it. It returns the uid of the node, empty if not found and not created, and whether data was written.
+// Without resource version in data the stored one is increased, which takes a query in the same transaction first
+func (s DGClient) upsert(ctx context.Context, u upsert, data map[string]interface{}) (string, bool, error) {
+	txn := s.dc.NewTxn()
+	defer txn.Discard(ctx)
+	q := fmt.Sprintf(upsertQuery, u.fn, "")
+	set := withEntityType(data)
+	if _, ok := set[util.ResourceVersion]; !ok {
+		resp, err := txn.QueryWithVars(ctx, q, map[string]string{"$key": u.key, "$version": "0"})
+		if err != nil {
+			return "", false, err
+		}
+		var current upsertResult
+		if err = json.Unmarshal(resp.GetJson(), &current); err != nil {
+			return "", false, err
+		}
+		set[util.ResourceVersion] = "0"
+		if len(current.Objects) > 0 && current.Objects[0].ResourceVersion != "" {
+			cv, _ := strconv.ParseInt(current.Objects[0].ResourceVersion, 10, 64)
+			set[util.ResourceVersion] = strconv.FormatInt(cv+1, 10)
+		}
+	}
+	version, _ := strconv.ParseInt(fmt.Sprintf("%v", set[util.ResourceVersion]), 10, 64)
+	set[util.VersionNumber] = version
+
+	var mutations []*api.Mutation
+	created := ""
+	if u.create {
+		if _, ok := set[util.UID]; !ok {
+			set[util.UID] = "_:A"
+		}
+		created = set[util.UID].(string)
+		createJSON, _ := json.Marshal(set)
+		mutations = append(mutations, &api.Mutation{Cond: "@if(eq(len(node), 0))", SetJson: createJSON})
+	}
+	// array and edges not able to replace, have to set them to nil and create it again
+	if u.replaceListOrEdge {
+		delMap := make(map[string]interface{})
+		for k, v := range data {
+			if reflect.TypeOf(v).Kind() == reflect.Map || reflect.TypeOf(v).Kind() == reflect.Slice {
+				delMap[k] = nil
+			}
+		}
+		if len(delMap) > 0 {
+			delMap[util.UID] = "uid(older)"
+			delJSON, _ := json.Marshal(delMap)
+			mutations = append(mutations, &api.Mutation{Cond: "@if(gt(len(older), 0))", DeleteJson: delJSON})
+		}
+	}
+	// object created again after it was deleted, the tombstone becomes the object
+	if u.cleanTombstone {
+		delJSON, _ := json.Marshal(map[string]interface{}{
+			util.UID:            "uid(tomb)",
+			util.DeletedObjType: nil,
+			util.DeletedAt:      nil,
+			util.K8sUID:         nil,
+			util.LastState:      nil,
+		})
+		mutations = append(mutations, &api.Mutation{Cond: "@if(gt(len(tomb), 0))", DeleteJson: delJSON})
+	}
+	set[util.UID] = "uid(older)"
+	updateJSON, _ := json.Marshal(set)
+	mutations = append(mutations, &api.Mutation{Cond: "@if(gt(len(older), 0))", SetJson: updateJSON})
+
+	if u.cleanTombstone {
+		q = fmt.Sprintf(upsertQuery, u.fn, tombQuery)
+	}
+	resp, err := txn.Do(ctx, &api.Request{
+		Query:     q,
+		Vars:      map[string]string{"$key": u.key, "$version": strconv.FormatInt(version, 10)},
+		Mutations: mutations,
+		CommitNow: true,
+	})
+	if err != nil {
+		return "", false, err
+	}
+	var result upsertResult
+	if err = json.Unmarshal(resp.GetJson(), &result); err != nil {
+		return "", false, err
+	}
+	s.syncEntityTypeFor(ctx, set)
+	if len(result.Objects) > 0 {
+		return result.Objects[0].UID, len(result.Updated) > 0, nil
+	}
+	if !u.create {
+		return "", false, nil
+	}
+	// return created blank node uid
+	if uid, ok := resp.Uids[strings.TrimPrefix(created, "_:")]; ok {
+		return uid, true, nil
+	}
+	return created, true, nil
+}
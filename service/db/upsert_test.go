@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func upsertSchema(client *DGClient) {
+	client.CreateSchema(context.Background(), Schema{Predicate: "resourceid", Type: "string", Index: true, Upsert: true, Tokenizer: []string{"term"}})
+	client.CreateSchema(context.Background(), Schema{Predicate: "objtype", Type: "string", Index: true, Tokenizer: []string{"term"}})
+	client.CreateSchema(context.Background(), Schema{Predicate: util.VersionNumber, Type: "int", Index: true, Tokenizer: []string{"int"}})
+	client.CreateSchema(context.Background(), Schema{Predicate: "conditions", Type: "string", List: true})
+}
+
+func TestUpsertResourceVersion(t *testing.T) {
+	client := NewDGClient("127.0.0.1:9080")
+	defer client.Close()
+	upsertSchema(client)
+	ctx := context.Background()
+
+	pod := func(version, status string) map[string]interface{} {
+		return map[string]interface{}{
+			"objtype":         "pod",
+			"resourceid":      "pod:upsert:ns1:pod01",
+			"name":            "pod01",
+			"resourceversion": version,
+			"status":          status,
+			"conditions":      []string{status},
+		}
+	}
+	uid, err := client.CreateEntity(ctx, "pod", pod("10", "Pending"))
+	assert.Nil(t, err)
+	defer client.DeleteEntity(ctx, uid)
+
+	// older version is ignored
+	same, err := client.CreateEntity(ctx, "pod", pod("9", "Failed"))
+	assert.Nil(t, err)
+	assert.Equal(t, uid, same)
+	obj, _ := client.GetEntity(ctx, uid)
+	o := obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Pending", o["status"])
+
+	// newer version replaces the fields and the lists
+	same, err = client.CreateEntity(ctx, "pod", pod("11", "Running"))
+	assert.Nil(t, err)
+	assert.Equal(t, uid, same)
+	obj, _ = client.GetEntity(ctx, uid)
+	o = obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Running", o["status"])
+	// dgraph 1.1 leaves the lists of values out of expand(_all_), fixed in 1.2
+	obj, _ = client.ExecuteDgraphQuery(ctx, `{ objects(func: uid(`+uid+`)) { conditions } }`)
+	o = obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{"Running"}, o["conditions"])
+
+	// without version the stored one is increased
+	assert.Nil(t, client.UpdateEntity(ctx, uid, map[string]interface{}{"status": "Succeeded"}))
+	obj, _ = client.GetEntity(ctx, uid)
+	o = obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "12", o["resourceversion"])
+	assert.NotNil(t, client.UpdateEntity(ctx, uid, map[string]interface{}{"resourceversion": "12", "status": "Failed"}))
+}
+
+func TestNumberVersions(t *testing.T) {
+	client := NewDGClient("127.0.0.1:9080")
+	defer client.Close()
+	upsertSchema(client)
+	ctx := context.Background()
+
+	// written by a release which did not store resourceversionnum
+	legacy, _ := json.Marshal(map[string]interface{}{
+		"uid":             "_:legacy",
+		"objtype":         "pod",
+		"resourceid":      "pod:upsert:ns1:pod04",
+		"name":            "pod04",
+		"resourceversion": "10",
+		"status":          "Pending",
+		util.DgraphType:   EntityType,
+	})
+	resp, err := client.dc.NewTxn().Mutate(ctx, &api.Mutation{SetJson: legacy, CommitNow: true})
+	assert.Nil(t, err)
+	uid := resp.GetUids()["legacy"]
+	defer client.DeleteEntity(ctx, uid)
+
+	n, err := client.NumberVersions(ctx)
+	assert.Nil(t, err)
+	assert.True(t, n > 0, "no version numbered")
+	obj, _ := client.GetEntity(ctx, uid)
+	o := obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, float64(10), o[util.VersionNumber])
+
+	// older version is ignored
+	same, err := client.CreateEntity(ctx, "pod", map[string]interface{}{
+		"objtype":         "pod",
+		"resourceid":      "pod:upsert:ns1:pod04",
+		"name":            "pod04",
+		"resourceversion": "9",
+		"status":          "Failed",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uid, same)
+	obj, _ = client.GetEntity(ctx, uid)
+	o = obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Pending", o["status"])
+
+	n, err = client.NumberVersions(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestUpsertConcurrentCreate(t *testing.T) {
+	client := NewDGClient("127.0.0.1:9080")
+	defer client.Close()
+	upsertSchema(client)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	uids := make([]string, 10)
+	for i := range uids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// concurrent creations conflict on the upsert resourceid, only one commits
+			uids[i], _ = client.CreateEntity(ctx, "pod", map[string]interface{}{
+				"objtype":         "pod",
+				"resourceid":      "pod:upsert:ns1:pod02",
+				"name":            "pod02",
+				"resourceversion": strconv.Itoa(i + 1),
+			})
+		}(i)
+	}
+	wg.Wait()
+	obj, err := client.ExecuteDgraphQuery(ctx, `{ objects(func: eq(resourceid, "pod:upsert:ns1:pod02")) { uid } }`)
+	assert.Nil(t, err)
+	objects := obj[util.Objects].([]interface{})
+	assert.Equal(t, 1, len(objects))
+	for _, o := range objects {
+		client.DeleteEntity(ctx, o.(map[string]interface{})[util.UID].(string))
+	}
+}
+
+func TestCreateTombstoneVersion(t *testing.T) {
+	client := NewDGClient("127.0.0.1:9080")
+	defer client.Close()
+	upsertSchema(client)
+	ctx := context.Background()
+
+	uid, err := client.CreateEntity(ctx, "pod", map[string]interface{}{
+		"objtype":         "pod",
+		"resourceid":      "pod:upsert:ns1:pod03",
+		"name":            "pod03",
+		"resourceversion": "10",
+		"status":          "Running",
+	})
+	assert.Nil(t, err)
+	defer client.DeleteEntity(ctx, uid)
+	tombstone := func(version string) map[string]interface{} {
+		return map[string]interface{}{
+			"objtype":         util.Tombstone,
+			"resourceid":      "pod:upsert:ns1:pod03",
+			"name":            "pod03",
+			"resourceversion": version,
+		}
+	}
+
+	// the stored object is newer, e.g. written by another replica since it was read
+	assert.Nil(t, client.CreateTombstone(ctx, uid, tombstone("9")))
+	obj, _ := client.GetEntity(ctx, uid)
+	o := obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "pod", o["objtype"])
+	assert.Equal(t, "Running", o["status"])
+
+	assert.Nil(t, client.CreateTombstone(ctx, uid, tombstone("10")))
+	obj, _ = client.GetEntity(ctx, uid)
+	o = obj[util.Objects].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, util.Tombstone, o["objtype"])
+	assert.Nil(t, o["status"], "predicates of the object left on the tombstone")
+}
+
+// BenchmarkCreateEntity measures the throughput of the write path, half of the writes update an existing object
+func BenchmarkCreateEntity(b *testing.B) {
+	client := NewDGClient("127.0.0.1:9080")
+	defer client.Close()
+	upsertSchema(client)
+	ctx := context.Background()
+
+	uids := map[string]bool{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		uid, err := client.CreateEntity(ctx, "pod", map[string]interface{}{
+			"objtype":         "pod",
+			"resourceid":      fmt.Sprintf("pod:benchmark:ns1:pod%d", i/2),
+			"name":            fmt.Sprintf("pod%d", i/2),
+			"resourceversion": strconv.Itoa(i),
+			"status":          "Running",
+			"conditions":      []string{"benchmark"},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		uids[uid] = true
+	}
+	b.StopTimer()
+	for uid := range uids {
+		client.DeleteEntity(ctx, uid)
+	}
+}
@@ -0,0 +1,32 @@
+module github.com/intuit/katlas/service
+
+go 1.12
+
+require (
+	github.com/cenkalti/backoff v2.1.1+incompatible
+	github.com/dgraph-io/dgo/v2 v2.1.0
+	github.com/gogo/protobuf v1.2.1 // indirect
+	github.com/google/gofuzz v1.0.0 // indirect
+	github.com/gorilla/context v1.1.2 // indirect
+	github.com/gorilla/mux v1.6.2
+	github.com/hashicorp/golang-lru v0.5.0
+	github.com/intuit/katlas/client v0.0.0
+	github.com/json-iterator/go v1.1.6 // indirect
+	github.com/mitchellh/mapstructure v1.1.2
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/prometheus/client_golang v0.9.2
+	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910
+	github.com/sirupsen/logrus v1.2.0
+	github.com/spf13/pflag v1.0.3 // indirect
+	github.com/stretchr/testify v1.4.0
+	google.golang.org/grpc v1.23.0
+	gopkg.in/inf.v0 v0.9.1 // indirect
+	gopkg.in/yaml.v2 v2.2.2
+	k8s.io/api v0.0.0-20190313235455-40a48860b5ab
+	k8s.io/apimachinery v0.0.0-20190313205120-d7deff9243b1 // indirect
+	k8s.io/klog v0.2.0 // indirect
+	sigs.k8s.io/yaml v1.1.0 // indirect
+)
+
+replace github.com/intuit/katlas/client => ../client
@@ -38,6 +38,12 @@ var (
 		Help: "The total number of requests processed by Katlas Service",
 	})
 
+	//KatlasStaleClusters ...The number of clusters without heartbeat from their collector for longer than the stale period
+	KatlasStaleClusters = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "katlas_stale_clusters",
+		Help: "The number of clusters without heartbeat from their collector for longer than the stale period",
+	})
+
 	//KatlasQueryLatencyHistogram ...latency metric for external Query Requests(keyword, QSL queries)
 	KatlasQueryLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "http_server_requests_seconds",
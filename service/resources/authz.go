@@ -0,0 +1,62 @@
+package resources
+
+import (
+	"net/http"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/auth"
+	"github.com/intuit/katlas/service/util"
+)
+
+// scopeOption pass the scopes of the caller to the query services
+func scopeOption(r *http.Request) util.OptionContext {
+	return util.OptionContext{Scopes: auth.ScopesFromContext(r.Context())}
+}
+
+// writeForbidden reject the access to an entity outside the scopes of the caller
+func writeForbidden(w http.ResponseWriter, r *http.Request, what string) {
+	writeError(w, r, apis.Forbidden("%v: %s", auth.ErrOutOfScope, what))
+}
+
+// allowsEntity check if the caller may access an entity, stored or built from a request payload,
+// by its resourceid or else its cluster and namespace
+func allowsEntity(r *http.Request, obj map[string]interface{}) bool {
+	if rid, ok := obj[util.ResourceID].(string); ok && rid != "" {
+		return auth.AllowsResourceID(r.Context(), rid)
+	}
+	switch obj[util.ObjType] {
+	case util.Cluster:
+		return auth.AllowsCluster(r.Context(), edgeName(obj[util.Name]))
+	case util.Namespace:
+		return auth.Allows(r.Context(), edgeName(obj[util.Cluster]), edgeName(obj[util.Name]))
+	}
+	return auth.Allows(r.Context(), edgeName(obj[util.Cluster]), edgeName(obj[util.Namespace]))
+}
+
+// allowsUID check if the caller may access the stored entity uid, entities not found are
+// left to the handler
+func (s ServerResource) allowsUID(r *http.Request, uid string) (bool, error) {
+	if auth.ScopesFromContext(r.Context()) == nil {
+		return true, nil
+	}
+	obj, err := s.EntitySvc.GetEntity(r.Context(), uid)
+	if err != nil {
+		return false, err
+	}
+	return len(obj) == 0 || allowsEntity(r, obj), nil
+}
+
+// edgeName return the name of a field holding a name or an edge to a named entity
+func edgeName(v interface{}) string {
+	switch e := v.(type) {
+	case string:
+		return e
+	case map[string]interface{}:
+		return edgeName(e[util.Name])
+	case []interface{}:
+		if len(e) == 1 {
+			return edgeName(e[0])
+		}
+	}
+	return ""
+}
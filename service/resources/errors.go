@@ -0,0 +1,127 @@
+package resources
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/intuit/katlas/service/apis"
+	metrics "github.com/intuit/katlas/service/metrics"
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// codes of the errors raised by the REST APIs rather than the services
+const (
+	codeTimeout  apis.Code = "Timeout"
+	codeInternal apis.Code = "Internal"
+)
+
+// maxRequestIDLength bounds the request ids given by callers, longer ones are replaced
+const maxRequestIDLength = 128
+
+// errorBody is the JSON body of the errors of the REST APIs
+type errorBody struct {
+	Status    int                    `json:"status"`
+	Code      apis.Code              `json:"code"`
+	Message   string                 `json:"message"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	RequestID string                 `json:"requestid,omitempty"`
+	// Error repeats Message for the clients of the former body
+	Error string `json:"error"`
+}
+
+// errorStatus map an error to the http status of its response and its code, 504 for the errors of a request past its
+// deadline and 500 for the errors without code
+func errorStatus(r *http.Request, err error) (int, apis.Code) {
+	switch apis.CodeOf(err) {
+	case apis.CodeNotFound:
+		return http.StatusNotFound, apis.CodeNotFound
+	case apis.CodeInvalid:
+		return http.StatusBadRequest, apis.CodeInvalid
+	case apis.CodeConflict:
+		return http.StatusConflict, apis.CodeConflict
+	case apis.CodeUnauthorized:
+		return http.StatusUnauthorized, apis.CodeUnauthorized
+	case apis.CodeForbidden:
+		return http.StatusForbidden, apis.CodeForbidden
+	}
+	if code := serverError(r); code == http.StatusGatewayTimeout {
+		return code, codeTimeout
+	}
+	if apis.CodeOf(err) == apis.CodeUnavailable {
+		return http.StatusServiceUnavailable, apis.CodeUnavailable
+	}
+	return http.StatusInternalServerError, codeInternal
+}
+
+// setError set the status, code and message of err in the result of a batch item or an imported line
+func setError(r *http.Request, result map[string]interface{}, err error) {
+	status, code := errorStatus(r, err)
+	result["status"] = status
+	result["code"] = code
+	result["error"] = err.Error()
+}
+
+// writeError write err with the status of its code and count it, errors on the server side are logged with the
+// request id. Return the status
+func writeError(w http.ResponseWriter, r *http.Request, err error) int {
+	code := writeErrorBody(w, r, err)
+	metrics.KatlasNumReqErr.Inc()
+	if code >= http.StatusInternalServerError {
+		metrics.KatlasNumReqErr5xx.Inc()
+		log.Errorf("%s %s failed [%s]: %v", r.Method, r.URL.Path, util.RequestIDFromContext(r.Context()), err)
+	} else {
+		metrics.KatlasNumReqErr4xx.Inc()
+	}
+	return code
+}
+
+// WriteError write the error of a request rejected by a middleware before its handler, e.g. by authentication,
+// the request is counted like the ones reaching their handler
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	metrics.KatlasNumReqCount.Inc()
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	writeError(w, r, err)
+}
+
+// writeErrorBody write err with the status of its code, return the status
+func writeErrorBody(w http.ResponseWriter, r *http.Request, err error) int {
+	code, c := errorStatus(r, err)
+	body := errorBody{
+		Status:    code,
+		Code:      c,
+		Message:   err.Error(),
+		RequestID: util.RequestIDFromContext(r.Context()),
+		Error:     err.Error(),
+	}
+	if e, ok := err.(*apis.Error); ok {
+		body.Details = e.Details
+	}
+	ret, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(ret)
+	return code
+}
+
+// RequestID give each request an id, the one in the X-Request-Id header of the caller if any, stored in the
+// request context and sent back in the response header and errors
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(util.RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		w.Header().Set(util.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(util.WithRequestID(r.Context(), id)))
+	})
+}
+
+// newRequestID return a random id of 16 hex digits
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/auth"
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   apis.Code
+	}{
+		{apis.NotFound("entity with id %s not found", "0x9"), http.StatusNotFound, apis.CodeNotFound},
+		{apis.Invalid("Malformed Query: %s", "pod["), http.StatusBadRequest, apis.CodeInvalid},
+		{apis.ErrClusterActive, http.StatusConflict, apis.CodeConflict},
+		{apis.Unavailable(errors.New("connection refused"), "Failed to connect to dgraph to get metadata"), http.StatusServiceUnavailable, apis.CodeUnavailable},
+		{apis.Unauthorized("authentication required: %v", auth.ErrNoCredentials), http.StatusUnauthorized, apis.CodeUnauthorized},
+		{auth.ErrOutOfScope, http.StatusForbidden, apis.CodeForbidden},
+		{apis.Forbidden("%s scope required", auth.ScopeWrite), http.StatusForbidden, apis.CodeForbidden},
+		{errors.New("mutation failed"), http.StatusInternalServerError, codeInternal},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/v1.1/entity/0x9", nil)
+		assert.Equal(t, test.status, writeError(w, r, test.err))
+		assert.Equal(t, test.status, w.Code)
+		body := errorBody{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, errorBody{Status: test.status, Code: test.code, Message: test.err.Error(), Error: test.err.Error()}, body)
+	}
+
+	// the message is sent as is, with its details and the request id
+	err := apis.Invalid(`invalid value "a\b" of field %s`, "name").WithDetails("field", "name")
+	r := httptest.NewRequest("GET", "/v1.1/query", nil)
+	r = r.WithContext(util.WithRequestID(r.Context(), "7f3a"))
+	w := httptest.NewRecorder()
+	writeError(w, r, err)
+	body := errorBody{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, `invalid value "a\b" of field name`, body.Message)
+	assert.Equal(t, map[string]interface{}{"field": "name"}, body.Details)
+	assert.Equal(t, "7f3a", body.RequestID)
+
+	// unavailable past the deadline of the request
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	w = httptest.NewRecorder()
+	writeError(w, httptest.NewRequest("GET", "/v1.1/qsl/pod", nil).WithContext(ctx), apis.Unavailable(ctx.Err(), "Failed to connect to dgraph to get metadata"))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"Timeout"`)
+}
+
+func TestRequestID(t *testing.T) {
+	var id string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = util.RequestIDFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v1.1/qsl/pod", nil))
+	assert.Len(t, id, 16)
+	assert.Equal(t, id, w.Header().Get(util.RequestIDHeader))
+
+	// the id of the caller is kept
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1.1/qsl/pod", nil)
+	r.Header.Set(util.RequestIDHeader, "7f3a")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "7f3a", id)
+	assert.Equal(t, "7f3a", w.Header().Get(util.RequestIDHeader))
+}
@@ -0,0 +1,18 @@
+package resources
+
+import (
+	"net/http"
+)
+
+// OpenAPI is the OpenAPI 3 document of the v1 and v1.1 APIs, loaded from the bootstrap files at startup and
+// kept in sync with the routes by the tests of the service
+type OpenAPI struct {
+	Doc []byte
+}
+
+// Handler REST API for the OpenAPI document
+func (o OpenAPI) Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(o.Doc)
+}
@@ -0,0 +1,70 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/intuit/katlas/service/apis"
+	log "github.com/sirupsen/logrus"
+)
+
+// PingTimeout is the maximum wait for dgraph to answer the readiness probe
+var PingTimeout = 2 * time.Second
+
+// Pinger checks the connectivity to the storage
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Probes answer the liveness and readiness probes of kubernetes, the service is ready once bootstrapped
+// while dgraph is reachable, until it stops
+type Probes struct {
+	DB           Pinger
+	bootstrapped int32
+	stopping     int32
+}
+
+// SetBootstrapped report the schema and metadata are loaded
+func (p *Probes) SetBootstrapped() {
+	atomic.StoreInt32(&p.bootstrapped, 1)
+}
+
+// SetStopping report the service is shutting down, it is not ready anymore so no new request is routed to it
+func (p *Probes) SetStopping() {
+	atomic.StoreInt32(&p.stopping, 1)
+}
+
+// LivezHandler REST API for the liveness probe, the service answers as long as it runs
+func (p *Probes) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf("{\"status\": %v}", http.StatusOK)))
+}
+
+// ReadyzHandler REST API for the readiness probe, 503 with the failed check if the service can't serve requests
+func (p *Probes) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := p.check(r.Context()); err != nil {
+		log.Warnf("not ready: %v", err)
+		writeErrorBody(w, r, apis.Unavailable(nil, "%v", err))
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("{\"status\": %v}", http.StatusOK)))
+}
+
+func (p *Probes) check(ctx context.Context) error {
+	if atomic.LoadInt32(&p.stopping) == 1 {
+		return fmt.Errorf("shutting down")
+	}
+	if atomic.LoadInt32(&p.bootstrapped) == 0 {
+		return fmt.Errorf("bootstrap of schema and metadata not completed")
+	}
+	ctx, cancel := context.WithTimeout(ctx, PingTimeout)
+	defer cancel()
+	if err := p.DB.Ping(ctx); err != nil {
+		return fmt.Errorf("dgraph unreachable: %v", err)
+	}
+	return nil
+}
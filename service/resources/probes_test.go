@@ -0,0 +1,51 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (f *fakePinger) Ping(ctx context.Context) error {
+	return f.err
+}
+
+func TestProbes(t *testing.T) {
+	db := &fakePinger{}
+	p := &Probes{DB: db}
+	ready := func() (int, string) {
+		w := httptest.NewRecorder()
+		p.ReadyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+	w := httptest.NewRecorder()
+	p.LivezHandler(w, httptest.NewRequest("GET", "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	code, body := ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "bootstrap")
+
+	p.SetBootstrapped()
+	code, _ = ready()
+	assert.Equal(t, http.StatusOK, code)
+
+	db.err = errors.New("connection refused")
+	code, body = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "dgraph unreachable: connection refused")
+
+	db.err = nil
+	p.SetStopping()
+	code, body = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "shutting down")
+}
@@ -1,19 +1,21 @@
 package resources
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/auth"
 	"github.com/intuit/katlas/service/db"
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
 	"github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/api/apps/v1beta2"
 	core_v1 "k8s.io/api/core/v1"
@@ -28,6 +30,8 @@ type ServerResource struct {
 	QuerySvc  *apis.QueryService
 	MetaSvc   *apis.MetaService
 	QSLSvc    *apis.QSLService
+	// ClusterSvc register, decommission and purge clusters
+	ClusterSvc *apis.ClusterService
 	// TODO:
 	// add metadata service, audit service and spec service after API ready
 }
@@ -47,22 +51,19 @@ func (s ServerResource) EntityGetHandler(w http.ResponseWriter, r *http.Request)
 	defer func() {
 		metrics.DgraphGetEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
-	obj, err := s.EntitySvc.GetEntity(uid)
+	obj, err := s.EntitySvc.GetEntity(r.Context(), uid)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	// object not found
 	if len(obj) == 0 {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
-		code = http.StatusNotFound
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"entity with id %s not found\"}", code, uid)))
+		code = writeError(w, r, apis.NotFound("entity with id %s not found", uid))
+		return
+	}
+	if !allowsEntity(r, obj) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, "entity with id "+uid)
 		return
 	}
 	obj["status"] = code
@@ -81,12 +82,9 @@ func (s ServerResource) MetaGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	vars := mux.Vars(r)
 	name := strings.ToLower(vars[util.Name])
-	obj, err := s.MetaSvc.GetMetadata(name)
+	obj, err := s.MetaSvc.GetMetadata(r.Context(), name)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 	if obj != nil {
@@ -98,10 +96,7 @@ func (s ServerResource) MetaGetHandler(w http.ResponseWriter, r *http.Request) {
 		w.Write(ret)
 		return
 	}
-	metrics.KatlasNumReqErr.Inc()
-	metrics.KatlasNumReqErr4xx.Inc()
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"metadata %s not found\"}", http.StatusNotFound, name)))
+	writeError(w, r, apis.NotFound("metadata %s not found", name))
 }
 
 // MetaDeleteHandler REST API for delete metadata
@@ -109,14 +104,16 @@ func (s ServerResource) MetaDeleteHandler(w http.ResponseWriter, r *http.Request
 	metrics.KatlasNumReqCount.Inc()
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+	// metadata and schema are shared by all clusters
+	if auth.ScopesFromContext(r.Context()) != nil {
+		writeForbidden(w, r, "metadata of all clusters")
+		return
+	}
 	vars := mux.Vars(r)
 	name := vars[util.Name]
-	err := s.MetaSvc.DeleteMetadata(name)
+	err := s.MetaSvc.DeleteMetadata(r.Context(), name)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
-		w.WriteHeader(http.StatusConflict)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusConflict, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -151,13 +148,14 @@ func (s ServerResource) EntityDeleteHandler(w http.ResponseWriter, r *http.Reque
 		metrics.DgraphDeleteEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	err := s.EntitySvc.DeleteEntityByResourceID(meta, rid)
+	if !auth.AllowsResourceID(r.Context(), rid) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, rid)
+		return
+	}
+	err := s.EntitySvc.DeleteEntityByResourceID(r.Context(), meta, rid)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -189,19 +187,13 @@ func (s ServerResource) EntityCreateHandler(w http.ResponseWriter, r *http.Reque
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	payload, err := buildEntityData(clusterName, meta, body, false)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	start := time.Now()
@@ -209,14 +201,14 @@ func (s ServerResource) EntityCreateHandler(w http.ResponseWriter, r *http.Reque
 		metrics.DgraphCreateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	uid, err := s.EntitySvc.CreateEntity(meta, payload.(map[string]interface{}))
+	if !allowsEntity(r, payload.(map[string]interface{})) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, meta+" in cluster "+clusterName)
+		return
+	}
+	uid, err := s.EntitySvc.CreateEntity(r.Context(), meta, payload.(map[string]interface{}))
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		log.Error(err)
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -249,20 +241,14 @@ func (s ServerResource) EntityUpdateHandler(w http.ResponseWriter, r *http.Reque
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	payload := make(map[string]interface{}, 0)
 	err = json.Unmarshal(body, &payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	start := time.Now()
@@ -270,14 +256,23 @@ func (s ServerResource) EntityUpdateHandler(w http.ResponseWriter, r *http.Reque
 		metrics.DgraphUpdateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	err = s.EntitySvc.UpdateEntity(uuid, payload)
+	if ok, err := s.allowsUID(r, uuid); err != nil || !ok {
+		if err != nil {
+			code = writeError(w, r, err)
+			return
+		}
+		code = http.StatusForbidden
+		writeForbidden(w, r, "entity with id "+uuid)
+		return
+	}
+	if rid, ok := payload[util.ResourceID].(string); ok && !auth.AllowsResourceID(r.Context(), rid) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, rid)
+		return
+	}
+	err = s.EntitySvc.UpdateEntity(r.Context(), uuid, payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		log.Error(err)
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -308,26 +303,28 @@ func (s ServerResource) EntitySyncHandler(w http.ResponseWriter, r *http.Request
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	payload, err := buildEntityData(clusterName, meta, body, true)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+	// sync deletes any object of the cluster missing in the payload
+	if !auth.AllowsCluster(r.Context(), clusterName) {
+		metrics.KatlasNumReqCount.Inc()
+		writeForbidden(w, r, "cluster "+clusterName)
 		return
 	}
 	metrics.KatlasNumReqCount.Inc()
 	// return status code 202 directly
 	w.WriteHeader(http.StatusAccepted)
 	w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"message\": \"%s sync request accepted\"}", http.StatusAccepted, meta)))
-	// process by goroutine
-	go func() {
-		err = s.EntitySvc.SyncEntities(meta, payload.([]map[string]interface{}))
+	// process in background, the request is done
+	apis.Background.Go(func(ctx context.Context) {
+		err := s.EntitySvc.SyncEntities(ctx, meta, payload.([]map[string]interface{}))
 		if err != nil {
 			metrics.KatlasNumReqErr.Inc()
 			metrics.KatlasNumReqErr5xx.Inc()
@@ -336,7 +333,7 @@ func (s ServerResource) EntitySyncHandler(w http.ResponseWriter, r *http.Request
 		}
 		log.Debugf("%s sync completed, total %d synced", meta, len(payload.([]map[string]interface{})))
 		metrics.KatlasNumReq2xx.Inc()
-	}()
+	})
 }
 
 // QueryHandler REST API for get Query Response
@@ -355,13 +352,9 @@ func (s ServerResource) QueryHandler(w http.ResponseWriter, r *http.Request) {
 		metrics.KatlasQueryLatencyHistogram.WithLabelValues("katlas", "*", "None", "dev", "containers", "GET", fmt.Sprintf("%d", code), "/**").Observe(time.Since(start).Seconds())
 	}()
 
-	obj, err := s.QuerySvc.GetQueryResult(queryMap)
+	obj, err := s.QuerySvc.GetQueryResult(r.Context(), queryMap, scopeOption(r))
 	if err != nil {
-		metrics.KatlasNumReqErr5xx.Inc()
-		metrics.KatlasNumReqErr.Inc()
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	obj["status"] = code
@@ -376,6 +369,11 @@ func (s ServerResource) MetaCreateHandler(w http.ResponseWriter, r *http.Request
 	metrics.KatlasNumReqCount.Inc()
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+	// metadata and schema are shared by all clusters
+	if auth.ScopesFromContext(r.Context()) != nil {
+		writeForbidden(w, r, "metadata of all clusters")
+		return
+	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
@@ -383,24 +381,17 @@ func (s ServerResource) MetaCreateHandler(w http.ResponseWriter, r *http.Request
 	var payload interface{}
 	err = json.Unmarshal(body, &payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	var msg map[string]interface{}
 	if reflect.TypeOf(payload).Kind() == reflect.Slice {
 		var rets []map[string]interface{}
 		for _, p := range payload.([]interface{}) {
-			uid, err := s.MetaSvc.CreateMetadata(p.(map[string]interface{}))
+			uid, err := s.MetaSvc.CreateMetadata(r.Context(), p.(map[string]interface{}))
 			if err != nil {
-				metrics.KatlasNumReqErr.Inc()
-				metrics.KatlasNumReqErr5xx.Inc()
-				log.Error(err)
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+				writeError(w, r, err)
 				return
 			}
 
@@ -415,13 +406,9 @@ func (s ServerResource) MetaCreateHandler(w http.ResponseWriter, r *http.Request
 		}
 		metrics.KatlasNumReq2xx.Inc()
 	} else {
-		uid, err := s.MetaSvc.CreateMetadata(payload.(map[string]interface{}))
+		uid, err := s.MetaSvc.CreateMetadata(r.Context(), payload.(map[string]interface{}))
 		if err != nil {
-			metrics.KatlasNumReqErr.Inc()
-			metrics.KatlasNumReqErr5xx.Inc()
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+			writeError(w, r, err)
 			return
 		}
 		msg = map[string]interface{}{
@@ -444,32 +431,29 @@ func (s ServerResource) MetaUpdateHandler(w http.ResponseWriter, r *http.Request
 	metrics.KatlasNumReqCount.Inc()
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+	// metadata and schema are shared by all clusters
+	if auth.ScopesFromContext(r.Context()) != nil {
+		writeForbidden(w, r, "metadata of all clusters")
+		return
+	}
 	vars := mux.Vars(r)
 	name := vars[util.Name]
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	var payload interface{}
 	err = json.Unmarshal(body, &payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
-	err = s.MetaSvc.UpdateMetadata(name, payload.(map[string]interface{}))
+	err = s.MetaSvc.UpdateMetadata(r.Context(), name, payload.(map[string]interface{}))
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		log.Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -494,21 +478,22 @@ func (s ServerResource) SchemaUpsertHandler(w http.ResponseWriter, r *http.Reque
 	defer s.MetaSvc.RemoveSchemaCache(db.LruCache)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+	// metadata and schema are shared by all clusters
+	if auth.ScopesFromContext(r.Context()) != nil {
+		writeForbidden(w, r, "schema of all clusters")
+		return
+	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	var payload interface{}
 	err = json.Unmarshal(body, &payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	var msg map[string]interface{}
@@ -516,22 +501,15 @@ func (s ServerResource) SchemaUpsertHandler(w http.ResponseWriter, r *http.Reque
 		var predicates []db.Schema
 		err := mapstructure.Decode(payload, &predicates)
 		if err != nil {
-			metrics.KatlasNumReqErr.Inc()
-			metrics.KatlasNumReqErr4xx.Inc()
 			log.Error(err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+			writeError(w, r, apis.Invalid("%v", err))
 			return
 		}
 		names := make([]string, 0)
 		for _, p := range predicates {
-			err := s.MetaSvc.CreateSchema(p)
+			err := s.MetaSvc.CreateSchema(r.Context(), p)
 			if err != nil {
-				log.Error(err)
-				metrics.KatlasNumReqErr.Inc()
-				metrics.KatlasNumReqErr5xx.Inc()
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+				writeError(w, r, err)
 				return
 			}
 			names = append(names, p.Predicate)
@@ -545,20 +523,13 @@ func (s ServerResource) SchemaUpsertHandler(w http.ResponseWriter, r *http.Reque
 		var predicate db.Schema
 		err := mapstructure.Decode(payload, &predicate)
 		if err != nil {
-			metrics.KatlasNumReqErr.Inc()
-			metrics.KatlasNumReqErr4xx.Inc()
 			log.Error(err)
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+			writeError(w, r, apis.Invalid("%v", err))
 			return
 		}
-		err = s.MetaSvc.CreateSchema(predicate)
+		err = s.MetaSvc.CreateSchema(r.Context(), predicate)
 		if err != nil {
-			metrics.KatlasNumReqErr.Inc()
-			metrics.KatlasNumReqErr5xx.Inc()
-			log.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+			writeError(w, r, err)
 			return
 		}
 		msg = map[string]interface{}{
@@ -577,15 +548,16 @@ func (s ServerResource) SchemaDropHandler(w http.ResponseWriter, r *http.Request
 	defer s.MetaSvc.RemoveSchemaCache(db.LruCache)
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
+	// metadata and schema are shared by all clusters
+	if auth.ScopesFromContext(r.Context()) != nil {
+		writeForbidden(w, r, "schema of all clusters")
+		return
+	}
 	vars := mux.Vars(r)
 	predicate := vars[util.Name]
-	err := s.MetaSvc.DropSchema(predicate)
+	err := s.MetaSvc.DropSchema(r.Context(), predicate)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		log.Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -947,13 +919,50 @@ func buildEntityData(clusterName string, meta string, body []byte, isArray bool)
 			util.Labels:          data.ObjectMeta.GetLabels(),
 			util.K8sObj:          util.K8sObj,
 		}, nil
+	case util.Node:
+		if isArray {
+			list := make([]map[string]interface{}, 0)
+			data := []core_v1.Node{}
+			err := json.Unmarshal(body, &data)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range data {
+				node := map[string]interface{}{
+					util.ObjType:         util.Node,
+					util.Name:            d.ObjectMeta.Name,
+					util.CreationTime:    d.ObjectMeta.CreationTimestamp,
+					util.Cluster:         clusterName,
+					util.ResourceVersion: d.ObjectMeta.ResourceVersion,
+					util.K8sObj:          util.K8sObj,
+				}
+				list = append(list, node)
+			}
+			return list, nil
+		}
+		data := core_v1.Node{}
+		err := json.Unmarshal(body, &data)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			util.ObjType:         util.Node,
+			util.Name:            data.ObjectMeta.Name,
+			util.CreationTime:    data.ObjectMeta.CreationTimestamp,
+			util.Cluster:         clusterName,
+			util.ResourceVersion: data.ObjectMeta.ResourceVersion,
+			util.K8sObj:          util.K8sObj,
+		}, nil
 	default:
-		var data interface{}
 		if isArray {
-			data = []map[string]interface{}{}
-		} else {
-			data = map[string]interface{}{}
+			data := []map[string]interface{}{}
+			err := json.Unmarshal(body, &data)
+			if err != nil {
+				return nil, err
+			}
+			return data, nil
 		}
+		data := map[string]interface{}{}
 		err := json.Unmarshal(body, &data)
 		if err != nil {
 			return nil, err
@@ -1009,38 +1018,24 @@ func (s *ServerResource) QSLHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	// get query for count only
-	query, err := s.QSLSvc.CreateDgraphQuery(vars[util.Query], true)
+	query, err := s.QSLSvc.CreateDgraphQuery(r.Context(), vars[util.Query], true, scopeOption(r))
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		if err.Error() == "Failed to connect to dgraph to get metadata" {
-			metrics.KatlasNumReqErr5xx.Inc()
-			w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
-			return
-		}
-		// code: 400
-		metrics.KatlasNumReqErr4xx.Inc()
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 
-	response, err := s.QSLSvc.DBclient.ExecuteDgraphQuery(query)
+	response, err := s.QSLSvc.DBclient.ExecuteDgraphQuery(r.Context(), query)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		fmt.Println(err.Error())
-		fmt.Println(trim(err.Error()))
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 	total := apis.GetTotalCnt(response)
 
 	// get query with pagination
-	query, err = s.QSLSvc.CreateDgraphQuery(vars[util.Query], false)
+	query, err = s.QSLSvc.CreateDgraphQuery(r.Context(), vars[util.Query], false, scopeOption(r))
 	log.Infof("dgraph query for %#v:\n %s", vars[util.Query], query)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusBadRequest, trim(err.Error()))))
+		writeError(w, r, err)
 		return
 	}
 	start := time.Now()
@@ -1050,40 +1045,26 @@ func (s *ServerResource) QSLHandler(w http.ResponseWriter, r *http.Request) {
 		metrics.KatlasQueryLatencyHistogram.WithLabelValues("katlas", "*", "None", "dev", "containers", "GET", fmt.Sprintf("%d", code), "/**").Observe(time.Since(start).Seconds())
 	}()
 
-	response, err = s.QSLSvc.DBclient.ExecuteDgraphQuery(query)
+	response, err = s.QSLSvc.DBclient.ExecuteDgraphQuery(r.Context(), query)
 	if err != nil {
 		metrics.DgraphNumQSLErr.Inc()
-		code = http.StatusInternalServerError
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	log.Infof("[elapsedtime: %s]response for query %#v", time.Since(start), vars[util.Query])
+	if s.ClusterSvc != nil {
+		// objects of clusters whose collector stopped reporting may be outdated
+		s.ClusterSvc.FlagStale(r.Context(), response)
+	}
 	response[util.Count] = total
 	response["status"] = http.StatusOK
 	ret, err := json.Marshal(response)
 	if err != nil {
 		metrics.DgraphNumQSLErr.Inc()
-		code = http.StatusInternalServerError
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", http.StatusInternalServerError, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	w.Write(ret)
 
 	metrics.KatlasNumReq2xx.Inc()
 }
-
-func trim(str string) string {
-	// remove newline
-	str = strings.Replace(strings.Replace(str, "\n", " ", -1), "\\n", " ", -1)
-	// remove quotation mark
-	str = strings.Replace(str, "\"", "", -1)
-	// remove slash
-	return strings.Replace(str, "\\", "", -1)
-}
-
-// TODO:
-// Add more supported rest APIs
@@ -1,12 +1,17 @@
 package resources
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
-	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/auth"
 	metrics "github.com/intuit/katlas/service/metrics"
 	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"time"
@@ -29,22 +34,19 @@ func (s ServerResource) EntityGetHandlerV1_1(w http.ResponseWriter, r *http.Requ
 		metrics.DgraphGetEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	obj, err := s.EntitySvc.GetEntity(uid)
+	obj, err := s.EntitySvc.GetEntity(r.Context(), uid)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	// object not found
 	if len(obj) == 0 {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
-		code = http.StatusNotFound
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"entity with id %s not found\"}", code, uid)))
+		code = writeError(w, r, apis.NotFound("entity with id %s not found", uid))
+		return
+	}
+	if !allowsEntity(r, obj) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, "entity with id "+uid)
 		return
 	}
 	obj["status"] = code
@@ -83,13 +85,18 @@ func (s ServerResource) EntityDeleteHandlerV1_1(w http.ResponseWriter, r *http.R
 		metrics.DgraphDeleteEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	err := s.EntitySvc.DeleteEntity(uid)
+	if ok, err := s.allowsUID(r, uid); err != nil || !ok {
+		if err != nil {
+			code = writeError(w, r, err)
+			return
+		}
+		code = http.StatusForbidden
+		writeForbidden(w, r, "entity with id "+uid)
+		return
+	}
+	err := s.EntitySvc.DeleteEntity(r.Context(), uid)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -106,6 +113,69 @@ func (s ServerResource) EntityDeleteHandlerV1_1(w http.ResponseWriter, r *http.R
 	metrics.KatlasNumReq2xx.Inc()
 }
 
+// DeleteRequest identifies a deleted object by resourceid and carries its last known state
+type DeleteRequest struct {
+	ObjType    string `json:"objtype"`
+	ResourceID string `json:"resourceid"`
+	// K8sUID and ResourceVersion of the object when it was deleted
+	K8sUID          string          `json:"k8suid,omitempty"`
+	ResourceVersion string          `json:"resourceversion,omitempty"`
+	Object          json.RawMessage `json:"object,omitempty"`
+}
+
+// EntityDeleteByResourceHandlerV1_1 REST API to delete Entity by resourceid given in the body
+// the object is replaced by a tombstone, the delete is ignored if the stored object is newer
+func (s ServerResource) EntityDeleteByResourceHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	code := http.StatusOK
+	req := DeleteRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil && (req.ObjType == "" || req.ResourceID == "") {
+		err = fmt.Errorf("objtype and resourceid are required")
+	}
+	if err != nil {
+		log.Error(err)
+		code = writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.DgraphDeleteEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
+	}()
+
+	if !auth.AllowsResourceID(r.Context(), req.ResourceID) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, req.ResourceID)
+		return
+	}
+	err = s.EntitySvc.DeleteEntityWithTombstone(r.Context(), req.ObjType, req.ResourceID, req.K8sUID, req.ResourceVersion, req.Object)
+	if err != nil {
+		code = writeError(w, r, err)
+		return
+	}
+	msg := map[string]interface{}{
+		"status": code,
+		"objects": []map[string]interface{}{
+			{
+				"resourceid": req.ResourceID,
+				"objtype":    req.ObjType,
+			},
+		},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
 // EntityCreateHandlerV1_1 REST API for create Entity
 func (s ServerResource) EntityCreateHandlerV1_1(w http.ResponseWriter, r *http.Request) {
 
@@ -120,28 +190,20 @@ func (s ServerResource) EntityCreateHandlerV1_1(w http.ResponseWriter, r *http.R
 	metas, ok := r.URL.Query()[util.ObjType]
 	code := http.StatusOK
 	if !ok || len(metas[0]) < 1 {
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"metadata not found from parameters\"}", code)))
+		code = writeError(w, r, apis.Invalid("metadata not found from parameters"))
 		return
 	}
 	meta := metas[0]
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	payload, err := buildEntityData(clusterName, meta, body, false)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 
@@ -150,14 +212,14 @@ func (s ServerResource) EntityCreateHandlerV1_1(w http.ResponseWriter, r *http.R
 		metrics.DgraphCreateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	uid, err := s.EntitySvc.CreateEntity(meta, payload.(map[string]interface{}))
+	if !allowsEntity(r, payload.(map[string]interface{})) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, meta+" in cluster "+clusterName)
+		return
+	}
+	uid, err := s.EntitySvc.CreateEntity(r.Context(), meta, payload.(map[string]interface{}))
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		log.Error(err)
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -192,20 +254,14 @@ func (s ServerResource) EntityUpdateHandlerV1_1(w http.ResponseWriter, r *http.R
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"metadata not found from parameters\"}", code)))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 	payload := make(map[string]interface{}, 0)
 	err = json.Unmarshal(body, &payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr4xx.Inc()
 		log.Error(err)
-		code = http.StatusBadRequest
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, apis.Invalid("%v", err))
 		return
 	}
 
@@ -214,14 +270,23 @@ func (s ServerResource) EntityUpdateHandlerV1_1(w http.ResponseWriter, r *http.R
 		metrics.DgraphUpdateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
 	}()
 
-	err = s.EntitySvc.UpdateEntity(uuid, payload)
+	if ok, err := s.allowsUID(r, uuid); err != nil || !ok {
+		if err != nil {
+			code = writeError(w, r, err)
+			return
+		}
+		code = http.StatusForbidden
+		writeForbidden(w, r, "entity with id "+uuid)
+		return
+	}
+	if rid, ok := payload[util.ResourceID].(string); ok && !auth.AllowsResourceID(r.Context(), rid) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, rid)
+		return
+	}
+	err = s.EntitySvc.UpdateEntity(r.Context(), uuid, payload)
 	if err != nil {
-		metrics.KatlasNumReqErr.Inc()
-		metrics.KatlasNumReqErr5xx.Inc()
-		log.Error(err)
-		code = http.StatusInternalServerError
-		w.WriteHeader(code)
-		w.Write([]byte(fmt.Sprintf("{\"status\": %v, \"error\": \"%s\"}", code, trim(err.Error()))))
+		code = writeError(w, r, err)
 		return
 	}
 	msg := map[string]interface{}{
@@ -238,11 +303,325 @@ func (s ServerResource) EntityUpdateHandlerV1_1(w http.ResponseWriter, r *http.R
 	metrics.KatlasNumReq2xx.Inc()
 }
 
+// BatchItem single operation in a batch request
+type BatchItem struct {
+	// Op is upsert or delete
+	Op         string          `json:"op"`
+	ObjType    string          `json:"objtype"`
+	ResourceID string          `json:"resourceid,omitempty"`
+	Object     json.RawMessage `json:"object,omitempty"`
+	// K8sUID and ResourceVersion of a deleted object, Object holds its last known state
+	K8sUID          string `json:"k8suid,omitempty"`
+	ResourceVersion string `json:"resourceversion,omitempty"`
+}
+
+// batch operations
+const (
+	batchUpsert = "upsert"
+	batchDelete = "delete"
+)
+
+// EntityBatchHandlerV1_1 REST API to create or delete many entities of mixed types in one request
+// items are processed in order, result is reported per item and status is 207 if any item failed
+func (s ServerResource) EntityBatchHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	clusterName := r.Header.Get(util.ClusterName)
+	code := http.StatusOK
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err)
+		code = writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+	items := make([]BatchItem, 0)
+	err = json.Unmarshal(body, &items)
+	if err != nil {
+		log.Error(err)
+		code = writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+
+	start := time.Now()
+	defer func() {
+		metrics.DgraphCreateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
+	}()
+
+	results := make([]map[string]interface{}, 0, len(items))
+	for i, item := range items {
+		result := s.processBatchItem(r, clusterName, item)
+		result["index"] = i
+		if result["status"] != http.StatusOK {
+			code = http.StatusMultiStatus
+		}
+		results = append(results, result)
+	}
+	if code != http.StatusOK {
+		metrics.KatlasNumReqErr.Inc()
+		w.WriteHeader(code)
+	} else {
+		metrics.KatlasNumReq2xx.Inc()
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": results,
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+}
+
+// processBatchItem upsert or delete single item and return its result
+func (s ServerResource) processBatchItem(r *http.Request, clusterName string, item BatchItem) map[string]interface{} {
+	result := map[string]interface{}{
+		"objtype": item.ObjType,
+	}
+	if item.ObjType == "" {
+		setError(r, result, apis.Invalid("objtype not found in batch item"))
+		return result
+	}
+	switch item.Op {
+	case batchUpsert:
+		payload, err := buildEntityData(clusterName, item.ObjType, item.Object, false)
+		if err != nil {
+			setError(r, result, apis.Invalid("%v", err))
+			return result
+		}
+		if !allowsEntity(r, payload.(map[string]interface{})) {
+			setError(r, result, auth.ErrOutOfScope)
+			return result
+		}
+		uid, err := s.EntitySvc.CreateEntity(r.Context(), item.ObjType, payload.(map[string]interface{}))
+		if err != nil {
+			log.Error(err)
+			setError(r, result, err)
+			return result
+		}
+		result["uid"] = uid
+	case batchDelete:
+		if item.ResourceID == "" {
+			setError(r, result, apis.Invalid("resourceid not found in batch item"))
+			return result
+		}
+		if !auth.AllowsResourceID(r.Context(), item.ResourceID) {
+			setError(r, result, auth.ErrOutOfScope)
+			return result
+		}
+		err := s.EntitySvc.DeleteEntityWithTombstone(r.Context(), item.ObjType, item.ResourceID, item.K8sUID, item.ResourceVersion, item.Object)
+		if err != nil {
+			log.Error(err)
+			setError(r, result, err)
+			return result
+		}
+		result["resourceid"] = item.ResourceID
+	default:
+		setError(r, result, apis.Invalid("unsupported batch operation %s", item.Op))
+		return result
+	}
+	result["status"] = http.StatusOK
+	return result
+}
+
+// MaxImportLineSize is the maximum size of an entity imported
+var MaxImportLineSize = 10 * 1024 * 1024
+
+// ExportHandlerV1_1 REST API to export the entities of the types in objtype parameters, all types if none,
+// of the cluster parameter if set, as NDJSON with one entity per line and its relationships given by resourceid
+func (s ServerResource) ExportHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	objtypes := r.URL.Query()[util.ObjType]
+	cluster := r.URL.Query().Get(util.Cluster)
+	if cluster != "" && !auth.AllowsCluster(r.Context(), cluster) {
+		w.Header().Set("Content-Type", "application/json")
+		writeForbidden(w, r, "cluster "+cluster)
+		return
+	}
+	count := 0
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	err := s.EntitySvc.ExportEntities(r.Context(), objtypes, cluster, func(entity map[string]interface{}) error {
+		// entities outside the scopes of the caller are left out
+		if !allowsEntity(r, entity) {
+			return nil
+		}
+		count++
+		if err := encoder.Encode(entity); err != nil {
+			return err
+		}
+		if flusher != nil && count%apis.ExportPageSize == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if count > 0 {
+			// the status is sent already, abort the response so the export is not taken as complete
+			metrics.KatlasNumReqErr.Inc()
+			metrics.KatlasNumReqErr5xx.Inc()
+			log.Errorf("export aborted after %d entities: %v", count, err)
+			panic(http.ErrAbortHandler)
+		}
+		writeError(w, r, err)
+		return
+	}
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// ImportHandlerV1_1 REST API to create or update the entities read as NDJSON in the format of the export, entities
+// imported again are ignored. Failed lines are reported and status is 207 if any line failed
+func (s ServerResource) ImportHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	code := http.StatusOK
+
+	start := time.Now()
+	defer func() {
+		metrics.DgraphCreateEntityLatencyHistogram.WithLabelValues(fmt.Sprintf("%d", code)).Observe(time.Since(start).Seconds())
+	}()
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), MaxImportLineSize)
+	imported := 0
+	failed := make([]map[string]interface{}, 0)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if result := s.importLine(r, text); result != nil {
+			result["line"] = line
+			failed = append(failed, result)
+			continue
+		}
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		result := map[string]interface{}{"line": line + 1}
+		setError(r, result, apis.Invalid("%v", err))
+		failed = append(failed, result)
+	}
+	if len(failed) > 0 {
+		code = http.StatusMultiStatus
+		metrics.KatlasNumReqErr.Inc()
+		w.WriteHeader(code)
+	} else {
+		metrics.KatlasNumReq2xx.Inc()
+	}
+	msg := map[string]interface{}{
+		"status":   code,
+		"imported": imported,
+		"errors":   failed,
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+}
+
+// importLine import the entity of a line, return its error or nil
+func (s ServerResource) importLine(r *http.Request, line []byte) map[string]interface{} {
+	entity := make(map[string]interface{})
+	if err := json.Unmarshal(line, &entity); err != nil {
+		result := map[string]interface{}{}
+		setError(r, result, apis.Invalid("%v", err))
+		return result
+	}
+	result := map[string]interface{}{
+		util.ObjType:    entity[util.ObjType],
+		util.ResourceID: entity[util.ResourceID],
+	}
+	objtype, _ := entity[util.ObjType].(string)
+	rid, _ := entity[util.ResourceID].(string)
+	if objtype == "" || rid == "" {
+		setError(r, result, apis.Invalid("objtype and resourceid are required"))
+		return result
+	}
+	if !allowsEntity(r, entity) {
+		setError(r, result, auth.ErrOutOfScope)
+		return result
+	}
+	if _, err := s.EntitySvc.ImportEntity(r.Context(), entity); err != nil {
+		if apis.CodeOf(err) == "" {
+			log.Error(err)
+		}
+		setError(r, result, err)
+		return result
+	}
+	return nil
+}
+
 // EntitySyncHandlerV1_1 REST API to sync entities
 func (s ServerResource) EntitySyncHandlerV1_1(w http.ResponseWriter, r *http.Request) {
 	s.EntitySyncHandler(w, r)
 }
 
+// EntitySyncDigestHandlerV1_1 REST API to compare the digest of all objects of a type in a cluster with the stored objects
+// objects not in the digest are deleted, the response lists the stale and missing objects the collector has to send
+func (s ServerResource) EntitySyncDigestHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	meta := mux.Vars(r)[util.Metadata]
+	clusterName := r.Header.Get(util.ClusterName)
+	code := http.StatusOK
+	digest := make([]apis.EntityDigest, 0)
+	err := json.NewDecoder(r.Body).Decode(&digest)
+	if err == nil && clusterName == "" {
+		err = fmt.Errorf("%s header is required", util.ClusterName)
+	}
+	if err != nil {
+		log.Error(err)
+		code = writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+
+	// the digest deletes any object of the cluster missing in it
+	if !auth.AllowsCluster(r.Context(), clusterName) {
+		code = http.StatusForbidden
+		writeForbidden(w, r, "cluster "+clusterName)
+		return
+	}
+	diff, err := s.EntitySvc.DiffEntities(r.Context(), meta, clusterName, digest)
+	if err != nil {
+		code = writeError(w, r, err)
+		return
+	}
+	log.Debugf("%s digest of %d objects compared, %d stale, %d missing, %d deleted", meta, len(digest), len(diff.Stale), len(diff.Missing), len(diff.Deleted))
+	msg := map[string]interface{}{
+		"status":  code,
+		"stale":   diff.Stale,
+		"missing": diff.Missing,
+		"deleted": diff.Deleted,
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
 // QueryHandlerV1_1 REST API for get Query Response
 func (s ServerResource) QueryHandlerV1_1(w http.ResponseWriter, r *http.Request) {
 	s.QueryHandler(w, r)
@@ -272,3 +651,250 @@ func (s ServerResource) SchemaDropHandlerV1_1(w http.ResponseWriter, r *http.Req
 func (s *ServerResource) QSLHandlerV1_1(w http.ResponseWriter, r *http.Request) {
 	s.QSLHandler(w, r)
 }
+
+// ClusterRegisterHandlerV1_1 REST API to register a cluster with its region, environment and owner
+func (s ServerResource) ClusterRegisterHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+	if !auth.AllowsCluster(r.Context(), name) {
+		writeError(w, r, auth.ErrOutOfScope)
+		return
+	}
+	code := http.StatusOK
+	meta := apis.ClusterMetadata{}
+	err := json.NewDecoder(r.Body).Decode(&meta)
+	if err != nil && err != io.EOF {
+		log.Error(err)
+		code = writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+	uid, err := s.ClusterSvc.RegisterCluster(r.Context(), name, meta)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	msg := map[string]interface{}{
+		"status": code,
+		"objects": []map[string]interface{}{
+			{
+				"uid":        uid,
+				"name":       name,
+				"resourceid": util.Cluster + ":" + name,
+			},
+		},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// ClusterGetHandlerV1_1 REST API to get a cluster with its status and purge progress
+func (s ServerResource) ClusterGetHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+	if !auth.AllowsCluster(r.Context(), name) {
+		writeError(w, r, auth.ErrOutOfScope)
+		return
+	}
+	code := http.StatusOK
+	cluster, err := s.ClusterSvc.GetCluster(r.Context(), name)
+	if err == nil && cluster == nil {
+		err = apis.ErrClusterNotFound
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": []map[string]interface{}{cluster},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// ClusterDecommissionHandlerV1_1 REST API to mark a cluster decommissioned
+func (s ServerResource) ClusterDecommissionHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+	if !auth.AllowsCluster(r.Context(), name) {
+		writeError(w, r, auth.ErrOutOfScope)
+		return
+	}
+	code := http.StatusOK
+	cluster, err := s.ClusterSvc.DecommissionCluster(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": []map[string]interface{}{cluster},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// ClusterPurgeHandlerV1_1 REST API to start or resume the purge of all entities of a decommissioned cluster
+// the purge runs in background, the response is 202 with the progress
+func (s ServerResource) ClusterPurgeHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+	if !auth.AllowsCluster(r.Context(), name) {
+		writeError(w, r, auth.ErrOutOfScope)
+		return
+	}
+	code := http.StatusAccepted
+	progress, err := s.ClusterSvc.StartPurge(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(code)
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": []*apis.PurgeProgress{progress},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// ClusterPurgeProgressHandlerV1_1 REST API to get the progress of the purge of a cluster
+func (s ServerResource) ClusterPurgeProgressHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+	if !auth.AllowsCluster(r.Context(), name) {
+		writeError(w, r, auth.ErrOutOfScope)
+		return
+	}
+	code := http.StatusOK
+	progress, err := s.ClusterSvc.GetPurgeProgress(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": []*apis.PurgeProgress{progress},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// ClusterHeartbeatHandlerV1_1 REST API for collectors to report they are alive with their version and informers status
+func (s ServerResource) ClusterHeartbeatHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)[util.Name]
+	if !auth.AllowsCluster(r.Context(), name) {
+		writeError(w, r, auth.ErrOutOfScope)
+		return
+	}
+	code := http.StatusOK
+	hb := apis.Heartbeat{}
+	err := json.NewDecoder(r.Body).Decode(&hb)
+	if err != nil && err != io.EOF {
+		log.Error(err)
+		code = writeError(w, r, apis.Invalid("%v", err))
+		return
+	}
+	cluster, err := s.ClusterSvc.RecordHeartbeat(r.Context(), name, hb)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"objects": []map[string]interface{}{cluster},
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
+
+// StaleClustersHandlerV1_1 REST API to list the clusters without heartbeat from their collector for longer than the stale period
+func (s ServerResource) StaleClustersHandlerV1_1(w http.ResponseWriter, r *http.Request) {
+
+	metrics.KatlasNumReqCount.Inc()
+
+	//Set Access-Control-Allow-Origin header now so that it will be present
+	//even if an error is returned (otherwise the error also causes a CORS
+	//exception in the browser/client)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	code := http.StatusOK
+	clusters, err := s.ClusterSvc.StaleClusters(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if auth.ScopesFromContext(r.Context()) != nil {
+		allowed := make([]map[string]interface{}, 0, len(clusters))
+		for _, c := range clusters {
+			if name, _ := c[util.Name].(string); auth.AllowsCluster(r.Context(), name) {
+				allowed = append(allowed, c)
+			}
+		}
+		clusters = allowed
+	}
+	msg := map[string]interface{}{
+		"status":  code,
+		"count":   len(clusters),
+		"objects": clusters,
+	}
+	ret, _ := json.Marshal(msg)
+	w.Write(ret)
+
+	metrics.KatlasNumReq2xx.Inc()
+}
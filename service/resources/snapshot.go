@@ -0,0 +1,113 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/intuit/katlas/service/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// SnapshotTypes are the object types ingested from a snapshot by kind, in the order they are synced so owners come
+// before the objects they own. Namespaces are synced only if the snapshot has some as `kubectl get all` leaves them
+// out, the other types are synced even if the snapshot has none so their deletions are reconciled
+var SnapshotTypes = []struct {
+	Kind    string
+	ObjType string
+}{
+	{"Namespace", util.Namespace},
+	{"Node", util.Node},
+	{"Deployment", util.Deployment},
+	{"ReplicaSet", util.ReplicaSet},
+	{"StatefulSet", util.StatefulSet},
+	{"Service", util.Service},
+	{"Pod", util.Pod},
+	{"Ingress", util.Ingress},
+}
+
+// SnapshotResult reports the objects ingested from a snapshot
+type SnapshotResult struct {
+	Cluster string `json:"cluster"`
+	Taken   string `json:"taken"`
+	// Objects synced by object type
+	Objects map[string]int `json:"objects"`
+	// Skipped objects of the kinds without object type by kind
+	Skipped map[string]int `json:"skipped"`
+}
+
+// kubectlList is the output of kubectl get -o json, a List of objects or a single object
+type kubectlList struct {
+	Kind  string            `json:"kind"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// IngestSnapshot sync the objects of the kubectl get -o json lists, e.g. of `kubectl get all,nodes,ingress -A -o json`,
+// taken from cluster at taken. The objects are transformed like the objects sent by the collector and tagged with
+// the snapshot time, the objects of the snapshot types stored for the cluster but not in the snapshot are deleted.
+// A snapshot older than the last one ingested for the cluster is refused, the time of the snapshot is recorded on
+// the cluster once all its objects are synced
+func (s ServerResource) IngestSnapshot(ctx context.Context, cluster string, taken time.Time, lists ...[]byte) (*SnapshotResult, error) {
+	items := make(map[string][]json.RawMessage)
+	result := &SnapshotResult{
+		Cluster: cluster,
+		Taken:   taken.UTC().Format(time.RFC3339),
+		Objects: make(map[string]int),
+		Skipped: make(map[string]int),
+	}
+	for _, data := range lists {
+		var list kubectlList
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("snapshot is not kubectl output: %v", err)
+		}
+		if list.Kind != "List" {
+			// single object of kubectl get <kind> <name>
+			list.Items = []json.RawMessage{data}
+		}
+		for _, item := range list.Items {
+			var obj struct {
+				Kind string `json:"kind"`
+			}
+			if err := json.Unmarshal(item, &obj); err != nil {
+				return nil, err
+			}
+			items[obj.Kind] = append(items[obj.Kind], item)
+		}
+	}
+	if err := s.ClusterSvc.CheckSnapshot(ctx, cluster, taken); err != nil {
+		return nil, err
+	}
+	for _, t := range SnapshotTypes {
+		objs, ok := items[t.Kind]
+		delete(items, t.Kind)
+		if !ok && t.ObjType == util.Namespace {
+			continue
+		}
+		if objs == nil {
+			objs = []json.RawMessage{}
+		}
+		body, _ := json.Marshal(objs)
+		payload, err := buildEntityData(cluster, t.ObjType, body, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s of snapshot: %v", t.Kind, err)
+		}
+		data := payload.([]map[string]interface{})
+		for _, d := range data {
+			d[util.SnapshotTime] = result.Taken
+		}
+		if err = s.EntitySvc.SyncClusterEntities(ctx, t.ObjType, cluster, data); err != nil {
+			return nil, err
+		}
+		result.Objects[t.ObjType] = len(data)
+		log.Infof("%d %s of snapshot of cluster %s synced", len(data), t.ObjType, cluster)
+	}
+	// recorded once all the types are synced, a snapshot failing midway is ingested again
+	if err := s.ClusterSvc.RecordSnapshot(ctx, cluster, taken); err != nil {
+		return nil, err
+	}
+	for kind, objs := range items {
+		result.Skipped[kind] = len(objs)
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestSnapshotInvalid(t *testing.T) {
+	s := ServerResource{}
+	_, err := s.IngestSnapshot(context.Background(), "c1", time.Now(), []byte("NAME READY STATUS"))
+	assert.NotNil(t, err)
+	_, err = s.IngestSnapshot(context.Background(), "c1", time.Now(), []byte(`{"kind": "List", "items": [1]}`))
+	assert.NotNil(t, err)
+}
+
+// snapshotPods is the kubectl get -o json output of a namespace and its pods of the given versions by name
+func snapshotPods(pods map[string]string) []byte {
+	items := []string{`{"kind": "Namespace", "metadata": {"name": "snapns", "resourceVersion": "1"}}`}
+	for name, version := range pods {
+		items = append(items, fmt.Sprintf(`{"kind": "Pod", "metadata": {"name": "%s", "namespace": "snapns", "resourceVersion": "%s"},
+			"spec": {"nodeName": "snapnode"}, "status": {"phase": "Running"}}`, name, version))
+	}
+	return []byte(`{"kind": "List", "items": [` + strings.Join(items, ",") + `]}`)
+}
+
+func TestIngestSnapshot(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	ctx := context.Background()
+	// schema and metadata of the service as bootstrapped
+	var predicates []db.Schema
+	data, _ := ioutil.ReadFile("../data/dbschema.json")
+	json.Unmarshal(data, &predicates)
+	for _, p := range predicates {
+		dc.CreateSchema(ctx, p)
+	}
+	metaSvc := apis.NewMetaService(dc)
+	var metas []map[string]interface{}
+	data, _ = ioutil.ReadFile("../data/meta.json")
+	json.Unmarshal(data, &metas)
+	for _, m := range metas {
+		metaSvc.CreateMetadata(ctx, m)
+	}
+	assert.Nil(t, metaSvc.SyncEntityType(ctx))
+
+	s := ServerResource{EntitySvc: apis.NewEntityService(dc), QuerySvc: apis.NewQueryService(dc), ClusterSvc: apis.NewClusterService(dc)}
+	pods := func(name, objtype string) []interface{} {
+		ret, _ := s.QuerySvc.GetQueryResult(ctx, map[string][]string{
+			util.ResourceID: {"pod:snapcluster:snapns:" + name},
+			util.ObjType:    {objtype},
+		})
+		return ret[util.Objects].([]interface{})
+	}
+	defer func() {
+		for _, name := range []string{"snapweb", "snapdb"} {
+			for _, objtype := range []string{util.Pod, util.Tombstone} {
+				for _, obj := range pods(name, objtype) {
+					s.EntitySvc.DeleteEntity(ctx, obj.(map[string]interface{})[util.UID].(string))
+				}
+			}
+		}
+		s.EntitySvc.DeleteEntityByResourceID(ctx, util.Namespace, "namespace:snapcluster:snapns")
+		s.EntitySvc.DeleteEntityByResourceID(ctx, util.Cluster, "cluster:snapcluster")
+	}()
+
+	a := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	result, err := s.IngestSnapshot(ctx, "snapcluster", a, snapshotPods(map[string]string{"snapweb": "10", "snapdb": "11"}))
+	assert.Nil(t, err)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, 2, result.Objects[util.Pod])
+	}
+	assert.Equal(t, 1, len(pods("snapdb", util.Pod)), "pod of snapshot A not created")
+
+	// snapshot B is newer and no longer has snapdb
+	b := a.Add(time.Hour)
+	_, err = s.IngestSnapshot(ctx, "snapcluster", b, snapshotPods(map[string]string{"snapweb": "12"}))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(pods("snapdb", util.Pod)), "pod missing from snapshot B not deleted")
+	assert.Equal(t, 1, len(pods("snapdb", util.Tombstone)), "pod missing from snapshot B not tombstoned")
+	if web := pods("snapweb", util.Pod); assert.Equal(t, 1, len(web)) {
+		assert.Equal(t, "12", web[0].(map[string]interface{})[util.ResourceVersion])
+		assert.Equal(t, "2019-03-01T13:00:00Z", web[0].(map[string]interface{})[util.SnapshotTime])
+	}
+	cluster, _ := s.ClusterSvc.GetCluster(ctx, "snapcluster")
+	if assert.NotNil(t, cluster) {
+		assert.Equal(t, "2019-03-01T13:00:00Z", cluster[util.SnapshotTime])
+	}
+
+	// a snapshot older than B is refused before any of its objects is synced
+	_, err = s.IngestSnapshot(ctx, "snapcluster", a.Add(30*time.Minute), snapshotPods(map[string]string{"snapweb": "13", "snapdb": "13"}))
+	assert.Equal(t, apis.ErrSnapshotOutdated, err)
+	assert.Equal(t, 0, len(pods("snapdb", util.Pod)), "pod of the refused snapshot created")
+	if web := pods("snapweb", util.Pod); assert.Equal(t, 1, len(web)) {
+		assert.Equal(t, "12", web[0].(map[string]interface{})[util.ResourceVersion])
+	}
+	cluster, _ = s.ClusterSvc.GetCluster(ctx, "snapcluster")
+	if assert.NotNil(t, cluster) {
+		assert.Equal(t, "2019-03-01T13:00:00Z", cluster[util.SnapshotTime])
+	}
+}
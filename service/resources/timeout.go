@@ -0,0 +1,45 @@
+package resources
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Timeout set a deadline on the context of the requests, canceling the queries and mutations still running when it
+// is reached. The deadline of a request is the one of the longest path prefix in endpoints matching its path, or
+// timeout if none matches, no deadline if 0
+func Timeout(timeout time.Duration, endpoints map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := requestTimeout(r.URL.Path, timeout, endpoints)
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestTimeout return the timeout of the longest prefix of path in endpoints, timeout if none matches
+func requestTimeout(path string, timeout time.Duration, endpoints map[string]time.Duration) time.Duration {
+	matched := ""
+	for prefix, d := range endpoints {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+			matched, timeout = prefix, d
+		}
+	}
+	return timeout
+}
+
+// serverError return the status of a request failed on the server side, 504 if its deadline was exceeded
+func serverError(r *http.Request) int {
+	if r.Context().Err() == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,33 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	endpoints := map[string]time.Duration{"/v1.1/qsl": 20 * time.Millisecond, "/v1.1/qsl/cluster": 0}
+	var status int
+	var deadline bool
+	handler := Timeout(time.Minute, endpoints)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, deadline = r.Context().Deadline()
+		<-time.After(40 * time.Millisecond)
+		status = serverError(r)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1.1/qsl/pod", nil))
+	assert.True(t, deadline)
+	assert.Equal(t, http.StatusGatewayTimeout, status)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1.1/entity/0x1", nil))
+	assert.True(t, deadline, "default timeout")
+	assert.Equal(t, http.StatusInternalServerError, status)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1.1/qsl/cluster", nil))
+	assert.False(t, deadline, "longest prefix wins, 0 is no deadline")
+	assert.Equal(t, http.StatusInternalServerError, status)
+}
@@ -1,25 +1,30 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/golang-lru"
 	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/auth"
 	"github.com/intuit/katlas/service/cfg"
 	"github.com/intuit/katlas/service/db"
 	"github.com/intuit/katlas/service/resources"
 	"github.com/intuit/katlas/service/util"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 )
 
-const cacheSize = 10
-
 //Health checks service health
 func Health(w http.ResponseWriter, r *http.Request) {
 	log.Info("RestService is still running")
@@ -34,15 +39,94 @@ func Up(w http.ResponseWriter, r *http.Request) {
 }
 
 func serve() {
-	router := mux.NewRouter()
-
-	dc := db.NewDGClient(cfg.ServerCfg.DgraphHost)
+	dc := newDGClient()
 	defer dc.Close()
 	metaSvc := apis.NewMetaService(dc)
 	entitySvc := apis.NewEntityService(dc)
 	querySvc := apis.NewQueryService(dc)
 	qslSvc := apis.NewQSLService(dc)
-	res := resources.ServerResource{EntitySvc: entitySvc, QuerySvc: querySvc, MetaSvc: metaSvc, QSLSvc: qslSvc}
+	clusterSvc := apis.NewClusterService(dc)
+	res := resources.ServerResource{EntitySvc: entitySvc, QuerySvc: querySvc, MetaSvc: metaSvc, QSLSvc: qslSvc, ClusterSvc: clusterSvc}
+	probes := &resources.Probes{DB: dc}
+	router := newRouter(res, probes, readOpenAPI())
+	util.RegisterHistogramMetrics()
+
+	// every request gets an id sent back in its response and errors
+	router.Use(resources.RequestID)
+	// queries and mutations of a request are canceled at its deadline
+	router.Use(resources.Timeout(cfg.ServerCfg.Server.RequestTimeout, cfg.ServerCfg.Server.EndpointTimeouts))
+	// Authentication, status and monitoring endpoints stay public
+	if cfg.ServerCfg.Auth.Config != "" {
+		authConfig, err := auth.LoadConfig(cfg.ServerCfg.Auth.Config)
+		if err != nil {
+			log.Fatalf("Auth config error: %v\n", err)
+		}
+		authenticators, err := authConfig.Authenticators()
+		if err != nil {
+			log.Fatalf("Auth config error: %v\n", err)
+		}
+		router.Use(auth.Middleware(authenticators, resources.WriteError, "/health", "/livez", "/readyz", "/", "/openapi.json", "/prometheus_metrics"))
+		log.Infof("Authentication enabled with %d authenticators", len(authenticators))
+		if cfg.ServerCfg.Auth.Policy != "" {
+			policy, err := auth.LoadPolicy(cfg.ServerCfg.Auth.Policy)
+			if err != nil {
+				log.Fatalf("Policy config error: %v\n", err)
+			}
+			router.Use(policy.Middleware(resources.WriteError))
+			log.Infof("Authorization enabled with policy %s", cfg.ServerCfg.Auth.Policy)
+		}
+	} else {
+		log.Warn("Authentication disabled, set -authConfig to authenticate requests")
+	}
+	// collectors authenticated by a client certificate only write to their own cluster, within their policy
+	if https() && cfg.ServerCfg.Server.ClientCA != "" && cfg.ServerCfg.Server.ClusterFromCert {
+		router.Use(auth.ClusterFromCertificate(resources.WriteError))
+	}
+
+	//Creates an LRU cache of the given size
+	var err error
+	db.LruCache, err = lru.New(cfg.ServerCfg.Cache.SchemaSize)
+	if err != nil {
+		log.Errorf("err: %v", err)
+	}
+	log.Infoln("LRU cache created with given size")
+
+	server := &http.Server{
+		Addr:         cfg.ServerCfg.Server.Address,
+		Handler:      router,
+		ReadTimeout:  cfg.ServerCfg.Server.ReadTimeout,
+		WriteTimeout: cfg.ServerCfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.ServerCfg.Server.IdleTimeout,
+	}
+	// the probes are answered during the bootstrap, requests are routed once ready
+	served := make(chan error, 1)
+	go func() {
+		served <- listen(server)
+	}()
+	log.Infof("Service started on %s, mode:%s", server.Addr, cfg.ServerCfg.Server.Type)
+	bootstrap(metaSvc, querySvc)
+	probes.SetBootstrapped()
+
+	ctx, stop := context.WithCancel(context.Background())
+	// purges interrupted by a restart continue where they stopped
+	clusterSvc.ResumePurges(ctx)
+	go clusterSvc.WatchStaleness(ctx, time.Minute)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	select {
+	case err := <-served:
+		log.Fatal(err)
+	case sig := <-signals:
+		log.Infof("%s received, shutting down", sig)
+	}
+	stop()
+	shutdown(server, probes)
+}
+
+// newRouter route the REST APIs to the handlers of res, every route is described in the OpenAPI document
+func newRouter(res resources.ServerResource, probes *resources.Probes, openAPI resources.OpenAPI) *mux.Router {
+	router := mux.NewRouter()
 	// Entity APIs v1
 
 	router.HandleFunc("/v1/entity/{metadata}/{uid}", res.EntityGetHandler).Methods("GET")
@@ -66,7 +150,20 @@ func serve() {
 	router.HandleFunc("/v1.1/entity", res.EntityCreateHandlerV1_1).Methods("POST")
 	router.HandleFunc("/v1.1/entity/{uid}", res.EntityUpdateHandlerV1_1).Methods("POST")
 	router.HandleFunc("/v1.1/entity/{uid}", res.EntityDeleteHandlerV1_1).Methods("DELETE")
+	router.HandleFunc("/v1.1/entity", res.EntityDeleteByResourceHandlerV1_1).Methods("DELETE")
+	router.HandleFunc("/v1.1/entities:batch", res.EntityBatchHandlerV1_1).Methods("POST")
 	router.HandleFunc("/v1.1/sync/{metadata}", res.EntitySyncHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/sync/{metadata}/digest", res.EntitySyncDigestHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/export", res.ExportHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/import", res.ImportHandlerV1_1).Methods("POST")
+	// Cluster APIs v1.1
+	router.HandleFunc("/v1.1/cluster/{name}", res.ClusterRegisterHandlerV1_1).Methods("PUT")
+	router.HandleFunc("/v1.1/cluster/{name}", res.ClusterGetHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/cluster/{name}/decommission", res.ClusterDecommissionHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/cluster/{name}/purge", res.ClusterPurgeHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/cluster/{name}/purge", res.ClusterPurgeProgressHandlerV1_1).Methods("GET")
+	router.HandleFunc("/v1.1/cluster/{name}/heartbeat", res.ClusterHeartbeatHandlerV1_1).Methods("POST")
+	router.HandleFunc("/v1.1/clusters/stale", res.StaleClustersHandlerV1_1).Methods("GET")
 	// Query APIs v1.1
 	router.HandleFunc("/v1.1/query", res.QueryHandlerV1_1).Methods("GET")
 	// add .* to support url that contains special characters like pod[@name="abc/bcd"]{}
@@ -81,31 +178,35 @@ func serve() {
 
 	// Status
 	router.HandleFunc("/health", Health).Methods("GET")
+	router.HandleFunc("/livez", probes.LivezHandler).Methods("GET")
+	router.HandleFunc("/readyz", probes.ReadyzHandler).Methods("GET")
 	router.HandleFunc("/", Up).Methods("GET", "POST")
+	router.HandleFunc("/openapi.json", openAPI.Handler).Methods("GET")
 	// Monitoring
 	router.Handle("/prometheus_metrics", promhttp.Handler()).Methods("GET")
-	util.RegisterHistogramMetrics()
+	return router
+}
 
-	//Creates an LRU cache of the given size
-	var err error
-	db.LruCache, err = lru.New(cacheSize)
-	if err != nil {
-		log.Errorf("err: %v", err)
-	}
-	log.Infoln("LRU cache created with given size")
+// bootstrap create the dgraph schema and the metadata from the bootstrap files
+func bootstrap(metaSvc *apis.MetaService, querySvc *apis.QueryService) {
 	log.Infoln("Starting initialize schema and metadata... ")
+	ctx := context.Background()
 	// Create dgraph schema
-	data, err := ioutil.ReadFile("data/dbschema.json")
+	data, err := ioutil.ReadFile(cfg.ServerCfg.Bootstrap.Schema)
 	if err != nil {
 		log.Fatalf("Schema file error: %v\n", err)
 	}
 	var predicates []db.Schema
 	json.Unmarshal(data, &predicates)
 	for _, p := range predicates {
-		metaSvc.CreateSchema(p)
+		metaSvc.CreateSchema(ctx, p)
+	}
+	// dgraph 1.1 only expands the predicates of the type of a node
+	if err := metaSvc.SyncEntityType(ctx); err != nil {
+		log.Errorf("failed to define the entity type, dgraph 1.1 or later is required: %v", err)
 	}
 	// Initialize metadata
-	meta, err := ioutil.ReadFile("data/meta.json")
+	meta, err := ioutil.ReadFile(cfg.ServerCfg.Bootstrap.Metadata)
 	if err != nil {
 		log.Fatalf("Metadata file error: %v\n", err)
 	}
@@ -113,32 +214,115 @@ func serve() {
 	json.Unmarshal(meta, &jsonData)
 	for _, data := range jsonData {
 		qm := map[string][]string{util.Name: {data[util.Name].(string)}, util.ObjType: {util.Metadata}}
-		metas, _ := querySvc.GetQueryResult(qm)
+		metas, _ := querySvc.GetQueryResult(ctx, qm)
 		if len(metas[util.Objects].([]interface{})) > 0 {
-			metaSvc.UpdateMetadata(data[util.Name].(string), data)
+			metaSvc.UpdateMetadata(ctx, data[util.Name].(string), data)
 		} else {
-			metaSvc.CreateMetadata(data)
+			metaSvc.CreateMetadata(ctx, data)
 		}
 	}
-	log.Infof("Service started on port:8011, mode:%s", cfg.ServerCfg.ServerType)
-	if strings.EqualFold(cfg.ServerCfg.ServerType, "https") {
-		log.Fatal(http.ListenAndServeTLS(":8011", "server.crt", "server.key", router))
-	} else {
-		log.Fatal(http.ListenAndServe(":8011", router))
+}
+
+// readOpenAPI read the OpenAPI document from the bootstrap files
+func readOpenAPI() resources.OpenAPI {
+	doc, err := ioutil.ReadFile(cfg.ServerCfg.Bootstrap.OpenAPI)
+	if err != nil {
+		log.Fatalf("OpenAPI file error: %v\n", err)
+	}
+	return resources.OpenAPI{Doc: doc}
+}
+
+// listen serve http or https requests until the server is shut down
+func listen(server *http.Server) error {
+	if https() {
+		server.TLSConfig = serverTLSConfig()
+		return server.ListenAndServeTLS(cfg.ServerCfg.Server.TLSCert, cfg.ServerCfg.Server.TLSKey)
 	}
+	return server.ListenAndServe()
+}
+
+// shutdown stop routing requests to the service, then drain the in-flight requests and the background syncs
+// and purges until the shutdown timeout, purges still running are resumed by the next start
+func shutdown(server *http.Server, probes *resources.Probes) {
+	probes.SetStopping()
+	// keep serving while kubernetes removes the pod from the endpoints after the readiness probe failed
+	time.Sleep(cfg.ServerCfg.Server.ShutdownDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ServerCfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("in-flight requests interrupted: %v", err)
+	}
+	if err := apis.Background.Shutdown(ctx); err != nil {
+		log.Errorf("background syncs and purges interrupted: %v", err)
+	}
+	log.Info("Service stopped")
+}
+
+func https() bool {
+	return strings.EqualFold(cfg.ServerCfg.Server.Type, "https")
+}
+
+// serverTLSConfig verify the client certificates with the clientCA bundle if set
+func serverTLSConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ServerCfg.Server.ClientCA == "" {
+		return config
+	}
+	pool, err := util.LoadCertPool(cfg.ServerCfg.Server.ClientCA)
+	if err != nil {
+		log.Fatalf("Client CA error: %v\n", err)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if cfg.ServerCfg.Server.ClientCertOptional {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	log.Infof("Client certificates verified with %s, optional: %v", cfg.ServerCfg.Server.ClientCA, cfg.ServerCfg.Server.ClientCertOptional)
+	return config
+}
+
+// newDGClient connect to the dgraph alphas of the config
+func newDGClient() *db.DGClient {
+	return db.NewDGClients(cfg.ServerCfg.Dgraph.Hosts, db.DGClientOptions{
+		TLS:            dgraphTLSConfig(),
+		MaxRecvMsgSize: cfg.ServerCfg.Dgraph.MaxRecvMsgSize,
+	})
+}
+
+// dgraphTLSConfig of the connection to dgraph, nil without TLS
+func dgraphTLSConfig() *tls.Config {
+	dg := cfg.ServerCfg.Dgraph
+	if dg.CA == "" && dg.Cert == "" {
+		return nil
+	}
+	config, err := util.NewClientTLSConfig(dg.CA, dg.Cert, dg.Key, dg.ServerName)
+	if err != nil {
+		log.Fatalf("Dgraph TLS error: %v\n", err)
+	}
+	return config
 }
 
 func main() {
 	log.SetLevel(log.DebugLevel)
 	// parse and print command line flags
 	flag.Parse()
-	log.Infof("EnvNamespace=%s", cfg.ServerCfg.EnvNamespace)
-	log.Infof("ServerType=%s", cfg.ServerCfg.ServerType)
-	log.Infof("DgraphHost=%s", cfg.ServerCfg.DgraphHost)
-
-	if cfg.ServerCfg.DgraphHost == "" {
+	if err := cfg.Load(); err != nil {
 		flag.PrintDefaults()
-		log.Fatal("Invalid input params")
+		log.Fatal(err)
+	}
+	log.Infof("EnvNamespace=%s", cfg.ServerCfg.EnvNamespace)
+	log.Infof("ServerType=%s", cfg.ServerCfg.Server.Type)
+	log.Infof("DgraphHosts=%s", strings.Join(cfg.ServerCfg.Dgraph.Hosts, ","))
+	// settings of the packages
+	apis.MaximumLimit = cfg.ServerCfg.Query.MaximumLimit
+	apis.DefaultLimit = cfg.ServerCfg.Query.DefaultLimit
+	apis.StaleAfter = cfg.ServerCfg.Cluster.StaleAfter
+	util.RetryCount = uint64(cfg.ServerCfg.Dgraph.RetryCount)
+	if flag.Arg(0) == "snapshot" {
+		if err := snapshot(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 	serve()
 }
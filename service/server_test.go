@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/db"
+	"github.com/intuit/katlas/service/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+var pathParam = regexp.MustCompile(`\{[^}]*\}`)
+
+// pathKey identify a path regardless of the names and patterns of its parameters, the same path for OpenAPI
+func pathKey(path string) string {
+	return pathParam.ReplaceAllString(path, "{}")
+}
+
+// openAPI is the OpenAPI document with its paths by pathKey
+type openAPI struct {
+	doc   map[string]interface{}
+	paths map[string]map[string]interface{}
+}
+
+func loadOpenAPI(t *testing.T, router *mux.Router) *openAPI {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	spec := &openAPI{paths: map[string]map[string]interface{}{}}
+	if !assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &spec.doc), "openapi.json is not valid JSON") {
+		t.FailNow()
+	}
+	for path, item := range spec.doc["paths"].(map[string]interface{}) {
+		_, dup := spec.paths[pathKey(path)]
+		assert.False(t, dup, "path %s described twice", path)
+		spec.paths[pathKey(path)] = item.(map[string]interface{})
+	}
+	return spec
+}
+
+// operation return the operation of the route of r, nil if not described
+func (s *openAPI) operation(router *mux.Router, r *http.Request) map[string]interface{} {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) {
+		return nil
+	}
+	tpl, _ := match.Route.GetPathTemplate()
+	op, _ := s.paths[pathKey(tpl)][strings.ToLower(r.Method)].(map[string]interface{})
+	return op
+}
+
+// resolve follow the $ref of a schema, response or parameter
+func (s *openAPI) resolve(v interface{}) (map[string]interface{}, error) {
+	m, _ := v.(map[string]interface{})
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m, nil
+	}
+	var node interface{} = s.doc
+	for _, name := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		obj, _ := node.(map[string]interface{})
+		if node, ok = obj[name]; !ok {
+			return nil, fmt.Errorf("%s not found", ref)
+		}
+	}
+	return s.resolve(node)
+}
+
+// validate check value against a schema, with the keywords used by the document
+func (s *openAPI) validate(schema interface{}, value interface{}, at string) error {
+	sc, err := s.resolve(schema)
+	if err != nil {
+		return err
+	}
+	if one, ok := sc["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, alt := range one {
+			if s.validate(alt, value, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s matches %d schemas of oneOf", at, matched)
+		}
+		return nil
+	}
+	if value == nil && sc["nullable"] == true {
+		return nil
+	}
+	switch sc["type"] {
+	case nil:
+		return nil
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object: %v", at, value)
+		}
+		for _, req := range toSlice(sc["required"]) {
+			if _, ok := obj[req.(string)]; !ok {
+				return fmt.Errorf("%s.%s is required", at, req)
+			}
+		}
+		props, _ := sc["properties"].(map[string]interface{})
+		for k, v := range obj {
+			prop, ok := props[k]
+			if !ok {
+				prop = sc["additionalProperties"]
+				if _, isSchema := prop.(map[string]interface{}); !isSchema {
+					continue
+				}
+			}
+			if err := s.validate(prop, v, at+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an array: %v", at, value)
+		}
+		for i, v := range arr {
+			if err := s.validate(sc["items"], v, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string: %v", at, value)
+		}
+		if enum := toSlice(sc["enum"]); len(enum) > 0 {
+			for _, e := range enum {
+				if e == str {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s %q is not in %v", at, str, enum)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s is not an integer: %v", at, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s is not a number: %v", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean: %v", at, value)
+		}
+	}
+	return nil
+}
+
+// checkResponse check the status and the body of the response to r are described by its operation
+func (s *openAPI) checkResponse(router *mux.Router, r *http.Request, w *httptest.ResponseRecorder) error {
+	op := s.operation(router, r)
+	if op == nil {
+		return fmt.Errorf("%s %s not described", r.Method, r.URL.Path)
+	}
+	responses := op["responses"].(map[string]interface{})
+	resp, ok := responses[fmt.Sprint(w.Code)]
+	if !ok {
+		resp = responses["default"]
+	}
+	res, err := s.resolve(resp)
+	if err != nil || res == nil {
+		return fmt.Errorf("%s %s: status %d not described", r.Method, r.URL.Path, w.Code)
+	}
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	content, _ := res["content"].(map[string]interface{})
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s %s: %s response of status %d not described", r.Method, r.URL.Path, mediaType, w.Code)
+	}
+	var values []interface{}
+	switch mediaType {
+	case "application/json":
+		var v interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			return fmt.Errorf("%s %s: invalid JSON %s", r.Method, r.URL.Path, w.Body.String())
+		}
+		values = append(values, v)
+	case "application/x-ndjson":
+		dec := json.NewDecoder(w.Body)
+		for {
+			var v interface{}
+			if err := dec.Decode(&v); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("%s %s: invalid NDJSON: %v", r.Method, r.URL.Path, err)
+			}
+			values = append(values, v)
+		}
+	}
+	for _, v := range values {
+		if err := s.validate(media["schema"], v, "body"); err != nil {
+			return fmt.Errorf("%s %s status %d: %v", r.Method, r.URL.Path, w.Code, err)
+		}
+	}
+	return nil
+}
+
+func toSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	router := newRouter(resources.ServerResource{}, &resources.Probes{}, readOpenAPI())
+	spec := loadOpenAPI(t, router)
+	assert.Equal(t, "3.0.3", spec.doc["openapi"])
+
+	// every route is described
+	routed := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, m := range methods {
+			method := strings.ToLower(m)
+			routed[pathKey(tpl)+" "+method] = true
+			op, ok := spec.paths[pathKey(tpl)][method].(map[string]interface{})
+			if !assert.True(t, ok, "%s %s not described", m, tpl) {
+				continue
+			}
+			responses, _ := op["responses"].(map[string]interface{})
+			assert.NotEmpty(t, responses, "%s %s has no response", m, tpl)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	// and every operation described is routed
+	for path, item := range spec.paths {
+		for method := range item {
+			if method != "parameters" {
+				assert.True(t, routed[path+" "+method], "%s %s described but not routed", method, path)
+			}
+		}
+	}
+	// parameters of the paths are declared
+	for path, item := range spec.doc["paths"].(map[string]interface{}) {
+		for method, op := range item.(map[string]interface{}) {
+			if method == "parameters" {
+				continue
+			}
+			declared := map[string]bool{}
+			params := append(toSlice(item.(map[string]interface{})["parameters"]), toSlice(op.(map[string]interface{})["parameters"])...)
+			for _, p := range params {
+				if param, err := spec.resolve(p); err == nil && param["in"] == "path" {
+					declared[param["name"].(string)] = true
+				}
+			}
+			for _, name := range pathParam.FindAllString(path, -1) {
+				assert.True(t, declared[strings.Trim(name, "{}")], "%s %s: parameter %s not declared", method, path, name)
+			}
+		}
+	}
+	// references resolve
+	var refs func(v interface{})
+	refs = func(v interface{}) {
+		switch n := v.(type) {
+		case map[string]interface{}:
+			if _, ok := n["$ref"]; ok {
+				_, err := spec.resolve(n)
+				assert.Nil(t, err)
+			}
+			for _, c := range n {
+				refs(c)
+			}
+		case []interface{}:
+			for _, c := range n {
+				refs(c)
+			}
+		}
+	}
+	refs(spec.doc)
+}
+
+func TestOpenAPIValidate(t *testing.T) {
+	spec := loadOpenAPI(t, newRouter(resources.ServerResource{}, &resources.Probes{}, readOpenAPI()))
+	objects := map[string]interface{}{"$ref": "#/components/schemas/Objects"}
+	apiError := map[string]interface{}{"$ref": "#/components/schemas/Error"}
+	either := map[string]interface{}{"oneOf": []interface{}{objects, apiError}}
+	tests := []struct {
+		schema interface{}
+		body   string
+		valid  bool
+	}{
+		{objects, `{"status": 200, "count": 1, "objects": [{"uid": "0x1", "name": "pod01"}]}`, true},
+		{objects, `{"status": 200}`, false},
+		{objects, `{"status": "200", "objects": []}`, false},
+		{objects, `{"status": 200, "count": 1.5, "objects": []}`, false},
+		{objects, `{"status": 200, "objects": [{"name": 1}]}`, false},
+		{apiError, `{"status": 400, "code": "Invalid", "message": "Malformed Query", "error": "Malformed Query", "requestid": "7f3a"}`, true},
+		{apiError, `{"status": 404, "code": "NotFound", "message": "m", "error": "m", "details": {"uid": "0x9"}}`, true},
+		{apiError, `{"status": 400, "error": "Malformed Query"}`, false},
+		{apiError, `{"status": 400, "code": "Malformed", "message": "m", "error": "m"}`, false},
+		{either, `{"status": 400, "code": "Invalid", "message": "m", "error": "m"}`, true},
+		{either, `{"status": 200, "objects": []}`, true},
+		{either, `{"status": 200}`, false},
+		{map[string]interface{}{"$ref": "#/components/schemas/Heartbeat"}, `{"informers": {"pod": "yes"}}`, false},
+		{map[string]interface{}{"$ref": "#/components/schemas/PurgeProgress"}, `{"cluster": "c1", "purged": 3, "status": "paused"}`, false},
+	}
+	for _, test := range tests {
+		var v interface{}
+		json.Unmarshal([]byte(test.body), &v)
+		err := spec.validate(test.schema, v, "body")
+		assert.Equal(t, test.valid, err == nil, "%s: %v", test.body, err)
+	}
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	dc := db.NewDGClient("127.0.0.1:9080")
+	defer dc.Close()
+	var err error
+	db.LruCache, err = lru.New(5)
+	assert.Nil(t, err)
+	res := resources.ServerResource{
+		EntitySvc:  apis.NewEntityService(dc),
+		QuerySvc:   apis.NewQueryService(dc),
+		MetaSvc:    apis.NewMetaService(dc),
+		QSLSvc:     apis.NewQSLService(dc),
+		ClusterSvc: apis.NewClusterService(dc),
+	}
+	router := newRouter(res, &resources.Probes{DB: dc}, readOpenAPI())
+	spec := loadOpenAPI(t, router)
+
+	// send the request, check its status and that the response is described
+	send := func(method, path, body string, code int) map[string]interface{} {
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		r.Header.Set("clustername", "openapicluster")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, code, w.Code, "%s %s: %s", method, path, w.Body.String())
+		assert.Nil(t, spec.checkResponse(router, r, w))
+		ret := map[string]interface{}{}
+		json.Unmarshal(w.Body.Bytes(), &ret)
+		return ret
+	}
+	uidOf := func(ret map[string]interface{}) string {
+		objs, _ := ret["objects"].([]interface{})
+		if len(objs) == 0 {
+			return ""
+		}
+		uid, _ := objs[0].(map[string]interface{})["uid"].(string)
+		return uid
+	}
+
+	send("GET", "/openapi.json", "", http.StatusOK)
+	send("GET", "/health", "", http.StatusOK)
+	send("POST", "/", "", http.StatusOK)
+	send("GET", "/livez", "", http.StatusOK)
+	send("GET", "/readyz", "", http.StatusServiceUnavailable)
+	send("GET", "/prometheus_metrics", "", http.StatusOK)
+	// metadata and schema
+	send("POST", "/v1.1/schema", `[{"predicate": "name", "type": "string", "index": true, "tokenizer": ["term"]},
+		{"predicate": "resourceid", "type": "string", "index": true, "tokenizer": ["term"]},
+		{"predicate": "objtype", "type": "string", "index": true, "tokenizer": ["term"]},
+		{"predicate": "resourceversionnum", "type": "int", "index": true, "tokenizer": ["int"]}]`, http.StatusOK)
+	send("POST", "/v1/schema", `{"predicate": "openapitestfield", "type": "string"}`, http.StatusOK)
+	send("DELETE", "/v1/schema/openapitestfield", "", http.StatusOK)
+	meta := `{"name": "openapitest", "objtype": "metadata", "fields": [
+		{"fieldname": "name", "fieldtype": "string", "mandatory": true, "cardinality": "one"},
+		{"fieldname": "resourceid", "fieldtype": "string", "mandatory": false, "cardinality": "one"}]}`
+	send("POST", "/v1.1/metadata", meta, http.StatusOK)
+	send("POST", "/v1/metadata/openapitest", meta, http.StatusOK)
+	send("GET", "/v1.1/metadata/openapitest", "", http.StatusOK)
+	send("GET", "/v1/metadata/openapimissing", "", http.StatusNotFound)
+	send("POST", "/v1.1/metadata", `{"name": `, http.StatusBadRequest)
+	// entities
+	uid := uidOf(send("POST", "/v1.1/entity?objtype=openapitest", `{"name": "oa1", "objtype": "openapitest", "resourceid": "openapitest:oa1"}`, http.StatusOK))
+	send("POST", "/v1.1/entity", `{"name": "oa1"}`, http.StatusBadRequest)
+	uidOf(send("POST", "/v1/entity/openapitest", `{"name": "oa4", "objtype": "openapitest", "resourceid": "openapitest:oa4"}`, http.StatusOK))
+	send("GET", "/v1.1/entity/"+uid, "", http.StatusOK)
+	send("GET", "/v1/entity/openapitest/"+uid, "", http.StatusOK)
+	send("GET", "/v1.1/entity/0xfffffff0", "", http.StatusNotFound)
+	send("POST", "/v1.1/entity/"+uid, `{"name": "oa1"}`, http.StatusOK)
+	send("POST", "/v1/entity/openapitest/"+uid, `{"name": "oa1"}`, http.StatusOK)
+	send("POST", "/v1.1/entities:batch", `[{"op": "upsert", "objtype": "openapitest", "object": {"name": "oa2", "objtype": "openapitest", "resourceid": "openapitest:oa2"}},
+		{"op": "move", "objtype": "openapitest"}]`, http.StatusMultiStatus)
+	send("POST", "/v1.1/sync/openapitest/digest", `[{"resourceid": "openapitest:oa1", "resourceversion": "1"}]`, http.StatusOK)
+	send("POST", "/v1.1/sync/openapitest/digest", `{}`, http.StatusBadRequest)
+	send("POST", "/v1/sync/openapitest", `[]`, http.StatusAccepted)
+	send("POST", "/v1.1/sync/openapitest", `[]`, http.StatusAccepted)
+	// queries
+	send("GET", "/v1.1/query?objtype=openapitest", "", http.StatusOK)
+	send("GET", "/v1/query?keyword=oa1", "", http.StatusOK)
+	send("GET", "/v1.1/qsl/openapitest[]{*}", "", http.StatusOK)
+	send("GET", `/v1/qsl/openapitest[@name=`, "", http.StatusBadRequest)
+	// export and import
+	send("GET", "/v1.1/export?objtype=openapitest", "", http.StatusOK)
+	send("GET", "/v1.1/export?objtype=openapimissing", "", http.StatusBadRequest)
+	send("POST", "/v1.1/import", "{\"objtype\": \"openapitest\", \"resourceid\": \"openapitest:oa3\", \"name\": \"oa3\"}\nnot json\n", http.StatusMultiStatus)
+	// deletes
+	send("DELETE", "/v1.1/entity", `{"objtype": "openapitest", "resourceid": "openapitest:oa2"}`, http.StatusOK)
+	send("DELETE", "/v1.1/entity", `{"objtype": "openapitest"}`, http.StatusBadRequest)
+	send("DELETE", "/v1/entity/openapitest/openapitest:oa3", "", http.StatusOK)
+	send("DELETE", "/v1/entity/openapitest/openapitest:oa4", "", http.StatusOK)
+	send("DELETE", "/v1.1/entity/"+uid, "", http.StatusOK)
+	send("DELETE", "/v1.1/metadata/openapitest", "", http.StatusOK)
+	// clusters
+	send("PUT", "/v1.1/cluster/openapicluster", `{"region": "us-west-2", "owner": "sre"}`, http.StatusOK)
+	send("PUT", "/v1.1/cluster/openapicluster", `{"region": `, http.StatusBadRequest)
+	send("GET", "/v1.1/cluster/openapicluster", "", http.StatusOK)
+	send("GET", "/v1.1/cluster/openapimissing", "", http.StatusNotFound)
+	send("POST", "/v1.1/cluster/openapicluster/heartbeat", `{"version": "1.0", "informers": {"pod": true}}`, http.StatusOK)
+	send("GET", "/v1.1/clusters/stale", "", http.StatusOK)
+	send("POST", "/v1.1/cluster/openapicluster/purge", "", http.StatusConflict)
+	send("POST", "/v1.1/cluster/openapicluster/decommission", "", http.StatusOK)
+	send("POST", "/v1.1/cluster/openapicluster/purge", "", http.StatusAccepted)
+	send("GET", "/v1.1/cluster/openapicluster/purge", "", http.StatusOK)
+	// wait for the syncs and the purge before closing the client
+	apis.Background.Shutdown(context.Background())
+}
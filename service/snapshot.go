@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/intuit/katlas/service/apis"
+	"github.com/intuit/katlas/service/resources"
+)
+
+// snapshot ingest the kubectl get -o json dumps of an air-gapped cluster given as args, - reads the standard input
+func snapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	cluster := fs.String("cluster", "", "name of the cluster the snapshot was taken from")
+	taken := fs.String("time", "", "time the snapshot was taken in RFC3339, the modification time of the first file by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: katlas snapshot -cluster <name> [-time <RFC3339>] <file|-> ...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *cluster == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("snapshot requires -cluster and at least one file")
+	}
+	var t time.Time
+	if *taken != "" {
+		var err error
+		if t, err = time.Parse(time.RFC3339, *taken); err != nil {
+			return fmt.Errorf("invalid -time: %v", err)
+		}
+	}
+	var lists [][]byte
+	for _, name := range fs.Args() {
+		var data []byte
+		var err error
+		if name == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(name)
+			if fi, serr := os.Stat(name); serr == nil && t.IsZero() {
+				t = fi.ModTime()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		lists = append(lists, data)
+	}
+	if t.IsZero() {
+		return errors.New("snapshot read from the standard input requires -time")
+	}
+
+	dc := newDGClient()
+	defer dc.Close()
+	s := resources.ServerResource{EntitySvc: apis.NewEntityService(dc), ClusterSvc: apis.NewClusterService(dc)}
+	result, err := s.IngestSnapshot(context.Background(), *cluster, t, lists...)
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	return nil
+}
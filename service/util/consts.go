@@ -4,6 +4,7 @@ package util
 const (
 	Metadata          = "metadata"
 	UID               = "uid"
+	DgraphType        = "dgraph.type"
 	Name              = "name"
 	ResourceID        = "resourceid"
 	ObjType           = "objtype"
@@ -23,6 +24,7 @@ const (
 	Owner             = "owner"
 	OwnerType         = "ownertype"
 	ResourceVersion   = "resourceversion"
+	VersionNumber     = "resourceversionnum"
 	Node              = "node"
 	Application       = "application"
 	ClusterName       = "clustername"
@@ -61,5 +63,27 @@ const (
 	Print             = "print"
 	Asset             = "asset"
 	AssetID           = "iks.intuit.com/service-asset-id"
-	RetryCount        = 20
+	Tombstone         = "tombstone"
+	DeletedObjType    = "deletedobjtype"
+	DeletedAt         = "deletedat"
+	K8sUID            = "k8suid"
+	LastState         = "laststate"
+	Region            = "region"
+	Environment       = "environment"
+	ClusterOwner      = "clusterowner"
+	ClusterStatus     = "clusterstatus"
+	DecommissionedAt  = "decommissionedat"
+	PurgeStatus       = "purgestatus"
+	PurgedCount       = "purgedcount"
+	PurgeStarted      = "purgestarted"
+	PurgeUpdated      = "purgeupdated"
+	PurgeError        = "purgeerror"
+	LastSeen          = "lastseen"
+	CollectorVersion  = "collectorversion"
+	InformersSynced   = "informerssynced"
+	SnapshotTime      = "snapshottime"
+	Stale             = "stale"
 )
+
+// RetryCount of the mutations aborted by a conflict
+var RetryCount uint64 = 20
@@ -1,7 +1,8 @@
 package util
 
 import (
-	log "github.com/Sirupsen/logrus"
+	"context"
+	log "github.com/sirupsen/logrus"
 	"sync"
 	"time"
 )
@@ -25,27 +26,31 @@ func NewKeyMutex(maxDuration time.Duration, delayFactor int) *KeyMutex {
 	}
 }
 
-// TryLock try lock by key
-func (k KeyMutex) TryLock(key interface{}) bool {
+// TryLock try lock by key, gives up after maxDuration or when ctx is done
+func (k KeyMutex) TryLock(ctx context.Context, key interface{}) bool {
 	timeout := time.NewTimer(k.maxDuration)
+	defer timeout.Stop()
 	bf := NewBackOff()
 	for {
+		k.mutex.Lock()
+		if _, ok := k.keys[key]; !ok {
+			k.keys[key] = struct{}{}
+			k.mutex.Unlock()
+			return true
+		}
+		k.mutex.Unlock()
+		// key already locked by others, wait then retry
+		wait := time.NewTimer(bf.NextBackOff())
 		select {
 		case <-timeout.C:
+			wait.Stop()
 			log.Infof("timeout when try acquire lock for %s ", key)
 			return false
-		default:
-			k.mutex.Lock()
-			// if key already locked by others, sleep random time then retry
-			if _, ok := k.keys[key]; ok {
-				k.mutex.Unlock()
-				//time.Sleep(time.Duration(rand.Intn(k.delayFactor)) * time.Microsecond)
-				time.Sleep(bf.NextBackOff())
-			} else {
-				k.keys[key] = struct{}{}
-				k.mutex.Unlock()
-				return true
-			}
+		case <-ctx.Done():
+			wait.Stop()
+			log.Infof("%v when try acquire lock for %s ", ctx.Err(), key)
+			return false
+		case <-wait.C:
 		}
 	}
 }
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyMutexTryLock(t *testing.T) {
+	k := NewKeyMutex(time.Second, 1000)
+	assert.True(t, k.TryLock(context.Background(), "pod:c1:ns1:p1"))
+	assert.True(t, k.TryLock(context.Background(), "pod:c1:ns1:p2"), "other keys are not locked")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.False(t, k.TryLock(ctx, "pod:c1:ns1:p1"))
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "gave up when the context was done")
+
+	start = time.Now()
+	assert.False(t, k.TryLock(context.Background(), "pod:c1:ns1:p1"))
+	assert.True(t, time.Since(start) >= time.Second, "gave up after the maximum duration")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		k.Unlock("pod:c1:ns1:p1")
+	}()
+	assert.True(t, k.TryLock(context.Background(), "pod:c1:ns1:p1"), "locked once released")
+}
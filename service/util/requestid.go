@@ -0,0 +1,22 @@
+package util
+
+import (
+	"context"
+)
+
+// RequestIDHeader is the header of the id of a request, given by the caller or generated, sent back in the
+// response and its errors to correlate them with the logs
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID return a copy of ctx holding the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext return the request id stored in ctx, empty if none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
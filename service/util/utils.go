@@ -12,6 +12,15 @@ import (
 type OptionContext struct {
 	// is replace field when update
 	ReplaceListOrEdge bool
+	// restrict queries to entities in these scopes, unrestricted if nil
+	Scopes []Scope
+}
+
+// Scope of entities a caller may access, a cluster ("*" for any cluster)
+// and its namespaces, all the cluster if Namespaces is empty
+type Scope struct {
+	Cluster    string   `json:"cluster"`
+	Namespaces []string `json:"namespaces,omitempty"`
 }
 
 // NewBackOff creates an instance of ExponentialBackOff using default values.
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"context"
+	"sync"
+)
+
+// WorkGroup runs the background work outliving the requests which started it, so the shutdown of the server
+// can wait for it
+type WorkGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkGroup returns WorkGroup instance
+func NewWorkGroup() *WorkGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WorkGroup{ctx: ctx, cancel: cancel}
+}
+
+// Go run f in a goroutine, its context is canceled when the shutdown gives up waiting
+func (g *WorkGroup) Go(f func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f(g.ctx)
+	}()
+}
+
+// Shutdown wait for the running work until ctx is done, then cancel it and wait for it to return,
+// the error of ctx is returned if the work was canceled
+func (g *WorkGroup) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,31 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkGroupShutdown(t *testing.T) {
+	g := NewWorkGroup()
+	done := false
+	g.Go(func(ctx context.Context) {
+		time.Sleep(20 * time.Millisecond)
+		done = true
+	})
+	assert.Nil(t, g.Shutdown(context.Background()))
+	assert.True(t, done, "running work drained")
+
+	g = NewWorkGroup()
+	canceled := false
+	g.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		canceled = true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, g.Shutdown(ctx))
+	assert.True(t, canceled, "work canceled after the timeout")
+}